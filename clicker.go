@@ -0,0 +1,67 @@
+package main
+
+import (
+	"io"
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// clicker sounds the terminal bell at a rate that increases with signal
+// level, like a Geiger counter, so that signal strength can be judged by
+// ear.
+type clicker struct {
+	frac    uint64 // math.Float64bits of the level scaled to [0,1]
+	enabled uint32
+}
+
+const (
+	minClickInterval = 50 * time.Millisecond
+	maxClickInterval = 2 * time.Second
+)
+
+// SetLevel sets the current signal level. bottomDBM and topDBM are the
+// levels mapped to the slowest and fastest click rate.
+func (c *clicker) SetLevel(levelDBM, bottomDBM, topDBM float64) {
+	frac := (levelDBM - bottomDBM) / (topDBM - bottomDBM)
+	frac = math.Max(0, math.Min(1, frac))
+	atomic.StoreUint64(&c.frac, math.Float64bits(frac))
+}
+
+// Toggle turns the clicks on or off and returns the new state.
+func (c *clicker) Toggle() bool {
+	for {
+		old := atomic.LoadUint32(&c.enabled)
+		if atomic.CompareAndSwapUint32(&c.enabled, old, old^1) {
+			return old == 0
+		}
+	}
+}
+
+// Enabled returns true if the clicks are on.
+func (c *clicker) Enabled() bool {
+	return atomic.LoadUint32(&c.enabled) != 0
+}
+
+// interval returns the time between clicks for the current level. The rate
+// is exponential in dB so that equal level changes sound like equal
+// changes in rate.
+func (c *clicker) interval() time.Duration {
+	frac := math.Float64frombits(atomic.LoadUint64(&c.frac))
+	ratio := float64(minClickInterval) / float64(maxClickInterval)
+	return time.Duration(float64(maxClickInterval) * math.Pow(ratio, frac))
+}
+
+// run writes a bell character to w for every click until stop is closed.
+func (c *clicker) run(w io.Writer, stop <-chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case <-time.After(c.interval()):
+		}
+		if c.Enabled() {
+			w.Write([]byte{'\a'})
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/samuel/rfexplorer/rfx/bands"
+)
+
+// config is the user configuration read from the config file. The file
+// contains "name = value" lines. Blank lines and lines starting with '#' are
+// ignored.
+//
+// Key bindings are set with "key.<action> = <key>", for example:
+//
+//	key.hold = H
+//	key.quit = q
+//
+// Broadcast station labels are loaded with "stations = <path>" and shown
+// next to the peak and the peaks of -peaks. See bands.ReadStations for the
+// file format.
+//
+// The location used to select band plans and mark channels that aren't
+// allowed is set with "region = <1|2|3>" (ITU region) and/or
+// "country = <ISO 3166 code>".
+type config struct {
+	keyMap   map[key]action
+	stations *bands.Band
+	locale   bands.Locale
+}
+
+// stationAt returns the name of the station at a frequency, or "" if there
+// isn't one or no stations are loaded.
+func (c *config) stationAt(freqHZ int) string {
+	if c.stations == nil {
+		return ""
+	}
+	if chs := c.stations.ChannelsAt(freqHZ); len(chs) != 0 {
+		return chs[0].Name
+	}
+	return ""
+}
+
+func defaultConfig() *config {
+	return &config{
+		keyMap: defaultKeyMap(),
+	}
+}
+
+// loadConfig reads the config file at path. An empty path returns the
+// default configuration.
+func loadConfig(path string) (*config, error) {
+	cfg := defaultConfig()
+	if path == "" {
+		return cfg, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if err := cfg.parse(f); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return cfg, nil
+}
+
+func (c *config) parse(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		idx := strings.IndexByte(line, '=')
+		if idx < 0 {
+			return fmt.Errorf("line %d: expected name = value", lineNo)
+		}
+		name := strings.TrimSpace(line[:idx])
+		value := strings.TrimSpace(line[idx+1:])
+		if err := c.set(name, value); err != nil {
+			return fmt.Errorf("line %d: %s", lineNo, err)
+		}
+	}
+	return scanner.Err()
+}
+
+func (c *config) set(name, value string) error {
+	switch {
+	case strings.HasPrefix(name, "key."):
+		act := action(strings.TrimPrefix(name, "key."))
+		if !isAction(act) {
+			return fmt.Errorf("unknown action %q", act)
+		}
+		k, err := parseKey(value)
+		if err != nil {
+			return err
+		}
+		bindKey(c.keyMap, act, k)
+		return nil
+	case name == "region":
+		r, err := strconv.Atoi(value)
+		if err != nil || r < 1 || r > 3 {
+			return fmt.Errorf("invalid ITU region %q, expected 1, 2, or 3", value)
+		}
+		c.locale.Region = bands.Region(r)
+		return nil
+	case name == "country":
+		l := bands.CountryLocale(value)
+		if c.locale.Region != bands.RegionAny {
+			l.Region = c.locale.Region
+		}
+		c.locale = l
+		return nil
+	case name == "stations":
+		f, err := os.Open(value)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		c.stations, err = bands.ReadStations(f)
+		return err
+	}
+	return fmt.Errorf("unknown setting %q", name)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/samuel/rfexplorer/rfx"
+	"github.com/samuel/rfexplorer/rfx/analysis"
+)
+
+// runFoxHunt parks on a frequency and logs the signal level over time.
+// Bearings are read from stdin one per line (typed by hand or piped from a
+// compass) and the current level is recorded against each of them. After
+// each bearing a chart of level vs bearing is printed. Entering g toggles
+// clicks on the terminal bell at a rate following the level.
+func runFoxHunt(src rfx.SpectrumSource, freqMHz float64, logPath string) error {
+	const spanKHZ = 200
+	centerKHZ := int(freqMHz * 1000)
+
+	var logFile *os.File
+	if logPath != "" {
+		var err error
+		logFile, err = os.Create(logPath)
+		if err != nil {
+			return err
+		}
+		defer logFile.Close()
+		fmt.Fprintf(logFile, "time,level_dbm,bearing_deg\n")
+	}
+
+	var mu sync.Mutex
+	level := -999.0
+	bearing := ""
+	var bearings analysis.BearingLog
+	clicks := &clicker{}
+	stopClicks := make(chan struct{})
+	defer close(stopClicks)
+	go clicks.run(os.Stdout, stopClicks)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	scanErr := make(chan error, 1)
+	go func() {
+		scanErr <- rfx.Scan(ctx, src, centerKHZ-spanKHZ/2, centerKHZ+spanKHZ/2, func(config *rfx.CurrentConfigPacket, samples []float64) {
+			peak := -999.0
+			for _, s := range samples {
+				if s > peak {
+					peak = s
+				}
+			}
+			clicks.SetLevel(peak, -120, 0)
+			mu.Lock()
+			level = peak
+			if logFile != nil {
+				fmt.Fprintf(logFile, "%s,%.1f,%s\n", time.Now().Format(time.RFC3339Nano), peak, bearing)
+			}
+			mu.Unlock()
+		})
+	}()
+
+	fmt.Printf("Listening on %.3f MHz. Enter a bearing in degrees to record the current level, empty line for the current level, g to toggle clicks, q to quit.\n", freqMHz)
+	lines := bufio.NewScanner(os.Stdin)
+	for lines.Scan() {
+		line := strings.TrimSpace(lines.Text())
+		mu.Lock()
+		current := level
+		mu.Unlock()
+		switch line {
+		case "":
+			fmt.Printf("%.1f dBm\n", current)
+			continue
+		case "g":
+			if clicks.Toggle() {
+				fmt.Println("Clicks on")
+			} else {
+				fmt.Println("Clicks off")
+			}
+			continue
+		case "q":
+			cancel()
+			return <-scanErr
+		}
+		deg, err := strconv.ParseFloat(line, 64)
+		if err != nil {
+			fmt.Printf("Invalid bearing %q\n", line)
+			continue
+		}
+		mu.Lock()
+		bearing = line
+		bearings.Add(time.Now(), deg, current)
+		mu.Unlock()
+		printBearingChart(&bearings)
+	}
+	cancel()
+	if err := <-scanErr; err != nil {
+		return err
+	}
+	return lines.Err()
+}
+
+// printBearingChart prints the strongest level per 10 degrees of bearing as a
+// bar chart scaled between the weakest and strongest reading.
+func printBearingChart(l *analysis.BearingLog) {
+	buckets := l.Buckets(10)
+	lo, hi := 0.0, -999.0
+	for _, b := range buckets {
+		if b.N == 0 {
+			continue
+		}
+		if hi == -999 || b.MaxDBM > hi {
+			hi = b.MaxDBM
+		}
+		if lo == 0 || b.MaxDBM < lo {
+			lo = b.MaxDBM
+		}
+	}
+	const barWidth = 40
+	for _, b := range buckets {
+		if b.N == 0 {
+			continue
+		}
+		n := barWidth
+		if hi > lo {
+			n = 1 + int(float64(barWidth-1)*(b.MaxDBM-lo)/(hi-lo))
+		}
+		fmt.Printf("%3.0f° %6.1f dBm %s\n", b.BearingDeg, b.MaxDBM, strings.Repeat("#", n))
+	}
+	if best, ok := l.Best(); ok {
+		fmt.Printf("Strongest: %.0f° at %.1f dBm\n", best.BearingDeg, best.LevelDBM)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	termbox "github.com/nsf/termbox-go"
+)
+
+// action is a user interface action that can be bound to a key.
+type action string
+
+const (
+	actionQuit            action = "quit"
+	actionRequestConfig   action = "request-config"
+	actionHold            action = "hold"
+	actionToggleLCD       action = "toggle-lcd"
+	actionMaxHold         action = "max-hold"
+	actionRealtime        action = "realtime"
+	actionScreenDump      action = "screen-dump"
+	actionVTX58           action = "vtx58"
+	actionWiFi24          action = "wifi24"
+	actionNextBand        action = "next-band"
+	actionNextOverlay     action = "next-overlay"
+	actionToggleClicks    action = "toggle-clicks"
+	actionStoreRefA       action = "store-ref-a"
+	actionDiffRefA        action = "diff-ref-a"
+	actionHistoryBack     action = "history-back"
+	actionHistoryForward  action = "history-forward"
+	actionHistoryPageBack action = "history-page-back"
+	actionHistoryPageFwd  action = "history-page-forward"
+	actionHistoryLive     action = "history-live"
+	actionPersistence     action = "persistence"
+)
+
+// rfExplorerOnly reports whether an action controls an RF Explorer, so that
+// it does nothing with other sources.
+func (a action) rfExplorerOnly() bool {
+	switch a {
+	case actionRequestConfig, actionHold, actionToggleLCD, actionMaxHold, actionRealtime, actionScreenDump:
+		return true
+	}
+	return false
+}
+
+// key identifies a key press. Printable characters have a zero Key and the
+// character in Ch, as reported by termbox.
+type key struct {
+	Key termbox.Key
+	Ch  rune
+}
+
+var namedKeys = map[string]termbox.Key{
+	"esc":       termbox.KeyEsc,
+	"enter":     termbox.KeyEnter,
+	"tab":       termbox.KeyTab,
+	"space":     termbox.KeySpace,
+	"backspace": termbox.KeyBackspace2,
+	"up":        termbox.KeyArrowUp,
+	"down":      termbox.KeyArrowDown,
+	"left":      termbox.KeyArrowLeft,
+	"right":     termbox.KeyArrowRight,
+	"pgup":      termbox.KeyPgup,
+	"pgdn":      termbox.KeyPgdn,
+	"home":      termbox.KeyHome,
+	"end":       termbox.KeyEnd,
+	"insert":    termbox.KeyInsert,
+	"delete":    termbox.KeyDelete,
+	"f1":        termbox.KeyF1,
+	"f2":        termbox.KeyF2,
+	"f3":        termbox.KeyF3,
+	"f4":        termbox.KeyF4,
+	"f5":        termbox.KeyF5,
+	"f6":        termbox.KeyF6,
+	"f7":        termbox.KeyF7,
+	"f8":        termbox.KeyF8,
+	"f9":        termbox.KeyF9,
+	"f10":       termbox.KeyF10,
+	"f11":       termbox.KeyF11,
+	"f12":       termbox.KeyF12,
+}
+
+// parseKey parses a key as written in the config file. It's either a single
+// character or one of the names in namedKeys.
+func parseKey(s string) (key, error) {
+	if r := []rune(s); len(r) == 1 {
+		if r[0] == ' ' {
+			return key{Key: termbox.KeySpace}, nil
+		}
+		return key{Ch: r[0]}, nil
+	}
+	if k, ok := namedKeys[strings.ToLower(s)]; ok {
+		return key{Key: k}, nil
+	}
+	return key{}, fmt.Errorf("unknown key %q", s)
+}
+
+// defaultKeyMap returns the built-in key bindings.
+func defaultKeyMap() map[key]action {
+	return map[key]action{
+		{Key: termbox.KeyEsc}:       actionQuit,
+		{Ch: 'c'}:                   actionRequestConfig,
+		{Ch: 'h'}:                   actionHold,
+		{Ch: 'l'}:                   actionToggleLCD,
+		{Ch: 'm'}:                   actionMaxHold,
+		{Ch: 'r'}:                   actionRealtime,
+		{Ch: 's'}:                   actionScreenDump,
+		{Ch: 'v'}:                   actionVTX58,
+		{Ch: 'w'}:                   actionWiFi24,
+		{Ch: 'b'}:                   actionNextBand,
+		{Ch: 'o'}:                   actionNextOverlay,
+		{Ch: 'g'}:                   actionToggleClicks,
+		{Ch: 'a'}:                   actionStoreRefA,
+		{Ch: 'd'}:                   actionDiffRefA,
+		{Key: termbox.KeyArrowUp}:   actionHistoryBack,
+		{Key: termbox.KeyArrowDown}: actionHistoryForward,
+		{Key: termbox.KeyPgup}:      actionHistoryPageBack,
+		{Key: termbox.KeyPgdn}:      actionHistoryPageFwd,
+		{Key: termbox.KeyEnd}:       actionHistoryLive,
+		{Ch: 'p'}:                   actionPersistence,
+	}
+}
+
+// bindKey binds k to act, removing any previous binding of act so that a
+// remapped action no longer responds to its default key.
+func bindKey(keyMap map[key]action, act action, k key) {
+	for ok, oa := range keyMap {
+		if oa == act {
+			delete(keyMap, ok)
+		}
+	}
+	keyMap[k] = act
+}
+
+func isAction(a action) bool {
+	for _, da := range defaultKeyMap() {
+		if da == a {
+			return true
+		}
+	}
+	return false
+}
@@ -6,8 +6,11 @@ package main
 import (
 	"context"
 	"encoding/hex"
+	"flag"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
 	"math"
 	"os"
 	"os/signal"
@@ -19,164 +22,404 @@ import (
 
 	termbox "github.com/nsf/termbox-go"
 	"github.com/samuel/rfexplorer/rfx"
+	"github.com/samuel/rfexplorer/rfx/analysis"
+	"github.com/samuel/rfexplorer/rfx/bands"
+	"github.com/samuel/rfexplorer/rfx/presets"
+	"github.com/samuel/rfexplorer/rfx/record"
+	"github.com/samuel/rfexplorer/rfx/store"
+	"github.com/samuel/rfexplorer/rfx/tinysa"
+	"github.com/samuel/rfexplorer/rfx/trace"
 )
 
-type channel struct {
-	name         string
-	centerFreqHz int
-	widthHZ      int
-	note         string
+// sweep is a sweep stored in the history along with the time it was received,
+// the configuration it was taken with, and its sequence number, which counts
+// the sweeps from 1.
+type sweep struct {
+	seq     int
+	t       time.Time
+	config  *rfx.CurrentConfigPacket
+	samples []float64
 }
 
-var wifi24Channels = []channel{
-	{name: "1", centerFreqHz: 2412000000, widthHZ: 20000000},
-	{name: "2", centerFreqHz: 2417000000, widthHZ: 20000000},
-	{name: "3", centerFreqHz: 2422000000, widthHZ: 20000000},
-	{name: "4", centerFreqHz: 2427000000, widthHZ: 20000000},
-	{name: "5", centerFreqHz: 2432000000, widthHZ: 20000000},
-	{name: "6", centerFreqHz: 2437000000, widthHZ: 20000000},
-	{name: "7", centerFreqHz: 2442000000, widthHZ: 20000000},
-	{name: "8", centerFreqHz: 2447000000, widthHZ: 20000000},
-	{name: "9", centerFreqHz: 2452000000, widthHZ: 20000000},
-	{name: "10", centerFreqHz: 2457000000, widthHZ: 20000000},
-	{name: "11", centerFreqHz: 2462000000, widthHZ: 20000000},
-	{name: "12", centerFreqHz: 2467000000, widthHZ: 20000000},
-	{name: "13", centerFreqHz: 2472000000, widthHZ: 20000000},
-	{name: "14", centerFreqHz: 2484000000, widthHZ: 20000000},
-}
-
-const vtx58ChannelWidth = 10000000
-
-var vtx58Channels = []channel{
-	// Band A: Team BlackSheep (TBS), RangeVideo, SpyHawk, FlyCamOne USA
-	{name: "A1", centerFreqHz: 5865000000, widthHZ: vtx58ChannelWidth},
-	{name: "A2", centerFreqHz: 5845000000, widthHZ: vtx58ChannelWidth},
-	{name: "A3", centerFreqHz: 5825000000, widthHZ: vtx58ChannelWidth},
-	{name: "A4", centerFreqHz: 5805000000, widthHZ: vtx58ChannelWidth},
-	{name: "A5", centerFreqHz: 5785000000, widthHZ: vtx58ChannelWidth},
-	{name: "A6", centerFreqHz: 5765000000, widthHZ: vtx58ChannelWidth},
-	{name: "A7", centerFreqHz: 5745000000, widthHZ: vtx58ChannelWidth},
-	{name: "A8", centerFreqHz: 5725000000, widthHZ: vtx58ChannelWidth},
-
-	// Band B: FlyCamOne Europe
-	{name: "B1", centerFreqHz: 5733000000, widthHZ: vtx58ChannelWidth},
-	{name: "B2", centerFreqHz: 5752000000, widthHZ: vtx58ChannelWidth},
-	{name: "B3", centerFreqHz: 5771000000, widthHZ: vtx58ChannelWidth},
-	{name: "B4", centerFreqHz: 5790000000, widthHZ: vtx58ChannelWidth},
-	{name: "B5", centerFreqHz: 5809000000, widthHZ: vtx58ChannelWidth},
-	{name: "B6", centerFreqHz: 5828000000, widthHZ: vtx58ChannelWidth},
-	{name: "B7", centerFreqHz: 5847000000, widthHZ: vtx58ChannelWidth},
-	{name: "B8", centerFreqHz: 5866000000, widthHZ: vtx58ChannelWidth},
-
-	// Band E: HobbyKing, Foxtech
-	{name: "E1", centerFreqHz: 5705000000, widthHZ: vtx58ChannelWidth},
-	{name: "E2", centerFreqHz: 5685000000, widthHZ: vtx58ChannelWidth},
-	{name: "E3", centerFreqHz: 5665000000, widthHZ: vtx58ChannelWidth},
-	{name: "E4", centerFreqHz: 5645000000, widthHZ: vtx58ChannelWidth},
-	{name: "E5", centerFreqHz: 5885000000, widthHZ: vtx58ChannelWidth},
-	{name: "E6", centerFreqHz: 5905000000, widthHZ: vtx58ChannelWidth},
-	{name: "E7", centerFreqHz: 5925000000, widthHZ: vtx58ChannelWidth},
-	{name: "E8", centerFreqHz: 5945000000, widthHZ: vtx58ChannelWidth},
-
-	// Band F (Airwave): ImmersionRC, Iftron
-	{name: "F1", centerFreqHz: 5740000000, widthHZ: vtx58ChannelWidth},
-	{name: "F2", centerFreqHz: 5760000000, widthHZ: vtx58ChannelWidth},
-	{name: "F3", centerFreqHz: 5780000000, widthHZ: vtx58ChannelWidth},
-	{name: "F4", centerFreqHz: 5800000000, widthHZ: vtx58ChannelWidth},
-	{name: "F5", centerFreqHz: 5820000000, widthHZ: vtx58ChannelWidth},
-	{name: "F6", centerFreqHz: 5840000000, widthHZ: vtx58ChannelWidth},
-	{name: "F7", centerFreqHz: 5860000000, widthHZ: vtx58ChannelWidth},
-	{name: "F8", centerFreqHz: 5880000000, widthHZ: vtx58ChannelWidth},
-
-	// Band C (R): Raceband
-	{name: "C1", centerFreqHz: 5658000000, widthHZ: vtx58ChannelWidth},
-	{name: "C2", centerFreqHz: 5695000000, widthHZ: vtx58ChannelWidth},
-	{name: "C3", centerFreqHz: 5732000000, widthHZ: vtx58ChannelWidth},
-	{name: "C4", centerFreqHz: 5769000000, widthHZ: vtx58ChannelWidth},
-	{name: "C5", centerFreqHz: 5806000000, widthHZ: vtx58ChannelWidth},
-	{name: "C6", centerFreqHz: 5843000000, widthHZ: vtx58ChannelWidth},
-	{name: "C7", centerFreqHz: 5880000000, widthHZ: vtx58ChannelWidth},
-	{name: "C8", centerFreqHz: 5917000000, widthHZ: vtx58ChannelWidth},
-
-	// Band D: Diatone
-	{name: "D1", centerFreqHz: 5362000000, widthHZ: vtx58ChannelWidth},
-	{name: "D2", centerFreqHz: 5399000000, widthHZ: vtx58ChannelWidth},
-	{name: "D3", centerFreqHz: 5436000000, widthHZ: vtx58ChannelWidth},
-	{name: "D4", centerFreqHz: 5473000000, widthHZ: vtx58ChannelWidth},
-	{name: "D5", centerFreqHz: 5510000000, widthHZ: vtx58ChannelWidth},
-	{name: "D6", centerFreqHz: 5547000000, widthHZ: vtx58ChannelWidth},
-	{name: "D7", centerFreqHz: 5584000000, widthHZ: vtx58ChannelWidth},
-	{name: "D8", centerFreqHz: 5621000000, widthHZ: vtx58ChannelWidth},
-
-	{name: "U1", centerFreqHz: 5325000000, widthHZ: vtx58ChannelWidth},
-	{name: "U2", centerFreqHz: 5348000000, widthHZ: vtx58ChannelWidth},
-	{name: "U3", centerFreqHz: 5366000000, widthHZ: vtx58ChannelWidth},
-	{name: "U4", centerFreqHz: 5384000000, widthHZ: vtx58ChannelWidth},
-	{name: "U5", centerFreqHz: 5402000000, widthHZ: vtx58ChannelWidth},
-	{name: "U6", centerFreqHz: 5420000000, widthHZ: vtx58ChannelWidth},
-	{name: "U7", centerFreqHz: 5438000000, widthHZ: vtx58ChannelWidth},
-	{name: "U8", centerFreqHz: 5456000000, widthHZ: vtx58ChannelWidth},
-
-	{name: "O1", centerFreqHz: 5474000000, widthHZ: vtx58ChannelWidth},
-	{name: "O2", centerFreqHz: 5492000000, widthHZ: vtx58ChannelWidth},
-	{name: "O3", centerFreqHz: 5510000000, widthHZ: vtx58ChannelWidth},
-	{name: "O4", centerFreqHz: 5528000000, widthHZ: vtx58ChannelWidth},
-	{name: "O5", centerFreqHz: 5546000000, widthHZ: vtx58ChannelWidth},
-	{name: "O6", centerFreqHz: 5564000000, widthHZ: vtx58ChannelWidth},
-	{name: "O7", centerFreqHz: 5582000000, widthHZ: vtx58ChannelWidth},
-	{name: "O8", centerFreqHz: 5600000000, widthHZ: vtx58ChannelWidth},
-
-	// Band L: Low band
-	{name: "L1", centerFreqHz: 5333000000, widthHZ: vtx58ChannelWidth},
-	{name: "L2", centerFreqHz: 5373000000, widthHZ: vtx58ChannelWidth},
-	{name: "L3", centerFreqHz: 5413000000, widthHZ: vtx58ChannelWidth},
-	{name: "L4", centerFreqHz: 5453000000, widthHZ: vtx58ChannelWidth},
-	{name: "L5", centerFreqHz: 5493000000, widthHZ: vtx58ChannelWidth},
-	{name: "L6", centerFreqHz: 5533000000, widthHZ: vtx58ChannelWidth},
-	{name: "L7", centerFreqHz: 5573000000, widthHZ: vtx58ChannelWidth},
-	{name: "L8", centerFreqHz: 5613000000, widthHZ: vtx58ChannelWidth},
-
-	// Band H: High band
-	{name: "H1", centerFreqHz: 5653000000, widthHZ: vtx58ChannelWidth},
-	{name: "H2", centerFreqHz: 5693000000, widthHZ: vtx58ChannelWidth},
-	{name: "H3", centerFreqHz: 5733000000, widthHZ: vtx58ChannelWidth},
-	{name: "H4", centerFreqHz: 5773000000, widthHZ: vtx58ChannelWidth},
-	{name: "H5", centerFreqHz: 5813000000, widthHZ: vtx58ChannelWidth},
-	{name: "H6", centerFreqHz: 5853000000, widthHZ: vtx58ChannelWidth},
-	{name: "H7", centerFreqHz: 5893000000, widthHZ: vtx58ChannelWidth},
-	{name: "H8", centerFreqHz: 5933000000, widthHZ: vtx58ChannelWidth},
-}
+// maxHistory is the number of sweeps kept for inspection with the time cursor.
+const maxHistory = 512
 
-// var zigbeeChannels = []int{
-// 	{name: "11", centerFreqHz: 2405000000, widthHZ: 2000000, note:"Overlaps Ch 1 Newer XBee only"},
-// 	{name: "12", centerFreqHz: 2410000000, widthHZ: 2000000, note:"Overlaps Ch 1"},
-// 	{name: "13", centerFreqHz: 2415000000, widthHZ: 2000000, note:"Overlaps Ch 1"},
-// 	{name: "14", centerFreqHz: 2420000000, widthHZ: 2000000, note:"Overlaps Ch 1"},
-// 	{name: "15", centerFreqHz: 2425000000, widthHZ: 2000000, note:"Overlaps Ch 6"},
-// 	{name: "16", centerFreqHz: 2430000000, widthHZ: 2000000, note:"Overlaps Ch 6"},
-// 	{name: "17", centerFreqHz: 2435000000, widthHZ: 2000000, note:"Overlaps Ch 6"},
-// 	{name: "18", centerFreqHz: 2440000000, widthHZ: 2000000, note:"Overlaps Ch 6"},
-// 	{name: "19", centerFreqHz: 2445000000, widthHZ: 2000000, note:"Overlaps Ch 6"},
-// 	{name: "20", centerFreqHz: 2450000000, widthHZ: 2000000, note:"Overlaps Ch 11"},
-// 	{name: "21", centerFreqHz: 2455000000, widthHZ: 2000000, note:"Overlaps Ch 11"},
-// 	{name: "22", centerFreqHz: 2460000000, widthHZ: 2000000, note:"Overlaps Ch 11"},
-// 	{name: "23", centerFreqHz: 2465000000, widthHZ: 2000000, note:"Overlaps Ch 11"},
-// 	{name: "24", centerFreqHz: 2470000000, widthHZ: 2000000, note:"Overlaps Ch 11 Newer XBee only"},
-// 	{name: "25", centerFreqHz: 2475000000, widthHZ: 2000000, note:"No Conflict Newer XBee only"},
-// 	{name: "26", centerFreqHz: 2480000000, widthHZ: 2000000, note:"No Conflict Newer non-PRO XBee only"},
-// }
+// persistenceSweeps is the number of sweeps counted by the persistence view.
+const persistenceSweeps = 200
 
 func main() {
-	rfe, err := rfx.New("/dev/tty.SLAB_USBtoUART")
+	device := flag.String("device", "", "serial device of the RF Explorer, or tcp://host:port of one shared with -share, found automatically if not set")
+	baud := flag.Int("baud", 500000, "baud rate of the RF Explorer, 0 detects it and switches the device to 500000")
+	ampCorrection := flag.String("amp-correction", "", "RF Explorer .rfa file of antenna, cable, or LNA corrections to apply to measured levels")
+	backpressure := flag.String("backpressure", "block", "what to do with packets the display can't keep up with: block, drop-oldest, drop-newest, or coalesce-sweeps")
+	reconnect := flag.Duration("reconnect", time.Second, "delay before reopening the RF Explorer if it's disconnected, 0 exits instead")
+	configPath := flag.String("config", "", "path to config file")
+	coordCount := flag.Int("coordinate", 0, "coordinate frequencies for this many wireless microphones and exit")
+	coordRange := flag.String("coord-range", "470-608", "tuning range of the microphones in MHz")
+	coordTVPlan := flag.String("tv-plan", "atsc", "TV channel plan for -tv (atsc or dvbt)")
+	coordTV := flag.String("tv", "", "comma separated list of TV channels in use locally")
+	coordScanTime := flag.Duration("scan-time", 10*time.Second, "how long to scan in the measurement modes")
+	vtxCheck := flag.String("vtx-check", "", "comma separated list of 5.8 GHz VTX channels to verify are clear and exit")
+	coex := flag.Bool("coex", false, "measure Zigbee and Wi-Fi occupancy, recommend Zigbee channels, and exit")
+	loraPlan := flag.String("lora", "", "measure occupancy of a LoRaWAN channel plan (eu868 or us915), rank the channels, and exit")
+	presetName := flag.String("preset", "", "name of a library preset to start with")
+	writePresets := flag.String("write-presets", "", "comma separated list of library presets (or \"all\") to write to the device and exit")
+	presetIndex := flag.Int("preset-index", 0, "first device preset slot (starting at 0) used by -write-presets")
+	listPresets := flag.Bool("list-presets", false, "list the library presets and exit")
+	wxSat := flag.Bool("wxsat", false, "monitor the 137 MHz weather satellite band and log passes")
+	sniffFreq := flag.Float64("sniff", 0, "frequency in MHz to capture OOK remotes on with the sniffer, decoded codes are printed")
+	foxHunt := flag.Float64("foxhunt", 0, "frequency in MHz to park on for direction finding, bearings are read from stdin")
+	foxHuntLog := flag.String("foxhunt-log", "", "CSV file to log levels to in -foxhunt mode")
+	surveyPath := flag.String("survey", "", "survey file to append location labeled max-hold snapshots to, labels are read from stdin")
+	surveyRange := flag.String("survey-range", "2400-2500", "range in MHz to record in -survey mode")
+	recordDir := flag.String("record", "", "directory to continuously record sweeps to")
+	recordRange := flag.String("record-range", "2400-2500", "range in MHz to record in -record mode")
+	retainFullDays := flag.Int("retain-full-days", 7, "days to keep full resolution recordings, 0 keeps them forever")
+	retainSummaryMonths := flag.Int("retain-summary-months", 6, "months to keep recording summaries, 0 keeps them forever")
+	summaryInterval := flag.Duration("summary-interval", time.Minute, "period covered by each recording summary")
+	harmonicsFreq := flag.Float64("harmonics", 0, "measure the 2nd and 3rd harmonics of a transmitter on this frequency in MHz and exit")
+	harmonicsLimit := flag.Float64("harmonic-limit", 0, "harmonic limit in dBc for -harmonics, defaults to the FCC part 97 limit for the frequency")
+	tinySADevice := flag.String("tinysa", "", "serial device of a tinySA to use instead of the RF Explorer, supported by the display, -monitor, -harmonics, -record, -survey, -foxhunt, -snapshot, -spectrogram, and the exports")
+	listPorts := flag.Bool("list-ports", false, "list the serial ports with their USB IDs, marking likely RF Explorers, and exit")
+	identify := flag.Bool("identify", false, "probe the serial ports, print which is an analyzer and which is a generator, and exit")
+	programPresets := flag.String("program-presets", "", "CSV file of preset definitions to write to the device, verify, and exit")
+	syncPresets := flag.String("sync-presets", "", "CSV file of preset definitions to make the device match, writing only the presets that differ, and exit")
+	dumpPresets := flag.String("dump-presets", "", "file to save the device's stored presets to as JSON, and exit")
+	loadPresets := flag.String("load-presets", "", "file saved by -dump-presets to write to the device, verify, and exit")
+	clearPresets := flag.Bool("clear-presets", false, "clear all stored presets on the device and exit")
+	profileName := flag.String("profile", "", "sweep profile to apply (fast or high-resolution)")
+	monitorPath := flag.String("monitor", "", "config file of bands to monitor unattended for limit and baseline violations")
+	aggregateAddr := flag.String("aggregate", "", "address to serve an aggregator for -monitor nodes on, e.g. :8080, which is limited to localhost without -tokens or -tls-client-ca")
+	aggregateDir := flag.String("aggregate-dir", "aggregate", "directory the aggregator records to")
+	tlsCert := flag.String("tls-cert", "", "certificate file to serve -aggregate over TLS with")
+	tlsKey := flag.String("tls-key", "", "key file of -tls-cert")
+	tlsClientCA := flag.String("tls-client-ca", "", "CA file to verify client certificates with, which get the -client-cert-role")
+	requireClientCert := flag.Bool("require-client-cert", false, "reject TLS clients without a certificate signed by -tls-client-ca")
+	clientCertRole := flag.String("client-cert-role", "control", "role (read or control) of clients with a verified certificate")
+	tokensPath := flag.String("tokens", "", "file of \"<role> <token>\" lines of API tokens accepted by -aggregate, which needs -tls-cert with them on addresses other than localhost")
+	fleet := flag.Bool("fleet", false, "apply -program-presets, -preset, and -profile to every analyzer on the serial ports, report each, and exit")
+	shareAddr := flag.String("share", "", "address to share the RF Explorer on for -device tcp://host:port clients without authentication, e.g. :7000, which is limited to localhost without -insecure")
+	insecure := flag.Bool("insecure", false, "serve -share and an unauthenticated -aggregate on addresses other than localhost, and -tokens there without -tls-cert, instead of refusing to")
+	numPeaks := flag.Int("peaks", 0, "number of peaks at least 10 dB above the noise floor to mark and list along with their -3 dB bandwidth")
+	average := flag.Float64("average", 0, "weight (0-1) of each sweep in an exponential average to display instead of the live sweep, 0 to display the live sweep")
+	tracePath := flag.String("trace", "", "file to write a timestamped hex dump of every command and frame exchanged with the device to, along with a debug log")
+	capturePath := flag.String("capture", "", "file to capture everything received from the device to, for the replay corpus")
+	sessionPath := flag.String("record-session", "", "file to record everything received from the device to with timestamps, for -play")
+	playPath := flag.String("play", "", "session recorded with -record-session to play back instead of using a device")
+	exportCSV := flag.String("export-csv", "", "file to save sweeps to in the CSV format of RF Explorer for Windows until interrupted or the end of -play")
+	exportSigMF := flag.String("export-sigmf", "", "base path to save sweeps to as a SigMF recording until interrupted or the end of -play")
+	spectrogramPath := flag.String("spectrogram", "", "PNG file to render a spectrogram of the last sweeps to when interrupted or at the end of -play")
+	snapshotPath := flag.String("snapshot", "", "PNG or SVG file to plot the last sweep, max-hold, and peaks after -scan-time to, and exit")
+	playSpeed := flag.Float64("play-speed", 1, "how many times faster than real time to -play, 0 for as fast as possible")
+	flag.Parse()
+
+	if *listPresets {
+		for _, p := range presets.Library {
+			fmt.Printf("%-12s %.3f-%.3f MHz\n", p.Name, float64(p.MinFreqKHz)/1000, float64(p.MaxFreqKHz)/1000)
+		}
+		return
+	}
+
+	if *listPorts {
+		if err := runListPorts(); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if *identify {
+		devices := rfx.Discover(2 * time.Second)
+		if len(devices) == 0 {
+			log.Fatal("no devices found")
+		}
+		for _, d := range devices {
+			setup := d.Setup
+			if setup.IsGenerator() {
+				fmt.Printf("%s\tgenerator %s firmware %s\n", d.Port, setup.Model, setup.FirmwareVersion)
+			} else {
+				fmt.Printf("%s\tanalyzer %s (expansion %s) firmware %s\n", d.Port, setup.Model, setup.ExpansionModel, setup.FirmwareVersion)
+			}
+		}
+		return
+	}
+
+	sec := &serverSecurity{
+		certFile:          *tlsCert,
+		keyFile:           *tlsKey,
+		clientCAFile:      *tlsClientCA,
+		requireClientCert: *requireClientCert,
+		clientCertRole:    *clientCertRole,
+		tokensFile:        *tokensPath,
+		insecure:          *insecure,
+	}
+	if *aggregateAddr != "" {
+		if err := runAggregator(*aggregateAddr, *aggregateDir, sec); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if *fleet {
+		if err := runFleet(*programPresets, *presetName, *profileName); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// runSourceMode runs the modes that work with any rfx.SpectrumSource
+	// and returns false if none of them were selected.
+	runSourceMode := func(s rfx.SpectrumSource) (bool, error) {
+		if *monitorPath != "" {
+			return true, runMonitor(s, *monitorPath)
+		}
+		if *harmonicsFreq > 0 {
+			return true, runHarmonics(s, *harmonicsFreq, *harmonicsLimit, *coordScanTime)
+		}
+		if *recordDir != "" {
+			policy := store.Policy{
+				FullRetention:    time.Duration(*retainFullDays) * 24 * time.Hour,
+				SummaryRetention: time.Duration(*retainSummaryMonths) * 31 * 24 * time.Hour,
+				SummaryInterval:  *summaryInterval,
+			}
+			return true, runRecord(s, *recordDir, *recordRange, policy)
+		}
+		if *surveyPath != "" {
+			return true, runSurvey(s, *surveyPath, *surveyRange, *coordScanTime)
+		}
+		if *foxHunt > 0 {
+			return true, runFoxHunt(s, *foxHunt, *foxHuntLog)
+		}
+		if *exportCSV != "" {
+			return true, runExportCSV(s, *exportCSV)
+		}
+		if *exportSigMF != "" {
+			return true, runExportSigMF(s, *exportSigMF)
+		}
+		if *snapshotPath != "" {
+			return true, runSnapshot(s, *snapshotPath, *coordScanTime)
+		}
+		if *spectrogramPath != "" {
+			return true, runSpectrogram(s, *spectrogramPath)
+		}
+		return false, nil
+	}
+	if *tinySADevice != "" {
+		sa, err := tinysa.Open(*tinySADevice)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer sa.Close()
+		if ok, err := runSourceMode(sa); err != nil {
+			log.Fatal(err)
+		} else if !ok {
+			if err := runTUI(sa, cfg, *average, *numPeaks); err != nil {
+				log.Fatal(err)
+			}
+		}
+		return
+	}
+
+	if *device == "" && *playPath == "" {
+		if *device, err = rfx.DiscoverAnalyzer(2 * time.Second); err != nil {
+			if *device, err = pickPort(err); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+	if *shareAddr != "" {
+		if err := runShare(*shareAddr, *device, rfx.BaudRate(*baud), sec); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	opt := rfx.WithBaudRate(rfx.BaudRate(*baud))
+	if *baud == 0 {
+		opt = rfx.WithAutoBaud(true)
+	}
+	opts := []rfx.Option{opt}
+	if *reconnect > 0 {
+		opts = append(opts, rfx.WithAutoReconnect(*reconnect))
+	}
+	bp, err := rfx.ParseBackpressure(*backpressure)
+	if err != nil {
+		log.Fatal(err)
+	}
+	opts = append(opts, rfx.WithBackpressure(bp))
+	if *tracePath != "" {
+		f, err := os.Create(*tracePath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		opts = append(opts,
+			rfx.WithTraceWriter(f),
+			rfx.WithLogger(slog.New(slog.NewTextHandler(f, &slog.HandlerOptions{Level: slog.LevelDebug}))))
+	}
+	var rfe *rfx.RFExplorer
+	if *playPath != "" {
+		rfe, err = playSession(*playPath, *playSpeed, opts)
+	} else if strings.HasPrefix(*device, "tcp://") {
+		rfe, err = rfx.Dial(*device, opts...)
+	} else {
+		rfe, err = rfx.New(*device, opts...)
+	}
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer rfe.Close()
 
+	if *ampCorrection != "" {
+		c, err := rfx.LoadAmplitudeCorrection(*ampCorrection)
+		if err != nil {
+			log.Fatal(err)
+		}
+		rfe.SetAmplitudeCorrection(c)
+	}
+	var captures []io.Writer
+	if *capturePath != "" {
+		f, err := os.Create(*capturePath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		captures = append(captures, f)
+	}
+	if *sessionPath != "" {
+		f, err := os.Create(*sessionPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		rec, err := record.NewRecorder(f)
+		if err != nil {
+			log.Fatal(err)
+		}
+		captures = append(captures, rec)
+	}
+	if len(captures) != 0 {
+		rfe.SetCapture(io.MultiWriter(captures...))
+		// Request the setup again so that it's in the capture.
+		if err := rfe.RequestConfig(); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *coordCount > 0 {
+		if err := runCoordinate(rfe, *coordCount, *coordRange, *coordTVPlan, *coordTV, *coordScanTime); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if *writePresets != "" {
+		if err := runWritePresets(rfe, *writePresets, *presetIndex); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if *clearPresets {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		n, err := rfe.ClearPresets(ctx)
+		cancel()
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Cleared %d presets\n", n)
+		return
+	}
+	if *dumpPresets != "" {
+		if err := runDumpPresets(rfe, *dumpPresets); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if *loadPresets != "" {
+		if err := runLoadPresets(rfe, *loadPresets); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if *programPresets != "" {
+		if err := runProgramPresets(rfe, *programPresets); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if *syncPresets != "" {
+		if err := runSyncPresets(rfe, *syncPresets); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if *presetName != "" {
+		p, ok := presets.Lookup(*presetName)
+		if !ok {
+			log.Fatalf("unknown preset %q, available presets: %s", *presetName, strings.Join(presets.Names(), ", "))
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err := rfe.ApplyPreset(ctx, p)
+		cancel()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *profileName != "" {
+		p, ok := rfx.LookupProfile(*profileName)
+		if !ok {
+			log.Fatalf("unknown profile %q", *profileName)
+		}
+		if err := rfe.ApplyProfile(p); err != nil {
+			log.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	if warning, err := rfe.CalibrationWarning(ctx); err == nil && warning != "" {
+		log.Printf("Warning: %s", warning)
+	}
+	cancel()
+	if ok, err := runSourceMode(rfe); err != nil {
+		log.Fatal(err)
+	} else if ok {
+		return
+	}
+	if *sniffFreq > 0 {
+		if err := runSniff(rfe, *sniffFreq); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if *wxSat {
+		if err := runWxSatMonitor(rfe); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if *loraPlan != "" {
+		if err := runLoRaOccupancy(rfe, *loraPlan, *coordScanTime); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if *coex {
+		if err := runCoexistence(rfe, *coordScanTime); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if *vtxCheck != "" {
+		if err := runVTXCheck(rfe, strings.Split(*vtxCheck, ","), *coordScanTime); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	// if err := rfe.SwitchModuleExp(); err != nil {
 	// 	log.Fatal(err)
 	// }
-	// if err := rfe.SetAnalyzerConfig(2475650, 2501300, 0, -120, 0); err != nil {
+	// if err := rfe.Configure(2475650, 2501300); err != nil {
 	// 	log.Fatal(err)
 	// }
 	// 2.4 GHz Zigbee
@@ -184,34 +427,34 @@ func main() {
 	// 	log.Fatal(err)
 	// }
 	// 2.4 GHz Wi-Fi
-	// if err := rfe.SetAnalyzerConfig(2401000, 2495000, 0, -120, 0); err != nil {
+	// if err := rfe.Configure(2401000, 2495000); err != nil {
 	// 	log.Fatal(err)
 	// }
 	// if err := rfe.SetSteps(512); err != nil {
 	// 	log.Fatal(err)
 	// }
 	// Interesting signal
-	// if err := rfe.SetAnalyzerConfig(2420000, 2450000, 0, -120, 0); err != nil {
+	// if err := rfe.Configure(2420000, 2450000); err != nil {
 	// 	log.Fatal(err)
 	// }
 	// ISM Band (Region 2)
-	// if err := rfe.SetAnalyzerConfig(902000, 928000, 0, -120, 0); err != nil {
+	// if err := rfe.Configure(902000, 928000); err != nil {
 	// 	log.Fatal(err)
 	// }
 	// 6 meter amateur radio
-	// if err := rfe.SetAnalyzerConfig(50000, 54000, 0, -120, 0); err != nil {
+	// if err := rfe.Configure(50000, 54000); err != nil {
 	// 	log.Fatal(err)
 	// }
 	// 2 meter amateur radio
-	// if err := rfe.SetAnalyzerConfig(144000, 148000, 0, -120, 0); err != nil {
+	// if err := rfe.Configure(144000, 148000); err != nil {
 	// 	log.Fatal(err)
 	// }
 	// 1.25 meter amateur radio
-	// if err := rfe.SetAnalyzerConfig(222000, 225000, 0, -120, 0); err != nil {
+	// if err := rfe.Configure(222000, 225000); err != nil {
 	// 	log.Fatal(err)
 	// }
 	// 70 centimeters
-	// if err := rfe.SetAnalyzerConfig(420000, 450000, 0, -120, 0); err != nil {
+	// if err := rfe.Configure(420000, 450000); err != nil {
 	// 	log.Fatal(err)
 	// }
 
@@ -219,19 +462,39 @@ func main() {
 	// 	log.Fatal(err)
 	// }
 	// 5 GHz Wi-Fi
-	// if err := rfe.SetAnalyzerConfig(5170000, 5835000, 0, -120, 0); err != nil {
+	// if err := rfe.Configure(5170000, 5835000); err != nil {
 	// 	log.Fatal(err)
 	// }
-	// if err := rfe.SetAnalyzerConfig(5500000, 5700000, 0, -120, 0); err != nil {
+	// if err := rfe.Configure(5500000, 5700000); err != nil {
 	// 	log.Fatal(err)
 	// }
 
-	// if err := rfe.SetAnalyzerConfig(433900, 434100, 0, -120, 0); err != nil {
+	// if err := rfe.Configure(433900, 434100); err != nil {
 	// 	log.Fatal(err)
 	// }
-	if err := rfe.SetScreenDumpEnabled(false); err != nil {
+	if err := runTUI(rfe, cfg, *average, *numPeaks); err != nil {
 		log.Fatal(err)
 	}
+}
+
+// runTUI shows the sweeps of src in the terminal until quit, or until the
+// source or an action fails, which is returned once the terminal has been
+// restored. Actions that control an RF Explorer do nothing with other
+// sources.
+func runTUI(src rfx.SpectrumSource, cfg *config, average float64, numPeaks int) error {
+	rfe, _ := src.(*rfx.RFExplorer)
+	var packets <-chan rfx.Packet
+	var errs <-chan error
+	if rfe != nil {
+		if err := rfe.SetScreenDumpEnabled(false); err != nil {
+			return err
+		}
+		packets, errs = rfe.Chan(), rfe.Errors()
+	} else {
+		stopSweeps := make(chan struct{})
+		defer close(stopSweeps)
+		packets, errs = sourcePackets(src, stopSweeps)
+	}
 
 	lcdEnabled := false
 	// if err := rfe.SetLCDEnabled(lcdEnabled); err != nil {
@@ -243,28 +506,57 @@ func main() {
 	// if err := rfe.SetScreenDumpEnabled(false); err != nil {
 	// 	log.Fatal(err)
 	// }
-	if err := rfe.RequestConfig(); err != nil {
-		log.Fatal(err)
-	}
-	if err := rfe.RequestPresets(); err != nil {
-		log.Fatal(err)
+	if rfe != nil {
+		if err := rfe.RequestConfig(); err != nil {
+			return err
+		}
+		if err := rfe.RequestPresets(); err != nil {
+			return err
+		}
 	}
 
 	if err := termbox.Init(); err != nil {
-		log.Fatal(err)
+		return err
 	}
 	defer termbox.Close()
 
 	termbox.HideCursor()
 	// termbox.SetInputMode(termbox.InputEsc)
 
-	wifi24 := uint32(0)
-	vtx85ghz := uint32(0)
+	// channelBand is the band whose channel power is shown as bars. It
+	// holds a nil *bands.Band when showing the normal spectrum view.
+	var channelBand atomic.Value
+	channelBand.Store((*bands.Band)(nil))
+	selectBand := func(b *bands.Band) error {
+		if b != nil {
+			lo, hi := b.Range()
+			margin := (hi - lo) / 20
+			if err := src.Configure((lo-margin)/1000, (hi+margin+999)/1000); err != nil {
+				return err
+			}
+		}
+		channelBand.Store(b)
+		return nil
+	}
+	// overlayBand is the band used to label the peak in the spectrum view.
+	var overlayBand atomic.Value
+	overlayBand.Store((*bands.Band)(nil))
 	dumpingScreen := uint32(0)
+	storeRefA := uint32(0)
+	diffRefA := uint32(0)
+	showPersistence := uint32(0)
+	// historyMove is the number of sweeps to move the time cursor back by,
+	// and historyLive is set to return it to the live sweep.
+	historyMove := int32(0)
+	historyLive := uint32(0)
+	clicks := &clicker{}
+	stopClicks := make(chan struct{})
+	defer close(stopClicks)
+	go clicks.run(os.Stdout, stopClicks)
 
 	logFile, err := os.Create("log.txt")
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 	defer logFile.Close()
 
@@ -273,67 +565,108 @@ func main() {
 	defer func() {
 		signal.Reset(os.Interrupt, syscall.SIGTERM)
 	}()
+	// Errors of the actions end the display from the main loop, which
+	// restores the terminal.
+	keyErr := make(chan error, 1)
 	go func() {
 		for {
 			switch ev := termbox.PollEvent(); ev.Type {
 			case termbox.EventKey:
-				switch ev.Key {
-				case termbox.KeyEsc:
+				a := cfg.keyMap[key{Key: ev.Key, Ch: ev.Ch}]
+				if rfe == nil && a.rfExplorerOnly() {
+					continue
+				}
+				switch a {
+				case actionHistoryBack:
+					atomic.AddInt32(&historyMove, 1)
+				case actionHistoryForward:
+					atomic.AddInt32(&historyMove, -1)
+				case actionHistoryPageBack:
+					atomic.AddInt32(&historyMove, 10)
+				case actionHistoryPageFwd:
+					atomic.AddInt32(&historyMove, -10)
+				case actionHistoryLive:
+					atomic.StoreInt32(&historyMove, 0)
+					atomic.StoreUint32(&historyLive, 1)
+				case actionQuit:
 					select {
 					case ch <- os.Signal(nil):
 					default:
 					}
 					return
-				case 0:
-					switch ev.Ch {
-					case 'c':
-						if err := rfe.RequestConfig(); err != nil {
-							log.Fatal(err)
-						}
-					case 'h':
-						if err := rfe.Hold(); err != nil {
-							log.Fatal(err)
-						}
-					case 'l':
-						lcdEnabled = !lcdEnabled
-						if err := rfe.SetLCDEnabled(lcdEnabled); err != nil {
-							log.Fatal(err)
-						}
-					case 'm':
-						if err := rfe.SetMaxHold(); err != nil {
-							log.Fatal(err)
-						}
-					case 'r':
-						if err := rfe.Realtime(); err != nil {
-							log.Fatal(err)
-						}
-					case 's':
-						isDumping := atomic.LoadUint32(&dumpingScreen) ^ 1
-						atomic.StoreUint32(&dumpingScreen, isDumping)
-						if err := rfe.SetScreenDumpEnabled(isDumping != 0); err != nil {
-							log.Fatal(err)
-						}
-					case 'v':
-						if atomic.LoadUint32(&vtx85ghz) == 0 {
+				case actionToggleClicks:
+					clicks.Toggle()
+				case actionStoreRefA:
+					atomic.StoreUint32(&storeRefA, 1)
+				case actionRequestConfig:
+					if err := rfe.RequestConfig(); err != nil {
+						keyErr <- err
+						return
+					}
+				case actionDiffRefA:
+					atomic.StoreUint32(&diffRefA, atomic.LoadUint32(&diffRefA)^1)
+				case actionPersistence:
+					atomic.StoreUint32(&showPersistence, atomic.LoadUint32(&showPersistence)^1)
+				case actionHold:
+					if err := rfe.Hold(); err != nil {
+						keyErr <- err
+						return
+					}
+				case actionToggleLCD:
+					lcdEnabled = !lcdEnabled
+					if err := rfe.SetLCDEnabled(lcdEnabled); err != nil {
+						keyErr <- err
+						return
+					}
+				case actionMaxHold:
+					if err := rfe.SetCalculatorMode(rfx.CalculatorModeMaxHold); err != nil {
+						keyErr <- err
+						return
+					}
+				case actionRealtime:
+					if err := rfe.SetCalculatorMode(rfx.CalculatorModeNormal); err != nil {
+						keyErr <- err
+						return
+					}
+				case actionScreenDump:
+					isDumping := atomic.LoadUint32(&dumpingScreen) ^ 1
+					atomic.StoreUint32(&dumpingScreen, isDumping)
+					if err := rfe.SetScreenDumpEnabled(isDumping != 0); err != nil {
+						keyErr <- err
+						return
+					}
+				case actionVTX58:
+					if overlayBand.Load().(*bands.Band) != bands.VTX58 {
+						if rfe != nil {
 							if err := rfe.SwitchModuleMain(); err != nil {
-								log.Fatal(err)
+								keyErr <- err
+								return
 							}
-							if err := rfe.SetAnalyzerConfig(5350000, 5950000, 0, -120, 0); err != nil {
-								log.Fatal(err)
-							}
-							atomic.StoreUint32(&vtx85ghz, 1)
-						} else {
-							atomic.StoreUint32(&vtx85ghz, 0)
 						}
-					case 'w':
-						if atomic.LoadUint32(&wifi24) == 0 {
-							if err := rfe.SetAnalyzerConfig(2401000, 2495000, 0, -120, 0); err != nil {
-								log.Fatal(err)
-							}
-							atomic.StoreUint32(&wifi24, 1)
-						} else {
-							atomic.StoreUint32(&wifi24, 0)
+						if err := src.Configure(5350000, 5950000); err != nil {
+							keyErr <- err
+							return
 						}
+						overlayBand.Store(bands.VTX58)
+					} else {
+						overlayBand.Store((*bands.Band)(nil))
+					}
+				case actionNextOverlay:
+					overlayBand.Store(nextBand(overlayBand.Load().(*bands.Band), cfg.locale))
+				case actionWiFi24:
+					b := bands.WiFi24
+					if channelBand.Load().(*bands.Band) == bands.WiFi24 {
+						b = nil
+					}
+					if err := selectBand(b); err != nil {
+						keyErr <- err
+						return
+					}
+				case actionNextBand:
+					if err := selectBand(nextBand(channelBand.Load().(*bands.Band), cfg.locale)); err != nil {
+						keyErr <- err
+						return
+					}
 				}
 			}
 		}
@@ -348,52 +681,94 @@ func main() {
 	maxAmp := -999.0
 	maxAmpFreq := 0
 	maxAmpStep := 0
-	var maxSamples []float64
-	const numAvg = 0 //2
-	var sumSamples []float64
-	var sumCount int
+	traces := trace.New(average)
+	// refA is the reference trace stored with 'a' and subtracted from the
+	// live trace when the difference view is toggled with 'd'. It's resampled
+	// onto the live grid so it stays valid when the span changes.
+	var refA []float64
+	var refAGrid analysis.Grid
+	const diffRangeDB = 30
+	// history holds the most recent sweeps, oldest first. Moving the time
+	// cursor up with the arrow keys displays older sweeps in place of the
+	// live one.
+	var history []sweep
+	// seq is the sequence number of the last sweep, and viewSeq that of the
+	// sweep being displayed or 0 for the live sweep. Anchoring the cursor
+	// to a sweep keeps the view from drifting as new sweeps arrive.
+	seq, viewSeq := 0, 0
+	// persistence counts the levels of the recent live sweeps for the
+	// persistence view toggled with 'p'.
+	persistence := analysis.NewPersistence(-130, 10, 1, persistenceSweeps)
 	for {
 		select {
-		case pkt := <-rfe.Chan():
+		case pkt := <-packets:
 			// fmt.Fprintf(logFile, "%#+v\n", pkt)
 			switch pkt := pkt.(type) {
 			case *rfx.CurrentConfigPacket:
 				fmt.Fprintf(logFile, "%#+v\n", pkt)
 				// fmt.Printf("%#+v\n", pkt)
 				config = pkt
+				persistence.Reset()
 			case *rfx.SweepDataPacket:
 				if atomic.LoadUint32(&dumpingScreen) != 0 {
 					break
 				}
-				if len(pkt.Samples) != len(maxSamples) {
-					maxSamples = make([]float64, len(pkt.Samples))
-					copy(maxSamples, pkt.Samples)
+				traces.Add(config, pkt.Samples)
+				persistence.Add(config, pkt.Samples)
+				if average > 0 {
+					copy(pkt.Samples, traces.Trace(trace.Average))
+				}
+				maxAmp = -999
+				maxAmpFreq = 0
+
+				if len(history) == maxHistory {
+					copy(history, history[1:])
+					history = history[:maxHistory-1]
 				}
-				if len(pkt.Samples) != len(sumSamples) {
-					sumSamples = make([]float64, len(pkt.Samples))
+				seq++
+				sweepConfig := pkt.Config
+				if sweepConfig == nil {
+					sweepConfig = config
 				}
-				if numAvg > 0 {
-					for i, s := range pkt.Samples {
-						sumSamples[i] += s
-					}
-					sumCount++
-					if sumCount < numAvg {
-						break
+				history = append(history, sweep{seq: seq, t: pkt.Time, config: sweepConfig, samples: append([]float64(nil), pkt.Samples...)})
+				if atomic.SwapUint32(&historyLive, 0) != 0 {
+					viewSeq = 0
+				}
+				if move := int(atomic.SwapInt32(&historyMove, 0)); move != 0 {
+					from := seq
+					if viewSeq != 0 {
+						from = viewSeq
 					}
-					for i, s := range sumSamples {
-						pkt.Samples[i] = s / float64(sumCount)
-						sumSamples[i] = 0
+					viewSeq = from - move
+					if viewSeq >= seq {
+						viewSeq = 0
 					}
-					sumCount = 0
-					maxAmp = -999.0
-					maxAmpFreq = 0
-				} else {
-					maxAmp = -999
-					maxAmpFreq = 0
 				}
+				// Sweeps older than the history can't be shown.
+				if oldest := history[0].seq; viewSeq != 0 && viewSeq < oldest {
+					viewSeq = oldest
+				}
+				viewing, cursor := history[len(history)-1], 0
+				if viewSeq != 0 {
+					viewing, cursor = history[viewSeq-history[0].seq], seq-viewSeq
+				}
+				// The history has a copy of the samples.
+				pkt.Release()
+				pkt = &rfx.SweepDataPacket{Config: viewing.config, Samples: viewing.samples}
+				// The sweep is drawn with the configuration it was taken
+				// with, which differs from the live one after a change of
+				// span when looking back at an older sweep.
+				config := viewing.config
+
+				if atomic.SwapUint32(&storeRefA, 0) != 0 {
+					refA = make([]float64, len(pkt.Samples))
+					copy(refA, pkt.Samples)
+					refAGrid = analysis.ConfigGrid(config, len(refA))
+				}
+				showDiff := atomic.LoadUint32(&diffRefA) != 0 && refA != nil
 
 				if err := termbox.Clear(termbox.ColorWhite, termbox.ColorBlack); err != nil {
-					log.Fatal(err)
+					return err
 				}
 				width, height := termbox.Size()
 				top := 1
@@ -410,31 +785,47 @@ func main() {
 				}
 				termbox.SetCell(left-1, bottom, '+', termbox.ColorWhite, termbox.ColorBlack)
 
+				ampTop, ampBottom := config.AmpTopDBM, config.AmpBottomDBM
+				samples := pkt.Samples
+				maxSamples := traces.Trace(trace.MaxHold)
+				if showDiff {
+					ampTop, ampBottom = diffRangeDB, -diffRangeDB
+					ref := analysis.Resample(refAGrid, refA, analysis.ConfigGrid(config, len(pkt.Samples)))
+					samples = analysis.Subtract(pkt.Samples, ref)
+					for i, s := range samples {
+						if math.IsNaN(s) {
+							// Outside of the reference
+							s = 0
+						}
+						samples[i] = math.Max(-diffRangeDB, math.Min(diffRangeDB, s))
+					}
+				}
 				ampToY := func(amp float64) int {
-					return top + int(float64(bottom-top)*(amp-float64(config.AmpTopDBM))/float64(config.AmpBottomDBM-config.AmpTopDBM)+0.5)
+					return top + int(float64(bottom-top)*(amp-float64(ampTop))/float64(ampBottom-ampTop)+0.5)
 				}
 				// freqToX := func(freqHZ int) int {
 				// 	return left + (freqHZ-config.StartFreqKHZ*1000+config.FreqStepHZ/2)/config.FreqStepHZ
 				// }
 
-				var channels []channel
-				if atomic.LoadUint32(&wifi24) != 0 {
-					channels = wifi24Channels
+				var channels []bands.Channel
+				band := channelBand.Load().(*bands.Band)
+				if band != nil {
+					channels = band.Channels
 				}
 
-				// if atomic.LoadUint32(&wifi24) != 0 {
-				// 	for _, cf := range wifi24Channels {
-				// 		x := freqToX(cf.centerFreqHz)
+				// if band == bands.WiFi24 {
+				// 	for _, cf := range bands.WiFi24.Channels {
+				// 		x := freqToX(cf.CenterFreqHZ)
 				// 		y := top
-				// 		putString(x, y, cf.name, termbox.ColorWhite, termbox.ColorBlack)
+				// 		putString(x, y, cf.Name, termbox.ColorWhite, termbox.ColorBlack)
 				// 		for y++; y < height-1; y++ {
 				// 			termbox.SetCell(x, y, '|', termbox.ColorWhite, termbox.ColorBlack)
 				// 		}
 				// 	}
 				// }
 
-				// for i, cf := range zigbeeChannels {
-				// 	x := freqToX(cf)
+				// for i, cf := range bands.Zigbee24.Channels {
+				// 	x := freqToX(cf.CenterFreqHZ)
 				// 	y := top
 				// 	putString(x, y, strconv.Itoa(i+1), termbox.ColorWhite, termbox.ColorBlack)
 				// 	for y++; y < height-1; y++ {
@@ -443,25 +834,61 @@ func main() {
 				// }
 
 				if len(channels) == 0 {
-					for i, s := range pkt.Samples {
+					if showDiff {
+						zeroY := ampToY(0)
+						for x := left; x < right; x++ {
+							termbox.SetCell(x, zeroY, '-', termbox.ColorWhite, termbox.ColorBlack)
+						}
+					}
+					// The persistence view replaces the sweep with how often
+					// each level was seen over the recent live sweeps.
+					showDensity := atomic.LoadUint32(&showPersistence) != 0 && !showDiff &&
+						persistence.Grid() == analysis.ConfigGrid(config, len(samples))
+					if showDensity {
+						// yToAmp is the inverse of ampToY.
+						yToAmp := func(y float64) float64 {
+							return float64(ampTop) + (y-float64(top))*float64(ampBottom-ampTop)/float64(bottom-top)
+						}
+						for i := range samples {
+							for y := top; y < bottom; y++ {
+								d := persistence.Density(i, yToAmp(float64(y)+0.5), yToAmp(float64(y)-0.5))
+								if d == 0 {
+									continue
+								}
+								ch, fg := '.', termbox.ColorBlue
+								switch {
+								case d >= 0.5:
+									ch, fg = '@', termbox.ColorRed
+								case d >= 0.2:
+									ch, fg = '*', termbox.ColorYellow
+								case d >= 0.05:
+									ch, fg = '+', termbox.ColorCyan
+								}
+								termbox.SetCell(left+i, y, ch, fg, termbox.ColorBlack)
+							}
+						}
+						putString(0, 14, fmt.Sprintf("Persistence: %d", persistence.Sweeps()), termbox.ColorWhite, termbox.ColorBlack)
+					}
+					for i, s := range samples {
 						if s > maxAmp {
 							maxAmp = s
 							maxAmpFreq = config.StartFreqKHZ*1000 + i*config.FreqStepHZ
 							maxAmpStep = i
 						}
-						y := ampToY(s)
-						if numAvg == 0 {
-							termbox.SetCell(left+i, y, '.', termbox.ColorWhite, termbox.ColorBlack)
-						} else {
-							termbox.SetCell(left+i, y, '*', termbox.ColorWhite, termbox.ColorBlack)
-						}
-						for y++; y < bottom; y++ {
-							termbox.SetCell(left+i, y, '.', termbox.ColorWhite, termbox.ColorBlack)
-						}
-						if numAvg == 0 {
-							if s > maxSamples[i] {
-								maxSamples[i] = s
+						if !showDensity {
+							y := ampToY(s)
+							if average == 0 {
+								termbox.SetCell(left+i, y, '.', termbox.ColorWhite, termbox.ColorBlack)
+							} else {
+								termbox.SetCell(left+i, y, '*', termbox.ColorWhite, termbox.ColorBlack)
+							}
+							for y++; y < bottom; y++ {
+								termbox.SetCell(left+i, y, '.', termbox.ColorWhite, termbox.ColorBlack)
 							}
+						}
+						// The max-hold is of the live span, which an
+						// older sweep from the history may not be of.
+						if average == 0 && !showDiff && len(maxSamples) == len(samples) {
 							y := ampToY(maxSamples[i])
 							termbox.SetCell(left+i, y, '#', termbox.ColorWhite, termbox.ColorBlack)
 							const r = '⎟'
@@ -479,66 +906,117 @@ func main() {
 							}
 						}
 					}
-					if atomic.LoadUint32(&vtx85ghz) != 0 {
+					if overlay := overlayBand.Load().(*bands.Band); overlay != nil {
 						var chs []string
-						for _, c := range vtx58Channels {
-							if maxAmpFreq > c.centerFreqHz-c.widthHZ/2 && maxAmpFreq < c.centerFreqHz+c.widthHZ/2 {
-								chs = append(chs, c.name)
+						for _, c := range overlay.ChannelsAt(maxAmpFreq) {
+							if !c.AllowedIn(cfg.locale) {
+								continue
 							}
+							chs = append(chs, c.Name)
 						}
 						putString(0, bottom-1, strings.Join(chs, ", "), termbox.ColorWhite, termbox.ColorBlack)
 					}
 				} else {
-					chanSums := make([]float64, len(channels))
-					chanCounts := make([]float64, len(channels))
-					for i, s := range pkt.Samples {
-						freq := config.StartFreqKHZ*1000 + i*config.FreqStepHZ
-						for i, c := range channels {
-							diff := freq - c.centerFreqHz + c.widthHZ/2
-							if diff >= 0 && diff <= c.widthHZ {
-								d := float64(diff) / float64(c.widthHZ)
-								scale := 0.42 - 0.5*math.Cos(2*math.Pi*d) + 0.08*math.Cos(4*math.Pi*d)
-								chanSums[i] += s * scale
-								chanCounts[i] += scale
-							}
-						}
-					}
+					power := analysis.ChannelPower(&rfx.SweepDataPacket{Config: config, Samples: pkt.Samples}, band, analysis.Blackman)
 					barWidth := (width - left) / len(channels)
+					if barWidth < 1 {
+						barWidth = 1
+					}
 					for i, c := range channels {
 						startX := left + i*barWidth
-						if chanCounts[i] != 0 {
-							startY := ampToY(chanSums[i] / float64(chanCounts[i]))
+						fg := termbox.ColorWhite
+						if !c.AllowedIn(cfg.locale) {
+							fg = termbox.ColorRed
+						} else if c.Highlight {
+							fg = termbox.ColorYellow
+						}
+						if power[i].Samples != 0 {
+							startY := ampToY(power[i].PowerDBM)
+							if startY < top {
+								startY = top
+							}
 							for x := startX; x < startX+barWidth; x++ {
-								termbox.SetCell(x, startY, '-', termbox.ColorWhite, termbox.ColorBlack)
+								termbox.SetCell(x, startY, '-', fg, termbox.ColorBlack)
 							}
 							for y := startY; y < bottom; y++ {
-								termbox.SetCell(startX, y, '|', termbox.ColorWhite, termbox.ColorBlack)
-								termbox.SetCell(startX+barWidth, y, '|', termbox.ColorWhite, termbox.ColorBlack)
+								termbox.SetCell(startX, y, '|', fg, termbox.ColorBlack)
+								termbox.SetCell(startX+barWidth, y, '|', fg, termbox.ColorBlack)
 							}
-							termbox.SetCell(startX, startY, '+', termbox.ColorWhite, termbox.ColorBlack)
-							termbox.SetCell(startX+barWidth, startY, '+', termbox.ColorWhite, termbox.ColorBlack)
+							termbox.SetCell(startX, startY, '+', fg, termbox.ColorBlack)
+							termbox.SetCell(startX+barWidth, startY, '+', fg, termbox.ColorBlack)
 						}
-						putString(startX+(barWidth+len(c.name))/2, bottom-1, c.name, termbox.ColorWhite, termbox.ColorBlack)
+						putString(startX+(barWidth+len(c.Name))/2, bottom-1, c.Name, fg, termbox.ColorBlack)
 					}
 				}
 
+				clicks.SetLevel(maxAmp, float64(config.AmpBottomDBM), float64(config.AmpTopDBM))
+				if clicks.Enabled() {
+					putString(0, 10, "Clicks on", termbox.ColorWhite, termbox.ColorBlack)
+				}
+				if rfe != nil {
+					if rate := rfe.SweepRate(); rate.SweepsPerSecond > 0 {
+						putString(0, 12, fmt.Sprintf("Sweeps/s: %.1f", rate.SweepsPerSecond), termbox.ColorWhite, termbox.ColorBlack)
+					}
+					if n := rfe.QueueDepth(); n > 0 {
+						putString(0, 13, fmt.Sprintf("Queued: %d", n), termbox.ColorYellow, termbox.ColorBlack)
+					}
+				}
+				if config.InputStage != rfx.InputStageDirect {
+					putString(0, 11, fmt.Sprintf("Input: %s", config.InputStage), termbox.ColorWhite, termbox.ColorBlack)
+				}
+
+				// The marker shows the interpolated peak which is finer than
+				// the step size.
+				peakFreq, peakAmp := float64(maxAmpFreq), maxAmp
+				if len(channels) == 0 && maxAmpStep < len(samples) {
+					peakFreq, peakAmp = analysis.InterpolatePeak(config, samples, maxAmpStep)
+				}
+				if numPeaks > 0 && len(channels) == 0 && !showDiff {
+					peaks := analysis.FindPeaks(&rfx.SweepDataPacket{Config: config, Samples: samples}, analysis.PeakOptions{
+						Max:          numPeaks,
+						ThresholdDB:  10,
+						MinSpacingHZ: 3 * config.FreqStepHZ,
+					})
+					for i, p := range peaks {
+						termbox.SetCell(left+p.Index, ampToY(samples[p.Index])-1, 'v', termbox.ColorWhite, termbox.ColorBlack)
+						putString(0, 15+i, strings.TrimSpace(fmt.Sprintf("%.4f %.1f %.0fk %s", p.FreqHZ/1000000.0, p.LevelDBM, p.BandwidthHZ/1000,
+							cfg.stationAt(int(p.FreqHZ)))), termbox.ColorWhite, termbox.ColorBlack)
+					}
+				}
 				y := ampToY(maxAmp)
 				termbox.SetCell(left+maxAmpStep, y-1, 'V', termbox.ColorWhite, termbox.ColorBlack)
-				putString(left+maxAmpStep-2, y-3, fmt.Sprintf("%.3f", float64(maxAmpFreq)/1000000.0),
+				putString(left+maxAmpStep-2, y-3, fmt.Sprintf("%.4f", peakFreq/1000000.0),
 					termbox.ColorWhite, termbox.ColorBlack)
-				putString(left+maxAmpStep-2, y-2, fmt.Sprintf("%.1f", maxAmp),
+				putString(left+maxAmpStep-2, y-2, fmt.Sprintf("%.1f", peakAmp),
 					termbox.ColorWhite, termbox.ColorBlack)
+				if name := cfg.stationAt(int(peakFreq)); name != "" {
+					putString(left+maxAmpStep-2, y-4, name, termbox.ColorWhite, termbox.ColorBlack)
+				}
 				putString(0, 0, fmt.Sprintf("CalcMode: %s", config.CalculatorMode), termbox.ColorWhite, termbox.ColorBlack)
 				putString(0, 1, fmt.Sprintf("MaxSpan: %d", config.MaxSpan), termbox.ColorWhite, termbox.ColorBlack)
 				putString(0, 2, fmt.Sprintf("MinFreq: %.3f", float64(config.MinFreqKHZ)/1000.0), termbox.ColorWhite, termbox.ColorBlack)
 				putString(0, 3, fmt.Sprintf("MaxFreq: %.3f", float64(config.MaxFreqKHZ)/1000.0), termbox.ColorWhite, termbox.ColorBlack)
 				putString(0, 4, fmt.Sprintf("SweepSteps: %d", config.SweepSteps), termbox.ColorWhite, termbox.ColorBlack)
 				putString(0, 5, fmt.Sprintf("RBW: %d khz", config.RBWKHZ), termbox.ColorWhite, termbox.ColorBlack)
+				if showDiff {
+					putString(0, 6, "Live - A", termbox.ColorWhite, termbox.ColorBlack)
+				} else if refA != nil {
+					putString(0, 6, "Ref A stored", termbox.ColorWhite, termbox.ColorBlack)
+				}
+				if band != nil {
+					putString(0, 8, band.Description, termbox.ColorWhite, termbox.ColorBlack)
+				}
+				if overlay := overlayBand.Load().(*bands.Band); overlay != nil {
+					putString(0, 9, "Overlay: "+overlay.Description, termbox.ColorWhite, termbox.ColorBlack)
+				}
+				if cursor > 0 {
+					putString(0, 7, fmt.Sprintf("History -%d %s", cursor, viewing.t.Format("15:04:05.000")), termbox.ColorWhite, termbox.ColorBlack)
+				}
 
 				// Amplitude labels
-				s := strconv.Itoa(config.AmpTopDBM)
+				s := strconv.Itoa(ampTop)
 				putString(left-len(s)-1, top, s, termbox.ColorWhite, termbox.ColorBlack)
-				s = strconv.Itoa(config.AmpBottomDBM)
+				s = strconv.Itoa(ampBottom)
 				putString(left-len(s)-1, bottom-1, s, termbox.ColorWhite, termbox.ColorBlack)
 
 				// Frequency labels
@@ -549,7 +1027,7 @@ func main() {
 				putString(left+(right-left)/2-len(s)/2, bottom+1, s, termbox.ColorWhite, termbox.ColorBlack)
 
 				if err := termbox.Flush(); err != nil {
-					log.Fatal(err)
+					return err
 				}
 			case *rfx.ScreenImage:
 				const top = '▀'
@@ -574,22 +1052,81 @@ func main() {
 						}
 					}
 				}
+				pkt.Release()
 				if err := termbox.Flush(); err != nil {
-					log.Fatal(err)
+					return err
 				}
 			// case *rfx.CalibrationAvailabilityPacket:
 			// case *rfx.SerialNumberPacket:
 			// case *rfx.CurrentSetupPacket:
 			case *rfx.UnhandledPacket:
 				fmt.Fprintf(logFile, "%s\n", hex.Dump(pkt.Data))
+			case *rfx.ParseErrorPacket:
+				fmt.Fprintf(logFile, "%s\n%s\n", pkt.Err, hex.Dump(pkt.Data))
 			default:
 				fmt.Fprintf(logFile, "%#+v\n", pkt)
 			}
 		case sig := <-ch:
 			fmt.Printf("Quitting due to signal %s", sig)
-			return
+			return nil
+		case err := <-errs:
+			return err
+		case err := <-keyErr:
+			return err
+		}
+	}
+}
+
+// sourcePackets returns the sweeps of a source other than an RF Explorer as
+// the packets an RF Explorer would send, with a config packet whenever the
+// config changes, and a channel that reports the source failing. The sweeps
+// stop when stop is closed.
+func sourcePackets(src rfx.SpectrumSource, stop <-chan struct{}) (<-chan rfx.Packet, <-chan error) {
+	packets := make(chan rfx.Packet)
+	errs := make(chan error, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-stop
+		cancel()
+	}()
+	go func() {
+		var config *rfx.CurrentConfigPacket
+		err := src.Sweeps(ctx, func(s *rfx.Sweep) {
+			var pkts []rfx.Packet
+			if config == nil || *s.Config != *config {
+				config = s.Config
+				pkts = append(pkts, config)
+			}
+			pkts = append(pkts, &rfx.SweepDataPacket{Time: s.Time, Config: s.Config, Samples: append([]float64(nil), s.Samples...)})
+			for _, pkt := range pkts {
+				select {
+				case packets <- pkt:
+				case <-ctx.Done():
+					return
+				}
+			}
+		})
+		if err != nil {
+			errs <- err
+		}
+	}()
+	return packets, errs
+}
+
+// nextBand returns the band following cur in the list of bands that apply in
+// the locale, or nil after the last one, so that repeatedly selecting the
+// next band cycles through all bands and then off.
+func nextBand(cur *bands.Band, locale bands.Locale) *bands.Band {
+	all := bands.AllIn(locale)
+	if cur == nil {
+		return all[0]
+	}
+	for i, b := range all {
+		if b == cur && i+1 < len(all) {
+			return all[i+1]
 		}
 	}
+	return nil
 }
 
 func putString(x, y int, s string, fg, bg termbox.Attribute) {
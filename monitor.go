@@ -0,0 +1,603 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/samuel/rfexplorer/rfx"
+	"github.com/samuel/rfexplorer/rfx/aggregate"
+	"github.com/samuel/rfexplorer/rfx/alert"
+	"github.com/samuel/rfexplorer/rfx/analysis"
+	"github.com/samuel/rfexplorer/rfx/auth"
+	"github.com/samuel/rfexplorer/rfx/mask"
+	"github.com/samuel/rfexplorer/rfx/store"
+)
+
+// monitorRetryDelay is how long the monitor waits before scanning again
+// after the source fails.
+const monitorRetryDelay = 5 * time.Second
+
+// monitorConfig is the configuration of an unattended monitor. It's read
+// from a file of "name = value" lines like the config file:
+//
+//	# Bands are scanned in turn, each for the dwell time. A band can
+//	# have its own limit in dBm after the range.
+//	band = 2400-2500
+//	band = 5725-5875 -70
+//	dwell = 10s
+//	# Limit in dBm for bands without their own.
+//	limit = -60
+//	# Sweeps used to learn each band's baseline, 0 disables the baseline.
+//	baseline-sweeps = 20
+//	# dB above the baseline that triggers an event.
+//	baseline-margin = 10
+//	# Limit line to check every band against, a CSV file of freq_mhz and
+//	# limit_dbm points (see rfx/mask). Each mask raises its own events,
+//	# named after the file.
+//	mask = fcc15-class-b.csv
+//	# Alert when any level in a range in MHz is above a level in dBm,
+//	# optionally only once it has been for a while (see rfx/alert).
+//	alert = 5725-5875 > -60 for 2s
+//	# POST alerts as JSON to these URLs, such as a Slack incoming
+//	# webhook, retrying failures this many times with backoff.
+//	webhook = https://hooks.slack.com/services/T000/B000/XXXX
+//	webhook-retries = 5
+//	# Record the sweeps of each band under this directory.
+//	record = /var/lib/rfexplorer
+//	# Command run with sh for each event, which is written to its stdin.
+//	# Events are run in order in the background, each for up to 30s.
+//	notify = mail -s rfexplorer ops@example.com
+//	# Send sweeps and events to an aggregator (see -aggregate) as this
+//	# node, which defaults to the host name.
+//	aggregator = http://aggregator.example.com:8080
+//	node = roof-north
+//	location = Building A roof, north side
+//	# Position of the node as latitude,longitude, which lets the
+//	# aggregator estimate where emitters seen by several nodes are.
+//	position = 47.6205,-122.3493
+//	# Credentials for an aggregator that requires them: an API token
+//	# and/or a client certificate, and the CA of the aggregator's
+//	# certificate if it's not in the system roots.
+//	aggregator-token = 6f1e...
+//	aggregator-ca = ca.pem
+//	aggregator-cert = node.pem
+//	aggregator-key = node-key.pem
+type monitorConfig struct {
+	bands            []*monitorBand
+	dwell            time.Duration
+	limitDBM         float64 // NaN for no limit
+	baselineSweeps   int
+	baselineMarginDB float64
+	masks            []*mask.Mask
+	alerts           *alert.Engine
+	webhook          alert.Webhook
+	recordDir        string
+	notify           string
+	// notifications are the events waiting for the notify command.
+	notifications chan *monitorEvent
+	aggregator    *aggregate.Client
+	// aggregatorCA, aggregatorCert, and aggregatorKey configure TLS for
+	// the aggregator client.
+	aggregatorCA   string
+	aggregatorCert string
+	aggregatorKey  string
+}
+
+// monitorBand is a band scanned by the monitor and its state.
+type monitorBand struct {
+	name          string
+	lowHZ, highHZ int
+	limitDBM      float64 // NaN to use the config limit
+
+	grid      analysis.Grid
+	baseline  []float64
+	baselineN int
+	store     *store.Store
+	// active is the kinds of events that have been raised and not yet
+	// cleared, so that an ongoing event is only reported once.
+	active map[string]bool
+}
+
+// monitorEvent is raised when a band goes over its limit or baseline and
+// again when it clears.
+type monitorEvent struct {
+	Time         time.Time
+	Band         string
+	Kind         string // "limit", "baseline", "<name> mask", or "alert <rule>"
+	Cleared      bool
+	FreqHZ       int
+	LevelDBM     float64
+	ThresholdDBM float64
+}
+
+func (e *monitorEvent) String() string {
+	if e.Cleared {
+		return fmt.Sprintf("%s %s MHz: %s cleared", e.Time.Format(time.RFC3339), e.Band, e.Kind)
+	}
+	return fmt.Sprintf("%s %s MHz: %.1f dBm at %.3f MHz is over the %s of %.1f dBm",
+		e.Time.Format(time.RFC3339), e.Band, e.LevelDBM, float64(e.FreqHZ)/1e6, e.Kind, e.ThresholdDBM)
+}
+
+func loadMonitorConfig(path string) (*monitorConfig, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	cfg, err := parseMonitorConfig(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return cfg, nil
+}
+
+func parseMonitorConfig(r io.Reader) (*monitorConfig, error) {
+	cfg := &monitorConfig{
+		dwell:            10 * time.Second,
+		limitDBM:         math.NaN(),
+		baselineSweeps:   20,
+		baselineMarginDB: 10,
+		alerts:           alert.NewEngine(),
+	}
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		idx := strings.IndexByte(line, '=')
+		if idx < 0 {
+			return nil, fmt.Errorf("line %d: expected name = value", lineNo)
+		}
+		name := strings.TrimSpace(line[:idx])
+		value := strings.TrimSpace(line[idx+1:])
+		if err := cfg.set(name, value); err != nil {
+			return nil, fmt.Errorf("line %d: %s", lineNo, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(cfg.bands) == 0 {
+		return nil, fmt.Errorf("no bands to monitor")
+	}
+	if a := cfg.aggregator; a != nil {
+		if a.URL == "" {
+			return nil, fmt.Errorf("node, location, and position need an aggregator")
+		}
+		if a.Node == "" {
+			a.Node, _ = os.Hostname()
+		}
+		if cfg.aggregatorCA != "" || cfg.aggregatorCert != "" {
+			tlsConfig, err := auth.ClientTLSConfig(cfg.aggregatorCA, cfg.aggregatorCert, cfg.aggregatorKey)
+			if err != nil {
+				return nil, err
+			}
+			a.HTTPClient = &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+		}
+	}
+	return cfg, nil
+}
+
+func (c *monitorConfig) set(name, value string) error {
+	var err error
+	switch name {
+	case "band":
+		fields := strings.Fields(value)
+		if len(fields) == 0 || len(fields) > 2 {
+			return fmt.Errorf("invalid band %q, expected low-high in MHz and an optional limit", value)
+		}
+		b := &monitorBand{name: fields[0], limitDBM: math.NaN(), active: make(map[string]bool)}
+		if b.lowHZ, b.highHZ, err = parseMHzRange(fields[0]); err != nil {
+			return err
+		}
+		if len(fields) == 2 {
+			if b.limitDBM, err = strconv.ParseFloat(fields[1], 64); err != nil {
+				return fmt.Errorf("invalid limit %q", fields[1])
+			}
+		}
+		c.bands = append(c.bands, b)
+	case "dwell":
+		if c.dwell, err = time.ParseDuration(value); err != nil || c.dwell <= 0 {
+			return fmt.Errorf("invalid dwell %q", value)
+		}
+	case "limit":
+		if c.limitDBM, err = strconv.ParseFloat(value, 64); err != nil {
+			return fmt.Errorf("invalid limit %q", value)
+		}
+	case "baseline-sweeps":
+		if c.baselineSweeps, err = strconv.Atoi(value); err != nil || c.baselineSweeps < 0 {
+			return fmt.Errorf("invalid baseline-sweeps %q", value)
+		}
+	case "baseline-margin":
+		if c.baselineMarginDB, err = strconv.ParseFloat(value, 64); err != nil {
+			return fmt.Errorf("invalid baseline-margin %q", value)
+		}
+	case "mask":
+		f, err := os.Open(value)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		name := strings.TrimSuffix(filepath.Base(value), filepath.Ext(value))
+		m, err := mask.ReadCSV(name, f)
+		if err != nil {
+			return fmt.Errorf("%s: %s", value, err)
+		}
+		c.masks = append(c.masks, m)
+	case "alert":
+		r, err := alert.ParseRule(value)
+		if err != nil {
+			return err
+		}
+		return c.alerts.Add(r)
+	case "webhook":
+		c.webhook.URLs = append(c.webhook.URLs, value)
+	case "webhook-retries":
+		if c.webhook.Retries, err = strconv.Atoi(value); err != nil || c.webhook.Retries < 0 {
+			return fmt.Errorf("invalid webhook-retries %q", value)
+		}
+		if c.webhook.Retries == 0 {
+			c.webhook.Retries = -1
+		}
+	case "record":
+		c.recordDir = value
+	case "notify":
+		c.notify = value
+	case "aggregator":
+		c.client().URL = value
+	case "node":
+		c.client().Node = value
+	case "location":
+		c.client().Location = value
+	case "aggregator-token":
+		c.client().Token = value
+	case "aggregator-ca":
+		c.aggregatorCA = value
+	case "aggregator-cert":
+		c.aggregatorCert = value
+	case "aggregator-key":
+		c.aggregatorKey = value
+	case "position":
+		a := c.client()
+		parts := strings.Split(value, ",")
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid position %q, expected latitude,longitude", value)
+		}
+		if a.Lat, err = strconv.ParseFloat(strings.TrimSpace(parts[0]), 64); err != nil {
+			return fmt.Errorf("invalid position %q, expected latitude,longitude", value)
+		}
+		if a.Lon, err = strconv.ParseFloat(strings.TrimSpace(parts[1]), 64); err != nil {
+			return fmt.Errorf("invalid position %q, expected latitude,longitude", value)
+		}
+	default:
+		return fmt.Errorf("unknown setting %q", name)
+	}
+	return nil
+}
+
+// client returns the aggregator client, creating it if necessary.
+func (c *monitorConfig) client() *aggregate.Client {
+	if c.aggregator == nil {
+		c.aggregator = &aggregate.Client{}
+	}
+	return c.aggregator
+}
+
+// check compares a sweep of the band against its limit and baseline and
+// returns the events raised or cleared by it.
+func (c *monitorConfig) check(b *monitorBand, sw *rfx.Sweep) []*monitorEvent {
+	grid := analysis.ConfigGrid(sw.Config, len(sw.Samples))
+	var events []*monitorEvent
+	update := func(kind string, over bool, i int, threshold float64) {
+		switch {
+		case over && !b.active[kind]:
+			b.active[kind] = true
+			events = append(events, &monitorEvent{
+				Time: sw.Time, Band: b.name, Kind: kind,
+				FreqHZ: grid.FreqHZ(i), LevelDBM: sw.Samples[i], ThresholdDBM: threshold,
+			})
+		case !over && b.active[kind]:
+			b.active[kind] = false
+			events = append(events, &monitorEvent{Time: sw.Time, Band: b.name, Kind: kind, Cleared: true})
+		}
+	}
+
+	limit := b.limitDBM
+	if math.IsNaN(limit) {
+		limit = c.limitDBM
+	}
+	if !math.IsNaN(limit) {
+		worst := 0
+		for i, v := range sw.Samples {
+			if v > sw.Samples[worst] {
+				worst = i
+			}
+		}
+		update("limit", sw.Samples[worst] > limit, worst, limit)
+	}
+	for _, m := range c.masks {
+		var worst mask.Violation
+		vs := m.Check(sw)
+		for _, v := range vs {
+			if v.MarginDB < worst.MarginDB {
+				worst = v
+			}
+		}
+		update(m.Name+" mask", len(vs) != 0, worst.Index, worst.LimitDBM)
+	}
+
+	if c.baselineSweeps == 0 {
+		return events
+	}
+	if b.baselineN < c.baselineSweeps {
+		// Learn the baseline as the max-hold of the first sweeps.
+		if b.baseline == nil {
+			b.grid = grid
+			b.baseline = append([]float64(nil), sw.Samples...)
+		}
+		samples := analysis.Resample(grid, sw.Samples, b.grid)
+		for i, v := range samples {
+			if v > b.baseline[i] {
+				b.baseline[i] = v
+			}
+		}
+		b.baselineN++
+		return events
+	}
+	samples := analysis.Resample(grid, sw.Samples, b.grid)
+	worst, worstDB := -1, 0.0
+	for i, v := range samples {
+		if d := v - b.baseline[i] - c.baselineMarginDB; !math.IsNaN(d) && (worst < 0 || d > worstDB) {
+			worst, worstDB = i, d
+		}
+	}
+	if worst >= 0 {
+		// Report the level at the frequency of the original sweep closest
+		// to where the baseline was exceeded.
+		i := int(math.Round(float64(b.grid.FreqHZ(worst)-grid.StartFreqHZ) / float64(grid.StepHZ)))
+		if i < 0 {
+			i = 0
+		} else if i >= len(sw.Samples) {
+			i = len(sw.Samples) - 1
+		}
+		update("baseline", worstDB > 0, i, b.baseline[worst]+c.baselineMarginDB)
+	}
+	return events
+}
+
+// notifyEvent logs an event, queues it for the aggregator, and runs the
+// notify command with it.
+func (c *monitorConfig) notifyEvent(e *monitorEvent, up *uploader) {
+	log.Print(e)
+	up.send(&aggregate.Event{
+		Time: e.Time, Band: e.Band, Kind: e.Kind, Cleared: e.Cleared,
+		FreqHZ: e.FreqHZ, LevelDBM: e.LevelDBM, ThresholdDBM: e.ThresholdDBM,
+		Text: e.String(),
+	})
+	if c.notifications == nil {
+		return
+	}
+	select {
+	case c.notifications <- e:
+	default:
+		log.Printf("monitor: notify queue is full, dropped %s", e)
+	}
+}
+
+// notifyQueueSize is the number of events that may wait for the notify
+// command before further ones are dropped.
+const notifyQueueSize = 64
+
+// notifyTimeout is how long the notify command may run for an event
+// before it's killed.
+const notifyTimeout = 30 * time.Second
+
+// runNotify runs the notify command for events in order until ctx is done.
+func (c *monitorConfig) runNotify(ctx context.Context, events <-chan *monitorEvent) {
+	for {
+		select {
+		case e := <-events:
+			nctx, cancel := context.WithTimeout(ctx, notifyTimeout)
+			cmd := exec.CommandContext(nctx, "sh", "-c", c.notify)
+			cmd.Stdin = strings.NewReader(e.String() + "\n")
+			// Don't wait for the output of processes the command left
+			// running once it's killed.
+			cmd.WaitDelay = time.Second
+			if out, err := cmd.CombinedOutput(); err != nil {
+				log.Printf("monitor: notify failed: %s: %s", err, out)
+			}
+			cancel()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// runMonitor scans the bands of a monitor config in turn until interrupted,
+// checking each sweep against the limits and baselines, recording it, and
+// notifying about events. Failures of the source are logged and the scan
+// retried so that the monitor can be left unattended.
+func runMonitor(src rfx.SpectrumSource, path string) error {
+	cfg, err := loadMonitorConfig(path)
+	if err != nil {
+		return err
+	}
+	if cfg.recordDir != "" {
+		for _, b := range cfg.bands {
+			s, err := store.Open(filepath.Join(cfg.recordDir, b.name), store.DefaultPolicy)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+			b.store = s
+		}
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if cfg.notify != "" {
+		// Run in the background like webhooks so that a slow command
+		// doesn't hold up the scan.
+		cfg.notifications = make(chan *monitorEvent, notifyQueueSize)
+		go cfg.runNotify(ctx, cfg.notifications)
+	}
+	var up *uploader
+	if cfg.aggregator != nil {
+		up = &uploader{client: cfg.aggregator, ch: make(chan interface{}, 256)}
+		go up.run(ctx)
+	}
+	if len(cfg.webhook.URLs) != 0 {
+		if sn, ok := src.(interface {
+			SerialNumber(context.Context) (string, error)
+		}); ok {
+			sctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			cfg.webhook.Serial, err = sn.SerialNumber(sctx)
+			cancel()
+			if err != nil {
+				log.Printf("monitor: failed to get the serial number for webhooks: %s", err)
+			}
+		}
+		// Posted in the background so that retries don't hold up the scan,
+		// one at a time so that they're posted in order.
+		events := make(chan alert.Event, webhookQueueSize)
+		go cfg.postWebhooks(ctx, events)
+		cfg.alerts.OnEvent(func(e alert.Event) {
+			select {
+			case events <- e:
+			default:
+				log.Printf("monitor: webhook queue is full, dropped %s", e)
+			}
+		})
+	}
+
+	fmt.Printf("Monitoring %d bands, interrupt to stop\n", len(cfg.bands))
+	for ctx.Err() == nil {
+		for _, b := range cfg.bands {
+			if ctx.Err() != nil {
+				break
+			}
+			if err := cfg.scanBand(ctx, src, b, up); err != nil {
+				log.Printf("monitor: %s MHz: %s, retrying in %s", b.name, err, monitorRetryDelay)
+				select {
+				case <-time.After(monitorRetryDelay):
+				case <-ctx.Done():
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// webhookQueueSize is the number of alert events that may wait to be posted
+// to the webhooks before further ones are dropped.
+const webhookQueueSize = 64
+
+// postWebhooks posts events to the webhooks in order until ctx is done.
+func (c *monitorConfig) postWebhooks(ctx context.Context, events <-chan alert.Event) {
+	for {
+		select {
+		case e := <-events:
+			if err := c.webhook.Send(ctx, e); err != nil {
+				log.Printf("monitor: %s", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// scanBand scans a band for the dwell time.
+func (c *monitorConfig) scanBand(ctx context.Context, src rfx.SpectrumSource, b *monitorBand, up *uploader) error {
+	ctx, cancel := context.WithTimeout(ctx, c.dwell)
+	defer cancel()
+	if err := src.Configure(b.lowHZ/1000, b.highHZ/1000); err != nil {
+		return err
+	}
+	var recordErr error
+	err := src.Sweeps(ctx, func(sw *rfx.Sweep) {
+		for _, e := range c.check(b, sw) {
+			c.notifyEvent(e, up)
+		}
+		for _, e := range c.alerts.Check(sw) {
+			c.notifyEvent(&monitorEvent{
+				Time: e.Time, Band: b.name, Kind: "alert " + e.Rule.Name, Cleared: e.Cleared,
+				FreqHZ: e.FreqHZ, LevelDBM: e.LevelDBM, ThresholdDBM: e.Rule.ThresholdDBM,
+			}, up)
+		}
+		up.send(&aggregate.Sweep{
+			Time:        sw.Time,
+			StartFreqHZ: sw.Config.StartFreqKHZ * 1000,
+			StepHZ:      sw.Config.FreqStepHZ,
+			Samples:     sw.Samples,
+		})
+		if b.store != nil && recordErr == nil {
+			recordErr = b.store.Add(sw.Time, sw.Config, sw.Samples)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return recordErr
+}
+
+// uploader sends reports to an aggregator in the background so that a slow
+// or unreachable aggregator doesn't hold up the scan. Reports are dropped
+// if the queue is full.
+type uploader struct {
+	client *aggregate.Client
+	ch     chan interface{}
+	failed bool
+}
+
+// send queues a report. It does nothing on a nil uploader.
+func (u *uploader) send(v interface{}) {
+	if u == nil {
+		return
+	}
+	select {
+	case u.ch <- v:
+	default:
+	}
+}
+
+func (u *uploader) run(ctx context.Context) {
+	for {
+		select {
+		case v := <-u.ch:
+			sctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+			var err error
+			switch v := v.(type) {
+			case *aggregate.Sweep:
+				err = u.client.SendSweep(sctx, v)
+			case *aggregate.Event:
+				err = u.client.SendEvent(sctx, v)
+			}
+			cancel()
+			// Only log changes so that an aggregator that's down doesn't
+			// flood the log.
+			if err != nil && !u.failed {
+				log.Printf("monitor: failed to send to aggregator: %s", err)
+			} else if err == nil && u.failed {
+				log.Printf("monitor: aggregator is reachable again")
+			}
+			u.failed = err != nil
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,426 @@
+// Package aggregate collects sweeps and events from many remote monitoring
+// nodes in one place, stores them tagged by node, and serves a combined
+// query API and dashboard.
+//
+// Nodes send reports as JSON with POST requests:
+//
+//	POST /api/sweeps   a Sweep
+//	POST /api/events   an Event
+//
+// and the combined data is queried with GET requests:
+//
+//	GET /api/nodes                  all nodes with their latest status
+//	GET /api/events?node=<name>     recent events, optionally of one node
+//	GET /api/sweeps/latest?node=<name>
+//	GET /api/locate?freq=<Hz>       where an emitter is, see Locate
+//	GET /                           an HTML dashboard
+//
+// Sweeps are recorded under the server's directory with one store per node,
+// see package store, and recent events are appended to events.jsonl.
+//
+// The server doesn't authenticate anything itself. Wrap it with an
+// auth.Authenticator to require tokens or client certificates, in which
+// case nodes need the control role to send reports.
+package aggregate
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/samuel/rfexplorer/rfx"
+	"github.com/samuel/rfexplorer/rfx/analysis"
+	"github.com/samuel/rfexplorer/rfx/store"
+)
+
+const (
+	// maxEvents is the number of recent events kept in memory for queries.
+	maxEvents = 1000
+	// locateWindow is how recent a node's latest sweep must be to be used
+	// to locate an emitter.
+	locateWindow = time.Minute
+	// maxSweepBytes and maxEventBytes limit the size of reports, enough for
+	// a sweep of 65536 points and an event with a long text.
+	maxSweepBytes = 4 << 20
+	maxEventBytes = 64 << 10
+)
+
+// Sweep is a sweep reported by a node.
+type Sweep struct {
+	Node        string    `json:"node"`
+	Location    string    `json:"location,omitempty"`
+	Lat         float64   `json:"lat,omitempty"`
+	Lon         float64   `json:"lon,omitempty"`
+	Time        time.Time `json:"time"`
+	StartFreqHZ int       `json:"startFreqHz"`
+	StepHZ      int       `json:"stepHz"`
+	Samples     []float64 `json:"samples"`
+}
+
+// Event is something of note reported by a node, such as a band going over
+// its limit.
+type Event struct {
+	Node         string    `json:"node"`
+	Location     string    `json:"location,omitempty"`
+	Lat          float64   `json:"lat,omitempty"`
+	Lon          float64   `json:"lon,omitempty"`
+	Time         time.Time `json:"time"`
+	Band         string    `json:"band,omitempty"`
+	Kind         string    `json:"kind"`
+	Cleared      bool      `json:"cleared,omitempty"`
+	FreqHZ       int       `json:"freqHz,omitempty"`
+	LevelDBM     float64   `json:"levelDbm,omitempty"`
+	ThresholdDBM float64   `json:"thresholdDbm,omitempty"`
+	Text         string    `json:"text,omitempty"`
+	// Estimate is where the emitter that caused the event probably is,
+	// filled in by the server if enough positioned nodes can see it.
+	Estimate *analysis.LocationEstimate `json:"estimate,omitempty"`
+}
+
+// Node is the status of a node.
+type Node struct {
+	Name     string `json:"name"`
+	Location string `json:"location,omitempty"`
+	// Lat and Lon are the position of the node, zero if it isn't known.
+	Lat      float64   `json:"lat,omitempty"`
+	Lon      float64   `json:"lon,omitempty"`
+	LastSeen time.Time `json:"lastSeen"`
+	Sweeps   int       `json:"sweeps"`
+	Events   int       `json:"events"`
+	// PeakFreqHZ and PeakDBM are the strongest signal in the latest sweep.
+	PeakFreqHZ int     `json:"peakFreqHz"`
+	PeakDBM    float64 `json:"peakDbm"`
+}
+
+// validNode matches node names that are safe to use as directory names.
+var validNode = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Server receives reports from nodes and serves the combined data. It
+// implements http.Handler.
+type Server struct {
+	dir    string
+	policy store.Policy
+	mux    *http.ServeMux
+
+	mu       sync.Mutex
+	nodes    map[string]*Node
+	latest   map[string]*Sweep
+	stores   map[string]*store.Store
+	events   []*Event
+	eventLog *os.File
+}
+
+// NewServer returns a server that records to dir with the given retention
+// policy.
+func NewServer(dir string, policy store.Policy) (*Server, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(filepath.Join(dir, "events.jsonl"), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		dir:      dir,
+		policy:   policy,
+		mux:      http.NewServeMux(),
+		nodes:    make(map[string]*Node),
+		latest:   make(map[string]*Sweep),
+		stores:   make(map[string]*store.Store),
+		eventLog: f,
+	}
+	s.mux.HandleFunc("/api/sweeps", s.handleSweeps)
+	s.mux.HandleFunc("/api/sweeps/latest", s.handleLatest)
+	s.mux.HandleFunc("/api/events", s.handleEvents)
+	s.mux.HandleFunc("/api/nodes", s.handleNodes)
+	s.mux.HandleFunc("/api/locate", s.handleLocate)
+	s.mux.HandleFunc("/", s.handleDashboard)
+	return s, nil
+}
+
+// Close closes the stores and event log.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.eventLog.Close()
+	for _, st := range s.stores {
+		if e := st.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// node returns the status of a node, creating it if it's new. s.mu must be
+// held.
+func (s *Server) node(name, location string, lat, lon float64, t time.Time) *Node {
+	n := s.nodes[name]
+	if n == nil {
+		n = &Node{Name: name}
+		s.nodes[name] = n
+	}
+	if location != "" {
+		n.Location = location
+	}
+	if lat != 0 || lon != 0 {
+		n.Lat, n.Lon = lat, lon
+	}
+	if t.After(n.LastSeen) {
+		n.LastSeen = t
+	}
+	return n
+}
+
+// AddSweep records a sweep from a node.
+func (s *Server) AddSweep(sw *Sweep) error {
+	if !validNode.MatchString(sw.Node) {
+		return fmt.Errorf("aggregate: invalid node name %q", sw.Node)
+	}
+	if len(sw.Samples) == 0 || sw.StepHZ <= 0 {
+		return fmt.Errorf("aggregate: sweep has no samples")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.stores[sw.Node]
+	if st == nil {
+		var err error
+		st, err = store.Open(filepath.Join(s.dir, sw.Node), s.policy)
+		if err != nil {
+			return err
+		}
+		s.stores[sw.Node] = st
+	}
+	config := &rfx.CurrentConfigPacket{StartFreqKHZ: sw.StartFreqHZ / 1000, FreqStepHZ: sw.StepHZ}
+	if err := st.Add(sw.Time, config, sw.Samples); err != nil {
+		return err
+	}
+	n := s.node(sw.Node, sw.Location, sw.Lat, sw.Lon, sw.Time)
+	n.Sweeps++
+	n.PeakDBM = sw.Samples[0]
+	n.PeakFreqHZ = sw.StartFreqHZ
+	for i, v := range sw.Samples {
+		if v > n.PeakDBM {
+			n.PeakDBM = v
+			n.PeakFreqHZ = sw.StartFreqHZ + i*sw.StepHZ
+		}
+	}
+	s.latest[sw.Node] = sw
+	return nil
+}
+
+// AddEvent records an event from a node.
+func (s *Server) AddEvent(e *Event) error {
+	if !validNode.MatchString(e.Node) {
+		return fmt.Errorf("aggregate: invalid node name %q", e.Node)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.node(e.Node, e.Location, e.Lat, e.Lon, e.Time).Events++
+	if !e.Cleared && e.FreqHZ > 0 && e.Estimate == nil {
+		e.Estimate, _, _ = s.locate(e.FreqHZ, e.Time)
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if _, err := s.eventLog.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	s.events = append(s.events, e)
+	if len(s.events) > maxEvents {
+		s.events = append(s.events[:0], s.events[len(s.events)-maxEvents:]...)
+	}
+	return nil
+}
+
+// Locate estimates the position of an emitter on freqHZ from the latest
+// sweeps of the positioned nodes that are within a minute of t, and returns
+// the levels used. See analysis.Localize.
+func (s *Server) Locate(freqHZ int, t time.Time) (*analysis.LocationEstimate, []analysis.NodeLevel, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.locate(freqHZ, t)
+}
+
+// locate is Locate with s.mu held.
+func (s *Server) locate(freqHZ int, t time.Time) (*analysis.LocationEstimate, []analysis.NodeLevel, error) {
+	var levels []analysis.NodeLevel
+	for name, sw := range s.latest {
+		n := s.nodes[name]
+		if n.Lat == 0 && n.Lon == 0 {
+			continue
+		}
+		if d := t.Sub(sw.Time); d > locateWindow || d < -locateWindow {
+			continue
+		}
+		i := int(math.Round(float64(freqHZ-sw.StartFreqHZ) / float64(sw.StepHZ)))
+		if i < 0 || i >= len(sw.Samples) {
+			continue
+		}
+		// Nodes may sweep with different steps so take the strongest of the
+		// neighbouring samples too.
+		level := sw.Samples[i]
+		for _, j := range []int{i - 1, i + 1} {
+			if j >= 0 && j < len(sw.Samples) && sw.Samples[j] > level {
+				level = sw.Samples[j]
+			}
+		}
+		levels = append(levels, analysis.NodeLevel{Node: name, Lat: n.Lat, Lon: n.Lon, LevelDBM: level})
+	}
+	sort.Slice(levels, func(i, j int) bool { return levels[i].Node < levels[j].Node })
+	est, err := analysis.Localize(levels, analysis.DefaultPathLossExponent)
+	return est, levels, err
+}
+
+// Nodes returns the status of all nodes sorted by name.
+func (s *Server) Nodes() []Node {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	nodes := make([]Node, 0, len(s.nodes))
+	for _, n := range s.nodes {
+		nodes = append(nodes, *n)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Name < nodes[j].Name })
+	return nodes
+}
+
+// Events returns the recent events, newest first, of the given node or of
+// all nodes if node is empty.
+func (s *Server) Events(node string) []*Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var events []*Event
+	for i := len(s.events) - 1; i >= 0; i-- {
+		if node == "" || s.events[i].Node == node {
+			events = append(events, s.events[i])
+		}
+	}
+	return events
+}
+
+func (s *Server) handleSweeps(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var sw Sweep
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSweepBytes)).Decode(&sw); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if sw.Time.IsZero() {
+		sw.Time = time.Now()
+	}
+	if err := s.AddSweep(&sw); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, s.Events(r.FormValue("node")))
+	case http.MethodPost:
+		var e Event
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxEventBytes)).Decode(&e); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if e.Time.IsZero() {
+			e.Time = time.Now()
+		}
+		if err := s.AddEvent(&e); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) handleLatest(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	sw := s.latest[r.FormValue("node")]
+	s.mu.Unlock()
+	if sw == nil {
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, sw)
+}
+
+func (s *Server) handleNodes(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, s.Nodes())
+}
+
+func (s *Server) handleLocate(w http.ResponseWriter, r *http.Request) {
+	freqHZ, err := strconv.Atoi(r.FormValue("freq"))
+	if err != nil {
+		http.Error(w, "invalid freq", http.StatusBadRequest)
+		return
+	}
+	est, levels, err := s.Locate(freqHZ, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	writeJSON(w, struct {
+		Estimate *analysis.LocationEstimate `json:"estimate"`
+		Levels   []analysis.NodeLevel       `json:"levels"`
+	}{est, levels})
+}
+
+var dashboardTemplate = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"mhz": func(hz int) string { return fmt.Sprintf("%.3f", float64(hz)/1e6) },
+}).Parse(`<!DOCTYPE html>
+<html><head><title>Spectrum monitoring</title><meta http-equiv="refresh" content="10"></head>
+<body>
+<h1>Nodes</h1>
+<table>
+<tr><th>Node</th><th>Location</th><th>Last seen</th><th>Sweeps</th><th>Events</th><th>Peak</th></tr>
+{{range .Nodes}}<tr><td>{{.Name}}</td><td>{{.Location}}</td><td>{{.LastSeen.Format "2006-01-02 15:04:05"}}</td><td>{{.Sweeps}}</td><td>{{.Events}}</td><td>{{printf "%.1f" .PeakDBM}} dBm at {{mhz .PeakFreqHZ}} MHz</td></tr>
+{{end}}</table>
+<h1>Recent events</h1>
+<table>
+<tr><th>Time</th><th>Node</th><th>Band</th><th>Event</th></tr>
+{{range .Events}}<tr><td>{{.Time.Format "2006-01-02 15:04:05"}}</td><td>{{.Node}}</td><td>{{.Band}}</td><td>{{if .Text}}{{.Text}}{{else}}{{.Kind}}{{if .Cleared}} cleared{{end}}{{end}}{{with .Estimate}}, emitter near {{printf "%.5f, %.5f" .Lat .Lon}} ±{{printf "%.0f" .RadiusM}} m{{end}}</td></tr>
+{{end}}</table>
+</body></html>
+`))
+
+func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	events := s.Events("")
+	if len(events) > 50 {
+		events = events[:50]
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	dashboardTemplate.Execute(w, struct {
+		Nodes  []Node
+		Events []*Event
+	}{s.Nodes(), events})
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,106 @@
+package aggregate
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samuel/rfexplorer/rfx/store"
+)
+
+func TestServer(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewServer(dir, store.DefaultPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	ctx := context.Background()
+	now := time.Now()
+	roof := &Client{URL: ts.URL, Node: "roof", Location: "Building A roof"}
+	lab := &Client{URL: ts.URL, Node: "lab"}
+	if err := roof.SendSweep(ctx, &Sweep{Time: now, StartFreqHZ: 2400000000, StepHZ: 1000000, Samples: []float64{-100, -40, -90}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := lab.SendSweep(ctx, &Sweep{Time: now, StartFreqHZ: 433000000, StepHZ: 10000, Samples: []float64{-110}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := roof.SendEvent(ctx, &Event{Time: now, Band: "2400-2500", Kind: "limit"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&Client{URL: ts.URL, Node: "../etc"}).SendEvent(ctx, &Event{Kind: "limit"}); err == nil {
+		t.Error("expected an invalid node name to be rejected")
+	}
+	if err := lab.SendEvent(ctx, &Event{Kind: "limit", Text: strings.Repeat("x", maxEventBytes)}); err == nil {
+		t.Error("expected an oversized event to be rejected")
+	}
+
+	res, err := http.Get(ts.URL + "/api/nodes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var nodes []Node
+	err = json.NewDecoder(res.Body).Decode(&nodes)
+	res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 2 || nodes[1].Name != "roof" || nodes[1].Location != "Building A roof" ||
+		nodes[1].PeakDBM != -40 || nodes[1].PeakFreqHZ != 2401000000 || nodes[1].Events != 1 {
+		t.Errorf("unexpected nodes %+v", nodes)
+	}
+	if events := s.Events("lab"); len(events) != 0 {
+		t.Errorf("lab has events %+v", events)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "roof", "full", now.Format("2006-01-02")+".csv")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLocateEvent(t *testing.T) {
+	s, err := NewServer(t.TempDir(), store.DefaultPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	now := time.Now()
+	// Three nodes in a line with the emitter closest to b.
+	for _, n := range []struct {
+		name  string
+		lon   float64
+		level float64
+	}{{"a", -122.30, -80}, {"b", -122.29, -60}, {"c", -122.28, -80}, {"far", -122.27, -90}} {
+		sw := &Sweep{Node: n.name, Lat: 47.6, Lon: n.lon, Time: now, StartFreqHZ: 433000000, StepHZ: 10000, Samples: []float64{-110, n.level, -110}}
+		if n.name == "far" {
+			sw.Time = now.Add(-time.Hour) // too old to be used
+		}
+		if err := s.AddSweep(sw); err != nil {
+			t.Fatal(err)
+		}
+	}
+	e := &Event{Node: "b", Time: now, Kind: "limit", FreqHZ: 433010000, LevelDBM: -60}
+	if err := s.AddEvent(e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Estimate == nil {
+		t.Fatal("event has no location estimate")
+	}
+	if e.Estimate.Lon < -122.295 || e.Estimate.Lon > -122.285 {
+		t.Errorf("estimate %+v should be near node b", e.Estimate)
+	}
+	if _, levels, _ := s.Locate(433010000, now); len(levels) != 3 {
+		t.Errorf("Locate used %d nodes, want 3", len(levels))
+	}
+}
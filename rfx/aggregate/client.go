@@ -0,0 +1,83 @@
+package aggregate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Client sends reports from a node to a Server.
+type Client struct {
+	// URL is the base URL of the server, e.g. "http://aggregator:8080".
+	URL string
+	// Node, Location, and the position are filled in on reports that
+	// don't set them.
+	Node     string
+	Location string
+	Lat, Lon float64
+	// Token, if not empty, is sent as a bearer token, see package auth.
+	Token string
+	// HTTPClient is used to make requests, http.DefaultClient if nil.
+	HTTPClient *http.Client
+}
+
+// SendSweep sends a sweep to the server.
+func (c *Client) SendSweep(ctx context.Context, sw *Sweep) error {
+	if sw.Node == "" {
+		sw.Node = c.Node
+	}
+	if sw.Location == "" {
+		sw.Location = c.Location
+	}
+	if sw.Lat == 0 && sw.Lon == 0 {
+		sw.Lat, sw.Lon = c.Lat, c.Lon
+	}
+	return c.post(ctx, "/api/sweeps", sw)
+}
+
+// SendEvent sends an event to the server.
+func (c *Client) SendEvent(ctx context.Context, e *Event) error {
+	if e.Node == "" {
+		e.Node = c.Node
+	}
+	if e.Location == "" {
+		e.Location = c.Location
+	}
+	if e.Lat == 0 && e.Lon == 0 {
+		e.Lat, e.Lon = c.Lat, c.Lon
+	}
+	return c.post(ctx, "/api/events", e)
+}
+
+func (c *Client) post(ctx context.Context, path string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(c.URL, "/")+path, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	hc := c.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	res, err := hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("aggregate: %s: %s: %s", path, res.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
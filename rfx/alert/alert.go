@@ -0,0 +1,260 @@
+// Package alert raises alerts when sweeps meet the conditions of rules such
+// as "any level in 5725-5875 MHz above -60 dBm for 2s". Alerts are delivered
+// to callbacks and channels for notifiers to build on.
+package alert
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/samuel/rfexplorer/rfx"
+	"github.com/samuel/rfexplorer/rfx/analysis"
+)
+
+// Rule is a condition that raises an alert while any level in a range of
+// frequencies is above a threshold.
+type Rule struct {
+	// Name identifies the rule, its String if not set.
+	Name                  string
+	LowFreqHZ, HighFreqHZ int
+	ThresholdDBM          float64
+	// For is how long the condition must hold before the alert is raised,
+	// 0 to raise it on the first sweep that meets it.
+	For time.Duration
+}
+
+// ParseRule parses a rule written as "<low>-<high> > <dBm> [for <duration>]"
+// with the range in MHz, e.g. "5725-5875 > -60 for 2s".
+func ParseRule(s string) (Rule, error) {
+	var r Rule
+	fields := strings.Fields(s)
+	if (len(fields) != 3 && len(fields) != 5) || fields[1] != ">" || (len(fields) == 5 && fields[3] != "for") {
+		return r, fmt.Errorf("alert: invalid rule %q, expected <low>-<high> > <dBm> [for <duration>]", s)
+	}
+	parts := strings.SplitN(fields[0], "-", 2)
+	if len(parts) != 2 {
+		return r, fmt.Errorf("alert: invalid range %q, expected low-high in MHz", fields[0])
+	}
+	loMHz, err1 := strconv.ParseFloat(parts[0], 64)
+	hiMHz, err2 := strconv.ParseFloat(parts[1], 64)
+	if err1 != nil || err2 != nil || hiMHz <= loMHz {
+		return r, fmt.Errorf("alert: invalid range %q, expected low-high in MHz", fields[0])
+	}
+	r.LowFreqHZ, r.HighFreqHZ = int(loMHz*1e6), int(hiMHz*1e6)
+	var err error
+	if r.ThresholdDBM, err = strconv.ParseFloat(fields[2], 64); err != nil {
+		return r, fmt.Errorf("alert: invalid threshold %q", fields[2])
+	}
+	if len(fields) == 5 {
+		if r.For, err = time.ParseDuration(fields[4]); err != nil || r.For < 0 {
+			return r, fmt.Errorf("alert: invalid duration %q", fields[4])
+		}
+	}
+	return r, nil
+}
+
+// String returns the rule in the form read by ParseRule.
+func (r Rule) String() string {
+	s := fmt.Sprintf("%s-%s > %s",
+		strconv.FormatFloat(float64(r.LowFreqHZ)/1e6, 'f', -1, 64),
+		strconv.FormatFloat(float64(r.HighFreqHZ)/1e6, 'f', -1, 64),
+		strconv.FormatFloat(r.ThresholdDBM, 'f', -1, 64))
+	if r.For > 0 {
+		s += " for " + r.For.String()
+	}
+	return s
+}
+
+// Event is an alert being raised, or cleared once the condition no longer
+// holds.
+type Event struct {
+	Rule    Rule
+	Time    time.Time
+	Cleared bool
+	// Since is when the condition started to hold.
+	Since time.Time
+	// FreqHZ and LevelDBM are of the strongest level in the range of the
+	// sweep that raised or cleared the alert.
+	FreqHZ   int
+	LevelDBM float64
+}
+
+func (e Event) String() string {
+	if e.Cleared {
+		return fmt.Sprintf("%s %s: cleared after %s", e.Time.Format(time.RFC3339), e.Rule.Name, e.Time.Sub(e.Since))
+	}
+	return fmt.Sprintf("%s %s: %.1f dBm at %.3f MHz since %s",
+		e.Time.Format(time.RFC3339), e.Rule.Name, e.LevelDBM, float64(e.FreqHZ)/1e6, e.Since.Format("15:04:05"))
+}
+
+// subscriptionSize is the number of events a subscription buffers.
+const subscriptionSize = 16
+
+// Engine checks sweeps against its rules. It's safe for concurrent use.
+type Engine struct {
+	mu       sync.Mutex
+	rules    []*state
+	handlers map[int]func(Event)
+	subs     map[int]chan Event
+	nextID   int
+}
+
+// state is a rule and whether its condition holds.
+type state struct {
+	rule    Rule
+	holding bool
+	since   time.Time
+	raised  bool
+}
+
+// NewEngine returns an Engine without any rules.
+func NewEngine() *Engine {
+	return &Engine{
+		handlers: make(map[int]func(Event)),
+		subs:     make(map[int]chan Event),
+	}
+}
+
+// Add adds a rule. Its name must not be used by another rule.
+func (e *Engine) Add(r Rule) error {
+	if r.HighFreqHZ < r.LowFreqHZ {
+		return errors.New("alert: high frequency is below low frequency")
+	}
+	if r.Name == "" {
+		r.Name = r.String()
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, s := range e.rules {
+		if s.rule.Name == r.Name {
+			return fmt.Errorf("alert: duplicate rule %q", r.Name)
+		}
+	}
+	e.rules = append(e.rules, &state{rule: r})
+	return nil
+}
+
+// Remove removes the rule of the given name and reports whether there was
+// one. An alert raised by the rule isn't cleared.
+func (e *Engine) Remove(name string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for i, s := range e.rules {
+		if s.rule.Name == name {
+			e.rules = append(e.rules[:i], e.rules[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Rules returns the rules in the order they were added.
+func (e *Engine) Rules() []Rule {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	rules := make([]Rule, len(e.rules))
+	for i, s := range e.rules {
+		rules[i] = s.rule
+	}
+	return rules
+}
+
+// OnEvent registers fn to be called with every event, and returns a
+// function that unregisters it. Callbacks are called by Check in no
+// particular order and may use the engine.
+func (e *Engine) OnEvent(fn func(Event)) func() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	id := e.nextID
+	e.nextID++
+	e.handlers[id] = fn
+	return func() {
+		e.mu.Lock()
+		delete(e.handlers, id)
+		e.mu.Unlock()
+	}
+}
+
+// Subscribe returns a channel that receives every event and a function that
+// ends the subscription and closes the channel. Check doesn't wait for a
+// subscriber: events that don't fit in the channel's buffer are dropped.
+func (e *Engine) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, subscriptionSize)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	id := e.nextID
+	e.nextID++
+	e.subs[id] = ch
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			e.mu.Lock()
+			delete(e.subs, id)
+			close(ch)
+			e.mu.Unlock()
+		})
+	}
+}
+
+// Check checks a sweep against the rules, delivers the events it raises and
+// clears, and returns them. Rules whose range the sweep doesn't cover are
+// left as they were, so that the sweeps of a scan across several bands can
+// be checked in turn. The duration of a condition is measured by the times
+// of the sweeps.
+func (e *Engine) Check(sw *rfx.Sweep) []Event {
+	grid := analysis.ConfigGrid(sw.Config, len(sw.Samples))
+	e.mu.Lock()
+	var events []Event
+	for _, s := range e.rules {
+		peak := -1
+		for i, v := range sw.Samples {
+			if f := grid.FreqHZ(i); f >= s.rule.LowFreqHZ && f <= s.rule.HighFreqHZ && (peak < 0 || v > sw.Samples[peak]) {
+				peak = i
+			}
+		}
+		if peak < 0 {
+			continue
+		}
+		ev := Event{Rule: s.rule, Time: sw.Time, FreqHZ: grid.FreqHZ(peak), LevelDBM: sw.Samples[peak]}
+		if sw.Samples[peak] > s.rule.ThresholdDBM {
+			if !s.holding {
+				s.holding, s.since = true, sw.Time
+			}
+			if !s.raised && sw.Time.Sub(s.since) >= s.rule.For {
+				s.raised = true
+				ev.Since = s.since
+				events = append(events, ev)
+			}
+			continue
+		}
+		if s.raised {
+			ev.Cleared, ev.Since = true, s.since
+			events = append(events, ev)
+		}
+		s.holding, s.raised = false, false
+	}
+	handlers := make([]func(Event), 0, len(e.handlers))
+	for _, fn := range e.handlers {
+		handlers = append(handlers, fn)
+	}
+	for _, ev := range events {
+		for _, ch := range e.subs {
+			select {
+			case ch <- ev:
+			default:
+			}
+		}
+	}
+	e.mu.Unlock()
+
+	for _, ev := range events {
+		for _, fn := range handlers {
+			fn(ev)
+		}
+	}
+	return events
+}
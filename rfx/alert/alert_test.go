@@ -0,0 +1,150 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samuel/rfexplorer/rfx"
+)
+
+func TestParseRule(t *testing.T) {
+	r, err := ParseRule("5725-5875 > -60 for 2s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Rule{LowFreqHZ: 5725e6, HighFreqHZ: 5875e6, ThresholdDBM: -60, For: 2 * time.Second}
+	if r != want {
+		t.Errorf("ParseRule = %+v, want %+v", r, want)
+	}
+	if s := r.String(); s != "5725-5875 > -60 for 2s" {
+		t.Errorf("String = %q", s)
+	}
+	for _, s := range []string{"5725-5875", "5875-5725 > -60", "5725-5875 < -60", "5725-5875 > -60 for", "5725-5875 > -60 for x"} {
+		if _, err := ParseRule(s); err == nil {
+			t.Errorf("expected an error for %q", s)
+		}
+	}
+}
+
+func TestEngine(t *testing.T) {
+	e := NewEngine()
+	if err := e.Add(Rule{Name: "wifi", LowFreqHZ: 2410e6, HighFreqHZ: 2420e6, ThresholdDBM: -60, For: 2 * time.Second}); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Add(Rule{Name: "wifi", LowFreqHZ: 2430e6, HighFreqHZ: 2440e6}); err == nil {
+		t.Error("expected an error for a duplicate name")
+	}
+	var called []Event
+	e.OnEvent(func(ev Event) { called = append(called, ev) })
+	ch, unsubscribe := e.Subscribe()
+
+	config := &rfx.CurrentConfigPacket{StartFreqKHZ: 2400000, FreqStepHZ: 1000000}
+	start := time.Date(2017, 1, 31, 23, 59, 0, 0, time.UTC)
+	check := func(sec int, levelDBM float64) []Event {
+		samples := make([]float64, 100)
+		for i := range samples {
+			samples[i] = -100
+		}
+		samples[15] = levelDBM
+		// Strong but outside of the rule.
+		samples[50] = -20
+		return e.Check(&rfx.Sweep{Time: start.Add(time.Duration(sec) * time.Second), Config: config, Samples: samples})
+	}
+	if evs := check(0, -50); len(evs) != 0 {
+		t.Fatalf("raised before the duration: %+v", evs)
+	}
+	// A sweep of another band leaves the rule as it was.
+	if evs := e.Check(&rfx.Sweep{Time: start.Add(time.Second), Config: &rfx.CurrentConfigPacket{StartFreqKHZ: 5725000, FreqStepHZ: 1000000}, Samples: []float64{0}}); len(evs) != 0 {
+		t.Fatalf("raised by a sweep of another band: %+v", evs)
+	}
+	evs := check(2, -55)
+	if len(evs) != 1 || evs[0].Cleared || evs[0].FreqHZ != 2415e6 || evs[0].LevelDBM != -55 || !evs[0].Since.Equal(start) {
+		t.Fatalf("events %+v, want the alert raised since the start at 2415 MHz", evs)
+	}
+	if evs := check(3, -50); len(evs) != 0 {
+		t.Fatalf("raised again: %+v", evs)
+	}
+	evs = check(4, -70)
+	if len(evs) != 1 || !evs[0].Cleared {
+		t.Fatalf("events %+v, want the alert cleared", evs)
+	}
+	if len(called) != 2 || called[0].Cleared || !called[1].Cleared {
+		t.Errorf("callback got %+v", called)
+	}
+	unsubscribe()
+	var got []Event
+	for ev := range ch {
+		got = append(got, ev)
+	}
+	if len(got) != 2 || got[0].Rule.Name != "wifi" {
+		t.Errorf("subscription got %+v", got)
+	}
+
+	if !e.Remove("wifi") || len(e.Rules()) != 0 {
+		t.Error("expected the rule to be removed")
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	var posts []Payload
+	status := []int{http.StatusServiceUnavailable, http.StatusOK}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p Payload
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			t.Error(err)
+		}
+		posts = append(posts, p)
+		code := http.StatusBadRequest
+		if len(status) != 0 {
+			code, status = status[0], status[1:]
+		}
+		w.WriteHeader(code)
+	}))
+	defer ts.Close()
+
+	start := time.Date(2017, 1, 31, 23, 59, 0, 0, time.UTC)
+	ev := Event{
+		Rule:  Rule{Name: "5.8", ThresholdDBM: -60},
+		Time:  start.Add(2 * time.Second),
+		Since: start, FreqHZ: 5800e6, LevelDBM: -42,
+	}
+	w := &Webhook{URLs: []string{ts.URL}, Serial: "B3AK7AL7CACAA74M", Backoff: time.Millisecond}
+	// Retried after the server error.
+	if err := w.Send(context.Background(), ev); err != nil {
+		t.Fatal(err)
+	}
+	want := Payload{
+		Rule: "5.8", Time: ev.Time, Since: start, FreqHZ: 5800e6, LevelDBM: -42, ThresholdDBM: -60,
+		Serial: "B3AK7AL7CACAA74M", Text: "B3AK7AL7CACAA74M: " + ev.String(),
+	}
+	if len(posts) != 2 || posts[1] != want {
+		t.Fatalf("posts %+v, want two of %+v", posts, want)
+	}
+	// Not retried after a client error.
+	posts = nil
+	if err := w.Send(context.Background(), ev); err == nil || strings.Contains(err.Error(), ts.URL) {
+		t.Errorf("expected an error without the URL, got %v", err)
+	}
+	if len(posts) != 1 {
+		t.Errorf("%d posts, want 1", len(posts))
+	}
+
+	now := time.Date(2017, 2, 1, 0, 0, 0, 0, time.UTC)
+	for v, want := range map[string]time.Duration{
+		"":                              0,
+		"2":                             2 * time.Second,
+		"-1":                            0,
+		"86400":                         maxRetryAfter,
+		"Wed, 01 Feb 2017 00:00:30 GMT": 30 * time.Second,
+		"soon":                          0,
+	} {
+		if d := parseRetryAfter(v, now); d != want {
+			t.Errorf("parseRetryAfter(%q) = %s, want %s", v, d, want)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Payload is the JSON body posted by a Webhook. Text makes it display as a
+// message in Slack and similar chat incoming webhooks.
+type Payload struct {
+	Rule         string    `json:"rule"`
+	Cleared      bool      `json:"cleared,omitempty"`
+	Time         time.Time `json:"time"`
+	Since        time.Time `json:"since"`
+	FreqHZ       int       `json:"freqHz"`
+	LevelDBM     float64   `json:"levelDbm"`
+	ThresholdDBM float64   `json:"thresholdDbm"`
+	Serial       string    `json:"serial,omitempty"`
+	Text         string    `json:"text"`
+}
+
+// Defaults of a Webhook.
+const (
+	DefaultRetries = 5
+	DefaultBackoff = time.Second
+	maxBackoff     = time.Minute
+	// maxRetryAfter caps the delay asked for by a server so that a
+	// misbehaving one can't hold up the events after it indefinitely.
+	maxRetryAfter = 10 * time.Minute
+)
+
+// webhookTimeout is how long each attempt at a post may take.
+const webhookTimeout = 10 * time.Second
+
+// Webhook posts events as JSON to URLs, retrying failed posts with
+// exponential backoff, or after the delay asked for by a Retry-After header.
+// Posts that fail with a client error other than 429 Too Many Requests
+// aren't retried since they'd fail again.
+type Webhook struct {
+	URLs []string
+	// Serial is the serial number of the device, included in the payload.
+	Serial string
+	// Retries is the number of times a failed post is retried, DefaultRetries
+	// if 0 and none if negative.
+	Retries int
+	// Backoff is the delay before the first retry, DefaultBackoff if 0. It
+	// doubles for each retry up to a minute.
+	Backoff time.Duration
+	// HTTPClient is used to make requests, http.DefaultClient if nil.
+	HTTPClient *http.Client
+}
+
+// Send posts an event to every URL, retrying each until it succeeds, the
+// retries run out, or ctx is done. It returns the first error of the URLs
+// that failed.
+func (w *Webhook) Send(ctx context.Context, e Event) error {
+	text := e.String()
+	if w.Serial != "" {
+		text = w.Serial + ": " + text
+	}
+	b, err := json.Marshal(&Payload{
+		Rule:         e.Rule.Name,
+		Cleared:      e.Cleared,
+		Time:         e.Time,
+		Since:        e.Since,
+		FreqHZ:       e.FreqHZ,
+		LevelDBM:     e.LevelDBM,
+		ThresholdDBM: e.Rule.ThresholdDBM,
+		Serial:       w.Serial,
+		Text:         text,
+	})
+	if err != nil {
+		return err
+	}
+	var firstErr error
+	for _, u := range w.URLs {
+		if err := w.send(ctx, u, b); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// send posts body to rawURL with retries.
+func (w *Webhook) send(ctx context.Context, rawURL string, body []byte) error {
+	retries := w.Retries
+	if retries == 0 {
+		retries = DefaultRetries
+	}
+	backoff := w.Backoff
+	if backoff <= 0 {
+		backoff = DefaultBackoff
+	}
+	for attempt := 0; ; attempt++ {
+		retry, retryAfter, err := w.post(ctx, rawURL, body)
+		if err == nil || !retry || attempt >= retries {
+			return err
+		}
+		delay := backoff
+		if retryAfter > delay {
+			delay = retryAfter
+		}
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return err
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// post makes one attempt at posting body to rawURL and reports whether
+// it's worth retrying if it fails, and how long the server asked to wait
+// before doing so. Errors only name the host since the URLs of chat webhooks
+// are secret.
+func (w *Webhook) post(ctx context.Context, rawURL string, body []byte) (bool, time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, rawURL, bytes.NewReader(body))
+	if err != nil {
+		return false, 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	hc := w.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	res, err := hc.Do(req)
+	if err != nil {
+		if ue, ok := err.(*url.Error); ok {
+			err = ue.Err
+		}
+		return true, 0, fmt.Errorf("alert: webhook %s: %s", req.URL.Host, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		retry := res.StatusCode/100 == 5 || res.StatusCode == http.StatusTooManyRequests
+		var retryAfter time.Duration
+		if res.StatusCode == http.StatusTooManyRequests || res.StatusCode == http.StatusServiceUnavailable {
+			retryAfter = parseRetryAfter(res.Header.Get("Retry-After"), time.Now())
+		}
+		return retry, retryAfter, fmt.Errorf("alert: webhook %s: %s: %s", req.URL.Host, res.Status, strings.TrimSpace(string(msg)))
+	}
+	return false, 0, nil
+}
+
+// parseRetryAfter parses the value of a Retry-After header, either a number
+// of seconds or an HTTP date, and returns 0 if it's missing or invalid.
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	var d time.Duration
+	if secs, err := strconv.Atoi(strings.TrimSpace(v)); err == nil {
+		d = time.Duration(secs) * time.Second
+	} else if t, err := http.ParseTime(v); err == nil {
+		d = t.Sub(now)
+	}
+	if d < 0 {
+		return 0
+	} else if d > maxRetryAfter {
+		return maxRetryAfter
+	}
+	return d
+}
@@ -0,0 +1,366 @@
+package analysis
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/samuel/rfexplorer/rfx"
+	"github.com/samuel/rfexplorer/rfx/bands"
+)
+
+// sweep24 returns a 2.4 GHz sweep at 1 MHz steps from 2400 to 2499 MHz with
+// the given frequencies (in MHz) set to -40 dBm.
+func sweep24(busyMHz ...int) (*rfx.CurrentConfigPacket, []float64) {
+	config := &rfx.CurrentConfigPacket{StartFreqKHZ: 2400000, FreqStepHZ: 1000000}
+	samples := make([]float64, 100)
+	for i := range samples {
+		samples[i] = -100
+	}
+	for _, f := range busyMHz {
+		samples[f-2400] = -40
+	}
+	return config, samples
+}
+
+func TestOccupancy(t *testing.T) {
+	occ := NewOccupancy(bands.Zigbee24, -80)
+	occ.Add(sweep24(2405))
+	occ.Add(sweep24())
+	// Samples without data aren't counted.
+	config, samples := sweep24()
+	for i := range samples {
+		samples[i] = -999
+	}
+	occ.Add(config, samples)
+	res := occ.Result()
+	if res[0].Channel.Name != "11" || res[0].Busy != 0.5 || res[0].MaxDBM != -40 || res[0].Sweeps != 2 {
+		t.Fatalf("channel 11 = %+v", res[0])
+	}
+	if res[1].Busy != 0 || res[1].MeanDBM != -100 {
+		t.Fatalf("channel 12 = %+v", res[1])
+	}
+}
+
+func TestZigbeeCoexistence(t *testing.T) {
+	zig := NewOccupancy(bands.Zigbee24, -80)
+	wifi := NewOccupancy(bands.WiFi24, -80)
+	// Wi-Fi on channels 1 and 6, nothing near Zigbee 26.
+	config, samples := sweep24(2412, 2437)
+	zig.Add(config, samples)
+	wifi.Add(config, samples)
+	reports := ZigbeeCoexistence(zig.Result(), wifi.Result())
+	if len(reports) != 16 {
+		t.Fatalf("got %d reports, want 16", len(reports))
+	}
+	best := reports[0]
+	if best.Busy != 0 || best.WiFiBusy != 0 {
+		t.Fatalf("best channel %s is busy: %+v", best.Channel.Name, best)
+	}
+	for _, r := range reports {
+		if r.Channel.Name == "12" && r.WiFiBusy != 1 {
+			t.Errorf("channel 12 overlaps Wi-Fi 1 and should have WiFiBusy 1: %+v", r)
+		}
+	}
+}
+
+func TestRankLoRaChannels(t *testing.T) {
+	occ := []ChannelOccupancy{
+		{Channel: bands.EU868.Channels[0], Busy: 0.05, MeanDBM: -90}, // 868.1 MHz, 1% sub-band
+		{Channel: bands.EU868.Channels[3], Busy: 0.001, MeanDBM: -110},
+		{Channel: bands.EU868.Channels[10], Busy: 0.02, MeanDBM: -100}, // 869.525 MHz, 10% sub-band
+	}
+	reports := RankLoRaChannels(occ, bands.ISM868)
+	if reports[0].Channel.Name != "3" || reports[1].Channel.Name != "RX2" || reports[2].Channel.Name != "0" {
+		t.Fatalf("unexpected order: %s, %s, %s", reports[0].Channel.Name, reports[1].Channel.Name, reports[2].Channel.Name)
+	}
+	if !reports[2].OverLimit || reports[2].DutyCycleLimit != 0.01 || reports[2].SubBand.Name != "h1.4" {
+		t.Errorf("channel 0 should be over its 1%% limit: %+v", reports[2])
+	}
+	if reports[1].OverLimit || reports[1].DutyCycleLimit != 0.1 {
+		t.Errorf("RX2 should be within its 10%% limit: %+v", reports[1])
+	}
+}
+
+func TestPassDetector(t *testing.T) {
+	config := &rfx.CurrentConfigPacket{StartFreqKHZ: 137000, FreqStepHZ: 10000}
+	sweep := func(carrierDBM float64) []float64 {
+		samples := make([]float64, 100)
+		for i := range samples {
+			samples[i] = -110
+		}
+		samples[90] = carrierDBM // 137.900 MHz
+		return samples
+	}
+	band := &bands.Band{Channels: []bands.Channel{{Name: "Meteor", CenterFreqHZ: 137900000, WidthHZ: 150000}}}
+	d := NewPassDetector(band)
+	t0 := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	if started, _ := d.Add(t0, config, sweep(-110)); len(started) != 0 {
+		t.Fatalf("unexpected pass start: %+v", started)
+	}
+	started, _ := d.Add(t0.Add(time.Minute), config, sweep(-90))
+	if len(started) != 1 || !started[0].Start.Equal(t0.Add(time.Minute)) {
+		t.Fatalf("expected pass start, got %+v", started)
+	}
+	d.Add(t0.Add(2*time.Minute), config, sweep(-80))
+	// A short fade shouldn't end the pass.
+	if _, ended := d.Add(t0.Add(2*time.Minute+10*time.Second), config, sweep(-110)); len(ended) != 0 {
+		t.Fatalf("pass ended during fade: %+v", ended)
+	}
+	d.Add(t0.Add(3*time.Minute), config, sweep(-95))
+	_, ended := d.Add(t0.Add(4*time.Minute), config, sweep(-110))
+	if len(ended) != 1 {
+		t.Fatalf("expected pass end, got %+v", ended)
+	}
+	p := ended[0]
+	if !p.End.Equal(t0.Add(3*time.Minute)) || p.PeakDBM != -80 || !p.PeakTime.Equal(t0.Add(2*time.Minute)) {
+		t.Fatalf("unexpected pass %+v", p)
+	}
+}
+
+func TestBearingLog(t *testing.T) {
+	var l BearingLog
+	now := time.Now()
+	l.Add(now, 355, -70)
+	l.Add(now, 4, -60)
+	l.Add(now, 90, -90)
+	l.Add(now, -90, -95)
+	b := l.Buckets(10)
+	if len(b) != 36 {
+		t.Fatalf("got %d buckets, want 36", len(b))
+	}
+	if b[0].N != 2 || b[0].MaxDBM != -60 || b[0].MeanDBM != -65 {
+		t.Errorf("north bucket = %+v", b[0])
+	}
+	if b[27].N != 1 || b[27].BearingDeg != 270 {
+		t.Errorf("west bucket = %+v", b[27])
+	}
+	if best, ok := l.Best(); !ok || best.BearingDeg != 4 {
+		t.Errorf("Best() = %+v, %t", best, ok)
+	}
+}
+
+func TestInterpolatePeak(t *testing.T) {
+	config := &rfx.CurrentConfigPacket{StartFreqKHZ: 100000, FreqStepHZ: 10000}
+	// Samples of -(x-2.25)^2 which peaks at 0 dBm at 100.0225 MHz.
+	samples := make([]float64, 5)
+	for i := range samples {
+		x := float64(i) - 2.25
+		samples[i] = -x * x
+	}
+	f, l := InterpolatePeak(config, samples, 2)
+	if f != 100022500 || l != 0 {
+		t.Errorf("InterpolatePeak = %.1f Hz, %.3f dBm, want 100022500 Hz, 0 dBm", f, l)
+	}
+	if f, l := InterpolatePeak(config, samples, 4); f != 100040000 || l != samples[4] {
+		t.Errorf("InterpolatePeak at edge = %.1f Hz, %.3f dBm", f, l)
+	}
+}
+
+func TestFindPeaks(t *testing.T) {
+	config, samples := sweep24()
+	samples = samples[:20]
+	samples[4], samples[5], samples[6] = -70, -40, -46
+	samples[7], samples[8] = -60, -45
+	samples[15] = -60
+	// A plateau at the end of the sweep
+	samples[18], samples[19] = -80, -80
+	sweep := &rfx.SweepDataPacket{Config: config, Samples: samples}
+	indexes := func(peaks []Peak) []int {
+		var idx []int
+		for _, p := range peaks {
+			idx = append(idx, p.Index)
+		}
+		return idx
+	}
+	for _, c := range []struct {
+		opts PeakOptions
+		want []int
+	}{
+		{PeakOptions{}, []int{5, 8, 15, 18}},
+		{PeakOptions{Max: 2}, []int{5, 8}},
+		{PeakOptions{MinSpacingHZ: 5000000}, []int{5, 15}},
+		{PeakOptions{ThresholdDB: 50}, []int{5, 8}},
+	} {
+		if got := indexes(FindPeaks(sweep, c.opts)); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("FindPeaks(%+v) found peaks at %v, want %v", c.opts, got, c.want)
+		}
+	}
+	peaks := FindPeaks(sweep, PeakOptions{Max: 1})
+	// -43 dBm is crossed at 4.9 and 5.5 steps.
+	if bw := peaks[0].BandwidthHZ; math.Abs(bw-600000) > 1 {
+		t.Errorf("bandwidth %.0f Hz, want 600000 Hz", bw)
+	}
+	if f, l := InterpolatePeak(config, samples, 5); peaks[0].FreqHZ != f || peaks[0].LevelDBM != l {
+		t.Errorf("peak at %.0f Hz, %.1f dBm isn't interpolated", peaks[0].FreqHZ, peaks[0].LevelDBM)
+	}
+	if all := FindPeaks(sweep, PeakOptions{}); all[3].BandwidthHZ != 0 {
+		t.Errorf("bandwidth of the plateau at the end is %.0f Hz, want 0", all[3].BandwidthHZ)
+	}
+	if FindPeaks(&rfx.SweepDataPacket{Samples: samples}, PeakOptions{}) != nil {
+		t.Error("expected no peaks without a config")
+	}
+}
+
+func TestChannelPower(t *testing.T) {
+	config, samples := sweep24()
+	config.RBWKHZ = 1000
+	// -40 dBm in each of the 11 samples of a 2401-2411 MHz channel. With
+	// the RBW equal to the step the power of every sample adds up.
+	for i := 2401; i <= 2411; i++ {
+		samples[i-2400] = -40
+	}
+	plan := &bands.Band{Channels: []bands.Channel{
+		{Name: "1", CenterFreqHZ: 2406000000, WidthHZ: 10000000},
+		{Name: "far", CenterFreqHZ: 5000000000, WidthHZ: 10000000},
+	}}
+	sweep := &rfx.SweepDataPacket{Config: config, Samples: samples}
+	want := -40 + 10*math.Log10(11)
+	for _, w := range []Window{Rectangular, Hann, Blackman} {
+		res := ChannelPower(sweep, plan, w)
+		if math.Abs(res[0].PowerDBM-want) > 0.01 || res[0].Samples != 11 {
+			t.Errorf("%s: channel 1 = %+v, want %.2f dBm", w, res[0], want)
+		}
+		if !math.IsNaN(res[1].PowerDBM) || res[1].Samples != 0 {
+			t.Errorf("%s: channel outside the sweep = %+v", w, res[1])
+		}
+	}
+
+	// Doubling the RBW halves the power each sample adds.
+	config.RBWKHZ = 2000
+	if res := ChannelPower(sweep, plan, Rectangular); math.Abs(res[0].PowerDBM-(want-3.01)) > 0.01 {
+		t.Errorf("channel 1 with a 2 MHz RBW = %.2f dBm, want %.2f dBm", res[0].PowerDBM, want-3.01)
+	}
+}
+
+func TestOccupiedBandwidth(t *testing.T) {
+	config, samples := sweep24()
+	samples = samples[:20]
+	for i := 5; i < 15; i++ {
+		samples[i] = -40
+	}
+	sweep := &rfx.SweepDataPacket{Config: config, Samples: samples}
+	// 0.5% of the power is in the outer 5% of the first and last samples
+	// of the signal, as the noise adds almost nothing.
+	b, ok := OccupiedBandwidth(sweep, 0.99)
+	if !ok || math.Abs(b.LowFreqHZ-2404550000) > 1000 || math.Abs(b.HighFreqHZ-2414450000) > 1000 {
+		t.Errorf("OccupiedBandwidth = %+v, %t, want 2404.55-2414.45 MHz", b, ok)
+	}
+	if math.Abs(b.CenterFreqHZ()-2409500000) > 1000 {
+		t.Errorf("center %.0f Hz", b.CenterFreqHZ())
+	}
+	if _, ok := OccupiedBandwidth(&rfx.SweepDataPacket{Samples: samples}, 0.99); ok {
+		t.Error("expected no bandwidth without a config")
+	}
+}
+
+func TestNDBBandwidth(t *testing.T) {
+	config, samples := sweep24()
+	samples[4], samples[5], samples[6] = -70, -40, -46
+	sweep := &rfx.SweepDataPacket{Config: config, Samples: samples}
+	// -46 dBm is crossed 0.8 steps after sample 4 and at sample 6.
+	b, ok := NDBBandwidth(sweep, 5, 6)
+	if !ok || math.Abs(b.LowFreqHZ-2404800000) > 1 || math.Abs(b.HighFreqHZ-2406000000) > 1 {
+		t.Errorf("NDBBandwidth = %+v, %t, want 2404.8-2406 MHz", b, ok)
+	}
+	if math.Abs(b.WidthHZ()-1200000) > 1 {
+		t.Errorf("width %.0f Hz", b.WidthHZ())
+	}
+	// The level never falls by 80 dB.
+	if _, ok := NDBBandwidth(sweep, 5, 80); ok {
+		t.Error("expected no -80 dB bandwidth")
+	}
+}
+
+func TestResample(t *testing.T) {
+	src := Grid{StartFreqHZ: 1000, StepHZ: 100, Points: 3}
+	out := Resample(src, []float64{-100, -80, -90}, Grid{StartFreqHZ: 950, StepHZ: 50, Points: 6})
+	if !math.IsNaN(out[0]) {
+		t.Errorf("point below the source should be NaN, got %f", out[0])
+	}
+	want := []float64{-100, -90, -80, -85, -90}
+	for i, w := range want {
+		if out[i+1] != w {
+			t.Errorf("out[%d] = %f, want %f", i+1, out[i+1], w)
+		}
+	}
+
+	a := Grid{StartFreqHZ: 0, StepHZ: 10, Points: 3}
+	b := Grid{StartFreqHZ: 20, StepHZ: 10, Points: 3}
+	st := Stitch(Grid{StartFreqHZ: 0, StepHZ: 10, Points: 6}, []Grid{a, b}, [][]float64{{-1, -2, -3}, {-4, -5, -6}})
+	if st[2] != -3 || st[4] != -6 || !math.IsNaN(st[5]) {
+		t.Errorf("Stitch = %v", st)
+	}
+}
+
+func TestPersistence(t *testing.T) {
+	p := NewPersistence(-120, 0, 1, 4)
+	// A signal at 2450 MHz is on in one of four sweeps, under a steady one
+	// at 2440 MHz.
+	for i := 0; i < 4; i++ {
+		busy := []int{2440}
+		if i == 1 {
+			busy = append(busy, 2450)
+		}
+		p.Add(sweep24(busy...))
+	}
+	if p.Sweeps() != 4 || p.Grid().Points != 100 {
+		t.Fatalf("%d sweeps on %+v", p.Sweeps(), p.Grid())
+	}
+	if n := p.Count(40, p.Bin(-40)); n != 4 {
+		t.Errorf("steady signal counted %d times, want 4", n)
+	}
+	if d := p.Density(50, -45, -35); d != 0.25 {
+		t.Errorf("intermittent signal density %f, want 0.25", d)
+	}
+	if d := p.Density(50, -101, -99); d != 0.75 {
+		t.Errorf("noise density %f, want 0.75", d)
+	}
+	// Levels beyond the bins are counted at the ends.
+	if p.Bin(10) != p.Bins-1 || p.Bin(-130) != 0 {
+		t.Errorf("Bin(10) = %d, Bin(-130) = %d", p.Bin(10), p.Bin(-130))
+	}
+	// The window slides past the intermittent signal.
+	p.Add(sweep24(2440))
+	p.Add(sweep24(2440))
+	if d := p.Density(50, -45, -35); d != 0 {
+		t.Errorf("density %f after the signal left the window, want 0", d)
+	}
+	p.Reset()
+	if p.Sweeps() != 0 || p.Density(40, -45, -35) != 0 {
+		t.Error("expected no sweeps after Reset")
+	}
+}
+
+func TestLocalize(t *testing.T) {
+	// Nodes on the corners of a 1 km square and an emitter 300 m east and
+	// 600 m north of the south west corner.
+	const lat0, lon0 = 47.6, -122.3
+	mPerLon := 111320.0 * math.Cos(lat0*math.Pi/180)
+	var levels []NodeLevel
+	for _, p := range [][2]float64{{0, 0}, {1000, 0}, {0, 1000}, {1000, 1000}} {
+		d := math.Hypot(p[0]-300, p[1]-600)
+		levels = append(levels, NodeLevel{
+			Lat:      lat0 + p[1]/110540,
+			Lon:      lon0 + p[0]/mPerLon,
+			LevelDBM: -20 - 20*math.Log10(d),
+		})
+	}
+	est, err := Localize(levels, DefaultPathLossExponent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x := (est.Lon - lon0) * mPerLon
+	y := (est.Lat - lat0) * 110540
+	if math.Hypot(x-300, y-600) > 20 || math.Abs(est.RefDBM+20) > 0.5 || est.RMSErrorDB > 0.1 {
+		t.Errorf("estimate at %.0f m, %.0f m, ref %.1f dBm, error %.2f dB", x, y, est.RefDBM, est.RMSErrorDB)
+	}
+	if est.RadiusM <= 0 {
+		t.Errorf("confidence radius %.0f m", est.RadiusM)
+	}
+	if _, err := Localize(levels[:2], DefaultPathLossExponent); err == nil {
+		t.Error("expected an error with 2 nodes")
+	}
+}
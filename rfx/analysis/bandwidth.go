@@ -0,0 +1,93 @@
+package analysis
+
+import (
+	"math"
+
+	"github.com/samuel/rfexplorer/rfx"
+)
+
+// Bandwidth is a frequency range measured from a sweep.
+type Bandwidth struct {
+	LowFreqHZ  float64
+	HighFreqHZ float64
+}
+
+// WidthHZ returns the width of the range.
+func (b Bandwidth) WidthHZ() float64 {
+	return b.HighFreqHZ - b.LowFreqHZ
+}
+
+// CenterFreqHZ returns the center of the range.
+func (b Bandwidth) CenterFreqHZ() float64 {
+	return (b.LowFreqHZ + b.HighFreqHZ) / 2
+}
+
+// OccupiedBandwidth returns the range that contains the given fraction of
+// the power of a sweep, such as 0.99 for the 99% occupied bandwidth, with
+// equal parts of the rest below and above it. Each sample is taken to
+// cover a step centered on its frequency. The power of the noise floor is
+// included so the sweep should be centered on the carrier and not much
+// wider than needed. It returns false for a sweep without a config.
+func OccupiedBandwidth(sweep *rfx.SweepDataPacket, fraction float64) (Bandwidth, bool) {
+	config := sweep.Config
+	if config == nil || len(sweep.Samples) == 0 || fraction <= 0 || fraction > 1 {
+		return Bandwidth{}, false
+	}
+	power := make([]float64, len(sweep.Samples))
+	total := 0.0
+	for i, s := range sweep.Samples {
+		power[i] = math.Pow(10, s/10)
+		total += power[i]
+	}
+	// freqAt returns the frequency below which target of the power is.
+	freqAt := func(target float64) float64 {
+		sum := 0.0
+		for i, p := range power {
+			if sum+p >= target {
+				return float64(sweep.FreqHZ(i)) + float64(config.FreqStepHZ)*((target-sum)/p-0.5)
+			}
+			sum += p
+		}
+		return float64(sweep.FreqHZ(len(power)-1)) + float64(config.FreqStepHZ)/2
+	}
+	rest := total * (1 - fraction) / 2
+	return Bandwidth{LowFreqHZ: freqAt(rest), HighFreqHZ: freqAt(total - rest)}, true
+}
+
+// NDBBandwidth returns the range around the signal peaking at sample i
+// where the level is within n dB of the peak, such as 6 for the -6 dB
+// bandwidth, interpolated between samples. It returns false if the level
+// doesn't fall by n dB on both sides within the sweep or the sweep has no
+// config.
+func NDBBandwidth(sweep *rfx.SweepDataPacket, i int, n float64) (Bandwidth, bool) {
+	if sweep.Config == nil || i < 0 || i >= len(sweep.Samples) {
+		return Bandwidth{}, false
+	}
+	b := ndbBandwidth(sweep.Config, sweep.Samples, i, n)
+	return b, b.WidthHZ() > 0
+}
+
+// ndbBandwidth returns the n dB bandwidth around sample i, or the zero
+// Bandwidth if the level doesn't fall by n dB on both sides.
+func ndbBandwidth(config *rfx.CurrentConfigPacket, samples []float64, i int, n float64) Bandwidth {
+	level := samples[i] - n
+	// crossing returns the frequency between sample j and its neighbor
+	// toward i where the level is crossed.
+	crossing := func(j, dir int) float64 {
+		a, b := samples[j], samples[j-dir]
+		pos := float64(j) - float64(dir)*(level-a)/(b-a)
+		return float64(config.StartFreqKHZ)*1000 + pos*float64(config.FreqStepHZ)
+	}
+	lo := i
+	for lo >= 0 && samples[lo] > level {
+		lo--
+	}
+	hi := i
+	for hi < len(samples) && samples[hi] > level {
+		hi++
+	}
+	if lo < 0 || hi == len(samples) || n <= 0 {
+		return Bandwidth{}
+	}
+	return Bandwidth{LowFreqHZ: crossing(lo, -1), HighFreqHZ: crossing(hi, 1)}
+}
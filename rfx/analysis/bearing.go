@@ -0,0 +1,82 @@
+package analysis
+
+import (
+	"math"
+	"time"
+)
+
+// BearingReading is a signal level measured while pointing a directional
+// antenna at a bearing.
+type BearingReading struct {
+	Time       time.Time
+	BearingDeg float64
+	LevelDBM   float64
+}
+
+// BearingBucket summarizes the readings within a range of bearings.
+type BearingBucket struct {
+	// BearingDeg is the center of the bucket.
+	BearingDeg float64
+	MaxDBM     float64
+	MeanDBM    float64
+	N          int
+}
+
+// BearingLog collects level readings against bearings to help locate a
+// transmitter by direction finding.
+type BearingLog struct {
+	Readings []BearingReading
+}
+
+// Add records a reading. The bearing is normalized to [0,360).
+func (l *BearingLog) Add(t time.Time, bearingDeg, levelDBM float64) {
+	bearingDeg = math.Mod(bearingDeg, 360)
+	if bearingDeg < 0 {
+		bearingDeg += 360
+	}
+	l.Readings = append(l.Readings, BearingReading{Time: t, BearingDeg: bearingDeg, LevelDBM: levelDBM})
+}
+
+// Buckets groups the readings into buckets of widthDeg degrees, returned in
+// bearing order starting at north. Buckets without readings have N == 0.
+func (l *BearingLog) Buckets(widthDeg float64) []BearingBucket {
+	n := int(math.Ceil(360 / widthDeg))
+	buckets := make([]BearingBucket, n)
+	sums := make([]float64, n)
+	for i := range buckets {
+		buckets[i].BearingDeg = float64(i) * widthDeg
+		buckets[i].MaxDBM = -999
+	}
+	for _, r := range l.Readings {
+		// Center the buckets on multiples of the width so that north is
+		// bucket 0 rather than the edge between two buckets.
+		i := int(math.Floor((r.BearingDeg+widthDeg/2)/widthDeg)) % n
+		b := &buckets[i]
+		b.N++
+		sums[i] += r.LevelDBM
+		if r.LevelDBM > b.MaxDBM {
+			b.MaxDBM = r.LevelDBM
+		}
+	}
+	for i := range buckets {
+		if buckets[i].N != 0 {
+			buckets[i].MeanDBM = sums[i] / float64(buckets[i].N)
+		}
+	}
+	return buckets
+}
+
+// Best returns the bearing of the strongest reading and false if there are
+// no readings.
+func (l *BearingLog) Best() (BearingReading, bool) {
+	if len(l.Readings) == 0 {
+		return BearingReading{}, false
+	}
+	best := l.Readings[0]
+	for _, r := range l.Readings[1:] {
+		if r.LevelDBM > best.LevelDBM {
+			best = r
+		}
+	}
+	return best, true
+}
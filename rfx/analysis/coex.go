@@ -0,0 +1,45 @@
+package analysis
+
+import "sort"
+
+// ZigbeeChannelReport describes how suitable a Zigbee channel is given the
+// measured occupancy of it and the Wi-Fi channels overlapping it.
+type ZigbeeChannelReport struct {
+	ChannelOccupancy
+	// WiFi are the overlapping Wi-Fi channels.
+	WiFi []ChannelOccupancy
+	// WiFiBusy is the highest occupancy of the overlapping Wi-Fi channels.
+	WiFiBusy float64
+}
+
+// ZigbeeCoexistence cross-references the occupancy of Zigbee channels with
+// the occupancy of the overlapping Wi-Fi channels and returns the Zigbee
+// channels ordered best first for a new deployment. Channels are ranked by
+// their own occupancy, then by the occupancy of the overlapping Wi-Fi
+// channels, and finally by their mean level.
+func ZigbeeCoexistence(zigbee, wifi []ChannelOccupancy) []ZigbeeChannelReport {
+	reports := make([]ZigbeeChannelReport, 0, len(zigbee))
+	for _, z := range zigbee {
+		r := ZigbeeChannelReport{ChannelOccupancy: z}
+		for _, w := range wifi {
+			if w.Channel.Overlaps(z.Channel) {
+				r.WiFi = append(r.WiFi, w)
+				if w.Busy > r.WiFiBusy {
+					r.WiFiBusy = w.Busy
+				}
+			}
+		}
+		reports = append(reports, r)
+	}
+	sort.SliceStable(reports, func(i, j int) bool {
+		a, b := reports[i], reports[j]
+		if a.Busy != b.Busy {
+			return a.Busy < b.Busy
+		}
+		if a.WiFiBusy != b.WiFiBusy {
+			return a.WiFiBusy < b.WiFiBusy
+		}
+		return a.MeanDBM < b.MeanDBM
+	})
+	return reports
+}
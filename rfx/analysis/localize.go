@@ -0,0 +1,131 @@
+package analysis
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	// DefaultPathLossExponent is the path loss exponent of free space.
+	// Cluttered environments are closer to 3 or 4.
+	DefaultPathLossExponent = 2.0
+	// shadowingDB is the assumed standard deviation of measured levels
+	// around the path loss model, used for the confidence region.
+	shadowingDB = 6.0
+	// chiSquare95 is the 95% quantile of the chi-square distribution with
+	// two degrees of freedom, for the two position coordinates.
+	chiSquare95 = 5.99
+	// localizeGrid is the number of points along each side of the search
+	// grid.
+	localizeGrid = 101
+)
+
+// NodeLevel is the level of an emitter measured by a node at a known
+// position.
+type NodeLevel struct {
+	Node     string
+	Lat, Lon float64
+	LevelDBM float64
+}
+
+// LocationEstimate is the estimated position of an emitter.
+type LocationEstimate struct {
+	Lat, Lon float64
+	// RefDBM is the estimated level 1 m from the emitter.
+	RefDBM float64
+	// RMSErrorDB is how far the measured levels are from the path loss model
+	// at the estimated position.
+	RMSErrorDB float64
+	// RadiusM is the radius around the estimate of the 95% confidence
+	// region, assuming levels vary by 6 dB around the model.
+	RadiusM float64
+}
+
+// Localize estimates the position of an emitter from the levels measured by
+// several nodes at the same time, using the differences in level between
+// them and a log-distance path loss model with the given exponent. Since
+// the transmit power is unknown at least three nodes are needed, and the
+// estimate is only as good as the model fits the environment, so it's meant
+// to narrow down where to look rather than to pinpoint an emitter.
+func Localize(levels []NodeLevel, exponent float64) (*LocationEstimate, error) {
+	if len(levels) < 3 {
+		return nil, fmt.Errorf("analysis: localization needs at least 3 nodes, got %d", len(levels))
+	}
+	// Work in meters on a plane around the first node, which is accurate
+	// enough over the few km a set of nodes covers.
+	lat0, lon0 := levels[0].Lat, levels[0].Lon
+	mPerLat := 110540.0
+	mPerLon := 111320.0 * math.Cos(lat0*math.Pi/180)
+	xs := make([]float64, len(levels))
+	ys := make([]float64, len(levels))
+	minX, maxX, minY, maxY := math.Inf(1), math.Inf(-1), math.Inf(1), math.Inf(-1)
+	for i, l := range levels {
+		xs[i] = (l.Lon - lon0) * mPerLon
+		ys[i] = (l.Lat - lat0) * mPerLat
+		minX, maxX = math.Min(minX, xs[i]), math.Max(maxX, xs[i])
+		minY, maxY = math.Min(minY, ys[i]), math.Max(maxY, ys[i])
+	}
+	// The emitter may be outside the nodes so search a margin around them.
+	margin := math.Max(math.Max(maxX-minX, maxY-minY), 100)
+	minX, maxX, minY, maxY = minX-margin, maxX+margin, minY-margin, maxY+margin
+
+	// fit returns the best reference level and residual sum of squares
+	// for an emitter at (x, y).
+	fit := func(x, y float64) (ref, rss float64) {
+		offsets := make([]float64, len(levels))
+		for i, l := range levels {
+			d := math.Max(math.Hypot(x-xs[i], y-ys[i]), 1)
+			offsets[i] = l.LevelDBM + 10*exponent*math.Log10(d)
+			ref += offsets[i]
+		}
+		ref /= float64(len(levels))
+		for _, o := range offsets {
+			rss += (o - ref) * (o - ref)
+		}
+		return ref, rss
+	}
+	type cell struct{ x, y, rss float64 }
+	search := func(minX, maxX, minY, maxY float64) []cell {
+		cells := make([]cell, 0, localizeGrid*localizeGrid)
+		for i := 0; i < localizeGrid; i++ {
+			x := minX + (maxX-minX)*float64(i)/(localizeGrid-1)
+			for j := 0; j < localizeGrid; j++ {
+				y := minY + (maxY-minY)*float64(j)/(localizeGrid-1)
+				_, rss := fit(x, y)
+				cells = append(cells, cell{x, y, rss})
+			}
+		}
+		return cells
+	}
+	best := func(cells []cell) cell {
+		b := cells[0]
+		for _, c := range cells[1:] {
+			if c.rss < b.rss {
+				b = c
+			}
+		}
+		return b
+	}
+
+	coarse := search(minX, maxX, minY, maxY)
+	b := best(coarse)
+	// Refine around the best coarse cell.
+	stepX := (maxX - minX) / (localizeGrid - 1)
+	stepY := (maxY - minY) / (localizeGrid - 1)
+	b = best(search(b.x-stepX, b.x+stepX, b.y-stepY, b.y+stepY))
+
+	ref, rss := fit(b.x, b.y)
+	est := &LocationEstimate{
+		Lat:        lat0 + b.y/mPerLat,
+		Lon:        lon0 + b.x/mPerLon,
+		RefDBM:     ref,
+		RMSErrorDB: math.Sqrt(rss / float64(len(levels))),
+		RadiusM:    math.Hypot(stepX, stepY),
+	}
+	for _, c := range coarse {
+		if (c.rss-rss)/(shadowingDB*shadowingDB) <= chiSquare95 {
+			est.RadiusM = math.Max(est.RadiusM, math.Hypot(c.x-b.x, c.y-b.y))
+		}
+	}
+	return est, nil
+}
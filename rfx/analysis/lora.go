@@ -0,0 +1,52 @@
+package analysis
+
+import (
+	"sort"
+
+	"github.com/samuel/rfexplorer/rfx/bands"
+)
+
+// LoRaChannelReport is the measured occupancy of a LoRaWAN channel along
+// with the regulatory context of the sub-band it falls in.
+type LoRaChannelReport struct {
+	ChannelOccupancy
+	// SubBand is the regulatory sub-band containing the channel, if any.
+	SubBand *bands.Channel
+	// DutyCycleLimit is the duty cycle limit of the sub-band or 0 if there
+	// is none.
+	DutyCycleLimit float64
+	// OverLimit is true when the measured occupancy exceeds the duty cycle
+	// limit, which means the channel is shared by many transmitters (or
+	// someone isn't following the rules).
+	OverLimit bool
+}
+
+// RankLoRaChannels ranks the measured channels of a LoRaWAN channel plan for
+// gateway planning, least occupied first. subBands (for example
+// bands.ISM868) provides the duty cycle limits and may be nil. The Busy
+// fraction of each channel is used as an estimate of its duty cycle.
+func RankLoRaChannels(occ []ChannelOccupancy, subBands *bands.Band) []LoRaChannelReport {
+	reports := make([]LoRaChannelReport, 0, len(occ))
+	for _, o := range occ {
+		r := LoRaChannelReport{ChannelOccupancy: o}
+		if subBands != nil {
+			for i, sb := range subBands.Channels {
+				if sb.Contains(o.Channel.CenterFreqHZ) {
+					r.SubBand = &subBands.Channels[i]
+					r.DutyCycleLimit = sb.DutyCycle
+					break
+				}
+			}
+		}
+		r.OverLimit = r.DutyCycleLimit > 0 && r.Busy > r.DutyCycleLimit
+		reports = append(reports, r)
+	}
+	sort.SliceStable(reports, func(i, j int) bool {
+		a, b := reports[i], reports[j]
+		if a.Busy != b.Busy {
+			return a.Busy < b.Busy
+		}
+		return a.MeanDBM < b.MeanDBM
+	})
+	return reports
+}
@@ -0,0 +1,105 @@
+// Package analysis provides measurements computed from sweep data.
+package analysis
+
+import (
+	"github.com/samuel/rfexplorer/rfx"
+	"github.com/samuel/rfexplorer/rfx/bands"
+)
+
+// ChannelOccupancy is the measured occupancy of a single channel.
+type ChannelOccupancy struct {
+	Channel bands.Channel
+	// Busy is the fraction of sweeps in which the channel peak was at or
+	// above the threshold.
+	Busy float64
+	// MeanDBM is the average of the per sweep channel peaks.
+	MeanDBM float64
+	// MaxDBM is the highest level seen in the channel.
+	MaxDBM float64
+	// Sweeps is the number of sweeps that covered the channel.
+	Sweeps int
+}
+
+// Occupancy measures how often each channel of a band is in use over a
+// series of sweeps. A channel is in use in a sweep if any sample within it
+// is at or above the threshold.
+type Occupancy struct {
+	Band         *bands.Band
+	ThresholdDBM float64
+
+	busy   []int
+	sum    []float64
+	max    []float64
+	sweeps []int
+}
+
+// NewOccupancy returns a new occupancy measurement for the channels of band.
+func NewOccupancy(band *bands.Band, thresholdDBM float64) *Occupancy {
+	n := len(band.Channels)
+	o := &Occupancy{
+		Band:         band,
+		ThresholdDBM: thresholdDBM,
+		busy:         make([]int, n),
+		sum:          make([]float64, n),
+		max:          make([]float64, n),
+		sweeps:       make([]int, n),
+	}
+	for i := range o.max {
+		o.max[i] = -999
+	}
+	return o
+}
+
+// noDataDBM marks a sample without a measurement, such as one of a
+// max-hold that no sweep has covered yet.
+const noDataDBM = -999
+
+// Add adds a sweep to the measurement. Channels not fully covered by the
+// sweep, or without any samples that hold a measurement, are not updated.
+func (o *Occupancy) Add(config *rfx.CurrentConfigPacket, samples []float64) {
+	startHZ := config.StartFreqKHZ * 1000
+	endHZ := startHZ + (len(samples)-1)*config.FreqStepHZ
+	for ci, c := range o.Band.Channels {
+		if c.LowFreqHZ() < startHZ || c.HighFreqHZ() > endHZ {
+			continue
+		}
+		peak, found := -999.0, false
+		for i, s := range samples {
+			f := startHZ + i*config.FreqStepHZ
+			if f >= c.LowFreqHZ() && f <= c.HighFreqHZ() && s > noDataDBM {
+				found = true
+				if s > peak {
+					peak = s
+				}
+			}
+		}
+		if !found {
+			continue
+		}
+		o.sweeps[ci]++
+		o.sum[ci] += peak
+		if peak > o.max[ci] {
+			o.max[ci] = peak
+		}
+		if peak >= o.ThresholdDBM {
+			o.busy[ci]++
+		}
+	}
+}
+
+// Result returns the occupancy of every channel in band order.
+func (o *Occupancy) Result() []ChannelOccupancy {
+	res := make([]ChannelOccupancy, len(o.Band.Channels))
+	for i, c := range o.Band.Channels {
+		res[i] = ChannelOccupancy{
+			Channel: c,
+			MaxDBM:  o.max[i],
+			Sweeps:  o.sweeps[i],
+		}
+		if o.sweeps[i] != 0 {
+			res[i].Busy = float64(o.busy[i]) / float64(o.sweeps[i])
+			res[i].MeanDBM = o.sum[i] / float64(o.sweeps[i])
+		}
+	}
+	return res
+}
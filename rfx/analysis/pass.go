@@ -0,0 +1,106 @@
+package analysis
+
+import (
+	"sort"
+	"time"
+
+	"github.com/samuel/rfexplorer/rfx"
+	"github.com/samuel/rfexplorer/rfx/bands"
+)
+
+// Pass is a period during which a carrier was present in a channel, such as
+// a satellite pass.
+type Pass struct {
+	Channel  bands.Channel
+	Start    time.Time
+	End      time.Time
+	PeakDBM  float64
+	PeakTime time.Time
+}
+
+// PassDetector detects the appearance and disappearance of carriers in the
+// channels of a band. A carrier is present when the channel peak is at least
+// MarginDB above the sweep's noise floor (its median level). A pass ends
+// once the carrier has been absent for Hangover, which bridges short fades.
+type PassDetector struct {
+	Band     *bands.Band
+	MarginDB float64
+	Hangover time.Duration
+
+	active   []*Pass
+	lastSeen []time.Time
+}
+
+// NewPassDetector returns a detector for the channels of band with a 10 dB
+// margin and 30 second hangover.
+func NewPassDetector(band *bands.Band) *PassDetector {
+	return &PassDetector{
+		Band:     band,
+		MarginDB: 10,
+		Hangover: 30 * time.Second,
+		active:   make([]*Pass, len(band.Channels)),
+		lastSeen: make([]time.Time, len(band.Channels)),
+	}
+}
+
+// Add processes a sweep received at time t and returns the passes that
+// started and ended with it. Ended passes have End set to the last time the
+// carrier was seen.
+func (d *PassDetector) Add(t time.Time, config *rfx.CurrentConfigPacket, samples []float64) (started, ended []Pass) {
+	if len(samples) == 0 {
+		return nil, nil
+	}
+	floor := median(samples)
+	startHZ := config.StartFreqKHZ * 1000
+	for ci, c := range d.Band.Channels {
+		peak, found := -999.0, false
+		for i, s := range samples {
+			f := startHZ + i*config.FreqStepHZ
+			if f >= c.LowFreqHZ() && f <= c.HighFreqHZ() {
+				found = true
+				if s > peak {
+					peak = s
+				}
+			}
+		}
+		if !found {
+			continue
+		}
+		p := d.active[ci]
+		if peak-floor >= d.MarginDB {
+			d.lastSeen[ci] = t
+			if p == nil {
+				p = &Pass{Channel: c, Start: t, PeakDBM: peak, PeakTime: t}
+				d.active[ci] = p
+				started = append(started, *p)
+			} else if peak > p.PeakDBM {
+				p.PeakDBM = peak
+				p.PeakTime = t
+			}
+		} else if p != nil && t.Sub(d.lastSeen[ci]) >= d.Hangover {
+			p.End = d.lastSeen[ci]
+			ended = append(ended, *p)
+			d.active[ci] = nil
+		}
+	}
+	return started, ended
+}
+
+// Flush ends and returns all passes still in progress.
+func (d *PassDetector) Flush() []Pass {
+	var ended []Pass
+	for ci, p := range d.active {
+		if p != nil {
+			p.End = d.lastSeen[ci]
+			ended = append(ended, *p)
+			d.active[ci] = nil
+		}
+	}
+	return ended
+}
+
+func median(samples []float64) float64 {
+	s := append([]float64(nil), samples...)
+	sort.Float64s(s)
+	return s[len(s)/2]
+}
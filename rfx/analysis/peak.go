@@ -0,0 +1,109 @@
+package analysis
+
+import (
+	"math"
+	"sort"
+
+	"github.com/samuel/rfexplorer/rfx"
+)
+
+// InterpolatePeak estimates the frequency and level of the peak at sample i
+// to a finer resolution than the sweep step by fitting a parabola through
+// the sample and its two neighbors. If i is at either end of the sweep or
+// isn't a local maximum then the sample's own frequency and level are
+// returned.
+func InterpolatePeak(config *rfx.CurrentConfigPacket, samples []float64, i int) (freqHZ, levelDBM float64) {
+	freqHZ = float64(config.StartFreqKHZ)*1000 + float64(i*config.FreqStepHZ)
+	levelDBM = samples[i]
+	if i <= 0 || i >= len(samples)-1 {
+		return freqHZ, levelDBM
+	}
+	a, b, c := samples[i-1], samples[i], samples[i+1]
+	if b < a || b < c {
+		return freqHZ, levelDBM
+	}
+	d := a - 2*b + c
+	if d == 0 {
+		// Flat top
+		return freqHZ, levelDBM
+	}
+	// Offset of the vertex from i in steps, within [-0.5,0.5].
+	p := 0.5 * (a - c) / d
+	return freqHZ + p*float64(config.FreqStepHZ), b - 0.25*(a-c)*p
+}
+
+// PeakOptions configures FindPeaks.
+type PeakOptions struct {
+	// Max is the number of peaks to return, all of them if 0.
+	Max int
+	// ThresholdDB is how far above the noise floor, taken to be the median
+	// level of the sweep, a peak must be.
+	ThresholdDB float64
+	// MinSpacingHZ is the minimum separation of peaks. Of peaks closer
+	// together only the strongest is returned.
+	MinSpacingHZ int
+}
+
+// Peak is a local maximum of a sweep.
+type Peak struct {
+	// Index is the sample of the peak.
+	Index int
+	// FreqHZ and LevelDBM are interpolated, see InterpolatePeak.
+	FreqHZ   float64
+	LevelDBM float64
+	// BandwidthHZ is the width where the level is within 3 dB of the peak
+	// sample, interpolated between samples. It's 0 if the level doesn't
+	// fall by 3 dB on both sides within the sweep.
+	BandwidthHZ float64
+}
+
+// FindPeaks returns the strongest local maxima of a sweep, strongest first.
+// A run of equal samples counts as one maximum at its first sample. It
+// returns nil for a sweep without a config.
+func FindPeaks(sweep *rfx.SweepDataPacket, opts PeakOptions) []Peak {
+	config, samples := sweep.Config, sweep.Samples
+	if config == nil || len(samples) == 0 {
+		return nil
+	}
+	threshold := median(samples) + opts.ThresholdDB
+	var candidates []int
+	for i := 0; i < len(samples); {
+		// Find the end of a run of equal samples.
+		j := i + 1
+		for j < len(samples) && samples[j] == samples[i] {
+			j++
+		}
+		if (i == 0 || samples[i-1] < samples[i]) && (j == len(samples) || samples[j] < samples[i]) && samples[i] >= threshold {
+			candidates = append(candidates, i)
+		}
+		i = j
+	}
+	sort.SliceStable(candidates, func(a, b int) bool {
+		return samples[candidates[a]] > samples[candidates[b]]
+	})
+
+	var peaks []Peak
+	for _, i := range candidates {
+		if opts.Max > 0 && len(peaks) == opts.Max {
+			break
+		}
+		freqHZ, levelDBM := InterpolatePeak(config, samples, i)
+		tooClose := false
+		for _, p := range peaks {
+			if math.Abs(p.FreqHZ-freqHZ) < float64(opts.MinSpacingHZ) {
+				tooClose = true
+				break
+			}
+		}
+		if tooClose {
+			continue
+		}
+		peaks = append(peaks, Peak{
+			Index:       i,
+			FreqHZ:      freqHZ,
+			LevelDBM:    levelDBM,
+			BandwidthHZ: ndbBandwidth(config, samples, i, 3).WidthHZ(),
+		})
+	}
+	return peaks
+}
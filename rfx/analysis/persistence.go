@@ -0,0 +1,142 @@
+package analysis
+
+import (
+	"math"
+
+	"github.com/samuel/rfexplorer/rfx"
+)
+
+// Persistence counts how often each level occurs at each frequency over a
+// sliding window of sweeps. Drawn as a density it's the persistence view of
+// a phosphor display, which shows intermittent and overlapping signals that
+// max-hold hides under the strongest level seen.
+//
+// The frequency grid is set by the first sweep added. Later sweeps of other
+// grids are resampled onto it.
+type Persistence struct {
+	// MinDBM is the bottom of the lowest bin. Levels outside of the bins
+	// are counted in the bin at that end.
+	MinDBM float64
+	// BinDB is the height of each bin.
+	BinDB float64
+	// Bins is the number of bins.
+	Bins int
+
+	grid   Grid
+	window int
+	counts []int   // Points by Bins
+	sweeps [][]int // ring of the bin of each point of the sweeps in the window, -1 if none
+	next   int
+}
+
+// NewPersistence returns a Persistence with bins of binDB from minDBM to
+// maxDBM, counting up to window sweeps.
+func NewPersistence(minDBM, maxDBM, binDB float64, window int) *Persistence {
+	if binDB <= 0 {
+		binDB = 1
+	}
+	if window < 1 {
+		window = 1
+	}
+	bins := int(math.Ceil((maxDBM - minDBM) / binDB))
+	if bins < 1 {
+		bins = 1
+	}
+	return &Persistence{MinDBM: minDBM, BinDB: binDB, Bins: bins, window: window}
+}
+
+// Add counts a sweep, dropping the oldest sweep in the window if it's full.
+// Points where the level is NaN aren't counted.
+func (p *Persistence) Add(config *rfx.CurrentConfigPacket, samples []float64) {
+	grid := ConfigGrid(config, len(samples))
+	if len(p.sweeps) == 0 {
+		p.grid = grid
+		p.counts = make([]int, grid.Points*p.Bins)
+	} else if grid != p.grid {
+		samples = Resample(grid, samples, p.grid)
+	}
+	var bins []int
+	if len(p.sweeps) < p.window {
+		bins = make([]int, p.grid.Points)
+		p.sweeps = append(p.sweeps, bins)
+	} else {
+		bins = p.sweeps[p.next]
+		p.next = (p.next + 1) % p.window
+		for i, b := range bins {
+			if b >= 0 {
+				p.counts[i*p.Bins+b]--
+			}
+		}
+	}
+	for i, s := range samples {
+		bins[i] = -1
+		if !math.IsNaN(s) {
+			bins[i] = p.Bin(s)
+			p.counts[i*p.Bins+bins[i]]++
+		}
+	}
+}
+
+// Grid returns the frequency grid of the counts.
+func (p *Persistence) Grid() Grid {
+	return p.grid
+}
+
+// Sweeps returns the number of sweeps in the window.
+func (p *Persistence) Sweeps() int {
+	return len(p.sweeps)
+}
+
+// Bin returns the bin of a level.
+func (p *Persistence) Bin(dbm float64) int {
+	b := int(math.Floor((dbm - p.MinDBM) / p.BinDB))
+	if b < 0 {
+		return 0
+	}
+	if b >= p.Bins {
+		return p.Bins - 1
+	}
+	return b
+}
+
+// LevelDBM returns the level at the center of a bin.
+func (p *Persistence) LevelDBM(bin int) float64 {
+	return p.MinDBM + (float64(bin)+0.5)*p.BinDB
+}
+
+// Count returns the number of sweeps in the window with the level at point
+// in bin.
+func (p *Persistence) Count(point, bin int) int {
+	if point < 0 || point >= p.grid.Points || bin < 0 || bin >= p.Bins || p.counts == nil {
+		return 0
+	}
+	return p.counts[point*p.Bins+bin]
+}
+
+// Density returns the fraction of the sweeps in the window with the level at
+// point in the bins overlapping lowDBM to highDBM.
+func (p *Persistence) Density(point int, lowDBM, highDBM float64) float64 {
+	if len(p.sweeps) == 0 {
+		return 0
+	}
+	lo := int(math.Floor((lowDBM - p.MinDBM) / p.BinDB))
+	hi := int(math.Ceil((highDBM-p.MinDBM)/p.BinDB)) - 1
+	if lo < 0 {
+		lo = 0
+	}
+	if hi >= p.Bins {
+		hi = p.Bins - 1
+	}
+	n := 0
+	for b := lo; b <= hi; b++ {
+		n += p.Count(point, b)
+	}
+	return float64(n) / float64(len(p.sweeps))
+}
+
+// Reset discards all sweeps. The next sweep added sets the grid.
+func (p *Persistence) Reset() {
+	p.counts = nil
+	p.sweeps = nil
+	p.next = 0
+}
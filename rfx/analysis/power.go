@@ -0,0 +1,95 @@
+package analysis
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/samuel/rfexplorer/rfx"
+	"github.com/samuel/rfexplorer/rfx/bands"
+)
+
+// Window weights the samples across a channel.
+type Window int
+
+const (
+	// Rectangular weights all samples in the channel equally.
+	Rectangular Window = iota
+	// Hann and Blackman weight samples toward the center of the channel,
+	// reducing the influence of neighboring channels' edges.
+	Hann
+	Blackman
+)
+
+func (w Window) String() string {
+	switch w {
+	case Rectangular:
+		return "Rectangular"
+	case Hann:
+		return "Hann"
+	case Blackman:
+		return "Blackman"
+	}
+	return fmt.Sprintf("Window(%d)", int(w))
+}
+
+// weight returns the weight of a sample at d across the channel, from 0 at
+// its low edge to 1 at its high edge.
+func (w Window) weight(d float64) float64 {
+	switch w {
+	case Hann:
+		return 0.5 - 0.5*math.Cos(2*math.Pi*d)
+	case Blackman:
+		return 0.42 - 0.5*math.Cos(2*math.Pi*d) + 0.08*math.Cos(4*math.Pi*d)
+	}
+	return 1
+}
+
+// ChannelPowerReading is the power measured in a channel.
+type ChannelPowerReading struct {
+	Channel bands.Channel
+	// PowerDBM is the integrated power in the channel, NaN if no samples
+	// were in it.
+	PowerDBM float64
+	// Samples is the number of samples in the channel.
+	Samples int
+}
+
+// ChannelPower returns the power integrated over each channel of a
+// plan, in plan order. Channels only partly covered by the sweep are
+// measured over the covered part.
+//
+// The power is the sum of the power of the samples in the channel scaled by
+// the step over the RBW, since each sample measures the power within the
+// RBW and neighboring samples overlap when the step is smaller. The window
+// weights are normalized so that a flat spectrum measures the same with any
+// window. It returns nil for a sweep without a config.
+func ChannelPower(sweep *rfx.SweepDataPacket, plan *bands.Band, window Window) []ChannelPowerReading {
+	config := sweep.Config
+	if config == nil {
+		return nil
+	}
+	scale := 1.0
+	if config.RBWKHZ > 0 {
+		scale = float64(config.FreqStepHZ) / float64(config.RBWKHZ*1000)
+	}
+	res := make([]ChannelPowerReading, len(plan.Channels))
+	for ci, c := range plan.Channels {
+		var sum, weights float64
+		n := 0
+		for i, s := range sweep.Samples {
+			diff := sweep.FreqHZ(i) - c.LowFreqHZ()
+			if diff < 0 || diff > c.WidthHZ {
+				continue
+			}
+			w := window.weight(float64(diff) / float64(c.WidthHZ))
+			sum += w * math.Pow(10, s/10)
+			weights += w
+			n++
+		}
+		res[ci] = ChannelPowerReading{Channel: c, PowerDBM: math.NaN(), Samples: n}
+		if weights > 0 {
+			res[ci].PowerDBM = 10 * math.Log10(sum/weights*float64(n)*scale)
+		}
+	}
+	return res
+}
@@ -0,0 +1,90 @@
+package analysis
+
+import (
+	"math"
+
+	"github.com/samuel/rfexplorer/rfx"
+)
+
+// Grid is a set of evenly spaced frequencies such as the bins of a sweep.
+type Grid struct {
+	StartFreqHZ int
+	StepHZ      int
+	Points      int
+}
+
+// ConfigGrid returns the grid of a sweep of n samples received with config.
+func ConfigGrid(config *rfx.CurrentConfigPacket, n int) Grid {
+	return Grid{StartFreqHZ: config.StartFreqKHZ * 1000, StepHZ: config.FreqStepHZ, Points: n}
+}
+
+// FreqHZ returns the frequency of point i.
+func (g Grid) FreqHZ(i int) int {
+	return g.StartFreqHZ + i*g.StepHZ
+}
+
+// EndFreqHZ returns the frequency of the last point.
+func (g Grid) EndFreqHZ() int {
+	return g.FreqHZ(g.Points - 1)
+}
+
+// Resample linearly interpolates samples taken on src onto dst so that
+// sweeps with different spans and steps can be compared point by point.
+// Points of dst outside of src are set to NaN.
+func Resample(src Grid, samples []float64, dst Grid) []float64 {
+	out := make([]float64, dst.Points)
+	for i := range out {
+		out[i] = sampleAt(src, samples, dst.FreqHZ(i))
+	}
+	return out
+}
+
+// sampleAt returns the level at freqHZ interpolated from samples on g, or
+// NaN if g doesn't cover freqHZ.
+func sampleAt(g Grid, samples []float64, freqHZ int) float64 {
+	if len(samples) == 0 || freqHZ < g.StartFreqHZ || freqHZ > g.FreqHZ(len(samples)-1) {
+		return math.NaN()
+	}
+	if g.StepHZ == 0 {
+		return samples[0]
+	}
+	pos := float64(freqHZ-g.StartFreqHZ) / float64(g.StepHZ)
+	i := int(pos)
+	if i >= len(samples)-1 {
+		return samples[len(samples)-1]
+	}
+	frac := pos - float64(i)
+	return samples[i] + frac*(samples[i+1]-samples[i])
+}
+
+// Subtract returns a-b point by point for two sweeps on the same grid, for
+// instance after resampling them with Resample.
+func Subtract(a, b []float64) []float64 {
+	n := len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+	out := make([]float64, n)
+	for i := range out {
+		out[i] = a[i] - b[i]
+	}
+	return out
+}
+
+// Stitch combines sweeps taken on the given grids into one sweep on dst,
+// for instance to join several narrow sweeps into a wide one. Where sweeps
+// overlap the highest level is used. Points not covered by any sweep are
+// set to NaN.
+func Stitch(dst Grid, grids []Grid, sweeps [][]float64) []float64 {
+	out := make([]float64, dst.Points)
+	for i := range out {
+		out[i] = math.NaN()
+		f := dst.FreqHZ(i)
+		for j, g := range grids {
+			if s := sampleAt(g, sweeps[j], f); !math.IsNaN(s) && (math.IsNaN(out[i]) || s > out[i]) {
+				out[i] = s
+			}
+		}
+	}
+	return out
+}
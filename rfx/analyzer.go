@@ -1,77 +1,148 @@
 package rfx
 
-// import (
-// 	"fmt"
-// 	"sync/atomic"
-// )
-
-// type Analyzer struct {
-// 	rf     *RFExplorer
-// 	config atomic.Value // *CurrentConfigPacket
-// 	ch     chan AnalyzerMessage
-// }
-
-// type AnalyzerMessage interface{}
-
-// type SamplesMessage struct {
-// 	Samples []Sample
-// }
-
-// type Sample struct {
-// 	FreqHZ int
-// 	Amp    int
-// }
-
-// func NewAnalyzer(device string) (*Analyzer, error) {
-// 	rf, err := New("/dev/tty.SLAB_USBtoUART")
-// 	if err != nil {
-// 		return nil, err
-// 	}
-// 	// Initial setup and fetch config
-// 	if err := rf.RequestConfig(); err != nil {
-// 		return nil, err
-// 	}
-// 	a := &Analyzer{
-// 		rf: rf,
-// 		ch: make(chan AnalyzerMessage, 16),
-// 	}
-// setupLoop:
-// 	for {
-// 		pkt, ok := <-rf.Chan()
-// 		if !ok {
-// 			rf.Close()
-// 			return nil, fmt.Errorf("rfx: failed to get current config")
-// 		}
-// 		switch pkt := pkt.(type) {
-// 		case *CurrentConfigPacket:
-// 			a.config.Store(pkt)
-// 			break setupLoop
-// 		}
-// 	}
-// 	go a.readLoop()
-// 	return a, nil
-// }
-
-// func (a *Analyzer) Close() error {
-// 	return a.rf.Close()
-// }
-
-// func (a *Analyzer) Chan() chan AnalyzerMessage {
-// 	return a.ch
-// }
-
-// func (a *Analyzer) Config() *CurrentConfigPacket {
-// 	return a.config.Load()
-// }
-
-// func (a *Analyzer) readLoop() {
-// 	for {
-// 		pkt := <-a.rf.Chan()
-// 		switch pkt := pkt.(type) {
-// 		case *CurrentConfigPacket:
-// 			a.config.Store(pkt)
-// 			a.ch <- pkt
-// 		case *rfx.SweepDataPacket:
-// 		}
-// 	}
-// }
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// analyzerQueueSize is the number of messages an Analyzer buffers for a
+// slow reader.
+const analyzerQueueSize = 16
+
+// Analyzer is a higher level interface to a spectrum analyzer for
+// applications that want sweeps as frequencies and levels without handling
+// packets. It reads packets with Subscribe so Chan of the underlying
+// RFExplorer remains free for other uses.
+type Analyzer struct {
+	rf     *RFExplorer
+	paused int32 // atomic, 1 while paused
+	ch     chan AnalyzerMessage
+	cancel func()
+	done   chan struct{}
+	once   sync.Once
+}
+
+// AnalyzerMessage is a *SamplesMessage or, whenever the device's
+// configuration changes, the new *CurrentConfigPacket.
+type AnalyzerMessage interface{}
+
+// SamplesMessage is a sweep.
+type SamplesMessage struct {
+	Time    time.Time
+	Config  *CurrentConfigPacket
+	Samples []Sample
+}
+
+// Sample is the level at a frequency.
+type Sample struct {
+	FreqHZ int
+	DBm    float64
+}
+
+// NewAnalyzer connects to the analyzer on device, see New.
+func NewAnalyzer(device string, opts ...Option) (*Analyzer, error) {
+	rf, err := New(device, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return NewAnalyzerFrom(rf), nil
+}
+
+// NewAnalyzerFrom returns an Analyzer that uses an already connected
+// RFExplorer, which is closed when the Analyzer is.
+func NewAnalyzerFrom(rf *RFExplorer) *Analyzer {
+	ch, cancel := rf.Subscribe("SweepData", "StateChanged")
+	a := &Analyzer{
+		rf:     rf,
+		ch:     make(chan AnalyzerMessage, analyzerQueueSize),
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go a.readLoop(ch)
+	return a
+}
+
+// RFExplorer returns the underlying connection for features the Analyzer
+// doesn't cover.
+func (a *Analyzer) RFExplorer() *RFExplorer {
+	return a.rf
+}
+
+// Close closes the connection to the device and Chan.
+func (a *Analyzer) Close() error {
+	a.once.Do(func() { close(a.done) })
+	a.cancel()
+	return a.rf.Close()
+}
+
+// Chan returns the messages from the analyzer. It's closed when the
+// connection ends.
+func (a *Analyzer) Chan() <-chan AnalyzerMessage {
+	return a.ch
+}
+
+// Config returns the current configuration of the device.
+func (a *Analyzer) Config() *CurrentConfigPacket {
+	return a.rf.Config()
+}
+
+// SetBand sets the analyzer to sweep the given range, clamped to the limits
+// of the active module, and waits for the device to apply it.
+func (a *Analyzer) SetBand(startFreqKHZ, endFreqKHZ int) error {
+	return a.rf.Configure(startFreqKHZ, endFreqKHZ)
+}
+
+// Pause stops the device from sweeping. Sweeps already on their way are
+// discarded.
+func (a *Analyzer) Pause() error {
+	atomic.StoreInt32(&a.paused, 1)
+	return a.rf.Hold()
+}
+
+// Resume starts the device sweeping again after Pause.
+func (a *Analyzer) Resume() error {
+	atomic.StoreInt32(&a.paused, 0)
+	return a.rf.RequestConfig()
+}
+
+// Paused returns true between Pause and Resume.
+func (a *Analyzer) Paused() bool {
+	return atomic.LoadInt32(&a.paused) != 0
+}
+
+func (a *Analyzer) readLoop(ch <-chan Packet) {
+	defer close(a.ch)
+	for pkt := range ch {
+		switch pkt := pkt.(type) {
+		case *StateChangedPacket:
+			if pkt.Changed&StateConfig != 0 && pkt.Config != nil {
+				if !a.deliver(pkt.Config) {
+					return
+				}
+			}
+		case *SweepDataPacket:
+			if a.Paused() || pkt.Config == nil {
+				continue
+			}
+			samples := make([]Sample, len(pkt.Samples))
+			for i, s := range pkt.Samples {
+				samples[i] = Sample{FreqHZ: pkt.FreqHZ(i), DBm: s}
+			}
+			if !a.deliver(&SamplesMessage{Time: pkt.Time, Config: pkt.Config, Samples: samples}) {
+				return
+			}
+		}
+	}
+}
+
+// deliver queues msg on Chan and returns false if the Analyzer was closed
+// instead.
+func (a *Analyzer) deliver(msg AnalyzerMessage) bool {
+	select {
+	case a.ch <- msg:
+		return true
+	case <-a.done:
+		return false
+	}
+}
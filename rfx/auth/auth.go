@@ -0,0 +1,199 @@
+// Package auth secures the HTTP servers with TLS, API tokens, and client
+// certificates, giving each client either read-only or control access.
+package auth
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Role is the access a client has.
+type Role int
+
+const (
+	// RoleNone has no access.
+	RoleNone Role = iota
+	// RoleRead can query data but not change anything.
+	RoleRead
+	// RoleControl can also send data and commands.
+	RoleControl
+)
+
+func (r Role) String() string {
+	switch r {
+	case RoleNone:
+		return "none"
+	case RoleRead:
+		return "read"
+	case RoleControl:
+		return "control"
+	}
+	return fmt.Sprintf("Role(%d)", int(r))
+}
+
+// ParseRole parses the name of a role as returned by Role.String.
+func ParseRole(s string) (Role, error) {
+	switch s {
+	case "read":
+		return RoleRead, nil
+	case "control":
+		return RoleControl, nil
+	}
+	return RoleNone, fmt.Errorf("auth: unknown role %q, expected read or control", s)
+}
+
+// Tokens maps API tokens to the role they grant.
+type Tokens map[string]Role
+
+// ReadTokens reads tokens from a file with one "<role> <token>" line per
+// token. Blank lines and lines starting with '#' are ignored.
+func ReadTokens(r io.Reader) (Tokens, error) {
+	tokens := make(Tokens)
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("auth: line %d: expected role and token", lineNo)
+		}
+		role, err := ParseRole(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("auth: line %d: %s", lineNo, err)
+		}
+		tokens[fields[1]] = role
+	}
+	return tokens, scanner.Err()
+}
+
+// Authenticator decides the role of requests. An Authenticator without
+// tokens or a client certificate role gives every request control, which
+// is only appropriate when serving on localhost; servers should refuse to
+// listen elsewhere without either.
+type Authenticator struct {
+	// Tokens are accepted as "Authorization: Bearer <token>".
+	Tokens Tokens
+	// ClientCertRole is given to clients that present a certificate that
+	// was verified against the server's client CAs.
+	ClientCertRole Role
+}
+
+// Role returns the role of a request, the highest of its token and client
+// certificate.
+func (a *Authenticator) Role(r *http.Request) Role {
+	if len(a.Tokens) == 0 && a.ClientCertRole == RoleNone {
+		return RoleControl
+	}
+	role := RoleNone
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		role = a.ClientCertRole
+	}
+	if h := r.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+		given := []byte(strings.TrimPrefix(h, "Bearer "))
+		// Compare against every token so the time taken doesn't reveal
+		// which ones exist.
+		for token, tr := range a.Tokens {
+			if subtle.ConstantTimeCompare(given, []byte(token)) == 1 && tr > role {
+				role = tr
+			}
+		}
+	}
+	return role
+}
+
+// RequiredRole returns the role needed for a request: reads for GET and
+// HEAD and control for anything else.
+func RequiredRole(r *http.Request) Role {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return RoleRead
+	}
+	return RoleControl
+}
+
+// Handler returns a handler that serves requests with next if the client
+// has the role they require.
+func (a *Authenticator) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		role := a.Role(r)
+		switch {
+		case role == RoleNone:
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+		case role < RequiredRole(r):
+			http.Error(w, "forbidden", http.StatusForbidden)
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// ServerTLSConfig returns a TLS config serving the given certificate. If
+// clientCAFile isn't empty client certificates signed by the CAs in it are
+// verified, and required if requireClientCert is true. Otherwise they're
+// optional so that clients can use tokens instead.
+func ServerTLSConfig(certFile, keyFile, clientCAFile string, requireClientCert bool) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if clientCAFile != "" {
+		if config.ClientCAs, err = loadCertPool(clientCAFile); err != nil {
+			return nil, err
+		}
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+		if requireClientCert {
+			config.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	return config, nil
+}
+
+// ClientTLSConfig returns a TLS config for connecting to a server. If caFile
+// isn't empty the server must have a certificate signed by a CA in it,
+// otherwise the system roots are used. If certFile isn't empty the client
+// presents it to the server.
+func ClientTLSConfig(caFile, certFile, keyFile string) (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	var err error
+	if caFile != "" {
+		if config.RootCAs, err = loadCertPool(caFile); err != nil {
+			return nil, err
+		}
+	}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+func loadCertPool(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("auth: no certificates in %s", path)
+	}
+	return pool, nil
+}
@@ -0,0 +1,44 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	tokens, err := ReadTokens(strings.NewReader("# dashboards\nread r3ad\ncontrol c0ntrol\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &Authenticator{Tokens: tokens}
+	h := a.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for _, c := range []struct {
+		method, token string
+		want          int
+	}{
+		{"GET", "", http.StatusUnauthorized},
+		{"GET", "wrong", http.StatusUnauthorized},
+		{"GET", "r3ad", http.StatusOK},
+		{"POST", "r3ad", http.StatusForbidden},
+		{"POST", "c0ntrol", http.StatusOK},
+	} {
+		r := httptest.NewRequest(c.method, "/api/nodes", nil)
+		if c.token != "" {
+			r.Header.Set("Authorization", "Bearer "+c.token)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != c.want {
+			t.Errorf("%s with token %q: status %d, want %d", c.method, c.token, w.Code, c.want)
+		}
+	}
+
+	if _, err := ReadTokens(strings.NewReader("admin secret\n")); err == nil {
+		t.Error("expected an error for an unknown role")
+	}
+	if role := (&Authenticator{}).Role(httptest.NewRequest("POST", "/", nil)); role != RoleControl {
+		t.Errorf("unconfigured authenticator gave %s", role)
+	}
+}
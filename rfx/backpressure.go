@@ -0,0 +1,133 @@
+package rfx
+
+import (
+	"fmt"
+)
+
+// Backpressure is what the reader does with a packet when Chan is full
+// because the client isn't keeping up.
+type Backpressure int
+
+const (
+	// BackpressureBlock waits for the client to make room, and the
+	// device's output backs up while the reader waits. It only loses
+	// packets while there are subscribers, see Subscribe, or a request is
+	// waiting for a response, such as GetConfig or GetPresets. Chan may
+	// not be read at all then, so its oldest packets are discarded like
+	// with BackpressureDropOldest rather than blocking the subscribers or
+	// the response. Discarded packets are counted in LinkStats.Dropped.
+	BackpressureBlock Backpressure = iota
+	// BackpressureDropOldest discards the oldest packet on Chan to make
+	// room for the new one.
+	BackpressureDropOldest
+	// BackpressureDropNewest discards the new packet.
+	BackpressureDropNewest
+	// BackpressureCoalesceSweeps discards the sweeps waiting on Chan so
+	// that only the latest is kept. If Chan is full of other packets it
+	// waits like BackpressureBlock, with the same exceptions.
+	BackpressureCoalesceSweeps
+)
+
+func (b Backpressure) String() string {
+	switch b {
+	case BackpressureBlock:
+		return "block"
+	case BackpressureDropOldest:
+		return "drop-oldest"
+	case BackpressureDropNewest:
+		return "drop-newest"
+	case BackpressureCoalesceSweeps:
+		return "coalesce-sweeps"
+	}
+	return fmt.Sprintf("Backpressure(%d)", int(b))
+}
+
+// ParseBackpressure parses the name of a policy as returned by String.
+func ParseBackpressure(s string) (Backpressure, error) {
+	for b := BackpressureBlock; b <= BackpressureCoalesceSweeps; b++ {
+		if b.String() == s {
+			return b, nil
+		}
+	}
+	return 0, fmt.Errorf("rfx: unknown backpressure policy %q", s)
+}
+
+// send sends pkt to Chan applying the backpressure policy and counts the
+// packets dropped. While there are subscribers Chan may not be read at
+// all, so rather than block the reader its oldest packets are discarded.
+// While a request is waiting for a response the reader doesn't block
+// either, see deliver, since the response would be stuck behind packets
+// nobody may be reading.
+func (r *RFExplorer) send(pkt Packet, wake <-chan struct{}) {
+	policy, _ := r.backpressure.Load().(Backpressure)
+	if policy == BackpressureBlock && r.subs.active() {
+		policy = BackpressureDropOldest
+	}
+	r.link.drop(deliver(r.readCh, pkt, policy, r.closeCh, wake))
+}
+
+// deliver sends pkt to ch applying policy, or gives up when done is closed.
+// A policy that waits for room discards the oldest packets instead once
+// wake is closed. It returns the number of packets dropped. The reader must
+// be the only sender on ch.
+func deliver(ch chan Packet, pkt Packet, policy Backpressure, done, wake <-chan struct{}) int {
+	select {
+	case ch <- pkt:
+		return 0
+	default:
+	}
+	dropped := 0
+	switch policy {
+	case BackpressureDropOldest:
+		for {
+			select {
+			case ch <- pkt:
+				return dropped
+			default:
+			}
+			select {
+			case <-ch:
+				dropped++
+			default:
+			}
+		}
+	case BackpressureDropNewest:
+		return 1
+	case BackpressureCoalesceSweeps:
+		if _, ok := pkt.(*SweepDataPacket); ok {
+			dropped = dropQueuedSweeps(ch)
+		}
+	}
+	select {
+	case ch <- pkt:
+	case <-done:
+	case <-wake:
+		dropped += deliver(ch, pkt, BackpressureDropOldest, done, nil)
+	}
+	return dropped
+}
+
+// dropQueuedSweeps removes the sweeps waiting on ch, keeping the other
+// packets in order, and returns how many it removed. The reader is the
+// only sender so nothing is added in the meantime, and the client only
+// ever receives packets in order.
+func dropQueuedSweeps(ch chan Packet) int {
+	var kept []Packet
+	dropped := 0
+	for drained := false; !drained; {
+		select {
+		case p := <-ch:
+			if _, ok := p.(*SweepDataPacket); ok {
+				dropped++
+			} else {
+				kept = append(kept, p)
+			}
+		default:
+			drained = true
+		}
+	}
+	for _, p := range kept {
+		ch <- p
+	}
+	return dropped
+}
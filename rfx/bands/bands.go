@@ -0,0 +1,145 @@
+// Package bands provides channel plans for common radio services.
+package bands
+
+import "strings"
+
+// Channel is a single channel in a band plan.
+type Channel struct {
+	Name         string
+	CenterFreqHZ int
+	WidthHZ      int
+	Note         string
+	// Highlight marks channels of particular interest such as the BLE
+	// advertising channels.
+	Highlight bool
+	// DutyCycle is the regulatory duty cycle limit as a fraction (0.01 for
+	// 1%), or 0 if there is no limit.
+	DutyCycle float64
+	// Regions and Countries restrict where the channel may be used. Empty
+	// means everywhere the band applies.
+	Regions   []Region
+	Countries []string
+}
+
+// LowFreqHZ returns the lower edge of the channel.
+func (c Channel) LowFreqHZ() int {
+	return c.CenterFreqHZ - c.WidthHZ/2
+}
+
+// HighFreqHZ returns the upper edge of the channel.
+func (c Channel) HighFreqHZ() int {
+	return c.CenterFreqHZ + c.WidthHZ/2
+}
+
+// Contains returns true if freqHZ falls strictly within the channel.
+func (c Channel) Contains(freqHZ int) bool {
+	return freqHZ > c.LowFreqHZ() && freqHZ < c.HighFreqHZ()
+}
+
+// Overlaps returns true if the channel overlaps with o.
+func (c Channel) Overlaps(o Channel) bool {
+	return c.LowFreqHZ() < o.HighFreqHZ() && o.LowFreqHZ() < c.HighFreqHZ()
+}
+
+// Band is a named set of channels.
+type Band struct {
+	Name        string
+	Description string
+	Channels    []Channel
+	// Regions and Countries restrict where the band plan applies. Empty
+	// means everywhere.
+	Regions   []Region
+	Countries []string
+}
+
+// Channel returns the channel with the given name.
+func (b *Band) Channel(name string) (Channel, bool) {
+	for _, c := range b.Channels {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return Channel{}, false
+}
+
+// ChannelsAt returns all channels that contain freqHZ. Channels in many
+// band plans overlap so more than one may be returned.
+func (b *Band) ChannelsAt(freqHZ int) []Channel {
+	var chs []Channel
+	for _, c := range b.Channels {
+		if c.Contains(freqHZ) {
+			chs = append(chs, c)
+		}
+	}
+	return chs
+}
+
+// Range returns the lowest and highest frequency covered by the band's
+// channels.
+func (b *Band) Range() (lowHZ, highHZ int) {
+	for i, c := range b.Channels {
+		if i == 0 || c.LowFreqHZ() < lowHZ {
+			lowHZ = c.LowFreqHZ()
+		}
+		if i == 0 || c.HighFreqHZ() > highHZ {
+			highHZ = c.HighFreqHZ()
+		}
+	}
+	return lowHZ, highHZ
+}
+
+var registry []*Band
+
+// Register adds a band to the set returned by All and Lookup. It is not
+// safe to call concurrently with lookups and is intended to be called
+// from init.
+func Register(b *Band) {
+	registry = append(registry, b)
+}
+
+// All returns all registered bands.
+func All() []*Band {
+	return append([]*Band(nil), registry...)
+}
+
+// Lookup returns the band with the given name. The comparison is
+// case-insensitive.
+func Lookup(name string) *Band {
+	for _, b := range registry {
+		if strings.EqualFold(b.Name, name) {
+			return b
+		}
+	}
+	return nil
+}
+
+// At returns all registered bands with a channel containing freqHZ.
+func At(freqHZ int) []*Band {
+	var bs []*Band
+	for _, b := range registry {
+		if len(b.ChannelsAt(freqHZ)) != 0 {
+			bs = append(bs, b)
+		}
+	}
+	return bs
+}
+
+func init() {
+	Register(WiFi24)
+	Register(VTX58)
+	Register(RC24)
+	Register(RC900)
+	Register(DJIO3)
+	Register(Zigbee24)
+	Register(BLE)
+	Register(DECT)
+	Register(DECT60)
+	Register(ATSC)
+	Register(DVBT)
+	Register(WxSat137)
+	Register(EU868)
+	Register(US915)
+	Register(ISM433)
+	Register(ISM868)
+	Register(ISM915)
+}
@@ -0,0 +1,117 @@
+package bands
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	if b := Lookup("WiFi24"); b != WiFi24 {
+		t.Fatalf("Lookup(WiFi24) = %v, want WiFi24", b)
+	}
+	if b := Lookup("nonexistent"); b != nil {
+		t.Fatalf("Lookup(nonexistent) = %v, want nil", b)
+	}
+	c, ok := VTX58.Channel("C1")
+	if !ok || c.CenterFreqHZ != 5658000000 {
+		t.Fatalf("VTX58.Channel(C1) = %+v, %t", c, ok)
+	}
+}
+
+func TestChannelsAt(t *testing.T) {
+	chs := WiFi24.ChannelsAt(2437000000)
+	var names []string
+	for _, c := range chs {
+		names = append(names, c.Name)
+	}
+	// Channels are 5 MHz apart and 20 MHz wide so the center of channel 6
+	// falls within its immediate neighbours but exactly on the edge of
+	// channels 4 and 8.
+	if len(names) != 3 || names[0] != "5" || names[2] != "7" {
+		t.Fatalf("WiFi24.ChannelsAt(2437 MHz) = %v", names)
+	}
+	if chs := WiFi24.ChannelsAt(5000000000); len(chs) != 0 {
+		t.Fatalf("WiFi24.ChannelsAt(5 GHz) = %v, want none", chs)
+	}
+}
+
+func TestRange(t *testing.T) {
+	lo, hi := Zigbee24.Range()
+	if lo != 2404000000 || hi != 2481000000 {
+		t.Fatalf("Zigbee24.Range() = %d, %d", lo, hi)
+	}
+}
+
+func TestBLE(t *testing.T) {
+	if len(BLE.Channels) != 40 {
+		t.Fatalf("len(BLE.Channels) = %d, want 40", len(BLE.Channels))
+	}
+	for name, freq := range map[string]int{"37": 2402000000, "0": 2404000000, "10": 2424000000, "38": 2426000000, "11": 2428000000, "36": 2478000000, "39": 2480000000} {
+		c, ok := BLE.Channel(name)
+		if !ok || c.CenterFreqHZ != freq {
+			t.Errorf("BLE.Channel(%s) = %+v, %t, want center %d", name, c, ok, freq)
+		}
+	}
+}
+
+func TestTV(t *testing.T) {
+	if chs := ATSC.ChannelsAt(575000000); len(chs) != 1 || chs[0].Name != "31" {
+		t.Errorf("ATSC.ChannelsAt(575 MHz) = %+v, want channel 31", chs)
+	}
+	if chs := DVBT.ChannelsAt(610000000); len(chs) != 1 || chs[0].Name != "38" {
+		t.Errorf("DVBT.ChannelsAt(610 MHz) = %+v, want channel 38", chs)
+	}
+}
+
+func TestReadStations(t *testing.T) {
+	const input = `# Local stations
+88.5 KQED San Francisco
+98.1 MHz KISQ
+|KFOG   |FM |104.5  MHz |
+`
+	b, err := ReadStations(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Channel{
+		{Name: "KQED", CenterFreqHZ: 88500000, WidthHZ: FMStationWidth, Note: "San Francisco"},
+		{Name: "KISQ", CenterFreqHZ: 98100000, WidthHZ: FMStationWidth},
+		{Name: "KFOG", CenterFreqHZ: 104500000, WidthHZ: FMStationWidth, Note: "FM"},
+	}
+	if len(b.Channels) != len(want) {
+		t.Fatalf("got %d stations, want %d: %+v", len(b.Channels), len(want), b.Channels)
+	}
+	for i, c := range b.Channels {
+		if !reflect.DeepEqual(c, want[i]) {
+			t.Errorf("station %d = %+v, want %+v", i, c, want[i])
+		}
+	}
+	if _, err := ReadStations(strings.NewReader("KQED\n")); err == nil {
+		t.Error("expected error for line without frequency")
+	}
+}
+
+func TestLocale(t *testing.T) {
+	tests := []struct {
+		locale Locale
+		want   int
+	}{
+		{Locale{}, 14},
+		{CountryLocale("US"), 11},
+		{CountryLocale("DE"), 13},
+		{CountryLocale("JP"), 14},
+		{Locale{Region: Region3}, 13},
+	}
+	for _, tt := range tests {
+		if n := len(WiFi24.ForLocale(tt.locale).Channels); n != tt.want {
+			t.Errorf("WiFi24.ForLocale(%+v) has %d channels, want %d", tt.locale, n, tt.want)
+		}
+	}
+	if ATSC.AllowedIn(CountryLocale("GB")) {
+		t.Error("ATSC should not apply in GB")
+	}
+	if !DVBT.AllowedIn(CountryLocale("GB")) {
+		t.Error("DVBT should apply in GB")
+	}
+}
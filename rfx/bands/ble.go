@@ -0,0 +1,41 @@
+package bands
+
+import "strconv"
+
+// BLE is the Bluetooth Low Energy band plan. Channels are listed in
+// frequency order and named by their BLE channel index, so the advertising
+// channels 37, 38, and 39 (which are highlighted) appear at 2402, 2426, and
+// 2480 MHz amongst the data channels.
+var BLE = &Band{
+	Name:        "ble",
+	Description: "Bluetooth LE",
+	Channels:    bleChannels(),
+}
+
+func bleChannels() []Channel {
+	chs := make([]Channel, 0, 40)
+	dataIndex := 0
+	for rf := 0; rf < 40; rf++ {
+		c := Channel{
+			CenterFreqHZ: 2402000000 + rf*2000000,
+			WidthHZ:      2000000,
+		}
+		switch rf {
+		case 0:
+			c.Name = "37"
+		case 12:
+			c.Name = "38"
+		case 39:
+			c.Name = "39"
+		default:
+			c.Name = strconv.Itoa(dataIndex)
+			dataIndex++
+		}
+		if c.Name == "37" || c.Name == "38" || c.Name == "39" {
+			c.Note = "Advertising"
+			c.Highlight = true
+		}
+		chs = append(chs, c)
+	}
+	return chs
+}
@@ -0,0 +1,46 @@
+package bands
+
+import "strconv"
+
+const dectCarrierSpacing = 1728000
+
+// DECT is the European DECT band (1880-1900 MHz). Carriers are numbered 0
+// through 9 with carrier 0 at the top of the band.
+var DECT = &Band{
+	Name:        "dect",
+	Description: "DECT (EU)",
+	Regions:     []Region{Region1},
+	Channels:    dectChannels(),
+}
+
+func dectChannels() []Channel {
+	chs := make([]Channel, 0, 10)
+	for i := 9; i >= 0; i-- {
+		chs = append(chs, Channel{
+			Name:         strconv.Itoa(i),
+			CenterFreqHZ: 1897344000 - i*dectCarrierSpacing,
+			WidthHZ:      dectCarrierSpacing,
+		})
+	}
+	return chs
+}
+
+// DECT60 is the North American DECT 6.0 band (1920-1930 MHz).
+var DECT60 = &Band{
+	Name:        "dect60",
+	Description: "DECT 6.0 (US)",
+	Regions:     []Region{Region2},
+	Channels:    dect60Channels(),
+}
+
+func dect60Channels() []Channel {
+	chs := make([]Channel, 0, 5)
+	for i := 0; i < 5; i++ {
+		chs = append(chs, Channel{
+			Name:         strconv.Itoa(i + 1),
+			CenterFreqHZ: 1921536000 + i*dectCarrierSpacing,
+			WidthHZ:      dectCarrierSpacing,
+		})
+	}
+	return chs
+}
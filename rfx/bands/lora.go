@@ -0,0 +1,116 @@
+package bands
+
+import "strconv"
+
+// EU868 is the LoRaWAN EU863-870 channel plan. Channels 0-2 are the
+// mandatory default channels; 3-7 are the additional channels used by most
+// network operators.
+var EU868 = &Band{
+	Name:        "eu868",
+	Description: "LoRaWAN EU868",
+	Regions:     []Region{Region1},
+	Channels: []Channel{
+		{Name: "0", CenterFreqHZ: 868100000, WidthHZ: 125000, Note: "Default"},
+		{Name: "1", CenterFreqHZ: 868300000, WidthHZ: 125000, Note: "Default"},
+		{Name: "2", CenterFreqHZ: 868500000, WidthHZ: 125000, Note: "Default"},
+		{Name: "3", CenterFreqHZ: 867100000, WidthHZ: 125000},
+		{Name: "4", CenterFreqHZ: 867300000, WidthHZ: 125000},
+		{Name: "5", CenterFreqHZ: 867500000, WidthHZ: 125000},
+		{Name: "6", CenterFreqHZ: 867700000, WidthHZ: 125000},
+		{Name: "7", CenterFreqHZ: 867900000, WidthHZ: 125000},
+		{Name: "LoRa250", CenterFreqHZ: 868300000, WidthHZ: 250000, Note: "SF7BW250"},
+		{Name: "FSK", CenterFreqHZ: 868800000, WidthHZ: 150000, Note: "FSK 50 kbps"},
+		{Name: "RX2", CenterFreqHZ: 869525000, WidthHZ: 125000, Note: "Downlink RX2"},
+	},
+}
+
+// US915 is the LoRaWAN US902-928 channel plan: 64 125 kHz uplink channels
+// (0-63), 8 500 kHz uplink channels (64-71), and 8 500 kHz downlink
+// channels (D0-D7).
+var US915 = &Band{
+	Name:        "us915",
+	Description: "LoRaWAN US915",
+	Regions:     []Region{Region2},
+	Channels:    us915Channels(),
+}
+
+func us915Channels() []Channel {
+	chs := make([]Channel, 0, 80)
+	for i := 0; i < 64; i++ {
+		chs = append(chs, Channel{
+			Name:         strconv.Itoa(i),
+			CenterFreqHZ: 902300000 + i*200000,
+			WidthHZ:      125000,
+			Note:         "Uplink sub-band " + strconv.Itoa(i/8+1),
+		})
+	}
+	for i := 0; i < 8; i++ {
+		chs = append(chs, Channel{
+			Name:         strconv.Itoa(64 + i),
+			CenterFreqHZ: 903000000 + i*1600000,
+			WidthHZ:      500000,
+			Note:         "Uplink sub-band " + strconv.Itoa(i+1),
+		})
+	}
+	for i := 0; i < 8; i++ {
+		chs = append(chs, Channel{
+			Name:         "D" + strconv.Itoa(i),
+			CenterFreqHZ: 923300000 + i*600000,
+			WidthHZ:      500000,
+			Note:         "Downlink",
+		})
+	}
+	return chs
+}
+
+// ISM868 is the set of European 863-870 MHz short range device sub-bands
+// (ERC Recommendation 70-03 annex 1) with their duty cycle limits.
+var ISM868 = &Band{
+	Name:        "ism868",
+	Description: "ISM 868 MHz sub-bands",
+	Regions:     []Region{Region1},
+	Channels: []Channel{
+		{Name: "h1.2", CenterFreqHZ: 864000000, WidthHZ: 2000000, Note: "0.1% duty cycle, 25 mW", DutyCycle: 0.001},
+		{Name: "h1.3", CenterFreqHZ: 866500000, WidthHZ: 3000000, Note: "1% duty cycle, 25 mW", DutyCycle: 0.01},
+		{Name: "h1.4", CenterFreqHZ: 868300000, WidthHZ: 600000, Note: "1% duty cycle, 25 mW", DutyCycle: 0.01},
+		{Name: "h1.5", CenterFreqHZ: 868950000, WidthHZ: 500000, Note: "0.1% duty cycle, 25 mW", DutyCycle: 0.001},
+		{Name: "h1.6", CenterFreqHZ: 869525000, WidthHZ: 250000, Note: "10% duty cycle, 500 mW", DutyCycle: 0.1},
+		{Name: "h1.7", CenterFreqHZ: 869850000, WidthHZ: 300000, Note: "1% duty cycle, 25 mW", DutyCycle: 0.01},
+	},
+}
+
+// ISM915 divides the 902-928 MHz ISM band into the eight LoRaWAN US915
+// sub-bands, each covering eight 125 kHz uplink channels.
+var ISM915 = &Band{
+	Name:        "ism915",
+	Description: "ISM 915 MHz sub-bands",
+	Regions:     []Region{Region2},
+	Channels:    ism915Channels(),
+}
+
+func ism915Channels() []Channel {
+	chs := make([]Channel, 0, 8)
+	for i := 0; i < 8; i++ {
+		chs = append(chs, Channel{
+			Name:         "SB" + strconv.Itoa(i+1),
+			CenterFreqHZ: 903000000 + i*1600000,
+			WidthHZ:      1600000,
+			Note:         "Channels " + strconv.Itoa(i*8) + "-" + strconv.Itoa(i*8+7) + " and " + strconv.Itoa(64+i),
+		})
+	}
+	return chs
+}
+
+// ISM433 is the ITU Region 1 433 MHz ISM band along with the default
+// LoRaWAN EU433 channels.
+var ISM433 = &Band{
+	Name:        "ism433",
+	Description: "ISM 433 MHz",
+	Regions:     []Region{Region1},
+	Channels: []Channel{
+		{Name: "ISM", CenterFreqHZ: 433920000, WidthHZ: 1740000, Note: "433.05-434.79 MHz"},
+		{Name: "0", CenterFreqHZ: 433175000, WidthHZ: 125000, Note: "LoRaWAN EU433 default"},
+		{Name: "1", CenterFreqHZ: 433375000, WidthHZ: 125000, Note: "LoRaWAN EU433 default"},
+		{Name: "2", CenterFreqHZ: 433575000, WidthHZ: 125000, Note: "LoRaWAN EU433 default"},
+	},
+}
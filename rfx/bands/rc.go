@@ -0,0 +1,38 @@
+package bands
+
+// The RC control links below are frequency hopping or adaptive systems so
+// each "channel" is the range the system hops over rather than a fixed
+// carrier. They are useful as context next to the video channels.
+
+// RC24 is the set of 2.4 GHz RC control links.
+var RC24 = &Band{
+	Name:        "rc24",
+	Description: "2.4 GHz RC links",
+	Channels: []Channel{
+		{Name: "ACCST", CenterFreqHZ: 2441750000, WidthHZ: 83500000, Note: "FrSky ACCST, FHSS over 47 channels"},
+		{Name: "ACCESS", CenterFreqHZ: 2441750000, WidthHZ: 83500000, Note: "FrSky ACCESS, FHSS"},
+		{Name: "Tracer", CenterFreqHZ: 2440000000, WidthHZ: 80000000, Note: "TBS Tracer, FHSS"},
+		{Name: "O3", CenterFreqHZ: 2441750000, WidthHZ: 83500000, Note: "DJI O3 control and video, adaptive"},
+	},
+}
+
+// RC900 is the set of sub-GHz RC control links.
+var RC900 = &Band{
+	Name:        "rc900",
+	Description: "900 MHz RC links",
+	Channels: []Channel{
+		{Name: "CRSF868", CenterFreqHZ: 866500000, WidthHZ: 7000000, Note: "TBS Crossfire EU, FHSS", Regions: []Region{Region1}},
+		{Name: "CRSF915", CenterFreqHZ: 915000000, WidthHZ: 26000000, Note: "TBS Crossfire US, FHSS", Regions: []Region{Region2, Region3}},
+	},
+}
+
+// DJIO3 is the operating range of DJI O3 air units. The system picks its
+// own 10, 20, or 40 MHz wide channel within these ranges.
+var DJIO3 = &Band{
+	Name:        "djio3",
+	Description: "DJI O3",
+	Channels: []Channel{
+		{Name: "2.4", CenterFreqHZ: 2441750000, WidthHZ: 83500000, Note: "2400-2483.5 MHz"},
+		{Name: "5.8", CenterFreqHZ: 5787500000, WidthHZ: 125000000, Note: "5725-5850 MHz"},
+	},
+}
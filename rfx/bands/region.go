@@ -0,0 +1,112 @@
+package bands
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Region is an ITU radio regulation region.
+type Region int
+
+// ITU regions. RegionAny is used when the region is unknown and matches
+// all regions.
+const (
+	RegionAny Region = 0
+	Region1   Region = 1 // Europe, Africa, Middle East, northern Asia
+	Region2   Region = 2 // Americas
+	Region3   Region = 3 // Asia-Pacific
+)
+
+func (r Region) String() string {
+	if r == RegionAny {
+		return "Any"
+	}
+	return fmt.Sprintf("Region %d", int(r))
+}
+
+// Locale is where the user is located. Country is an ISO 3166-1 alpha-2 code
+// and is only needed where a country deviates from its region.
+type Locale struct {
+	Region  Region
+	Country string
+}
+
+// countryRegions maps common countries to their ITU region.
+var countryRegions = map[string]Region{
+	"AR": Region2, "BR": Region2, "CA": Region2, "CL": Region2, "CO": Region2, "MX": Region2, "US": Region2,
+	"AT": Region1, "BE": Region1, "CH": Region1, "CZ": Region1, "DE": Region1, "DK": Region1, "ES": Region1,
+	"FI": Region1, "FR": Region1, "GB": Region1, "IE": Region1, "IT": Region1, "NL": Region1, "NO": Region1,
+	"PL": Region1, "PT": Region1, "RU": Region1, "SE": Region1, "TR": Region1, "UA": Region1, "ZA": Region1,
+	"AU": Region3, "CN": Region3, "HK": Region3, "ID": Region3, "IN": Region3, "JP": Region3, "KR": Region3,
+	"MY": Region3, "NZ": Region3, "PH": Region3, "SG": Region3, "TH": Region3, "TW": Region3, "VN": Region3,
+}
+
+// CountryLocale returns the locale for a country. The region is RegionAny if
+// the country isn't known.
+func CountryLocale(country string) Locale {
+	country = strings.ToUpper(country)
+	return Locale{Region: countryRegions[country], Country: country}
+}
+
+// allowed returns true if something restricted to the given regions and
+// countries may be used in the locale. Empty restrictions allow everything.
+func (l Locale) allowed(regions []Region, countries []string) bool {
+	if len(countries) != 0 {
+		for _, c := range countries {
+			if strings.EqualFold(c, l.Country) {
+				return true
+			}
+		}
+		// An explicit country list is authoritative when the country is
+		// known. Otherwise fall back to the region check.
+		if l.Country != "" {
+			return false
+		}
+		if len(regions) == 0 {
+			return l.Region == RegionAny
+		}
+	}
+	if len(regions) == 0 || l.Region == RegionAny {
+		return true
+	}
+	for _, r := range regions {
+		if r == l.Region {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowedIn returns true if the channel may be used in the locale.
+func (c Channel) AllowedIn(l Locale) bool {
+	return l.allowed(c.Regions, c.Countries)
+}
+
+// AllowedIn returns true if the band plan applies in the locale.
+func (b *Band) AllowedIn(l Locale) bool {
+	return l.allowed(b.Regions, b.Countries)
+}
+
+// ForLocale returns a copy of the band with only the channels allowed in the
+// locale.
+func (b *Band) ForLocale(l Locale) *Band {
+	b2 := *b
+	b2.Channels = nil
+	for _, c := range b.Channels {
+		if c.AllowedIn(l) {
+			b2.Channels = append(b2.Channels, c)
+		}
+	}
+	return &b2
+}
+
+// AllIn returns all registered bands that apply in the locale.
+func AllIn(l Locale) []*Band {
+	var bs []*Band
+	for _, b := range registry {
+		if b.AllowedIn(l) {
+			bs = append(bs, b)
+		}
+	}
+	return bs
+}
@@ -0,0 +1,105 @@
+package bands
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// FMStationWidth is the channel width used for FM broadcast stations.
+const FMStationWidth = 200000
+
+// ReadStations reads a list of broadcast stations and returns them as a band
+// with one channel per station named by its call sign.
+//
+// Each line holds a frequency in MHz (optionally followed by "MHz") and a
+// station name, separated by whitespace, commas, tabs, or pipes. The first
+// field that parses as a frequency is used as the frequency and the first
+// other field as the name, which makes pipe-delimited exports such as those
+// from the FCC FM query usable directly. Any remaining fields are kept as
+// the channel note. Blank lines and lines starting with '#' are ignored.
+func ReadStations(r io.Reader) (*Band, error) {
+	b := &Band{
+		Name:        "stations",
+		Description: "FM stations",
+	}
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		fields := splitStationLine(line)
+		c := Channel{WidthHZ: FMStationWidth}
+		var notes []string
+		for _, f := range fields {
+			if c.CenterFreqHZ == 0 {
+				if hz, ok := parseMHz(f); ok {
+					c.CenterFreqHZ = hz
+					continue
+				}
+			}
+			if c.Name == "" {
+				c.Name = f
+			} else {
+				notes = append(notes, f)
+			}
+		}
+		if c.CenterFreqHZ == 0 || c.Name == "" {
+			return nil, fmt.Errorf("bands: stations line %d: expected frequency and name", lineNo)
+		}
+		c.Note = strings.Join(notes, " ")
+		b.Channels = append(b.Channels, c)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func splitStationLine(line string) []string {
+	var sep func(rune) bool
+	switch {
+	case strings.ContainsRune(line, '|'):
+		sep = func(r rune) bool { return r == '|' }
+	case strings.ContainsRune(line, ','):
+		sep = func(r rune) bool { return r == ',' }
+	case strings.ContainsRune(line, '\t'):
+		sep = func(r rune) bool { return r == '\t' }
+	default:
+		sep = func(r rune) bool { return r == ' ' }
+	}
+	var fields []string
+	for _, f := range strings.FieldsFunc(line, sep) {
+		if f = strings.TrimSpace(f); f != "" {
+			fields = append(fields, f)
+		}
+	}
+	// With plain whitespace separation "98.5 MHz" is split in two.
+	out := fields[:0]
+	for _, f := range fields {
+		if strings.EqualFold(f, "MHz") && len(out) != 0 {
+			if _, ok := parseMHz(out[len(out)-1]); ok {
+				continue
+			}
+		}
+		out = append(out, f)
+	}
+	return out
+}
+
+func parseMHz(s string) (int, bool) {
+	s = strings.TrimSpace(s)
+	if len(s) > 3 && strings.EqualFold(s[len(s)-3:], "MHz") {
+		s = strings.TrimSpace(s[:len(s)-3])
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || f <= 0 {
+		return 0, false
+	}
+	return int(f*1e6 + 0.5), true
+}
@@ -0,0 +1,88 @@
+package bands
+
+import "strconv"
+
+// ATSC is the North American broadcast television RF channel plan (6 MHz
+// channels). UHF channels above 36 were reallocated by the 600 MHz repack
+// and are kept so that older equipment and legacy carriers can be labeled.
+var ATSC = &Band{
+	Name:        "atsc",
+	Description: "ATSC TV (North America)",
+	Regions:     []Region{Region2},
+	Channels:    atscChannels(),
+}
+
+func atscChannels() []Channel {
+	const width = 6000000
+	var chs []Channel
+	add := func(n, lowHZ int, note string) {
+		chs = append(chs, Channel{
+			Name:         strconv.Itoa(n),
+			CenterFreqHZ: lowHZ + width/2,
+			WidthHZ:      width,
+			Note:         note,
+		})
+	}
+	for n := 2; n <= 4; n++ {
+		add(n, 54000000+(n-2)*width, "VHF low")
+	}
+	for n := 5; n <= 6; n++ {
+		add(n, 76000000+(n-5)*width, "VHF low")
+	}
+	for n := 7; n <= 13; n++ {
+		add(n, 174000000+(n-7)*width, "VHF high")
+	}
+	for n := 14; n <= 51; n++ {
+		note := "UHF"
+		switch {
+		case n == 37:
+			note = "Radio astronomy, no TV"
+		case n >= 38:
+			note = "600 MHz band, reallocated to mobile"
+		}
+		add(n, 470000000+(n-14)*width, note)
+	}
+	return chs
+}
+
+// DVBT is the European broadcast television RF channel plan (7 MHz VHF
+// and 8 MHz UHF channels). Channels 49 and up were cleared for mobile
+// services in most countries.
+var DVBT = &Band{
+	Name:        "dvbt",
+	Description: "DVB-T TV (Europe)",
+	Regions:     []Region{Region1},
+	Channels:    dvbtChannels(),
+}
+
+func dvbtChannels() []Channel {
+	var chs []Channel
+	for n := 5; n <= 12; n++ {
+		const width = 7000000
+		chs = append(chs, Channel{
+			Name:         strconv.Itoa(n),
+			CenterFreqHZ: 174000000 + (n-5)*width + width/2,
+			WidthHZ:      width,
+			Note:         "VHF band III",
+		})
+	}
+	for n := 21; n <= 69; n++ {
+		const width = 8000000
+		note := "UHF"
+		switch {
+		case n == 38:
+			note = "Radio astronomy"
+		case n >= 61:
+			note = "800 MHz band, reallocated to mobile"
+		case n >= 49:
+			note = "700 MHz band, reallocated to mobile"
+		}
+		chs = append(chs, Channel{
+			Name:         strconv.Itoa(n),
+			CenterFreqHZ: 470000000 + (n-21)*width + width/2,
+			WidthHZ:      width,
+			Note:         note,
+		})
+	}
+	return chs
+}
@@ -0,0 +1,108 @@
+package bands
+
+const vtx58ChannelWidth = 10000000
+
+// VTX58 is the 5.8 GHz FPV video transmitter band plan.
+var VTX58 = &Band{
+	Name:        "vtx58",
+	Description: "5.8 GHz FPV video",
+	Channels: []Channel{
+		// Band A: Team BlackSheep (TBS), RangeVideo, SpyHawk, FlyCamOne USA
+		{Name: "A1", CenterFreqHZ: 5865000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "A2", CenterFreqHZ: 5845000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "A3", CenterFreqHZ: 5825000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "A4", CenterFreqHZ: 5805000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "A5", CenterFreqHZ: 5785000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "A6", CenterFreqHZ: 5765000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "A7", CenterFreqHZ: 5745000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "A8", CenterFreqHZ: 5725000000, WidthHZ: vtx58ChannelWidth},
+
+		// Band B: FlyCamOne Europe
+		{Name: "B1", CenterFreqHZ: 5733000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "B2", CenterFreqHZ: 5752000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "B3", CenterFreqHZ: 5771000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "B4", CenterFreqHZ: 5790000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "B5", CenterFreqHZ: 5809000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "B6", CenterFreqHZ: 5828000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "B7", CenterFreqHZ: 5847000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "B8", CenterFreqHZ: 5866000000, WidthHZ: vtx58ChannelWidth},
+
+		// Band E: HobbyKing, Foxtech
+		{Name: "E1", CenterFreqHZ: 5705000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "E2", CenterFreqHZ: 5685000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "E3", CenterFreqHZ: 5665000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "E4", CenterFreqHZ: 5645000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "E5", CenterFreqHZ: 5885000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "E6", CenterFreqHZ: 5905000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "E7", CenterFreqHZ: 5925000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "E8", CenterFreqHZ: 5945000000, WidthHZ: vtx58ChannelWidth},
+
+		// Band F (Airwave): ImmersionRC, Iftron
+		{Name: "F1", CenterFreqHZ: 5740000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "F2", CenterFreqHZ: 5760000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "F3", CenterFreqHZ: 5780000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "F4", CenterFreqHZ: 5800000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "F5", CenterFreqHZ: 5820000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "F6", CenterFreqHZ: 5840000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "F7", CenterFreqHZ: 5860000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "F8", CenterFreqHZ: 5880000000, WidthHZ: vtx58ChannelWidth},
+
+		// Band C (R): Raceband
+		{Name: "C1", CenterFreqHZ: 5658000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "C2", CenterFreqHZ: 5695000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "C3", CenterFreqHZ: 5732000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "C4", CenterFreqHZ: 5769000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "C5", CenterFreqHZ: 5806000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "C6", CenterFreqHZ: 5843000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "C7", CenterFreqHZ: 5880000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "C8", CenterFreqHZ: 5917000000, WidthHZ: vtx58ChannelWidth},
+
+		// Band D: Diatone
+		{Name: "D1", CenterFreqHZ: 5362000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "D2", CenterFreqHZ: 5399000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "D3", CenterFreqHZ: 5436000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "D4", CenterFreqHZ: 5473000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "D5", CenterFreqHZ: 5510000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "D6", CenterFreqHZ: 5547000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "D7", CenterFreqHZ: 5584000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "D8", CenterFreqHZ: 5621000000, WidthHZ: vtx58ChannelWidth},
+
+		{Name: "U1", CenterFreqHZ: 5325000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "U2", CenterFreqHZ: 5348000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "U3", CenterFreqHZ: 5366000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "U4", CenterFreqHZ: 5384000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "U5", CenterFreqHZ: 5402000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "U6", CenterFreqHZ: 5420000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "U7", CenterFreqHZ: 5438000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "U8", CenterFreqHZ: 5456000000, WidthHZ: vtx58ChannelWidth},
+
+		{Name: "O1", CenterFreqHZ: 5474000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "O2", CenterFreqHZ: 5492000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "O3", CenterFreqHZ: 5510000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "O4", CenterFreqHZ: 5528000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "O5", CenterFreqHZ: 5546000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "O6", CenterFreqHZ: 5564000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "O7", CenterFreqHZ: 5582000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "O8", CenterFreqHZ: 5600000000, WidthHZ: vtx58ChannelWidth},
+
+		// Band L: Low band
+		{Name: "L1", CenterFreqHZ: 5333000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "L2", CenterFreqHZ: 5373000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "L3", CenterFreqHZ: 5413000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "L4", CenterFreqHZ: 5453000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "L5", CenterFreqHZ: 5493000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "L6", CenterFreqHZ: 5533000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "L7", CenterFreqHZ: 5573000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "L8", CenterFreqHZ: 5613000000, WidthHZ: vtx58ChannelWidth},
+
+		// Band H: High band
+		{Name: "H1", CenterFreqHZ: 5653000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "H2", CenterFreqHZ: 5693000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "H3", CenterFreqHZ: 5733000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "H4", CenterFreqHZ: 5773000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "H5", CenterFreqHZ: 5813000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "H6", CenterFreqHZ: 5853000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "H7", CenterFreqHZ: 5893000000, WidthHZ: vtx58ChannelWidth},
+		{Name: "H8", CenterFreqHZ: 5933000000, WidthHZ: vtx58ChannelWidth},
+	},
+}
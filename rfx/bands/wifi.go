@@ -0,0 +1,23 @@
+package bands
+
+// WiFi24 is the 2.4 GHz 802.11b/g/n band plan.
+var WiFi24 = &Band{
+	Name:        "wifi24",
+	Description: "Wi-Fi 2.4 GHz",
+	Channels: []Channel{
+		{Name: "1", CenterFreqHZ: 2412000000, WidthHZ: 20000000},
+		{Name: "2", CenterFreqHZ: 2417000000, WidthHZ: 20000000},
+		{Name: "3", CenterFreqHZ: 2422000000, WidthHZ: 20000000},
+		{Name: "4", CenterFreqHZ: 2427000000, WidthHZ: 20000000},
+		{Name: "5", CenterFreqHZ: 2432000000, WidthHZ: 20000000},
+		{Name: "6", CenterFreqHZ: 2437000000, WidthHZ: 20000000},
+		{Name: "7", CenterFreqHZ: 2442000000, WidthHZ: 20000000},
+		{Name: "8", CenterFreqHZ: 2447000000, WidthHZ: 20000000},
+		{Name: "9", CenterFreqHZ: 2452000000, WidthHZ: 20000000},
+		{Name: "10", CenterFreqHZ: 2457000000, WidthHZ: 20000000},
+		{Name: "11", CenterFreqHZ: 2462000000, WidthHZ: 20000000},
+		{Name: "12", CenterFreqHZ: 2467000000, WidthHZ: 20000000, Regions: []Region{Region1, Region3}, Note: "Not available in Region 2"},
+		{Name: "13", CenterFreqHZ: 2472000000, WidthHZ: 20000000, Regions: []Region{Region1, Region3}, Note: "Not available in Region 2"},
+		{Name: "14", CenterFreqHZ: 2484000000, WidthHZ: 20000000, Countries: []string{"JP"}, Note: "Japan only, 802.11b"},
+	},
+}
@@ -0,0 +1,15 @@
+package bands
+
+// WxSat137 is the 137-138 MHz weather satellite downlink band. NOAA APT
+// signals are about 40 kHz wide and Meteor LRPT about 150 kHz.
+var WxSat137 = &Band{
+	Name:        "wxsat137",
+	Description: "Weather satellites 137 MHz",
+	Channels: []Channel{
+		{Name: "NOAA 19", CenterFreqHZ: 137100000, WidthHZ: 40000, Note: "APT, decommissioned 2025"},
+		{Name: "NOAA 15", CenterFreqHZ: 137620000, WidthHZ: 40000, Note: "APT, decommissioned 2025"},
+		{Name: "NOAA 18", CenterFreqHZ: 137912500, WidthHZ: 40000, Note: "APT, decommissioned 2025"},
+		{Name: "Meteor 137.1", CenterFreqHZ: 137100000, WidthHZ: 150000, Note: "Meteor-M LRPT"},
+		{Name: "Meteor 137.9", CenterFreqHZ: 137900000, WidthHZ: 150000, Note: "Meteor-M LRPT"},
+	},
+}
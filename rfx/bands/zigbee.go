@@ -0,0 +1,26 @@
+package bands
+
+// Zigbee24 is the 2.4 GHz IEEE 802.15.4 (Zigbee) band plan. Notes refer to
+// overlapping 2.4 GHz Wi-Fi channels and XBee module support.
+var Zigbee24 = &Band{
+	Name:        "zigbee24",
+	Description: "Zigbee 2.4 GHz",
+	Channels: []Channel{
+		{Name: "11", CenterFreqHZ: 2405000000, WidthHZ: 2000000, Note: "Overlaps Ch 1 Newer XBee only"},
+		{Name: "12", CenterFreqHZ: 2410000000, WidthHZ: 2000000, Note: "Overlaps Ch 1"},
+		{Name: "13", CenterFreqHZ: 2415000000, WidthHZ: 2000000, Note: "Overlaps Ch 1"},
+		{Name: "14", CenterFreqHZ: 2420000000, WidthHZ: 2000000, Note: "Overlaps Ch 1"},
+		{Name: "15", CenterFreqHZ: 2425000000, WidthHZ: 2000000, Note: "Overlaps Ch 6"},
+		{Name: "16", CenterFreqHZ: 2430000000, WidthHZ: 2000000, Note: "Overlaps Ch 6"},
+		{Name: "17", CenterFreqHZ: 2435000000, WidthHZ: 2000000, Note: "Overlaps Ch 6"},
+		{Name: "18", CenterFreqHZ: 2440000000, WidthHZ: 2000000, Note: "Overlaps Ch 6"},
+		{Name: "19", CenterFreqHZ: 2445000000, WidthHZ: 2000000, Note: "Overlaps Ch 6"},
+		{Name: "20", CenterFreqHZ: 2450000000, WidthHZ: 2000000, Note: "Overlaps Ch 11"},
+		{Name: "21", CenterFreqHZ: 2455000000, WidthHZ: 2000000, Note: "Overlaps Ch 11"},
+		{Name: "22", CenterFreqHZ: 2460000000, WidthHZ: 2000000, Note: "Overlaps Ch 11"},
+		{Name: "23", CenterFreqHZ: 2465000000, WidthHZ: 2000000, Note: "Overlaps Ch 11"},
+		{Name: "24", CenterFreqHZ: 2470000000, WidthHZ: 2000000, Note: "Overlaps Ch 11 Newer XBee only"},
+		{Name: "25", CenterFreqHZ: 2475000000, WidthHZ: 2000000, Note: "No Conflict Newer XBee only"},
+		{Name: "26", CenterFreqHZ: 2480000000, WidthHZ: 2000000, Note: "No Conflict Newer non-PRO XBee only"},
+	},
+}
@@ -0,0 +1,99 @@
+package rfx
+
+import (
+	"context"
+	"fmt"
+)
+
+// CalibrationDataPacket is the internal amplitude calibration of the active
+// module, sent as $q<Size><Correction>…<EOL> in response to
+// RequestInternalCalibrationData. Each correction is a signed byte in 0.5 dB
+// units.
+type CalibrationDataPacket struct {
+	// CorrectionsDB are the amplitude corrections in dB at points evenly
+	// spaced across the module's frequency range, the first at its minimum
+	// frequency and the last at its maximum. Each point is the correction
+	// for the segment around it.
+	CorrectionsDB []float64
+}
+
+func (p *CalibrationDataPacket) Type() string {
+	return "CalibrationData"
+}
+
+// parseCalibrationData parses the corrections that follow the size byte.
+func parseCalibrationData(b []byte) *CalibrationDataPacket {
+	p := &CalibrationDataPacket{CorrectionsDB: make([]float64, len(b))}
+	for i, c := range b {
+		p.CorrectionsDB[i] = float64(int8(c)) / 2
+	}
+	return p
+}
+
+// Correction returns the correction in dB for a frequency in a module's
+// range from minFreqKHZ to maxFreqKHZ, interpolated between the points on
+// either side of it.
+func (p *CalibrationDataPacket) Correction(freqHZ, minFreqKHZ, maxFreqKHZ int) float64 {
+	n := len(p.CorrectionsDB)
+	switch {
+	case n == 0:
+		return 0
+	case n == 1 || maxFreqKHZ <= minFreqKHZ:
+		return p.CorrectionsDB[0]
+	}
+	pos := (float64(freqHZ)/1000 - float64(minFreqKHZ)) / float64(maxFreqKHZ-minFreqKHZ) * float64(n-1)
+	if pos <= 0 {
+		return p.CorrectionsDB[0]
+	}
+	if pos >= float64(n-1) {
+		return p.CorrectionsDB[n-1]
+	}
+	i := int(pos)
+	frac := pos - float64(i)
+	return p.CorrectionsDB[i]*(1-frac) + p.CorrectionsDB[i+1]*frac
+}
+
+// Apply corrects the samples of a sweep taken with config in place.
+func (p *CalibrationDataPacket) Apply(config *CurrentConfigPacket, samples []float64) {
+	startHZ := config.StartFreqKHZ * 1000
+	for i := range samples {
+		samples[i] += p.Correction(startHZ+i*config.FreqStepHZ, config.MinFreqKHZ, config.MaxFreqKHZ)
+	}
+}
+
+// GetCalibrationData requests the internal calibration data of the active
+// module and waits for it.
+func (r *RFExplorer) GetCalibrationData(ctx context.Context) (*CalibrationDataPacket, error) {
+	pkt, err := r.request(ctx, "Cq", func(p Packet) bool {
+		_, ok := p.(*CalibrationDataPacket)
+		return ok
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pkt.(*CalibrationDataPacket), nil
+}
+
+// CalibrationData returns the calibration data last received or nil if
+// none has been.
+func (r *RFExplorer) CalibrationData() *CalibrationDataPacket {
+	cal, _ := r.calData.Load().(*CalibrationDataPacket)
+	return cal
+}
+
+// ApplyCalibration corrects the amplitudes of a sweep in place using the
+// calibration data last received and the current configuration. It returns
+// an error if no calibration data has been received, see
+// GetCalibrationData.
+func (r *RFExplorer) ApplyCalibration(sweep *SweepDataPacket) error {
+	cal := r.CalibrationData()
+	if cal == nil {
+		return fmt.Errorf("rfx: no calibration data received")
+	}
+	config, ok := r.config.Load().(*CurrentConfigPacket)
+	if !ok {
+		return fmt.Errorf("rfx: no configuration received")
+	}
+	cal.Apply(config, sweep.Samples)
+	return nil
+}
@@ -0,0 +1,239 @@
+// Package coord computes intermodulation-free frequency assignments for
+// wireless microphones and similar analog transmitters.
+package coord
+
+import (
+	"sort"
+
+	"github.com/samuel/rfexplorer/rfx/bands"
+)
+
+// Unit is a transmitter that needs a frequency.
+type Unit struct {
+	Name string
+	// MinFreqHZ and MaxFreqHZ is the tuning range of the unit.
+	MinFreqHZ int
+	MaxFreqHZ int
+	// StepHZ is the tuning step of the unit. Candidate frequencies are
+	// MinFreqHZ + n*StepHZ.
+	StepHZ int
+}
+
+// Spectrum is a measured spectrum (normally a max-hold over a period of
+// time) used to find active carriers.
+type Spectrum struct {
+	StartFreqHZ int
+	StepHZ      int
+	Samples     []float64
+}
+
+// Level returns the highest sample within guardHZ of freqHZ and false if the
+// frequency is outside of the spectrum or the spectrum has no step.
+func (s *Spectrum) Level(freqHZ, guardHZ int) (float64, bool) {
+	if s.StepHZ <= 0 {
+		return 0, false
+	}
+	lo := (freqHZ - guardHZ - s.StartFreqHZ + s.StepHZ - 1) / s.StepHZ
+	hi := (freqHZ + guardHZ - s.StartFreqHZ) / s.StepHZ
+	if lo < 0 {
+		lo = 0
+	}
+	if hi >= len(s.Samples) {
+		hi = len(s.Samples) - 1
+	}
+	if lo > hi {
+		return 0, false
+	}
+	level := s.Samples[lo]
+	for _, v := range s.Samples[lo+1 : hi+1] {
+		if v > level {
+			level = v
+		}
+	}
+	return level, true
+}
+
+// Options controls the coordination.
+type Options struct {
+	// Excluded are channels that may not be used, usually the TV channels
+	// that are on air locally.
+	Excluded []bands.Channel
+	// ThresholdDBM is the level above which a measured sample is
+	// considered an active carrier.
+	ThresholdDBM float64
+	// CarrierGuardHZ is the minimum distance from an active carrier.
+	CarrierGuardHZ int
+	// MinSpacingHZ is the minimum distance between two assigned
+	// frequencies.
+	MinSpacingHZ int
+	// IMDGuardHZ is the minimum distance between an assigned frequency and
+	// any third-order intermodulation product of the assigned set.
+	IMDGuardHZ int
+	// ThreeTransmitter enables checking of three-transmitter products
+	// (f1+f2-f3) in addition to two-transmitter products (2f1-f2).
+	ThreeTransmitter bool
+}
+
+// DefaultOptions are conservative settings for analog wireless microphones.
+var DefaultOptions = Options{
+	ThresholdDBM:     -90,
+	CarrierGuardHZ:   200000,
+	MinSpacingHZ:     400000,
+	IMDGuardHZ:       100000,
+	ThreeTransmitter: true,
+}
+
+// Assignment is the frequency assigned to a unit. FreqHZ is 0 if no clean
+// frequency could be found.
+type Assignment struct {
+	Unit    Unit
+	FreqHZ  int
+	LevelDB float64
+}
+
+// Coordinate assigns a frequency to each unit in order. Candidates are tried
+// quietest first so that the cleanest frequencies are used. spectrum may be
+// nil in which case no carrier checking is done.
+func Coordinate(units []Unit, spectrum *Spectrum, opts *Options) []Assignment {
+	if opts == nil {
+		opts = &DefaultOptions
+	}
+	var assigned []int
+	var products []int
+	out := make([]Assignment, len(units))
+	for i, u := range units {
+		out[i].Unit = u
+		for _, c := range candidates(u, spectrum, opts) {
+			if !compatible(c.freqHZ, assigned, products, opts) {
+				continue
+			}
+			out[i].FreqHZ = c.freqHZ
+			out[i].LevelDB = c.level
+			assigned = append(assigned, c.freqHZ)
+			products = intermodProducts(assigned, opts.ThreeTransmitter)
+			break
+		}
+	}
+	return out
+}
+
+type candidate struct {
+	freqHZ int
+	level  float64
+}
+
+func candidates(u Unit, spectrum *Spectrum, opts *Options) []candidate {
+	step := u.StepHZ
+	if step <= 0 {
+		step = 25000
+	}
+	var cs []candidate
+	for f := u.MinFreqHZ; f <= u.MaxFreqHZ; f += step {
+		if excluded(f, opts.Excluded) {
+			continue
+		}
+		c := candidate{freqHZ: f}
+		if spectrum != nil {
+			level, ok := spectrum.Level(f, opts.CarrierGuardHZ)
+			if !ok || level >= opts.ThresholdDBM {
+				continue
+			}
+			c.level = level
+		}
+		cs = append(cs, c)
+	}
+	sort.SliceStable(cs, func(i, j int) bool {
+		return cs[i].level < cs[j].level
+	})
+	return cs
+}
+
+func excluded(freqHZ int, chs []bands.Channel) bool {
+	for _, c := range chs {
+		if freqHZ >= c.LowFreqHZ() && freqHZ <= c.HighFreqHZ() {
+			return true
+		}
+	}
+	return false
+}
+
+// compatible returns true if f can be added to the assigned set without
+// violating spacing or landing on or creating an intermodulation product.
+// products must be the sorted products of the assigned set.
+func compatible(f int, assigned, products []int, opts *Options) bool {
+	for _, a := range assigned {
+		if abs(f-a) < opts.MinSpacingHZ {
+			return false
+		}
+	}
+	if near(products, f, opts.IMDGuardHZ) {
+		return false
+	}
+	// Products involving f must not land on f or any assigned frequency.
+	set := append(append([]int(nil), assigned...), f)
+	hits := func(p int) bool {
+		for _, s := range set {
+			if abs(p-s) < opts.IMDGuardHZ {
+				return true
+			}
+		}
+		return false
+	}
+	for i, a := range assigned {
+		if hits(2*f-a) || hits(2*a-f) {
+			return false
+		}
+		if !opts.ThreeTransmitter {
+			continue
+		}
+		for j, b := range assigned {
+			if j == i {
+				continue
+			}
+			if hits(f + a - b) {
+				return false
+			}
+			if j > i && hits(a+b-f) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// intermodProducts returns the sorted third-order intermodulation products
+// of freqs.
+func intermodProducts(freqs []int, threeTransmitter bool) []int {
+	var ps []int
+	for i, a := range freqs {
+		for j, b := range freqs {
+			if i == j {
+				continue
+			}
+			ps = append(ps, 2*a-b)
+			if !threeTransmitter || j < i {
+				continue
+			}
+			for k, c := range freqs {
+				if k != i && k != j {
+					ps = append(ps, a+b-c)
+				}
+			}
+		}
+	}
+	sort.Ints(ps)
+	return ps
+}
+
+// near returns true if any value in sorted is within guard of v.
+func near(sorted []int, v, guard int) bool {
+	i := sort.SearchInts(sorted, v-guard+1)
+	return i < len(sorted) && sorted[i] < v+guard
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,66 @@
+package coord
+
+import (
+	"testing"
+
+	"github.com/samuel/rfexplorer/rfx/bands"
+)
+
+func TestCoordinate(t *testing.T) {
+	const start = 470000000
+	const step = 50000
+	sp := &Spectrum{StartFreqHZ: start, StepHZ: step, Samples: make([]float64, 400)}
+	for i := range sp.Samples {
+		sp.Samples[i] = -110
+	}
+	// Active carrier at 475 MHz.
+	sp.Samples[(475000000-start)/step] = -40
+
+	tv, _ := bands.ATSC.Channel("15") // 476-482 MHz
+	opts := DefaultOptions
+	opts.Excluded = []bands.Channel{tv}
+
+	var units []Unit
+	for i := 0; i < 6; i++ {
+		units = append(units, Unit{Name: "mic", MinFreqHZ: start, MaxFreqHZ: 489000000, StepHZ: 25000})
+	}
+	as := Coordinate(units, sp, &opts)
+	var freqs []int
+	for _, a := range as {
+		if a.FreqHZ == 0 {
+			t.Fatalf("unit not assigned: %+v", as)
+		}
+		if a.FreqHZ >= tv.LowFreqHZ() && a.FreqHZ <= tv.HighFreqHZ() {
+			t.Errorf("%d is in excluded TV channel", a.FreqHZ)
+		}
+		if abs(a.FreqHZ-475000000) < opts.CarrierGuardHZ {
+			t.Errorf("%d is too close to active carrier", a.FreqHZ)
+		}
+		freqs = append(freqs, a.FreqHZ)
+	}
+	for _, p := range intermodProducts(freqs, true) {
+		for _, f := range freqs {
+			if abs(p-f) < opts.IMDGuardHZ {
+				t.Errorf("intermod product %d hits assigned frequency %d", p, f)
+			}
+		}
+	}
+}
+
+func TestCoordinateExhausted(t *testing.T) {
+	units := []Unit{
+		{Name: "a", MinFreqHZ: 500000000, MaxFreqHZ: 500000000},
+		{Name: "b", MinFreqHZ: 500000000, MaxFreqHZ: 500000000},
+	}
+	as := Coordinate(units, nil, nil)
+	if as[0].FreqHZ != 500000000 || as[1].FreqHZ != 0 {
+		t.Fatalf("Coordinate = %+v", as)
+	}
+}
+
+func TestSpectrumLevelWithoutStep(t *testing.T) {
+	sp := &Spectrum{StartFreqHZ: 500000000, Samples: []float64{-50}}
+	if _, ok := sp.Level(500000000, 0); ok {
+		t.Error("Level of a spectrum without a step is ok")
+	}
+}
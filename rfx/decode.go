@@ -0,0 +1,323 @@
+package rfx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// maxLineLength is the longest text line the device sends. Anything longer
+// without an EOL is garbage.
+const maxLineLength = 512
+
+// ParseErrorPacket is sent in place of bytes that couldn't be decoded, such
+// as a packet whose length doesn't match its framing or a line that doesn't
+// start like any packet. The reader skips ahead to the next packet after it.
+type ParseErrorPacket struct {
+	// Data are the bytes that were skipped.
+	Data []byte
+	Err  error
+}
+
+func (p *ParseErrorPacket) Type() string {
+	return "ParseError"
+}
+
+func parseError(b []byte, format string, args ...interface{}) *ParseErrorPacket {
+	return &ParseErrorPacket{
+		Data: append([]byte(nil), b...),
+		Err:  fmt.Errorf("rfx: "+format, args...),
+	}
+}
+
+// isPacketStart returns true if c can be the first byte of a packet.
+func isPacketStart(c byte) bool {
+	return c == '#' || c == '$' || c == 'D'
+}
+
+// resync returns how many bytes to skip to get past a broken packet at the
+// start of b: up to the first EOL that's followed by the start of a packet,
+// otherwise up to the last EOL, otherwise all of b.
+func resync(b []byte) int {
+	last := 0
+	for i := 1; i+1 < len(b); i++ {
+		if b[i] != '\r' || b[i+1] != '\n' {
+			continue
+		}
+		if i+2 < len(b) && isPacketStart(b[i+2]) {
+			return i + 2
+		}
+		last = i + 2
+	}
+	if last > 0 {
+		return last
+	}
+	return len(b)
+}
+
+// decodePacket decodes the packet at the start of b. It returns the packet
+// and the number of bytes it took including the EOL. The packet is nil for
+// bytes that are skipped without one, such as blank lines. If b doesn't
+// hold a whole packet yet n is 0 and need is how long b must be at least,
+// or just more than it is when that isn't known yet.
+func decodePacket(b []byte) (pkt Packet, n, need int) {
+	if len(b) < 2 {
+		return nil, 0, 2
+	}
+	switch b[0] {
+	case '#', 'D':
+		// Some firmware reports the DSP mode without a leading '#'.
+		eol := bytes.Index(b, []byte{'\r', '\n'})
+		if eol < 0 {
+			if len(b) > maxLineLength {
+				n := resync(b)
+				return parseError(b[:n], "line of more than %d bytes", maxLineLength), n, 0
+			}
+			return nil, 0, len(b) + 1
+		}
+		return parseLine(b[:eol]), eol + 2, 0
+	case '$':
+		return decodeBinary(b)
+	case '\r':
+		if b[1] == '\n' {
+			return nil, 2, 0
+		}
+	}
+	// Garbage, skip through the end of the line.
+	eol := bytes.Index(b, []byte{'\r', '\n'})
+	if eol < 0 {
+		if len(b) > maxLineLength {
+			n := resync(b)
+			return parseError(b[:n], "unexpected %q", b[0]), n, 0
+		}
+		return nil, 0, len(b) + 1
+	}
+	return parseError(b[:eol], "unexpected %q", b[0]), eol + 2, 0
+}
+
+// decodeBinary decodes a $ packet, most of which have binary data and a
+// length in their header. The length is needed because the data may
+// contain an EOL.
+func decodeBinary(b []byte) (pkt Packet, n, need int) {
+	var header, size int
+	switch b[1] {
+	case 'D':
+		// Screen image - $D<128x8 bytes><EOL>
+		header, size = 2, screenImageSize
+	case 'P':
+		// Preset - $P <Index>…<EOL>
+		header, size = 0, presetRecordSize
+	case 'R':
+		// Raw data (used for sniffer) - $R<Size_LSB><Size_MSB><Data>…<Data> <EOL>
+		if len(b) < 4 {
+			return nil, 0, 4
+		}
+		header, size = 4, int(b[2])|int(b[3])<<8
+	case 'S':
+		// Sweep_data - $S<Sample_Steps> <AdBm>… <AdBm> <EOL> - Send all dBm sample points to PC client, in binary
+		if len(b) < 3 {
+			return nil, 0, 3
+		}
+		header, size = 3, int(b[2])
+	case 'q':
+		// Internal calibration data - $q<Size><Correction>…<EOL>
+		if len(b) < 3 {
+			return nil, 0, 3
+		}
+		header, size = 3, int(b[2])
+	case 's':
+		// Large sweep data - $s<Sample_Steps/16 - 1> <AdBm>… <AdBm> <EOL> - up to 4096 points
+		if len(b) < 3 {
+			return nil, 0, 3
+		}
+		header, size = 3, (int(b[2])+1)*16
+	case 'z':
+		// Large sweep data - $z<Sample_Steps_MSB><Sample_Steps_LSB> <AdBm>… <AdBm> <EOL> - up to 65536 points
+		if len(b) < 4 {
+			return nil, 0, 4
+		}
+		header, size = 4, int(b[2])<<8|int(b[3])
+		if size == 0 {
+			size = 65536
+		}
+	default:
+		// TODO: $C?
+		eol := bytes.Index(b, []byte{'\r', '\n'})
+		if eol < 0 {
+			if len(b) > maxLineLength {
+				n := resync(b)
+				return parseError(b[:n], "unknown packet $%c", b[1]), n, 0
+			}
+			return nil, 0, len(b) + 1
+		}
+		return &UnhandledPacket{Data: append([]byte(nil), b[:eol]...)}, eol + 2, 0
+	}
+	end := header + size
+	if len(b) < end+2 {
+		return nil, 0, end + 2
+	}
+	if b[end] != '\r' || b[end+1] != '\n' {
+		n := resync(b)
+		return parseError(b[:n], "$%c packet of %d bytes isn't followed by an EOL", b[1], end), n, 0
+	}
+	data := b[header:end]
+	switch b[1] {
+	case 'D':
+		si := screenImagePool.Get().(*ScreenImage)
+		copy(si.Data, data)
+		return si, end + 2, 0
+	case 'P':
+		return parsePreset(data), end + 2, 0
+	case 'R':
+		return &RawData{Data: append([]byte(nil), data...)}, end + 2, 0
+	case 'q':
+		return parseCalibrationData(data), end + 2, 0
+	}
+	return sweepSamples(data), end + 2, 0
+}
+
+// parseLine parses a text line without its EOL.
+func parseLine(b []byte) Packet {
+	if pkt, ok := parseDSP(b); ok {
+		return pkt
+	}
+	if len(b) < 2 || b[0] != '#' {
+		return &UnhandledPacket{Data: append([]byte(nil), b...)}
+	}
+	switch b[1] {
+	case 'K':
+		// Tracking status - #K<0|1>
+		if len(b) >= 3 {
+			return &TrackingStatusPacket{Tracking: b[2] == '1'}
+		}
+	case 'a':
+		// Input_Stage - #a<InputStage> - WSUB1G+ and IoT modules only
+		if len(b) >= 3 {
+			if stage := InputStage(b[2] - '0'); stage >= InputStageDirect && stage <= InputStageLNA2 {
+				return &InputStagePacket{Stage: stage}
+			}
+			return parseError(b, "unknown input stage %q", b[2])
+		}
+	case 'C':
+		if pkt := parseConfigLine(b); pkt != nil {
+			return pkt
+		}
+	case 'S':
+		// Serial_Number - #Sn<SerialNumber> - device serial number
+		if bytes.HasPrefix(b, []byte("#Sn")) {
+			return &SerialNumberPacket{SN: string(b[3:])}
+		}
+		// #Se<SerialNumber> - expansion module serial number
+		if bytes.HasPrefix(b, []byte("#Se")) {
+			return &ExpansionSerialNumberPacket{SN: string(b[3:])}
+		}
+	case 'P':
+		if bytes.HasPrefix(b, []byte("#PCK")) {
+			return &EndOfPresetsPacket{}
+		}
+	case 'Q':
+		// #QA:<value> - sent once on startup
+		if len(b) > 4 && string(b[:4]) == "#QA:" {
+			return &QualityPacket{Value: parseASCIIDecimal(string(b[4:]))}
+		}
+	}
+	if pkt, ok := parseStatus(b); ok {
+		return pkt
+	}
+	return &UnhandledPacket{Data: append([]byte(nil), b...)}
+}
+
+// parseConfigLine parses the #C lines. It returns nil for lines it doesn't
+// know and a ParseErrorPacket for known lines with missing fields.
+func parseConfigLine(b []byte) Packet {
+	if len(b) < 6 {
+		return nil
+	}
+	s := string(b)
+	switch {
+	case strings.HasPrefix(s, "#C2-F:"):
+		// Current_config - #C2-F:<Start_Freq>, <Freq_Step>, <Amp_Top>, <Amp_Bottom>, <Sweep_Steps>,
+		//                  <ExpModuleActive>, <CurrentMode>, <Min_Freq>, <Max_Freq>, <Max_Span>, <RBW>,
+		//                  <AmpOffset>, <CalculatorMode> <EOL>
+		// Send current Spectrum Analyzer configuration data. From RFE to PC, will be used
+		// by the PC to control PC client GUI. Note this has been updated in v1.12
+		p := strings.Split(s[6:], ",")
+		if len(p) < 13 {
+			return parseError(b, "configuration has %d fields, expected 13", len(p))
+		}
+		return &CurrentConfigPacket{
+			StartFreqKHZ:    parseASCIIDecimal(p[0]),
+			FreqStepHZ:      parseASCIIDecimal(p[1]),
+			AmpTopDBM:       parseASCIIDecimal(p[2]),
+			AmpBottomDBM:    parseASCIIDecimal(p[3]),
+			SweepSteps:      parseASCIIDecimal(p[4]),
+			ExpModuleActive: p[5] == "1",
+			CurrentMode:     parseMode(p[6]),
+			MinFreqKHZ:      parseASCIIDecimal(p[7]),
+			MaxFreqKHZ:      parseASCIIDecimal(p[8]),
+			MaxSpan:         parseASCIIDecimal(p[9]),
+			RBWKHZ:          parseASCIIDecimal(p[10]),
+			AmpOffset:       parseASCIIDecimal(p[11]),
+			CalculatorMode:  parseCalculatorMode(p[12]),
+		}
+	case strings.HasPrefix(s, "#C2-M:"), strings.HasPrefix(s, "#C3-M:"):
+		// Current_Setup - #C2-M:<Main_Model>, <Expansion_Model>, <Firmware_Version> <EOL>
+		// Send current Spectrum Analyzer model setup and firmware version	1.06
+		// #C3-M is the same for the signal generator.
+		return parseSetup(s[6:])
+	case strings.HasPrefix(s, "#C3-"):
+		// TODO: #C3- configs https://github.com/RFExplorer/RFExplorer-for-Python/blob/master/RFExplorer/RFEConfiguration.py#L136
+	case strings.HasPrefix(s, "#C4-F:"):
+		// Sniffer config - #C4-F:<Start_Freq>, <ExpModuleActive>, <CurrentMode>, <Delay>, <Modulation>, <RBW>, <Threshold> <EOL>
+		// https://github.com/RFExplorer/RFExplorer-for-Python/blob/master/RFExplorer/RFEConfiguration.py#L190
+		p := strings.Split(s[6:], ",")
+		if len(p) < 7 {
+			return parseError(b, "sniffer configuration has %d fields, expected 7", len(p))
+		}
+		return &CurrentSnifferConfig{
+			StartFreqKHZ:    parseASCIIDecimal(p[0]),
+			ExpModuleActive: p[1] == "1",
+			CurrentMode:     parseMode(p[2]),
+			Delay:           parseASCIIDecimal(p[3]), // baudrate = (FCY_CLOCK=16*1000*1000)/delay,
+			Modulation:      parseModulation(p[4]),
+			RBWKHZ:          parseASCIIDecimal(p[5]),
+			ThresholdDBM:    -0.5 * float64(parseASCIIDecimal(p[6])),
+		}
+	case strings.HasPrefix(s, "#CAL:"):
+		if len(b) < 7 {
+			return parseError(b, "calibration availability is too short")
+		}
+		return &CalibrationAvailabilityPacket{
+			MainboardInternalCalibrationAvailable:      b[5] == '1',
+			ExpansionBoardInternalCalibrationAvailable: b[6] == '1',
+		}
+	}
+	return nil
+}
+
+// presetRecordSize is the length of a stored preset as the device sends it,
+// without the EOL.
+const presetRecordSize = 35
+
+// parsePreset parses a preset record, which must be at least
+// presetRecordSize long.
+func parsePreset(b []byte) *Preset {
+	// "$P " index:byte \x01 name:byte*12 \x00 \x00 minfreqkhz:uint32 maxfeqkhz:uint32 calcmode:byte amptop:int8 ampbottom:int8 calciter:byte mainboard:bool markermode:byte \x42 \x00
+	nameBytes := b[5 : 5+12]
+	if ix := bytes.IndexByte(nameBytes, 0); ix >= 0 {
+		nameBytes = nameBytes[:ix]
+	}
+	return &Preset{
+		Index:          int(b[3]),
+		Name:           string(nameBytes),
+		MinFreqKHz:     int(binary.LittleEndian.Uint32(b[19:23])),
+		MaxFreqKHz:     int(binary.LittleEndian.Uint32(b[23:27])),
+		CalcMode:       CalculatorMode(b[27]),
+		AmpTopDBm:      int(int8(b[28])),
+		AmpBottomDBm:   int(int8(b[29])),
+		CalcIterations: int(b[30]),
+		Mainboard:      b[31] != 0,
+		MarkerMode:     MarkerMode(b[32]),
+	}
+}
@@ -0,0 +1,133 @@
+package rfx
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrUnsupportedByFirmware is returned, wrapped with details, for commands
+// that the device's model or firmware doesn't support. Old firmware tends
+// to misinterpret commands it doesn't know rather than reject them, so they
+// aren't sent.
+var ErrUnsupportedByFirmware = errors.New("rfx: not supported by the device's firmware")
+
+// FirmwareVersion is a firmware version such as 1.12.
+type FirmwareVersion struct {
+	Major, Minor int
+}
+
+// ParseFirmwareVersion parses a version as reported in the setup, such as
+// "01.12". Anything after the minor version's digits, such as a beta
+// suffix, is ignored.
+func ParseFirmwareVersion(s string) (FirmwareVersion, error) {
+	parts := strings.SplitN(strings.TrimSpace(s), ".", 2)
+	if len(parts) != 2 {
+		return FirmwareVersion{}, fmt.Errorf("rfx: invalid firmware version %q", s)
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return FirmwareVersion{}, fmt.Errorf("rfx: invalid firmware version %q", s)
+	}
+	minor := parts[1]
+	if i := strings.IndexFunc(minor, func(r rune) bool { return r < '0' || r > '9' }); i >= 0 {
+		minor = minor[:i]
+	}
+	m, err := strconv.Atoi(minor)
+	if err != nil {
+		return FirmwareVersion{}, fmt.Errorf("rfx: invalid firmware version %q", s)
+	}
+	return FirmwareVersion{Major: major, Minor: m}, nil
+}
+
+func (v FirmwareVersion) String() string {
+	return fmt.Sprintf("%d.%02d", v.Major, v.Minor)
+}
+
+// AtLeast returns true if v is the same as or newer than o.
+func (v FirmwareVersion) AtLeast(o FirmwareVersion) bool {
+	return v.Major > o.Major || v.Major == o.Major && v.Minor >= o.Minor
+}
+
+// Version returns the parsed firmware version and false if it's missing or
+// can't be parsed.
+func (p *CurrentSetupPacket) Version() (FirmwareVersion, bool) {
+	v, err := ParseFirmwareVersion(p.FirmwareVersion)
+	return v, err == nil
+}
+
+// Capability is a feature that only some models or firmware support.
+type Capability int
+
+const (
+	// CapSweepPoints is setting the number of sweep points up to 4096.
+	CapSweepPoints Capability = iota
+	// CapLargeSweeps is setting up to 65536 sweep points with Cj.
+	CapLargeSweeps
+	// CapDSP is selecting the DSP mode.
+	CapDSP
+	// CapInputStage is switching the input stage.
+	CapInputStage
+	// Cap100Presets is having 100 preset slots instead of 30.
+	Cap100Presets
+)
+
+// capabilities lists what each capability needs. A nil model func means
+// every model.
+var capabilities = map[Capability]struct {
+	name       string
+	minVersion FirmwareVersion
+	model      func(Model) bool
+}{
+	CapSweepPoints: {"sweep points", FirmwareVersion{1, 12}, nil},
+	CapLargeSweeps: {"large sweeps", FirmwareVersion{1, 26}, nil},
+	CapDSP:         {"DSP mode", FirmwareVersion{1, 12}, Model.HasDSP},
+	CapInputStage:  {"input stage", FirmwareVersion{1, 12}, func(m Model) bool { return m == ModelWSUB1GPlus }},
+	Cap100Presets:  {"100 presets", FirmwareVersion{1, 12}, Model.IsPlus},
+}
+
+func (c Capability) String() string {
+	if req, ok := capabilities[c]; ok {
+		return req.name
+	}
+	return fmt.Sprintf("Capability(%d)", int(c))
+}
+
+// Check returns nil if model with the setup's firmware supports c, and an
+// error wrapping ErrUnsupportedByFirmware otherwise. A firmware version
+// that can't be parsed is assumed to be new enough.
+func (p *CurrentSetupPacket) Check(model Model, c Capability) error {
+	req, ok := capabilities[c]
+	if !ok {
+		return fmt.Errorf("rfx: unknown capability %d", int(c))
+	}
+	if req.model != nil && !req.model(model) {
+		return fmt.Errorf("%w: the %s doesn't support %s", ErrUnsupportedByFirmware, model, req.name)
+	}
+	if v, ok := p.Version(); ok && !v.AtLeast(req.minVersion) {
+		return fmt.Errorf("%w: %s needs firmware %s, the device has %s", ErrUnsupportedByFirmware, req.name, req.minVersion, v)
+	}
+	return nil
+}
+
+// Supports returns true if the active module and firmware support c, or
+// if the device hasn't reported its setup yet.
+func (r *RFExplorer) Supports(c Capability) bool {
+	return r.require(c) == nil
+}
+
+// require returns an error wrapping ErrUnsupportedByFirmware if the active
+// module or firmware don't support c. Without a setup it can't tell so
+// everything is allowed.
+func (r *RFExplorer) require(c Capability) error {
+	setup := r.Setup()
+	if setup == nil {
+		return nil
+	}
+	model := setup.Model
+	if config, ok := r.config.Load().(*CurrentConfigPacket); ok && config.ExpModuleActive {
+		model = setup.ExpansionModel
+	}
+	return setup.Check(model, c)
+}
@@ -0,0 +1,264 @@
+package rfx
+
+import (
+	"fmt"
+	"time"
+)
+
+// Frequency range of the RFE6GEN signal generator.
+const (
+	GenMinFreqKHZ = 23400
+	GenMaxFreqKHZ = 6000000
+)
+
+// GenPower is an output power setting of the signal generator. The level
+// selects one of four attenuations within the low or high power range.
+type GenPower struct {
+	Level     int // 0-3
+	HighPower bool
+}
+
+func (p GenPower) validate() error {
+	if p.Level < 0 || p.Level > 3 {
+		return fmt.Errorf("rfx: generator power level must be between 0 and 3, got %d", p.Level)
+	}
+	return nil
+}
+
+func (p GenPower) args() string {
+	high := 0
+	if p.HighPower {
+		high = 1
+	}
+	return fmt.Sprintf("%d,%d", p.Level, high)
+}
+
+// checkGenerator returns an error unless the device is known to be a
+// signal generator.
+func (r *RFExplorer) checkGenerator() error {
+	setup := r.Setup()
+	if setup == nil {
+		return fmt.Errorf("rfx: model of the device is unknown, can't tell if it's a signal generator")
+	}
+	if !setup.IsGenerator() {
+		return fmt.Errorf("rfx: %s is not a signal generator", setup.Model)
+	}
+	return nil
+}
+
+// genExpansion returns true if the expansion module of an RFE6GEN Combo has
+// been selected with SwitchModuleExp, in which case the generator commands
+// are the C5 ones that set the output power in dBm.
+func (r *RFExplorer) genExpansion() bool {
+	active, _ := r.genExpActive.Load().(bool)
+	setup := r.Setup()
+	return active && setup != nil && setup.ExpansionModel == ModelRFGenExpansion
+}
+
+func checkGenFreq(name string, freqKHZ int) error {
+	if freqKHZ < GenMinFreqKHZ || freqKHZ > GenMaxFreqKHZ {
+		return fmt.Errorf("rfx: generator %s frequency %d KHz out of range %d-%d KHz", name, freqKHZ, GenMinFreqKHZ, GenMaxFreqKHZ)
+	}
+	return nil
+}
+
+// Range of the output power of the expansion module of an RFE6GEN Combo
+// that fits in the C5 commands.
+const (
+	genExpMinDBM = -99.9
+	genExpMaxDBM = 99.9
+)
+
+// genPower returns the power set by GenSetPower, the lowest by default.
+func (r *RFExplorer) genPower() GenPower {
+	p, _ := r.genPowerSet.Load().(GenPower)
+	return p
+}
+
+// genExpPower returns the power set by GenSetExpansionPower in the format
+// of the C5 commands, -30 dBm by default.
+func (r *RFExplorer) genExpPower() string {
+	dbm, ok := r.genExpDBM.Load().(float64)
+	if !ok {
+		dbm = -30
+	}
+	return genDBM(dbm)
+}
+
+func genDBM(dbm float64) string {
+	return fmt.Sprintf("%+05.1f", dbm)
+}
+
+func checkGenDBM(name string, dbm float64) error {
+	if dbm < genExpMinDBM || dbm > genExpMaxDBM {
+		return fmt.Errorf("rfx: generator %s power %.1f dBm out of range", name, dbm)
+	}
+	return nil
+}
+
+// GenSetPower sets the output power of the mainboard used by GenSetCW and
+// GenStartFreqSweep. The protocol has no command of its own for the power,
+// so if a continuous wave is being transmitted it's sent again with the new
+// power, otherwise the power takes effect with the next of those commands.
+func (r *RFExplorer) GenSetPower(level int, highPower bool) error {
+	p := GenPower{Level: level, HighPower: highPower}
+	if err := p.validate(); err != nil {
+		return err
+	}
+	if err := r.checkGenerator(); err != nil {
+		return err
+	}
+	r.genPowerSet.Store(p)
+	if cw, _ := r.genCWKHZ.Load().(int); cw != 0 && !r.genExpansion() {
+		return r.GenSetCW(cw)
+	}
+	return nil
+}
+
+// GenSetExpansionPower sets the output power in dBm of the expansion module
+// of an RFE6GEN Combo like GenSetPower does for the mainboard.
+func (r *RFExplorer) GenSetExpansionPower(dbm float64) error {
+	if err := checkGenDBM("expansion", dbm); err != nil {
+		return err
+	}
+	if err := r.checkGenerator(); err != nil {
+		return err
+	}
+	r.genExpDBM.Store(dbm)
+	if cw, _ := r.genCWKHZ.Load().(int); cw != 0 && r.genExpansion() {
+		return r.GenSetCW(cw)
+	}
+	return nil
+}
+
+// GenSetCW starts transmitting a continuous wave on a frequency.
+func (r *RFExplorer) GenSetCW(freqKHZ int) error {
+	if err := r.checkGenerator(); err != nil {
+		return err
+	}
+	if err := checkGenFreq("CW", freqKHZ); err != nil {
+		return err
+	}
+	var err error
+	if r.genExpansion() {
+		// #<Size>C5-F:<CW_Freq_KHZ>,<Power_dBm>
+		err = r.SendCommand(fmt.Sprintf("C5-F:%07d,%s", freqKHZ, r.genExpPower()))
+	} else {
+		// #<Size>C3-F:<CW_Freq_KHZ>,<PowerLevel>,<HighPowerSwitch>
+		err = r.SendCommand(fmt.Sprintf("C3-F:%07d,%s", freqKHZ, r.genPower().args()))
+	}
+	if err != nil {
+		return err
+	}
+	r.genCWKHZ.Store(freqKHZ)
+	return nil
+}
+
+// GenStartFreqSweep sweeps the output from startKHZ to stopKHZ in steps of
+// stepKHZ, dwelling delay on each step.
+func (r *RFExplorer) GenStartFreqSweep(startKHZ, stopKHZ, stepKHZ int, delay time.Duration) error {
+	if err := r.checkGenerator(); err != nil {
+		return err
+	}
+	if err := checkGenFreq("start", startKHZ); err != nil {
+		return err
+	}
+	if err := checkGenFreq("stop", stopKHZ); err != nil {
+		return err
+	}
+	if stepKHZ <= 0 || stopKHZ <= startKHZ {
+		return fmt.Errorf("rfx: generator sweep needs a positive step and a stop above the start")
+	}
+	steps := (stopKHZ - startKHZ) / stepKHZ
+	if steps > 9999 {
+		return fmt.Errorf("rfx: generator sweep of %d steps exceeds 9999", steps)
+	}
+	delayMS, err := genDelay(delay)
+	if err != nil {
+		return err
+	}
+	r.genCWKHZ.Store(0)
+	if r.genExpansion() {
+		// #<Size>C5-F:<Start_Freq_KHZ>,<Power_dBm>,<Sweep_Steps>,<Step_Freq_KHZ>,<Sweep_Delay_ms>
+		return r.SendCommand(fmt.Sprintf("C5-F:%07d,%s,%04d,%07d,%05d", startKHZ, r.genExpPower(), steps, stepKHZ, delayMS))
+	}
+	// #<Size>C3-F:<Start_Freq_KHZ>,<PowerLevel>,<HighPowerSwitch>,<Sweep_Steps>,<Step_Freq_KHZ>,<Sweep_Delay_ms>
+	return r.SendCommand(fmt.Sprintf("C3-F:%07d,%s,%04d,%07d,%05d", startKHZ, r.genPower().args(), steps, stepKHZ, delayMS))
+}
+
+// GenStartAmpSweep sweeps the output power of the mainboard on a frequency
+// from start to stop, dwelling delay on each setting. The expansion module
+// of an RFE6GEN Combo is swept with GenStartExpansionAmpSweep instead.
+func (r *RFExplorer) GenStartAmpSweep(freqKHZ int, start, stop GenPower, delay time.Duration) error {
+	// #<Size>C3-A:<CW_Freq_KHZ>,<Start_PowerLevel>,<Start_HighPowerSwitch>,<Stop_PowerLevel>,<Stop_HighPowerSwitch>,<Sweep_Delay_ms>
+	if err := r.checkGenerator(); err != nil {
+		return err
+	}
+	if r.genExpansion() {
+		return fmt.Errorf("rfx: the expansion module is active, use GenStartExpansionAmpSweep")
+	}
+	if err := checkGenFreq("CW", freqKHZ); err != nil {
+		return err
+	}
+	if err := start.validate(); err != nil {
+		return err
+	}
+	if err := stop.validate(); err != nil {
+		return err
+	}
+	delayMS, err := genDelay(delay)
+	if err != nil {
+		return err
+	}
+	r.genCWKHZ.Store(0)
+	return r.SendCommand(fmt.Sprintf("C3-A:%07d,%s,%s,%05d", freqKHZ, start.args(), stop.args(), delayMS))
+}
+
+// GenStartExpansionAmpSweep sweeps the output power of the expansion module
+// of an RFE6GEN Combo on a frequency from startDBM to stopDBM in steps of
+// stepDB, dwelling delay on each step. The expansion module must have been
+// selected with SwitchModuleExp.
+func (r *RFExplorer) GenStartExpansionAmpSweep(freqKHZ int, startDBM, stepDB, stopDBM float64, delay time.Duration) error {
+	// #<Size>C5-A:<CW_Freq_KHZ>,<Start_Power_dBm>,<Step_Power_dB>,<Stop_Power_dBm>,<Sweep_Delay_ms>
+	if err := r.checkGenerator(); err != nil {
+		return err
+	}
+	if !r.genExpansion() {
+		return fmt.Errorf("rfx: the expansion module of an RFE6GEN Combo isn't active")
+	}
+	if err := checkGenFreq("CW", freqKHZ); err != nil {
+		return err
+	}
+	if err := checkGenDBM("start", startDBM); err != nil {
+		return err
+	}
+	if err := checkGenDBM("stop", stopDBM); err != nil {
+		return err
+	}
+	if stepDB <= 0 || stepDB > 99.9 || stopDBM <= startDBM {
+		return fmt.Errorf("rfx: generator power sweep needs a positive step and a stop above the start")
+	}
+	delayMS, err := genDelay(delay)
+	if err != nil {
+		return err
+	}
+	r.genCWKHZ.Store(0)
+	return r.SendCommand(fmt.Sprintf("C5-A:%07d,%s,%04.1f,%s,%05d", freqKHZ, genDBM(startDBM), stepDB, genDBM(stopDBM), delayMS))
+}
+
+// GenStop turns off the generator's output.
+func (r *RFExplorer) GenStop() error {
+	if err := r.checkGenerator(); err != nil {
+		return err
+	}
+	r.genCWKHZ.Store(0)
+	return r.SetGeneratorPower(false)
+}
+
+func genDelay(d time.Duration) (int, error) {
+	ms := int(d / time.Millisecond)
+	if ms < 0 || ms > 99999 {
+		return 0, fmt.Errorf("rfx: generator sweep delay %s out of range", d)
+	}
+	return ms, nil
+}
@@ -0,0 +1,122 @@
+// Package harmonics measures the harmonics of a transmitter and compares
+// them against a spurious emission mask.
+package harmonics
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/samuel/rfexplorer/rfx"
+)
+
+// Mask is a spurious emission limit for harmonics relative to the
+// fundamental.
+type Mask struct {
+	Name string
+	// LimitDBC is the highest allowed harmonic level relative to the
+	// fundamental. It's negative.
+	LimitDBC float64
+}
+
+// Common masks from FCC part 97.307 for amateur transmitters.
+var (
+	MaskHF  = Mask{Name: "FCC 97.307(d) below 30 MHz", LimitDBC: -43}
+	MaskVHF = Mask{Name: "FCC 97.307(e) 30-225 MHz", LimitDBC: -60}
+)
+
+// DefaultMask returns the mask for a fundamental frequency. MaskVHF is used
+// for everything at or above 30 MHz.
+func DefaultMask(fundamentalHZ int) Mask {
+	if fundamentalHZ < 30e6 {
+		return MaskHF
+	}
+	return MaskVHF
+}
+
+// Result is the measurement of a single harmonic.
+type Result struct {
+	// N is the harmonic number, 1 for the fundamental.
+	N      int
+	FreqHZ int
+	// Measured is false when the harmonic is outside of the device's
+	// range, in which case the other values are not set.
+	Measured bool
+	LevelDBM float64
+	// RelativeDB is the level relative to the fundamental in dBc.
+	RelativeDB float64
+	// Pass is true if the level is within the mask. It's always true for
+	// the fundamental.
+	Pass bool
+}
+
+// PeakLevel returns the strongest level in a sweep within spanHZ centered
+// on freqHZ, and false if the sweep doesn't cover freqHZ.
+func PeakLevel(config *rfx.CurrentConfigPacket, samples []float64, freqHZ, spanHZ int) (float64, bool) {
+	startHZ := config.StartFreqKHZ * 1000
+	endHZ := startHZ + (len(samples)-1)*config.FreqStepHZ
+	if freqHZ < startHZ || freqHZ > endHZ {
+		return 0, false
+	}
+	peak := -999.0
+	for i, s := range samples {
+		f := startHZ + i*config.FreqStepHZ
+		if f >= freqHZ-spanHZ/2 && f <= freqHZ+spanHZ/2 && s > peak {
+			peak = s
+		}
+	}
+	return peak, true
+}
+
+// Check fills in the relative level and pass state of each result
+// according to mask. The first result must be the fundamental.
+func Check(results []Result, mask Mask) {
+	if len(results) == 0 || !results[0].Measured {
+		return
+	}
+	fund := results[0].LevelDBM
+	results[0].Pass = true
+	for i := range results[1:] {
+		r := &results[i+1]
+		if !r.Measured {
+			continue
+		}
+		r.RelativeDB = r.LevelDBM - fund
+		r.Pass = r.RelativeDB <= mask.LimitDBC
+	}
+}
+
+// Measure retunes the analyzer to the fundamental and each harmonic up to
+// and including harmonic n, holding the maximum level within spanHZ of each
+// for dwell. Harmonics beyond the range of the active module are reported
+// as not measured. It consumes packets from the device so it should not be
+// used while something else is reading from it.
+func Measure(ctx context.Context, s rfx.SpectrumSource, fundamentalHZ, n, spanHZ int, dwell time.Duration, mask Mask) ([]Result, error) {
+	results := make([]Result, 0, n)
+	maxFreqKHZ := 0
+	for h := 1; h <= n; h++ {
+		res := Result{N: h, FreqHZ: h * fundamentalHZ}
+		centerKHZ := res.FreqHZ / 1000
+		if maxFreqKHZ != 0 && centerKHZ+spanHZ/2000 > maxFreqKHZ {
+			results = append(results, res)
+			continue
+		}
+		dctx, cancel := context.WithTimeout(ctx, dwell)
+		config, samples, err := rfx.MaxHold(dctx, s, centerKHZ-spanHZ/2000, centerKHZ+spanHZ/2000)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+		maxFreqKHZ = config.MaxFreqKHZ
+		res.LevelDBM, res.Measured = PeakLevel(config, samples, res.FreqHZ, spanHZ)
+		if !res.Measured && h == 1 {
+			return nil, fmt.Errorf("rfx: fundamental %d Hz is outside of the device range", fundamentalHZ)
+		}
+		results = append(results, res)
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+	Check(results, mask)
+	return results, nil
+}
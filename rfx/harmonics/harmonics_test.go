@@ -0,0 +1,37 @@
+package harmonics
+
+import (
+	"testing"
+
+	"github.com/samuel/rfexplorer/rfx"
+)
+
+func TestPeakLevel(t *testing.T) {
+	config := &rfx.CurrentConfigPacket{StartFreqKHZ: 145000, FreqStepHZ: 10000}
+	samples := []float64{-90, -90, -20, -90, -10, -90}
+	if l, ok := PeakLevel(config, samples, 145020000, 30000); !ok || l != -20 {
+		t.Errorf("PeakLevel = %.1f, %t, want -20, true", l, ok)
+	}
+	if _, ok := PeakLevel(config, samples, 146000000, 30000); ok {
+		t.Error("PeakLevel should fail outside of the sweep")
+	}
+}
+
+func TestCheck(t *testing.T) {
+	results := []Result{
+		{N: 1, FreqHZ: 145000000, Measured: true, LevelDBM: 0},
+		{N: 2, FreqHZ: 290000000, Measured: true, LevelDBM: -65},
+		{N: 3, FreqHZ: 435000000, Measured: true, LevelDBM: -50},
+		{N: 4, FreqHZ: 580000000},
+	}
+	Check(results, DefaultMask(145000000))
+	if !results[0].Pass || !results[1].Pass || results[1].RelativeDB != -65 {
+		t.Errorf("2nd harmonic should pass: %+v", results[1])
+	}
+	if results[2].Pass || results[2].RelativeDB != -50 {
+		t.Errorf("3rd harmonic should fail: %+v", results[2])
+	}
+	if results[3].Pass {
+		t.Errorf("unmeasured harmonic should not pass: %+v", results[3])
+	}
+}
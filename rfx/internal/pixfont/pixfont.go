@@ -0,0 +1,75 @@
+// Package pixfont draws text in a tiny built-in bitmap font, for labeling
+// images without depending on a font renderer. It has the digits, some
+// punctuation, and the letters of units such as MHz and dBm.
+package pixfont
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// Size of a glyph at scale 1. Glyphs are Advance apart.
+const (
+	Width   = 3
+	Height  = 5
+	Advance = Width + 1
+)
+
+var glyphs = map[rune][Height]string{
+	'0': {"###", "#.#", "#.#", "#.#", "###"},
+	'1': {".#.", "##.", ".#.", ".#.", "###"},
+	'2': {"###", "..#", "###", "#..", "###"},
+	'3': {"###", "..#", ".##", "..#", "###"},
+	'4': {"#.#", "#.#", "###", "..#", "..#"},
+	'5': {"###", "#..", "###", "..#", "###"},
+	'6': {"###", "#..", "###", "#.#", "###"},
+	'7': {"###", "..#", "..#", ".#.", ".#."},
+	'8': {"###", "#.#", "###", "#.#", "###"},
+	'9': {"###", "#.#", "###", "..#", "###"},
+	'.': {"...", "...", "...", "...", ".#."},
+	'-': {"...", "...", "###", "...", "..."},
+	'+': {"...", ".#.", "###", ".#.", "..."},
+	':': {"...", ".#.", "...", ".#.", "..."},
+	'/': {"..#", "..#", ".#.", "#..", "#.."},
+	'B': {"##.", "#.#", "##.", "#.#", "##."},
+	'G': {"###", "#..", "#.#", "#.#", "###"},
+	'H': {"#.#", "#.#", "###", "#.#", "#.#"},
+	'M': {"#.#", "###", "###", "#.#", "#.#"},
+	'd': {"..#", "..#", "###", "#.#", "###"},
+	'k': {"#..", "#.#", "##.", "#.#", "#.#"},
+	'm': {"...", "...", "###", "###", "#.#"},
+	's': {".##", "#..", ".#.", "..#", "##."},
+	'z': {"...", "###", "..#", ".#.", "###"},
+}
+
+// TextWidth returns the width in pixels of s drawn at the given scale.
+func TextWidth(s string, scale int) int {
+	n := len([]rune(s))
+	if n == 0 {
+		return 0
+	}
+	return (n*Advance - 1) * scale
+}
+
+// Draw draws s with its top left corner at x, y, with each pixel of the
+// font drawn as a scale by scale square. Characters the font doesn't have
+// are left blank.
+func Draw(img draw.Image, x, y int, s string, c color.Color, scale int) {
+	src := image.NewUniform(c)
+	for _, r := range s {
+		g, ok := glyphs[r]
+		if ok {
+			for gy, row := range g {
+				for gx, p := range row {
+					if p != '#' {
+						continue
+					}
+					px := image.Rect(x+gx*scale, y+gy*scale, x+(gx+1)*scale, y+(gy+1)*scale)
+					draw.Draw(img, px, src, image.Point{}, draw.Src)
+				}
+			}
+		}
+		x += Advance * scale
+	}
+}
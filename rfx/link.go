@@ -0,0 +1,106 @@
+package rfx
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// LinkStats describes the health of the link to the device.
+type LinkStats struct {
+	// Probes is the number of probes that got a response and Timeouts the
+	// number that didn't.
+	Probes   int
+	Timeouts int
+	// LastRTT, MinRTT, MeanRTT, and MaxRTT are statistics of the round
+	// trip times of the probes that got a response.
+	LastRTT time.Duration
+	MinRTT  time.Duration
+	MeanRTT time.Duration
+	MaxRTT  time.Duration
+	// FramingErrors is the number of packets whose length didn't match
+	// their framing, which usually means bytes were lost or corrupted.
+	FramingErrors int
+	// Resyncs is the number of times the receive buffer was discarded
+	// because no packet could be found in it.
+	Resyncs int
+	// Dropped is the number of packets discarded by the WithBackpressure
+	// policy because Chan was full.
+	Dropped int
+}
+
+// linkMeter accumulates LinkStats.
+type linkMeter struct {
+	mu       sync.Mutex
+	stats    LinkStats
+	totalRTT time.Duration
+}
+
+func (m *linkMeter) probe(rtt time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := &m.stats
+	s.Probes++
+	s.LastRTT = rtt
+	if s.Probes == 1 || rtt < s.MinRTT {
+		s.MinRTT = rtt
+	}
+	if rtt > s.MaxRTT {
+		s.MaxRTT = rtt
+	}
+	m.totalRTT += rtt
+	s.MeanRTT = m.totalRTT / time.Duration(s.Probes)
+}
+
+func (m *linkMeter) timeout() {
+	m.mu.Lock()
+	m.stats.Timeouts++
+	m.mu.Unlock()
+}
+
+func (m *linkMeter) framingError() {
+	m.mu.Lock()
+	m.stats.FramingErrors++
+	m.mu.Unlock()
+}
+
+func (m *linkMeter) drop(n int) {
+	if n == 0 {
+		return
+	}
+	m.mu.Lock()
+	m.stats.Dropped += n
+	m.mu.Unlock()
+}
+
+func (m *linkMeter) resync() {
+	m.mu.Lock()
+	m.stats.Resyncs++
+	m.mu.Unlock()
+}
+
+// LinkStats returns the round trip times of the probes done so far, the
+// number of framing errors and resyncs seen by the reader, and the number
+// of packets dropped because Chan was full.
+func (r *RFExplorer) LinkStats() LinkStats {
+	r.link.mu.Lock()
+	defer r.link.mu.Unlock()
+	return r.link.stats
+}
+
+// Probe measures the round trip time of the link by requesting the current
+// configuration and waiting for it to arrive. This only works in analyzer
+// mode. A probe that doesn't get a response before ctx is done is counted
+// as a timeout in LinkStats.
+func (r *RFExplorer) Probe(ctx context.Context) (time.Duration, error) {
+	start := time.Now()
+	if _, err := r.GetConfig(ctx); err != nil {
+		if ctx.Err() != nil {
+			r.link.timeout()
+		}
+		return 0, err
+	}
+	rtt := time.Since(start)
+	r.link.probe(rtt)
+	return rtt, nil
+}
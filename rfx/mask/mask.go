@@ -0,0 +1,179 @@
+// Package mask checks sweeps against limit lines, such as an emission limit
+// for EMC pre-compliance or the expected quiet level of a band.
+package mask
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/samuel/rfexplorer/rfx"
+	"github.com/samuel/rfexplorer/rfx/analysis"
+)
+
+// Point is a corner of a limit line.
+type Point struct {
+	FreqHZ   int
+	LimitDBM float64
+}
+
+// Mask is a limit line. The limit is interpolated linearly between points
+// and two points at the same frequency make a step. Frequencies outside of
+// the first and last point aren't checked.
+type Mask struct {
+	Name   string
+	Points []Point
+}
+
+// New returns a mask of at least two points in order of frequency.
+func New(name string, points []Point) (*Mask, error) {
+	if len(points) < 2 {
+		return nil, errors.New("mask: need at least two points")
+	}
+	for i := 1; i < len(points); i++ {
+		if points[i].FreqHZ < points[i-1].FreqHZ {
+			return nil, fmt.Errorf("mask: point at %d Hz is below the previous point", points[i].FreqHZ)
+		}
+	}
+	return &Mask{Name: name, Points: points}, nil
+}
+
+// LimitAt returns the limit at a frequency, and false if the mask doesn't
+// cover it. At a step the lower limit applies.
+func (m *Mask) LimitAt(freqHZ int) (float64, bool) {
+	limit, ok := math.Inf(1), false
+	for i := 1; i < len(m.Points); i++ {
+		a, b := m.Points[i-1], m.Points[i]
+		if freqHZ < a.FreqHZ || freqHZ > b.FreqHZ {
+			continue
+		}
+		l := math.Min(a.LimitDBM, b.LimitDBM)
+		if a.FreqHZ != b.FreqHZ {
+			l = a.LimitDBM + float64(freqHZ-a.FreqHZ)/float64(b.FreqHZ-a.FreqHZ)*(b.LimitDBM-a.LimitDBM)
+		}
+		limit, ok = math.Min(limit, l), true
+	}
+	return limit, ok
+}
+
+// Violation is a run of neighboring samples of a sweep over a mask,
+// described by the sample furthest over it.
+type Violation struct {
+	Time time.Time
+	Mask string
+	// Index is the index of the sample in the sweep.
+	Index    int
+	FreqHZ   int
+	LevelDBM float64
+	LimitDBM float64
+	// MarginDB is the limit minus the level, negative since it's over.
+	MarginDB float64
+	// LowFreqHZ and HighFreqHZ are the frequencies of the first and last
+	// sample of the run.
+	LowFreqHZ, HighFreqHZ int
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("%s %s: %.1f dBm at %.3f MHz is %.1f dB over the limit of %.1f dBm (%.3f-%.3f MHz)",
+		v.Time.Format(time.RFC3339), v.Mask, v.LevelDBM, float64(v.FreqHZ)/1e6, -v.MarginDB, v.LimitDBM,
+		float64(v.LowFreqHZ)/1e6, float64(v.HighFreqHZ)/1e6)
+}
+
+// Check returns the violations of a sweep in order of frequency. The sweep
+// passes if there are none.
+func (m *Mask) Check(sw *rfx.Sweep) []Violation {
+	grid := analysis.ConfigGrid(sw.Config, len(sw.Samples))
+	var vs []Violation
+	var cur *Violation
+	for i, s := range sw.Samples {
+		f := grid.FreqHZ(i)
+		limit, ok := m.LimitAt(f)
+		if !ok || math.IsNaN(s) || s <= limit {
+			cur = nil
+			continue
+		}
+		margin := limit - s
+		if cur == nil {
+			vs = append(vs, Violation{Time: sw.Time, Mask: m.Name, MarginDB: math.Inf(1), LowFreqHZ: f})
+			cur = &vs[len(vs)-1]
+		}
+		cur.HighFreqHZ = f
+		if margin < cur.MarginDB {
+			cur.Index, cur.FreqHZ, cur.LevelDBM, cur.LimitDBM, cur.MarginDB = i, f, s, limit, margin
+		}
+	}
+	return vs
+}
+
+// ReadCSV reads the points of a mask from a CSV file with a header row
+// naming the freq_mhz and limit_dbm columns, for instance:
+//
+//	freq_mhz,limit_dbm
+//	30,-50
+//	88,-50
+//	88,-46
+//	216,-46
+func ReadCSV(name string, r io.Reader) (*Mask, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("mask: failed to read header: %s", err)
+	}
+	freqCol, limitCol := -1, -1
+	for i, h := range header {
+		switch strings.ToLower(strings.TrimSpace(h)) {
+		case "freq_mhz":
+			freqCol = i
+		case "limit_dbm":
+			limitCol = i
+		default:
+			return nil, fmt.Errorf("mask: unknown column %q", h)
+		}
+	}
+	if freqCol < 0 || limitCol < 0 {
+		return nil, errors.New("mask: need freq_mhz and limit_dbm columns")
+	}
+	var points []Point
+	for line := 2; ; line++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		mhz, err := strconv.ParseFloat(strings.TrimSpace(rec[freqCol]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("mask: line %d: invalid freq_mhz %q", line, rec[freqCol])
+		}
+		limit, err := strconv.ParseFloat(strings.TrimSpace(rec[limitCol]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("mask: line %d: invalid limit_dbm %q", line, rec[limitCol])
+		}
+		points = append(points, Point{FreqHZ: int(math.Round(mhz * 1e6)), LimitDBM: limit})
+	}
+	return New(name, points)
+}
+
+// WriteCSV writes the points of a mask in the format read by ReadCSV.
+func (m *Mask) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"freq_mhz", "limit_dbm"}); err != nil {
+		return err
+	}
+	for _, p := range m.Points {
+		if err := cw.Write([]string{
+			strconv.FormatFloat(float64(p.FreqHZ)/1e6, 'f', -1, 64),
+			strconv.FormatFloat(p.LimitDBM, 'f', -1, 64),
+		}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
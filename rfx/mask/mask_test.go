@@ -0,0 +1,92 @@
+package mask
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samuel/rfexplorer/rfx"
+)
+
+func TestLimitAt(t *testing.T) {
+	m, err := New("test", []Point{{100e6, -50}, {200e6, -40}, {200e6, -60}, {300e6, -60}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		freqHZ int
+		limit  float64
+		ok     bool
+	}{
+		{50e6, 0, false},
+		{100e6, -50, true},
+		{150e6, -45, true},
+		{200e6, -60, true}, // the lower side of the step
+		{250e6, -60, true},
+		{301e6, 0, false},
+	} {
+		limit, ok := m.LimitAt(c.freqHZ)
+		if ok != c.ok || (ok && limit != c.limit) {
+			t.Errorf("LimitAt(%d) = %f, %t, want %f, %t", c.freqHZ, limit, ok, c.limit, c.ok)
+		}
+	}
+	if _, err := New("test", []Point{{200e6, -50}, {100e6, -50}}); err == nil {
+		t.Error("expected an error for points out of order")
+	}
+}
+
+func TestCheck(t *testing.T) {
+	m, err := New("flat", []Point{{2410e6, -60}, {2490e6, -60}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	samples := make([]float64, 100)
+	for i := range samples {
+		samples[i] = -90
+	}
+	// Over the limit but outside the mask.
+	samples[5] = -20
+	samples[20], samples[21], samples[22] = -55, -50, -58
+	samples[60] = -61 // just under
+	samples[70] = -40
+	now := time.Date(2017, 1, 31, 23, 59, 0, 0, time.UTC)
+	vs := m.Check(&rfx.Sweep{
+		Time:    now,
+		Config:  &rfx.CurrentConfigPacket{StartFreqKHZ: 2400000, FreqStepHZ: 1000000},
+		Samples: samples,
+	})
+	want := []Violation{
+		{Time: now, Mask: "flat", Index: 21, FreqHZ: 2421e6, LevelDBM: -50, LimitDBM: -60, MarginDB: -10, LowFreqHZ: 2420e6, HighFreqHZ: 2422e6},
+		{Time: now, Mask: "flat", Index: 70, FreqHZ: 2470e6, LevelDBM: -40, LimitDBM: -60, MarginDB: -20, LowFreqHZ: 2470e6, HighFreqHZ: 2470e6},
+	}
+	if !reflect.DeepEqual(vs, want) {
+		t.Errorf("Check = %+v, want %+v", vs, want)
+	}
+}
+
+func TestCSV(t *testing.T) {
+	m, err := ReadCSV("fcc", strings.NewReader("freq_mhz, limit_dbm\n30,-50\n88,-50\n88,-46\n216.5,-46\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Point{{30e6, -50}, {88e6, -50}, {88e6, -46}, {216.5e6, -46}}
+	if m.Name != "fcc" || !reflect.DeepEqual(m.Points, want) {
+		t.Fatalf("ReadCSV = %+v, want %+v", m, want)
+	}
+	var buf bytes.Buffer
+	if err := m.WriteCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	m2, err := ReadCSV("fcc", &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m2, m) {
+		t.Errorf("round trip = %+v, want %+v", m2, m)
+	}
+	if _, err := ReadCSV("bad", strings.NewReader("freq_mhz,level\n")); err == nil {
+		t.Error("expected an error for an unknown column")
+	}
+}
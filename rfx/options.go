@@ -0,0 +1,88 @@
+package rfx
+
+import (
+	"io"
+	"log/slog"
+	"time"
+)
+
+// autoBaudRates are the rates tried by WithAutoBaud, fastest first.
+var autoBaudRates = []BaudRate{
+	BaudRate500000, BaudRate115200, BaudRate57600, BaudRate38400, BaudRate19200,
+	BaudRate9600, BaudRate4800, BaudRate2400, BaudRate1200,
+}
+
+// defaultAutoBaudTimeout is how long WithAutoBaud waits for a response at
+// each rate if no timeout is set.
+const defaultAutoBaudTimeout = 2 * time.Second
+
+// Option configures New.
+type Option func(*options)
+
+type options struct {
+	baudRate     BaudRate
+	timeout      time.Duration
+	autoBaud     bool
+	upgrade      bool
+	reconnect    time.Duration
+	redial       func() (Transport, error)
+	backpressure Backpressure
+	logger       *slog.Logger
+	trace        io.Writer
+}
+
+// WithBaudRate sets the baud rate to connect at. The default is 500,000
+// which is what the device ships with.
+func WithBaudRate(br BaudRate) Option {
+	return func(o *options) {
+		o.baudRate = br
+	}
+}
+
+// WithTimeout sets how long New waits for the device to report its
+// configuration. By default it waits indefinitely.
+func WithTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.timeout = d
+	}
+}
+
+// WithAutoBaud makes New try each supported baud rate in turn, fastest
+// first, until the device reports its configuration. The timeout is used
+// for each rate and defaults to 2 seconds. If upgrade is true and the
+// device was found at a slower rate it's switched to 500,000 baud.
+func WithAutoBaud(upgrade bool) Option {
+	return func(o *options) {
+		o.autoBaud = true
+		o.upgrade = upgrade
+	}
+}
+
+// WithAutoReconnect makes the connection reopen the port when it's lost,
+// for instance because the cable was unplugged or the device rebooted,
+// instead of reporting the error on Errors. The first attempt is made after
+// backoff and the delay doubles after each failed attempt up to
+// maxReconnectBackoff. Once reconnected the last analyzer configuration is
+// sent again and a ReconnectedPacket is sent on Chan.
+func WithAutoReconnect(backoff time.Duration) Option {
+	return func(o *options) {
+		o.reconnect = backoff
+	}
+}
+
+// WithRedial sets how NewWithTransport reopens the transport for
+// WithAutoReconnect.
+func WithRedial(dial func() (Transport, error)) Option {
+	return func(o *options) {
+		o.redial = dial
+	}
+}
+
+// WithBackpressure sets what happens to packets when the client doesn't
+// keep up with Chan. By default the reader waits, which stalls reading from
+// the device. Dropped packets are counted in LinkStats.
+func WithBackpressure(b Backpressure) Option {
+	return func(o *options) {
+		o.backpressure = b
+	}
+}
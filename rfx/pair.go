@@ -0,0 +1,204 @@
+package rfx
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// IsGenerator returns true if the setup is that of an RFE6GEN signal
+// generator rather than a spectrum analyzer.
+func (p *CurrentSetupPacket) IsGenerator() bool {
+	return p.Model == ModelRFGen
+}
+
+// Identify opens device, requests its configuration, and returns the setup
+// it reports which identifies the model. Each supported baud rate is tried
+// in turn, fastest first, waiting up to timeout at each. The device is
+// closed before returning.
+func Identify(device string, timeout time.Duration) (*CurrentSetupPacket, error) {
+	d, err := identify(device, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return d.Setup, nil
+}
+
+func identify(device string, timeout time.Duration) (Device, error) {
+	br, setup, err := probe(device, timeout, "#C2-M:", "#C3-M:")
+	if err != nil {
+		return Device{}, err
+	}
+	return Device{Port: device, Setup: parseSetup(setup), BaudRate: br}, nil
+}
+
+// requestLine requests the config from a port and returns the rest of the
+// first line received that contains one of prefixes. The port must be
+// closed after an error to stop the reader.
+func requestLine(port io.ReadWriter, timeout time.Duration, prefixes ...string) (string, error) {
+	lineCh := make(chan string, 1)
+	go func() {
+		// Sweeps and other binary data may arrive before the line but
+		// it's always terminated by an EOL.
+		s := bufio.NewScanner(port)
+		s.Buffer(make([]byte, 0, 4096), 1<<20)
+		for s.Scan() {
+			line := strings.TrimSuffix(s.Text(), "\r")
+			for _, p := range prefixes {
+				if i := strings.Index(line, p); i >= 0 {
+					lineCh <- line[i+len(p):]
+					return
+				}
+			}
+		}
+	}()
+	if _, err := port.Write([]byte("#\x04C0")); err != nil {
+		return "", fmt.Errorf("rfx: failed to write to port: %s", err)
+	}
+	select {
+	case line := <-lineCh:
+		return line, nil
+	case <-time.After(timeout):
+		return "", fmt.Errorf("rfx: timed out waiting for %s", strings.Join(prefixes, " or "))
+	}
+}
+
+// CandidatePorts returns the serial devices that look like they could be an
+// RF Explorer on this platform.
+func CandidatePorts() []string {
+	var patterns []string
+	switch runtime.GOOS {
+	case "darwin":
+		patterns = []string{"/dev/tty.SLAB_USBtoUART*", "/dev/cu.SLAB_USBtoUART*", "/dev/tty.usbserial*"}
+	case "windows":
+		var ports []string
+		for i := 1; i <= 32; i++ {
+			ports = append(ports, fmt.Sprintf("COM%d", i))
+		}
+		return ports
+	default:
+		for _, p := range linuxTTYPatterns {
+			patterns = append(patterns, "/dev/"+p)
+		}
+	}
+	var ports []string
+	for _, p := range patterns {
+		m, _ := filepath.Glob(p)
+		ports = append(ports, m...)
+	}
+	return ports
+}
+
+// Device is a device found by Discover.
+type Device struct {
+	Port  string
+	Setup *CurrentSetupPacket
+	// BaudRate is the rate the device responded at.
+	BaudRate BaudRate
+}
+
+// Discover probes the likely RF Explorer serial ports on this platform, see
+// CandidatePorts, and returns the devices that respond within timeout at
+// any of the supported baud rates, see Identify. Ports that don't respond
+// are skipped. On macOS, where each device has both a tty and a cu port,
+// only the tty port is probed.
+func Discover(timeout time.Duration) []Device {
+	ports := CandidatePorts()
+	seen := make(map[string]bool, len(ports))
+	for _, port := range ports {
+		seen[port] = true
+	}
+	var devices []Device
+	for _, port := range ports {
+		if strings.HasPrefix(port, "/dev/cu.") && seen["/dev/tty."+strings.TrimPrefix(port, "/dev/cu.")] {
+			continue
+		}
+		d, err := identify(port, timeout)
+		if err != nil {
+			continue
+		}
+		devices = append(devices, d)
+	}
+	return devices
+}
+
+// DiscoverAnalyzer returns the port of the first analyzer found by
+// Discover.
+func DiscoverAnalyzer(timeout time.Duration) (string, error) {
+	for _, d := range Discover(timeout) {
+		if !d.Setup.IsGenerator() {
+			return d.Port, nil
+		}
+	}
+	return "", fmt.Errorf("rfx: no RF Explorer analyzer found")
+}
+
+// Pair is an analyzer and signal generator used together, for instance
+// for tracking or scalar network analysis.
+type Pair struct {
+	Analyzer       *RFExplorer
+	AnalyzerPort   string
+	AnalyzerSetup  *CurrentSetupPacket
+	Generator      *RFExplorer
+	GeneratorPort  string
+	GeneratorSetup *CurrentSetupPacket
+}
+
+// OpenPair identifies the devices on ports and opens the first analyzer and
+// generator found at the baud rates they responded at. If ports is empty
+// then the devices are found with Discover. Ports that don't respond within
+// timeout are skipped.
+func OpenPair(ports []string, timeout time.Duration) (*Pair, error) {
+	var devices []Device
+	if len(ports) == 0 {
+		devices = Discover(timeout)
+	} else {
+		for _, port := range ports {
+			if d, err := identify(port, timeout); err == nil {
+				devices = append(devices, d)
+			}
+		}
+	}
+	p := &Pair{}
+	var analyzerBR, generatorBR BaudRate
+	for _, d := range devices {
+		if d.Setup.IsGenerator() {
+			if p.GeneratorPort == "" {
+				p.GeneratorPort, p.GeneratorSetup, generatorBR = d.Port, d.Setup, d.BaudRate
+			}
+		} else if p.AnalyzerPort == "" {
+			p.AnalyzerPort, p.AnalyzerSetup, analyzerBR = d.Port, d.Setup, d.BaudRate
+		}
+	}
+	switch {
+	case p.AnalyzerPort == "" && p.GeneratorPort == "":
+		return nil, fmt.Errorf("rfx: no analyzer or generator found")
+	case p.AnalyzerPort == "":
+		return nil, fmt.Errorf("rfx: found a generator on %s but no analyzer", p.GeneratorPort)
+	case p.GeneratorPort == "":
+		return nil, fmt.Errorf("rfx: found an analyzer on %s but no generator", p.AnalyzerPort)
+	}
+	var err error
+	if p.Analyzer, err = New(p.AnalyzerPort, WithBaudRate(analyzerBR)); err != nil {
+		return nil, err
+	}
+	if p.Generator, err = open(p.GeneratorPort, generatorBR); err != nil {
+		p.Analyzer.Close()
+		return nil, err
+	}
+	p.Generator.setup.Store(p.GeneratorSetup)
+	return p, nil
+}
+
+// Close closes both devices.
+func (p *Pair) Close() error {
+	err := p.Analyzer.Close()
+	if e := p.Generator.Close(); err == nil {
+		err = e
+	}
+	return err
+}
@@ -0,0 +1,150 @@
+// Package plot draws a sweep, optionally with its max-hold and markers, as
+// a spectrum analyzer style trace with frequency and level axes, to PNG or
+// SVG.
+package plot
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/samuel/rfexplorer/rfx"
+	"github.com/samuel/rfexplorer/rfx/analysis"
+)
+
+// Marker marks a frequency on the plot, such as a peak.
+type Marker struct {
+	FreqHZ float64
+	Label  string
+}
+
+// Plot is a sweep to draw.
+type Plot struct {
+	Grid    analysis.Grid
+	Samples []float64
+	// MaxHold is drawn behind the sweep if set. It must be on the same
+	// grid.
+	MaxHold []float64
+	Markers []Marker
+	// MinDBM and MaxDBM are the levels at the bottom and top of the plot.
+	// If they are equal the range of the levels is used.
+	MinDBM, MaxDBM float64
+	// Width and Height of the image, 800 by 400 if 0.
+	Width, Height int
+}
+
+// FromSweep returns a plot of a sweep with the device's amplitude range.
+func FromSweep(sweep *rfx.SweepDataPacket) (*Plot, error) {
+	if sweep.Config == nil {
+		return nil, errors.New("plot: sweep has no config")
+	}
+	return &Plot{
+		Grid:    analysis.ConfigGrid(sweep.Config, len(sweep.Samples)),
+		Samples: sweep.Samples,
+		MinDBM:  float64(sweep.Config.AmpBottomDBM),
+		MaxDBM:  float64(sweep.Config.AmpTopDBM),
+	}, nil
+}
+
+// Layout of the image, in pixels.
+const (
+	marginLeft   = 48
+	marginRight  = 16
+	marginTop    = 16
+	marginBottom = 32
+	tickLength   = 4
+	fontHeight   = 10
+)
+
+// layout is where things go in an image of a plot, shared by the PNG and
+// SVG renderers.
+type layout struct {
+	width, height  int
+	left, right    int
+	top, bottom    int
+	minDBM, maxDBM float64
+	freqTicks      []tick
+	levelTicks     []tick
+}
+
+// tick is a labeled position along an axis.
+type tick struct {
+	pos   int
+	label string
+}
+
+func (p *Plot) layout() (*layout, error) {
+	if len(p.Samples) == 0 || p.Grid.Points != len(p.Samples) {
+		return nil, errors.New("plot: no samples on the grid")
+	}
+	if p.MaxHold != nil && len(p.MaxHold) != len(p.Samples) {
+		return nil, errors.New("plot: max-hold isn't on the grid of the samples")
+	}
+	l := &layout{width: p.Width, height: p.Height, minDBM: p.MinDBM, maxDBM: p.MaxDBM}
+	if l.width <= 0 {
+		l.width = 800
+	}
+	if l.height <= 0 {
+		l.height = 400
+	}
+	l.left, l.right = marginLeft, l.width-marginRight
+	l.top, l.bottom = marginTop, l.height-marginBottom
+	if l.minDBM == l.maxDBM {
+		l.minDBM, l.maxDBM = math.Inf(1), math.Inf(-1)
+		for _, s := range append(append([]float64(nil), p.Samples...), p.MaxHold...) {
+			l.minDBM = math.Min(l.minDBM, s)
+			l.maxDBM = math.Max(l.maxDBM, s)
+		}
+		// Round out to whole 10 dB.
+		l.minDBM = 10 * math.Floor(l.minDBM/10-0.01)
+		l.maxDBM = 10 * math.Ceil(l.maxDBM/10+0.01)
+	}
+
+	startHZ, endHZ := float64(p.Grid.StartFreqHZ), float64(p.Grid.EndFreqHZ())
+	if step := niceStep((endHZ - startHZ) / 6); step > 0 {
+		decimals := int(math.Max(0, math.Ceil(-math.Log10(step/1e6))))
+		first := math.Ceil(startHZ/step) * step
+		for i := 0; first+float64(i)*step <= endHZ; i++ {
+			f := first + float64(i)*step
+			l.freqTicks = append(l.freqTicks, tick{pos: l.x(p, f), label: fmt.Sprintf("%.*f", decimals, f/1e6)})
+		}
+	}
+	step := niceStep((l.maxDBM - l.minDBM) / 6)
+	first := math.Ceil(l.minDBM/step) * step
+	for i := 0; step > 0 && first+float64(i)*step <= l.maxDBM; i++ {
+		v := first + float64(i)*step
+		l.levelTicks = append(l.levelTicks, tick{pos: l.y(v), label: fmt.Sprintf("%.0f", v)})
+	}
+	return l, nil
+}
+
+// x returns the position of a frequency.
+func (l *layout) x(p *Plot, freqHZ float64) int {
+	span := float64(p.Grid.EndFreqHZ() - p.Grid.StartFreqHZ)
+	if span == 0 {
+		return (l.left + l.right) / 2
+	}
+	return l.left + int(math.Round((freqHZ-float64(p.Grid.StartFreqHZ))/span*float64(l.right-l.left)))
+}
+
+// y returns the position of a level, clamped to the plot.
+func (l *layout) y(dbm float64) int {
+	v := (l.maxDBM - dbm) / (l.maxDBM - l.minDBM)
+	v = math.Max(0, math.Min(1, v))
+	return l.top + int(math.Round(v*float64(l.bottom-l.top)))
+}
+
+// niceStep returns the smallest of 1, 2, or 5 times a power of 10 that's at
+// least v, or 0 if v isn't positive.
+func niceStep(v float64) float64 {
+	if v <= 0 || math.IsInf(v, 0) || math.IsNaN(v) {
+		return 0
+	}
+	pow := math.Pow(10, math.Floor(math.Log10(v)))
+	for _, m := range []float64{1, 2, 5, 10} {
+		if m*pow >= v {
+			return m * pow
+		}
+	}
+	return 10 * pow
+}
@@ -0,0 +1,67 @@
+package plot
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/samuel/rfexplorer/rfx"
+)
+
+func testPlot(t *testing.T) *Plot {
+	config := &rfx.CurrentConfigPacket{StartFreqKHZ: 2400000, FreqStepHZ: 1000000, AmpTopDBM: -10, AmpBottomDBM: -120}
+	samples := make([]float64, 101)
+	for i := range samples {
+		samples[i] = -100
+	}
+	samples[50] = -40
+	p, err := FromSweep(&rfx.SweepDataPacket{Config: config, Samples: samples})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.MaxHold = append([]float64(nil), samples...)
+	p.MaxHold[50] = -30
+	p.Markers = []Marker{{FreqHZ: 2450e6, Label: "2450.000"}}
+	return p
+}
+
+func TestWritePNG(t *testing.T) {
+	p := testPlot(t)
+	var buf bytes.Buffer
+	if err := p.WritePNG(&buf); err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 800 || b.Dy() != 400 {
+		t.Fatalf("size %dx%d, want 800x400", b.Dx(), b.Dy())
+	}
+	l, err := p.layout()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The flat part of the sweep is drawn just right of the left edge.
+	if c := img.At(l.left+2, l.y(-100)); c != traceColor {
+		t.Errorf("trace pixel is %v, want %v", c, traceColor)
+	}
+}
+
+func TestWriteSVG(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testPlot(t).WriteSVG(&buf); err != nil {
+		t.Fatal(err)
+	}
+	svg := buf.String()
+	if strings.Count(svg, "<polyline") != 2 || !strings.Contains(svg, ">2450.000<") {
+		t.Errorf("expected two traces and the marker label in:\n%s", svg)
+	}
+}
+
+func TestEmpty(t *testing.T) {
+	if err := new(Plot).WritePNG(new(bytes.Buffer)); err == nil {
+		t.Error("expected an error for a plot without samples")
+	}
+}
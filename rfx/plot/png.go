@@ -0,0 +1,130 @@
+package plot
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+
+	"github.com/samuel/rfexplorer/rfx/internal/pixfont"
+)
+
+// Colors of the plot.
+var (
+	background   = color.RGBA{0, 0, 0, 255}
+	foreground   = color.RGBA{255, 255, 255, 255}
+	gridColor    = color.RGBA{64, 64, 64, 255}
+	traceColor   = color.RGBA{255, 255, 0, 255}
+	maxHoldColor = color.RGBA{255, 64, 64, 255}
+	markerColor  = color.RGBA{0, 255, 255, 255}
+)
+
+// Render draws the plot.
+func (p *Plot) Render() (*image.RGBA, error) {
+	l, err := p.layout()
+	if err != nil {
+		return nil, err
+	}
+	img := image.NewRGBA(image.Rect(0, 0, l.width, l.height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(background), image.Point{}, draw.Src)
+
+	for _, t := range l.freqTicks {
+		line(img, t.pos, l.top, t.pos, l.bottom, gridColor)
+		line(img, t.pos, l.bottom, t.pos, l.bottom+tickLength, foreground)
+		pixfont.Draw(img, t.pos-pixfont.TextWidth(t.label, 1)/2, l.bottom+tickLength+2, t.label, foreground, 1)
+	}
+	pixfont.Draw(img, l.right-pixfont.TextWidth("MHz", 1), l.bottom+tickLength+4+fontHeight, "MHz", foreground, 1)
+	for _, t := range l.levelTicks {
+		line(img, l.left, t.pos, l.right, t.pos, gridColor)
+		line(img, l.left-tickLength, t.pos, l.left, t.pos, foreground)
+		pixfont.Draw(img, l.left-tickLength-2-pixfont.TextWidth(t.label, 1), t.pos-pixfont.Height/2, t.label, foreground, 1)
+	}
+	pixfont.Draw(img, 2, 2, "dBm", foreground, 1)
+	line(img, l.left, l.top, l.left, l.bottom, foreground)
+	line(img, l.left, l.bottom, l.right, l.bottom, foreground)
+
+	if p.MaxHold != nil {
+		p.drawTrace(img, l, p.MaxHold, maxHoldColor)
+	}
+	p.drawTrace(img, l, p.Samples, traceColor)
+	for _, m := range p.Markers {
+		x := l.x(p, m.FreqHZ)
+		y := l.y(p.levelAt(m.FreqHZ))
+		for i := 0; i < 4; i++ {
+			line(img, x-i, y-2-i, x+i, y-2-i, markerColor)
+		}
+		pixfont.Draw(img, x-pixfont.TextWidth(m.Label, 1)/2, y-6-pixfont.Height-2, m.Label, markerColor, 1)
+	}
+	return img, nil
+}
+
+// WritePNG writes the plot as a PNG image.
+func (p *Plot) WritePNG(w io.Writer) error {
+	img, err := p.Render()
+	if err != nil {
+		return err
+	}
+	return png.Encode(w, img)
+}
+
+func (p *Plot) drawTrace(img *image.RGBA, l *layout, samples []float64, c color.RGBA) {
+	px, py := 0, 0
+	for i, s := range samples {
+		x, y := l.x(p, float64(p.Grid.FreqHZ(i))), l.y(s)
+		if i > 0 {
+			line(img, px, py, x, y, c)
+		}
+		px, py = x, y
+	}
+	if len(samples) == 1 {
+		img.SetRGBA(px, py, c)
+	}
+}
+
+// levelAt returns the level of the sample nearest to freqHZ.
+func (p *Plot) levelAt(freqHZ float64) float64 {
+	i := 0
+	if p.Grid.StepHZ > 0 {
+		i = int((freqHZ-float64(p.Grid.StartFreqHZ))/float64(p.Grid.StepHZ) + 0.5)
+	}
+	if i < 0 {
+		i = 0
+	} else if i >= len(p.Samples) {
+		i = len(p.Samples) - 1
+	}
+	return p.Samples[i]
+}
+
+// line draws a line from x0, y0 to x1, y1.
+func line(img *image.RGBA, x0, y0, x1, y1 int, c color.RGBA) {
+	dx, dy := abs(x1-x0), -abs(y1-y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+	e := dx + dy
+	for {
+		img.SetRGBA(x0, y0, c)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		if e2 := 2 * e; e2 >= dy {
+			e += dy
+			x0 += sx
+		} else {
+			e += dx
+			y0 += sy
+		}
+	}
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
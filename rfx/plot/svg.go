@@ -0,0 +1,71 @@
+package plot
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"image/color"
+	"io"
+	"strings"
+)
+
+// WriteSVG writes the plot as an SVG image.
+func (p *Plot) WriteSVG(w io.Writer) error {
+	l, err := p.layout()
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="monospace" font-size="%d">`+"\n",
+		l.width, l.height, l.width, l.height, fontHeight)
+	fmt.Fprintf(bw, `<rect width="%d" height="%d" fill="%s"/>`+"\n", l.width, l.height, rgb(background))
+	for _, t := range l.freqTicks {
+		svgLine(bw, t.pos, l.top, t.pos, l.bottom, gridColor)
+		svgLine(bw, t.pos, l.bottom, t.pos, l.bottom+tickLength, foreground)
+		svgText(bw, t.pos, l.bottom+tickLength+fontHeight, "middle", t.label, foreground)
+	}
+	svgText(bw, l.right, l.bottom+tickLength+2*fontHeight+2, "end", "MHz", foreground)
+	for _, t := range l.levelTicks {
+		svgLine(bw, l.left, t.pos, l.right, t.pos, gridColor)
+		svgLine(bw, l.left-tickLength, t.pos, l.left, t.pos, foreground)
+		svgText(bw, l.left-tickLength-2, t.pos+fontHeight/2-1, "end", t.label, foreground)
+	}
+	svgText(bw, 2, fontHeight, "start", "dBm", foreground)
+	svgLine(bw, l.left, l.top, l.left, l.bottom, foreground)
+	svgLine(bw, l.left, l.bottom, l.right, l.bottom, foreground)
+
+	if p.MaxHold != nil {
+		p.svgTrace(bw, l, p.MaxHold, maxHoldColor)
+	}
+	p.svgTrace(bw, l, p.Samples, traceColor)
+	for _, m := range p.Markers {
+		x := l.x(p, m.FreqHZ)
+		y := l.y(p.levelAt(m.FreqHZ))
+		fmt.Fprintf(bw, `<path d="M%d %dl-4 -4h8z" fill="%s"/>`+"\n", x, y-2, rgb(markerColor))
+		svgText(bw, x, y-8, "middle", m.Label, markerColor)
+	}
+	fmt.Fprintln(bw, "</svg>")
+	return bw.Flush()
+}
+
+func (p *Plot) svgTrace(w io.Writer, l *layout, samples []float64, c color.RGBA) {
+	points := make([]string, len(samples))
+	for i, s := range samples {
+		points[i] = fmt.Sprintf("%d,%d", l.x(p, float64(p.Grid.FreqHZ(i))), l.y(s))
+	}
+	fmt.Fprintf(w, `<polyline points="%s" fill="none" stroke="%s"/>`+"\n", strings.Join(points, " "), rgb(c))
+}
+
+func svgLine(w io.Writer, x0, y0, x1, y1 int, c color.RGBA) {
+	fmt.Fprintf(w, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="%s"/>`+"\n", x0, y0, x1, y1, rgb(c))
+}
+
+func svgText(w io.Writer, x, y int, anchor, s string, c color.RGBA) {
+	fmt.Fprintf(w, `<text x="%d" y="%d" text-anchor="%s" fill="%s">`, x, y, anchor, rgb(c))
+	xml.EscapeText(w, []byte(s))
+	fmt.Fprintln(w, "</text>")
+}
+
+func rgb(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
@@ -0,0 +1,122 @@
+package rfx
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// USB vendor and product ID of the Silicon Labs CP210x serial bridge used
+// by the RF Explorer.
+const (
+	cp210xVID = 0x10c4
+	cp210xPID = 0xea60
+)
+
+// PortInfo describes a serial port found by ListPorts.
+type PortInfo struct {
+	// Name is the device to open, e.g. /dev/ttyUSB0 or COM3.
+	Name string
+	// VID and PID are the USB vendor and product IDs of the serial
+	// bridge, 0 if they aren't known.
+	VID, PID uint16
+	// Product and Serial are the USB product description and serial
+	// number if known.
+	Product string
+	Serial  string
+}
+
+// IsRFExplorer returns true if the port is a CP210x bridge like the ones
+// in RF Explorers. Other devices use the same bridge so it may still be
+// something else.
+func (p PortInfo) IsRFExplorer() bool {
+	return p.VID == cp210xVID && p.PID == cp210xPID
+}
+
+func (p PortInfo) String() string {
+	s := p.Name
+	if p.VID != 0 {
+		s += fmt.Sprintf(" (%04x:%04x", p.VID, p.PID)
+		if p.Product != "" {
+			s += " " + p.Product
+		}
+		s += ")"
+	}
+	return s
+}
+
+// sysfsRoot is where ListPorts looks for serial ports on Linux.
+var sysfsRoot = "/sys"
+
+// linuxTTYPatterns match the names of the USB serial ports on Linux, for
+// ListPorts and CandidatePorts.
+var linuxTTYPatterns = []string{"ttyUSB*", "ttyACM*"}
+
+// ListPorts returns the serial ports that could be an RF Explorer. On Linux
+// they're found in sysfs along with their USB IDs. Elsewhere they're the
+// CandidatePorts without USB IDs, so VID and PID are 0 and IsRFExplorer
+// is false on Windows and macOS.
+func ListPorts() ([]PortInfo, error) {
+	if runtime.GOOS == "linux" {
+		return listSysfsPorts(sysfsRoot)
+	}
+	var ports []PortInfo
+	for _, name := range CandidatePorts() {
+		ports = append(ports, PortInfo{Name: name})
+	}
+	return ports, nil
+}
+
+// listSysfsPorts lists the USB serial ports in a sysfs tree.
+func listSysfsPorts(root string) ([]PortInfo, error) {
+	var ports []PortInfo
+	for _, pattern := range linuxTTYPatterns {
+		ttys, err := filepath.Glob(filepath.Join(root, "class", "tty", pattern))
+		if err != nil {
+			return nil, err
+		}
+		for _, tty := range ttys {
+			p := PortInfo{Name: "/dev/" + filepath.Base(tty)}
+			if dir, ok := usbDeviceDir(filepath.Join(tty, "device")); ok {
+				p.VID = readHexID(filepath.Join(dir, "idVendor"))
+				p.PID = readHexID(filepath.Join(dir, "idProduct"))
+				p.Product = readSysfs(filepath.Join(dir, "product"))
+				p.Serial = readSysfs(filepath.Join(dir, "serial"))
+			}
+			ports = append(ports, p)
+		}
+	}
+	return ports, nil
+}
+
+// usbDeviceDir returns the USB device directory above a tty's device, the
+// first one that has an idVendor.
+func usbDeviceDir(device string) (string, bool) {
+	dir, err := filepath.EvalSymlinks(device)
+	if err != nil {
+		return "", false
+	}
+	for i := 0; i < 4; i++ {
+		if _, err := os.Stat(filepath.Join(dir, "idVendor")); err == nil {
+			return dir, true
+		}
+		dir = filepath.Dir(dir)
+	}
+	return "", false
+}
+
+func readSysfs(path string) string {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+func readHexID(path string) uint16 {
+	id, _ := strconv.ParseUint(readSysfs(path), 16, 16)
+	return uint16(id)
+}
@@ -0,0 +1,109 @@
+package rfx
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// presetJSON is the JSON representation of a preset. Indexes count from 1
+// like on the device.
+type presetJSON struct {
+	Index          int    `json:"index"`
+	Name           string `json:"name"`
+	MinFreqKHz     int    `json:"min_freq_khz"`
+	MaxFreqKHz     int    `json:"max_freq_khz"`
+	AmpTopDBm      int    `json:"amp_top_dbm"`
+	AmpBottomDBm   int    `json:"amp_bottom_dbm"`
+	CalcMode       string `json:"calc_mode"`
+	CalcIterations int    `json:"calc_iterations"`
+	Mainboard      bool   `json:"mainboard"`
+	MarkerMode     string `json:"marker_mode"`
+}
+
+// ExportPresets writes presets as a JSON array with the modes by name.
+func ExportPresets(w io.Writer, presets []*Preset) error {
+	out := make([]presetJSON, len(presets))
+	for i, p := range presets {
+		out[i] = presetJSON{
+			Index:          p.Index + 1,
+			Name:           p.Name,
+			MinFreqKHz:     p.MinFreqKHz,
+			MaxFreqKHz:     p.MaxFreqKHz,
+			AmpTopDBm:      p.AmpTopDBm,
+			AmpBottomDBm:   p.AmpBottomDBm,
+			CalcMode:       p.CalcMode.String(),
+			CalcIterations: p.CalcIterations,
+			Mainboard:      p.Mainboard,
+			MarkerMode:     p.MarkerMode.String(),
+		}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(out)
+}
+
+// ImportPresets reads presets written by ExportPresets. The presets aren't
+// validated, see Preset.Validate.
+func ImportPresets(r io.Reader) ([]*Preset, error) {
+	var in []presetJSON
+	if err := json.NewDecoder(r).Decode(&in); err != nil {
+		return nil, fmt.Errorf("rfx: invalid preset JSON: %s", err)
+	}
+	presets := make([]*Preset, len(in))
+	for i, p := range in {
+		if p.Index < 1 {
+			return nil, fmt.Errorf("rfx: preset %d: index must be at least 1, got %d", i+1, p.Index)
+		}
+		calcMode, ok := parseCalculatorModeName(p.CalcMode)
+		if !ok {
+			return nil, fmt.Errorf("rfx: preset %d: unknown calc_mode %q", p.Index, p.CalcMode)
+		}
+		markerMode, ok := parseMarkerModeName(p.MarkerMode)
+		if !ok {
+			return nil, fmt.Errorf("rfx: preset %d: unknown marker_mode %q", p.Index, p.MarkerMode)
+		}
+		presets[i] = &Preset{
+			Index:          p.Index - 1,
+			Name:           p.Name,
+			MinFreqKHz:     p.MinFreqKHz,
+			MaxFreqKHz:     p.MaxFreqKHz,
+			AmpTopDBm:      p.AmpTopDBm,
+			AmpBottomDBm:   p.AmpBottomDBm,
+			CalcMode:       calcMode,
+			CalcIterations: p.CalcIterations,
+			Mainboard:      p.Mainboard,
+			MarkerMode:     markerMode,
+		}
+	}
+	return presets, nil
+}
+
+// parseCalculatorModeName parses the name of a calculator mode. An empty name
+// is the normal mode.
+func parseCalculatorModeName(s string) (CalculatorMode, bool) {
+	if s == "" {
+		return CalculatorModeNormal, true
+	}
+	for m := CalculatorModeNormal; m <= CalculatorModeMaxHold; m++ {
+		if strings.EqualFold(m.String(), s) {
+			return m, true
+		}
+	}
+	return CalculatorModeInvalid, false
+}
+
+// parseMarkerModeName parses the name of a marker mode. An empty name is the
+// peak marker.
+func parseMarkerModeName(s string) (MarkerMode, bool) {
+	if s == "" {
+		return MarkerModePeak, true
+	}
+	for m := MarkerModePeak; m <= MarkerModeManual; m++ {
+		if strings.EqualFold(m.String(), s) {
+			return m, true
+		}
+	}
+	return 0, false
+}
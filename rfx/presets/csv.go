@@ -0,0 +1,169 @@
+package presets
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/samuel/rfexplorer/rfx"
+)
+
+// csvColumns are the columns of a preset CSV file in the order they're
+// written. Only name, min_freq_khz, and max_freq_khz are required when
+// reading. Other columns default to the values used by the library.
+var csvColumns = []string{
+	"index",
+	"name",
+	"min_freq_khz",
+	"max_freq_khz",
+	"amp_top_dbm",
+	"amp_bottom_dbm",
+	"calc_mode",
+	"calc_iterations",
+	"mainboard",
+	"marker_mode",
+}
+
+var calcModes = []rfx.CalculatorMode{
+	rfx.CalculatorModeNormal,
+	rfx.CalculatorModeMax,
+	rfx.CalculatorModeAvg,
+	rfx.CalculatorModeOverwrite,
+	rfx.CalculatorModeMaxHold,
+}
+
+var markerModes = []rfx.MarkerMode{
+	rfx.MarkerModePeak,
+	rfx.MarkerModeNone,
+	rfx.MarkerModeManual,
+}
+
+// ReadCSV reads preset definitions from a CSV file with a header row naming
+// the columns (index, name, min_freq_khz, max_freq_khz, amp_top_dbm,
+// amp_bottom_dbm, calc_mode, calc_iterations, mainboard, marker_mode).
+// Presets without an index are numbered following the previous row, which
+// starts at slot 1. Indexes in the file count from 1 like on the device.
+func ReadCSV(r io.Reader) ([]*rfx.Preset, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("presets: failed to read header: %s", err)
+	}
+	cols := make(map[string]int, len(header))
+	for i, h := range header {
+		h = strings.ToLower(strings.TrimSpace(h))
+		known := false
+		for _, c := range csvColumns {
+			known = known || c == h
+		}
+		if !known {
+			return nil, fmt.Errorf("presets: unknown column %q", h)
+		}
+		cols[h] = i
+	}
+	for _, c := range []string{"name", "min_freq_khz", "max_freq_khz"} {
+		if _, ok := cols[c]; !ok {
+			return nil, fmt.Errorf("presets: missing required column %q", c)
+		}
+	}
+
+	var presets []*rfx.Preset
+	next := 0
+	for line := 2; ; line++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return presets, nil
+		} else if err != nil {
+			return nil, err
+		}
+		p := preset("", 0, 0)
+		p.Index = next
+		for name, i := range cols {
+			v := strings.TrimSpace(rec[i])
+			if v == "" && name != "name" {
+				continue
+			}
+			if err := setField(&p, name, v); err != nil {
+				return nil, fmt.Errorf("presets: line %d: %s", line, err)
+			}
+		}
+		next = p.Index + 1
+		presets = append(presets, &p)
+	}
+}
+
+func setField(p *rfx.Preset, name, v string) error {
+	var err error
+	switch name {
+	case "index":
+		var n int
+		n, err = strconv.Atoi(v)
+		if err == nil && n < 1 {
+			return fmt.Errorf("index must be at least 1, got %d", n)
+		}
+		p.Index = n - 1
+	case "name":
+		p.Name = v
+	case "min_freq_khz":
+		p.MinFreqKHz, err = strconv.Atoi(v)
+	case "max_freq_khz":
+		p.MaxFreqKHz, err = strconv.Atoi(v)
+	case "amp_top_dbm":
+		p.AmpTopDBm, err = strconv.Atoi(v)
+	case "amp_bottom_dbm":
+		p.AmpBottomDBm, err = strconv.Atoi(v)
+	case "calc_iterations":
+		p.CalcIterations, err = strconv.Atoi(v)
+	case "mainboard":
+		p.Mainboard, err = strconv.ParseBool(v)
+	case "calc_mode":
+		for _, m := range calcModes {
+			if strings.EqualFold(m.String(), v) {
+				p.CalcMode = m
+				return nil
+			}
+		}
+		return fmt.Errorf("unknown calc_mode %q", v)
+	case "marker_mode":
+		for _, m := range markerModes {
+			if strings.EqualFold(m.String(), v) {
+				p.MarkerMode = m
+				return nil
+			}
+		}
+		return fmt.Errorf("unknown marker_mode %q", v)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid %s %q", name, v)
+	}
+	return nil
+}
+
+// WriteCSV writes presets in the format read by ReadCSV.
+func WriteCSV(w io.Writer, presets []*rfx.Preset) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvColumns); err != nil {
+		return err
+	}
+	for _, p := range presets {
+		if err := cw.Write([]string{
+			strconv.Itoa(p.Index + 1),
+			p.Name,
+			strconv.Itoa(p.MinFreqKHz),
+			strconv.Itoa(p.MaxFreqKHz),
+			strconv.Itoa(p.AmpTopDBm),
+			strconv.Itoa(p.AmpBottomDBm),
+			p.CalcMode.String(),
+			strconv.Itoa(p.CalcIterations),
+			strconv.FormatBool(p.Mainboard),
+			p.MarkerMode.String(),
+		}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
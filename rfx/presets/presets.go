@@ -0,0 +1,79 @@
+// Package presets is a library of ready-made analyzer configurations for
+// common bands. The presets can be applied directly or written to the
+// device's stored presets.
+package presets
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/samuel/rfexplorer/rfx"
+)
+
+func preset(name string, minFreqKHz, maxFreqKHz int) rfx.Preset {
+	return rfx.Preset{
+		Name:           name,
+		MinFreqKHz:     minFreqKHz,
+		MaxFreqKHz:     maxFreqKHz,
+		AmpTopDBm:      0,
+		AmpBottomDBm:   -120,
+		CalcMode:       rfx.CalculatorModeNormal,
+		CalcIterations: 1,
+		Mainboard:      true,
+		MarkerMode:     rfx.MarkerModePeak,
+	}
+}
+
+// Library is the list of built-in presets. Names are at most 12 characters
+// so they fit in a device preset slot. Index is not set.
+var Library = []rfx.Preset{
+	preset("Airband", 118000, 137000),
+	preset("Wx Sat 137", 137000, 138000),
+	preset("ISM 433", 433050, 434790),
+	preset("ISM 868", 863000, 870000),
+	preset("ISM 915", 902000, 928000),
+	preset("GSM850 UL", 824000, 849000),
+	preset("GSM900 UL", 880000, 915000),
+	preset("GSM1800 UL", 1710000, 1785000),
+	preset("GSM1900 UL", 1850000, 1910000),
+	preset("LTE B12 UL", 699000, 716000),
+	preset("LTE B13 UL", 777000, 787000),
+	preset("LTE B20 UL", 832000, 862000),
+	preset("LTE B7 UL", 2500000, 2570000),
+	preset("2.4 GHz", 2400000, 2500000),
+	preset("VTX 5.8", 5645000, 5945000),
+}
+
+// normalize reduces a name to lower case letters and digits so that
+// "ISM 433", "ism433", and "ism-433" all match.
+func normalize(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(unicode.ToLower(r))
+		}
+	}
+	return b.String()
+}
+
+// Lookup returns a copy of the library preset with the given name. Case,
+// spaces, and punctuation are ignored when matching.
+func Lookup(name string) (*rfx.Preset, bool) {
+	n := normalize(name)
+	for _, p := range Library {
+		if normalize(p.Name) == n {
+			p := p
+			return &p, true
+		}
+	}
+	return nil, false
+}
+
+// Names returns the names of all library presets.
+func Names() []string {
+	names := make([]string, len(Library))
+	for i, p := range Library {
+		names[i] = p.Name
+	}
+	return names
+}
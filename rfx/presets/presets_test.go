@@ -0,0 +1,107 @@
+package presets
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/samuel/rfexplorer/rfx"
+)
+
+func TestLookup(t *testing.T) {
+	for _, name := range []string{"ISM 433", "ism433", "ISM-433"} {
+		p, ok := Lookup(name)
+		if !ok || p.MinFreqKHz != 433050 {
+			t.Errorf("Lookup(%q) = %+v, %t", name, p, ok)
+		}
+	}
+	if _, ok := Lookup("nonexistent"); ok {
+		t.Error("Lookup(nonexistent) should fail")
+	}
+	p, _ := Lookup("airband")
+	p.Name = "changed"
+	if Library[0].Name != "Airband" {
+		t.Error("Lookup should return a copy")
+	}
+}
+
+func TestLibraryNames(t *testing.T) {
+	seen := make(map[string]bool)
+	for _, p := range Library {
+		if len(p.Name) > 12 {
+			t.Errorf("preset name %q is longer than 12 characters", p.Name)
+		}
+		if n := normalize(p.Name); seen[n] {
+			t.Errorf("duplicate preset name %q", p.Name)
+		} else {
+			seen[n] = true
+		}
+		if p.MinFreqKHz >= p.MaxFreqKHz {
+			t.Errorf("preset %q has an empty range", p.Name)
+		}
+	}
+}
+
+func TestCSV(t *testing.T) {
+	in := `name,min_freq_khz,max_freq_khz,index,calc_mode,amp_bottom_dbm
+Tower 1,450000,451000,5,max,-100
+Tower 2,451000,452000,,,
+`
+	ps, err := ReadCSV(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ps) != 2 {
+		t.Fatalf("got %d presets, want 2", len(ps))
+	}
+	if p := ps[0]; p.Index != 4 || p.CalcMode != rfx.CalculatorModeMax || p.AmpBottomDBm != -100 || p.AmpTopDBm != 0 || !p.Mainboard {
+		t.Errorf("unexpected first preset %+v", *p)
+	}
+	if p := ps[1]; p.Index != 5 || p.Name != "Tower 2" || p.CalcMode != rfx.CalculatorModeNormal || p.AmpBottomDBm != -120 {
+		t.Errorf("unexpected second preset %+v", *p)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, ps); err != nil {
+		t.Fatal(err)
+	}
+	ps2, err := ReadCSV(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(ps, ps2); err != nil {
+		t.Error(err)
+	}
+	ps2[1].MaxFreqKHz++
+	if err := Verify(ps, ps2); err == nil {
+		t.Error("Verify should fail for a changed preset")
+	}
+
+	if _, err := ReadCSV(strings.NewReader("name,min_freq_khz\nx,1\n")); err == nil {
+		t.Error("ReadCSV should fail without max_freq_khz")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	a, _ := Lookup("ISM 433")
+	b, _ := Lookup("ISM 868")
+	c, _ := Lookup("ISM 915")
+	a.Index, b.Index, c.Index = 0, 1, 2
+	storedB := *b
+	storedB.AmpBottomDBm = -100
+	empty := &rfx.Preset{Index: 2}
+	other := &rfx.Preset{Index: 3, Name: "Other"}
+	changes := Diff([]*rfx.Preset{c, b, a}, []*rfx.Preset{a, &storedB, empty, other})
+	want := []ChangeKind{Unchanged, Updated, Added}
+	if len(changes) != len(want) {
+		t.Fatalf("got %d changes, want %d", len(changes), len(want))
+	}
+	for i, c := range changes {
+		if c.Preset.Index != i || c.Kind != want[i] {
+			t.Errorf("change %d = %s of slot %d, want %s of slot %d", i, c.Kind, c.Preset.Index, want[i], i)
+		}
+	}
+	if changes[1].Old != &storedB {
+		t.Error("updated change should reference the stored preset")
+	}
+}
@@ -0,0 +1,49 @@
+package presets
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/samuel/rfexplorer/rfx"
+)
+
+// Program writes presets to the device's stored presets and then reads the
+// stored presets back to verify that every one of them was written as
+// given. progress, if not nil, is called after each preset is written.
+func Program(ctx context.Context, rfe rfx.Explorer, presets []*rfx.Preset, progress func(p *rfx.Preset)) error {
+	if err := rfe.WritePresets(ctx, presets, progress); err != nil {
+		return err
+	}
+	rctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	stored, err := rfe.GetPresets(rctx)
+	if err != nil {
+		return fmt.Errorf("presets: failed to read back presets: %s", err)
+	}
+	return Verify(presets, stored)
+}
+
+// Verify checks that every preset in want is in stored at the same index
+// with the same settings.
+func Verify(want, stored []*rfx.Preset) error {
+	byIndex := make(map[int]*rfx.Preset, len(stored))
+	for _, p := range stored {
+		byIndex[p.Index] = p
+	}
+	var problems []string
+	for _, w := range want {
+		s, ok := byIndex[w.Index]
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("slot %d is missing", w.Index+1))
+		case *s != *w:
+			problems = append(problems, fmt.Sprintf("slot %d is %+v, want %+v", w.Index+1, *s, *w))
+		}
+	}
+	if len(problems) != 0 {
+		return fmt.Errorf("presets: verification failed: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package presets
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/samuel/rfexplorer/rfx"
+)
+
+// ChangeKind is what Sync does to a preset slot.
+type ChangeKind int
+
+const (
+	// Unchanged means the slot already holds the wanted preset.
+	Unchanged ChangeKind = iota
+	// Added means the slot was empty.
+	Added
+	// Updated means the slot held a different preset.
+	Updated
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case Unchanged:
+		return "unchanged"
+	case Added:
+		return "added"
+	case Updated:
+		return "updated"
+	}
+	return fmt.Sprintf("ChangeKind(%d)", int(k))
+}
+
+// Change is the difference between the wanted and stored preset of a slot.
+type Change struct {
+	Kind   ChangeKind
+	Preset *rfx.Preset
+	// Old is the stored preset that's replaced when Kind is Updated.
+	Old *rfx.Preset
+}
+
+// Diff compares the wanted presets to those stored on the device and
+// returns a change for every wanted preset in slot order. Stored presets
+// with an empty name are considered empty slots. Slots that aren't in want
+// are left alone.
+func Diff(want, stored []*rfx.Preset) []Change {
+	byIndex := make(map[int]*rfx.Preset, len(stored))
+	for _, p := range stored {
+		byIndex[p.Index] = p
+	}
+	changes := make([]Change, 0, len(want))
+	for _, w := range want {
+		c := Change{Kind: Unchanged, Preset: w}
+		switch s := byIndex[w.Index]; {
+		case s == nil || s.Name == "":
+			c.Kind = Added
+		case *s != *w:
+			c.Kind = Updated
+			c.Old = s
+		}
+		changes = append(changes, c)
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Preset.Index < changes[j].Preset.Index
+	})
+	return changes
+}
+
+// Sync brings the device's stored presets to the wanted state by writing
+// only the presets that differ, then verifies the result. It returns the
+// changes that were applied, including the unchanged presets, so they can
+// be reported. Running it again with the same presets makes no changes.
+func Sync(ctx context.Context, rfe rfx.Explorer, want []*rfx.Preset) ([]Change, error) {
+	rctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	stored, err := rfe.GetPresets(rctx)
+	cancel()
+	if err != nil {
+		return nil, fmt.Errorf("presets: failed to read presets: %s", err)
+	}
+	changes := Diff(want, stored)
+	var write []*rfx.Preset
+	for _, c := range changes {
+		if c.Kind != Unchanged {
+			write = append(write, c.Preset)
+		}
+	}
+	if len(write) == 0 {
+		return changes, nil
+	}
+	if err := Program(ctx, rfe, write, nil); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
@@ -0,0 +1,85 @@
+package rfx
+
+import (
+	"fmt"
+	"strings"
+)
+
+// HasDSP returns true if the model supports selecting the DSP mode.
+func (m Model) HasDSP() bool {
+	switch m {
+	case ModelWSUB3G, Model6G, Model4GPlus, Model6GPlus:
+		return true
+	}
+	return false
+}
+
+// Profile is a set of settings that trade sweep speed against resolution.
+type Profile struct {
+	Name        string
+	SweepPoints int
+	// DSP is only applied to models that support it.
+	DSP      DSPMode
+	CalcMode CalculatorMode
+}
+
+// Built in profiles.
+var (
+	// ProfileFastRefresh sweeps the fewest points with the fast DSP mode
+	// for the highest refresh rate.
+	ProfileFastRefresh = Profile{
+		Name:        "fast",
+		SweepPoints: 112,
+		DSP:         DSPModeFast,
+		CalcMode:    CalculatorModeNormal,
+	}
+	// ProfileHighResolution sweeps many points with filtering for image
+	// rejection which is slow but shows narrow signals accurately.
+	ProfileHighResolution = Profile{
+		Name:        "high-resolution",
+		SweepPoints: 4096,
+		DSP:         DSPModeFilter,
+		CalcMode:    CalculatorModeNormal,
+	}
+)
+
+// Profiles is the list of built in profiles.
+var Profiles = []Profile{ProfileFastRefresh, ProfileHighResolution}
+
+// LookupProfile returns the built in profile with the given name.
+func LookupProfile(name string) (Profile, bool) {
+	for _, p := range Profiles {
+		if strings.EqualFold(p.Name, name) {
+			return p, true
+		}
+	}
+	return Profile{}, false
+}
+
+// SetDSP sets the DSP mode. Not all models support it, see CapDSP.
+// The device confirms the change with a DSPModePacket, after which DSPMode
+// returns the new mode.
+func (r *RFExplorer) SetDSP(mode DSPMode) error {
+	if err := r.require(CapDSP); err != nil {
+		return err
+	}
+	if mode < DSPModeAuto || mode > DSPModeNoImage {
+		return fmt.Errorf("rfx: unknown DSP mode %d", int(mode))
+	}
+	return r.SendCommand("Cp" + string([]byte{byte('0' + mode)}))
+}
+
+// ApplyProfile sets the sweep points, calculator mode, and, if the active
+// module supports it, the DSP mode of a profile.
+func (r *RFExplorer) ApplyProfile(p Profile) error {
+	if err := r.SetSweepPointsEx(p.SweepPoints); err != nil {
+		return err
+	}
+	if err := r.SetCalculatorMode(p.CalcMode); err != nil {
+		return err
+	}
+	if r.Setup() != nil && r.Supports(CapDSP) {
+		return r.SetDSP(p.DSP)
+	}
+	return nil
+}
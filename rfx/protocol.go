@@ -12,13 +12,11 @@ import (
 	"image"
 	"image/color"
 	"io"
-	"log"
 	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
-
-	"github.com/jacobsa/go-serial/serial"
 )
 
 const MaxSpectrumSteps = 65535
@@ -26,18 +24,39 @@ const MaxSpectrumSteps = 65535
 type Model int
 
 const (
-	Model433M    Model = 0
-	Model868M    Model = 1
-	Model915M    Model = 2
-	ModelWSUB1G  Model = 3
-	Model24G     Model = 4
-	ModelWSUB3G  Model = 5
-	Model6G      Model = 6
-	ModelRFGen   Model = 60
-	ModelNone    Model = 255
-	ModelInvalid Model = -1
+	Model433M       Model = 0
+	Model868M       Model = 1
+	Model915M       Model = 2
+	ModelWSUB1G     Model = 3
+	Model24G        Model = 4
+	ModelWSUB3G     Model = 5
+	Model6G         Model = 6
+	ModelWSUB1GPlus Model = 10
+	ModelAudioPro   Model = 11
+	Model24GPlus    Model = 12
+	Model4GPlus     Model = 13
+	Model6GPlus     Model = 14
+	ModelRFGen      Model = 60
+	// ModelRFGenExpansion is the expansion module of an RFE6GEN Combo.
+	ModelRFGenExpansion Model = 61
+	ModelNone           Model = 255
+	ModelInvalid        Model = -1
 )
 
+// IsPlus returns true for the Plus models which have more memory, such as
+// 100 preset slots instead of 30.
+func (m Model) IsPlus() bool {
+	return m >= ModelWSUB1GPlus && m <= Model6GPlus
+}
+
+// PresetSlots returns the number of stored preset slots of the model.
+func (m Model) PresetSlots() int {
+	if m.IsPlus() {
+		return 100
+	}
+	return 30
+}
+
 type Mode int
 
 const (
@@ -102,12 +121,28 @@ type CurrentConfigPacket struct {
 	RBWKHZ          int
 	AmpOffset       int
 	CalculatorMode  CalculatorMode
+	// InputStage is the input stage last reported by the device. It's only
+	// reported by models with a switchable input stage such as the
+	// WSUB1G+, otherwise it's InputStageDirect.
+	InputStage InputStage
 }
 
 func (p *CurrentConfigPacket) Type() string {
 	return "CurrentConfig"
 }
 
+// Encode returns the configuration as the device sends it, a #C2-F line,
+// for emulators and playback that answer configuration requests.
+func (p *CurrentConfigPacket) Encode() []byte {
+	exp := 0
+	if p.ExpModuleActive {
+		exp = 1
+	}
+	return []byte(fmt.Sprintf("#C2-F:%07d,%07d,%04d,%04d,%04d,%d,%03d,%07d,%07d,%07d,%05d,%04d,%03d\r\n",
+		p.StartFreqKHZ, p.FreqStepHZ, p.AmpTopDBM, p.AmpBottomDBM, p.SweepSteps, exp, int(p.CurrentMode),
+		p.MinFreqKHZ, p.MaxFreqKHZ, p.MaxSpan, p.RBWKHZ, p.AmpOffset, int(p.CalculatorMode)))
+}
+
 type CurrentSetupPacket struct {
 	Model           Model
 	ExpansionModel  Model
@@ -127,8 +162,72 @@ func (p *CalibrationAvailabilityPacket) Type() string {
 	return "CalibrationAvailability"
 }
 
+// SweepDataPacket is a sweep of levels in dBm.
 type SweepDataPacket struct {
 	Samples []float64
+	// Config is the configuration the device last reported before the
+	// sweep, which describes its frequencies and amplitude range. It's
+	// nil if none was reported yet.
+	Config *CurrentConfigPacket
+	// Time is when the sweep was received, see Timestamped.
+	Time time.Time
+	// shared is set when the sweep was handed to more than one reader,
+	// which makes Release a no-op.
+	shared bool
+}
+
+// FreqHZ returns the frequency of sample i, or 0 without a Config.
+func (p *SweepDataPacket) FreqHZ(i int) int {
+	if p.Config == nil {
+		return 0
+	}
+	return p.Config.StartFreqKHZ*1000 + i*p.Config.FreqStepHZ
+}
+
+// FrequenciesHZ returns the frequency of every sample, or nil without a
+// Config.
+func (p *SweepDataPacket) FrequenciesHZ() []int {
+	if p.Config == nil {
+		return nil
+	}
+	freqs := make([]int, len(p.Samples))
+	for i := range freqs {
+		freqs[i] = p.FreqHZ(i)
+	}
+	return freqs
+}
+
+// Peak returns the frequency and level of the strongest sample. The
+// frequency is 0 without a Config.
+func (p *SweepDataPacket) Peak() (freqHZ int, levelDBM float64) {
+	if len(p.Samples) == 0 {
+		return 0, 0
+	}
+	peak := 0
+	for i, s := range p.Samples {
+		if s > p.Samples[peak] {
+			peak = i
+		}
+	}
+	return p.FreqHZ(peak), p.Samples[peak]
+}
+
+// sweepPool holds released sweeps. A sweep is reused for any sweep of up to
+// as many points, so after a change to fewer points the buffers stay large.
+var sweepPool sync.Pool
+
+// Release returns the sweep to a pool to be reused for a later sweep, which
+// avoids allocating the samples of every sweep at high sweep rates. The
+// sweep and its Samples must not be used after calling Release. A sweep
+// that was also delivered to a subscriber, such as an Analyzer, or
+// returned by a request is shared with its other readers and isn't
+// returned to the pool. Calling it is optional, sweeps that aren't
+// released are garbage collected as usual.
+func (p *SweepDataPacket) Release() {
+	if p.shared {
+		return
+	}
+	sweepPool.Put(p)
 }
 
 func (p *SweepDataPacket) Type() string {
@@ -143,6 +242,16 @@ func (p *SerialNumberPacket) Type() string {
 	return "SerialNumber"
 }
 
+// ExpansionSerialNumberPacket is the serial number of the expansion module
+// of a combo unit, sent as #Se<SerialNumber>.
+type ExpansionSerialNumberPacket struct {
+	SN string
+}
+
+func (p *ExpansionSerialNumberPacket) Type() string {
+	return "ExpansionSerialNumber"
+}
+
 // Preset represents a stored preset.
 type Preset struct {
 	// Index is the index of the preset starting at 0 (equivalent to 1 in the interface).
@@ -187,10 +296,40 @@ func (p *CurrentSnifferConfig) Type() string {
 	return "CurrentSnifferConfig"
 }
 
+// SampleRate returns the rate in samples per second that raw data is
+// captured at.
+func (p *CurrentSnifferConfig) SampleRate() int {
+	if p.Delay <= 0 {
+		return 0
+	}
+	return snifferClockHZ / p.Delay
+}
+
 // ScreenImage is a image of the LCD screen sent by the device. It implements
 // the image.Image interface.
 type ScreenImage struct {
 	Data []byte
+	// Time is when the image was received, see Timestamped.
+	Time time.Time
+}
+
+// screenImageSize is the size of the data in a screen dump.
+const screenImageSize = 0x400
+
+var screenImagePool = sync.Pool{
+	New: func() interface{} {
+		return &ScreenImage{Data: make([]byte, screenImageSize)}
+	},
+}
+
+// Release returns the image to a pool to be reused for a later screen dump,
+// which avoids an allocation per frame when streaming the screen. The image
+// must not be used after calling Release. Calling it is optional, images
+// that aren't released are garbage collected as usual.
+func (si *ScreenImage) Release() {
+	if len(si.Data) == screenImageSize {
+		screenImagePool.Put(si)
+	}
 }
 
 func (si *ScreenImage) Type() string {
@@ -225,6 +364,45 @@ func (si *ScreenImage) AtGray(x, y int) color.Gray {
 	return color.Gray{Y: 255 ^ (255 * ((si.Data[(y/8)*128+x] >> (uint(y) % 8)) & 1))}
 }
 
+// QualityPacket is sent by the device as #QA:<value> once on startup. The
+// meaning of the value isn't documented.
+type QualityPacket struct {
+	Value int
+}
+
+func (p *QualityPacket) Type() string {
+	return "Quality"
+}
+
+// StatusPacket is a status line of the form #<Code>:<Value> that isn't
+// otherwise understood. Unlike UnhandledPacket it's well formed, so it's
+// likely a status report of a newer firmware.
+type StatusPacket struct {
+	Code  string
+	Value string
+}
+
+func (p *StatusPacket) Type() string {
+	return "Status"
+}
+
+// parseStatus parses a printable #<Code>:<Value> line.
+func parseStatus(line []byte) (*StatusPacket, bool) {
+	if len(line) < 3 || line[0] != '#' {
+		return nil, false
+	}
+	for _, c := range line {
+		if c < 0x20 || c > 0x7e {
+			return nil, false
+		}
+	}
+	i := bytes.IndexByte(line, ':')
+	if i < 2 {
+		return nil, false
+	}
+	return &StatusPacket{Code: string(line[1:i]), Value: string(line[i+1:])}, true
+}
+
 // UnhandledPacket is the contents of an unhandled packet sent from RF Explorer.
 type UnhandledPacket struct {
 	Data []byte
@@ -237,6 +415,11 @@ func (p *UnhandledPacket) Type() string {
 // RawData is a packet of raw bytes sent from RF explorer as used by the sniffer.
 type RawData struct {
 	Data []byte
+	// Config is the sniffer configuration the data was captured with, or
+	// nil if the device hasn't reported one.
+	Config *CurrentSnifferConfig
+	// Time is when the data was received, see Timestamped.
+	Time time.Time
 }
 
 func (p *RawData) Type() string {
@@ -267,8 +450,20 @@ func (m Model) String() string {
 		return "WSUB3G"
 	case Model6G:
 		return "6G"
+	case ModelWSUB1GPlus:
+		return "WSUB1G+"
+	case ModelAudioPro:
+		return "AudioPro"
+	case Model24GPlus:
+		return "2.4G+"
+	case Model4GPlus:
+		return "4G+"
+	case Model6GPlus:
+		return "6G+"
 	case ModelRFGen:
 		return "RFE6GEN"
+	case ModelRFGenExpansion:
+		return "RFE6GEN Expansion"
 	case ModelNone:
 		return ""
 	case ModelInvalid:
@@ -335,13 +530,115 @@ func (m MarkerMode) String() string {
 	return fmt.Sprintf("MarkerMode(%d)", int(m))
 }
 
-// class eDSP(Enum):
-//     """All possible DSP values
-// 	"""
-//     DSP_AUTO = 0
-//     DSP_FILTER = 1
-//     DSP_FAST = 2
-//     DSP_NO_IMG = 3
+// InputStage is the active input stage of models with a switchable
+// attenuator and LNA such as the WSUB1G+ and IoT modules.
+type InputStage int
+
+const (
+	InputStageDirect      InputStage = 0
+	InputStageAttenuator  InputStage = 1
+	InputStageLNA         InputStage = 2
+	InputStageAttenuator2 InputStage = 3
+	InputStageLNA2        InputStage = 4
+)
+
+func (s InputStage) String() string {
+	switch s {
+	case InputStageDirect:
+		return "Direct"
+	case InputStageAttenuator:
+		return "Attenuator 30dB"
+	case InputStageLNA:
+		return "LNA 25dB"
+	case InputStageAttenuator2:
+		return "Attenuator 60dB"
+	case InputStageLNA2:
+		return "LNA 12dB"
+	}
+	return fmt.Sprintf("InputStage(%d)", int(s))
+}
+
+// GainDB returns the nominal gain of the input stage. The device already
+// compensates the levels it reports but the stage changes the noise floor
+// and the strongest signal that can be measured by this much.
+func (s InputStage) GainDB() int {
+	switch s {
+	case InputStageAttenuator:
+		return -30
+	case InputStageLNA:
+		return 25
+	case InputStageAttenuator2:
+		return -60
+	case InputStageLNA2:
+		return 12
+	}
+	return 0
+}
+
+// InputStagePacket is the input stage reported by the device as #a<stage>.
+type InputStagePacket struct {
+	Stage InputStage
+}
+
+func (p *InputStagePacket) Type() string {
+	return "InputStage"
+}
+
+// TrackingStatusPacket is reported by the device as #K1 when a tracking
+// sweep starts and #K0 when it stops.
+type TrackingStatusPacket struct {
+	Tracking bool
+}
+
+func (p *TrackingStatusPacket) Type() string {
+	return "TrackingStatus"
+}
+
+// DSPMode is the signal processing mode of the analyzer.
+type DSPMode int
+
+const (
+	DSPModeAuto    DSPMode = 0
+	DSPModeFilter  DSPMode = 1
+	DSPModeFast    DSPMode = 2
+	DSPModeNoImage DSPMode = 3
+)
+
+func (m DSPMode) String() string {
+	switch m {
+	case DSPModeAuto:
+		return "Auto"
+	case DSPModeFilter:
+		return "Filter"
+	case DSPModeFast:
+		return "Fast"
+	case DSPModeNoImage:
+		return "NoImage"
+	}
+	return fmt.Sprintf("DSPMode(%d)", int(m))
+}
+
+// DSPModePacket is the DSP mode reported by the device as DSP:<mode>, or as
+// #C2-d:<mode> when it confirms a SetDSP.
+type DSPModePacket struct {
+	Mode DSPMode
+}
+
+func (p *DSPModePacket) Type() string {
+	return "DSPMode"
+}
+
+// parseDSP parses a DSP mode report, with or without a leading '#', or a
+// #C2-d confirmation.
+func parseDSP(line []byte) (*DSPModePacket, bool) {
+	line = bytes.TrimPrefix(line, []byte{'#'})
+	for _, prefix := range []string{"DSP:", "C2-d:"} {
+		if bytes.HasPrefix(line, []byte(prefix)) && len(line) > len(prefix) {
+			return &DSPModePacket{Mode: DSPMode(parseASCIIDecimal(string(line[len(prefix):])))}, true
+		}
+	}
+	return nil, false
+}
 
 // BaudRate is the serial communications baud rate configured on the RF Explorer.
 type BaudRate int
@@ -374,6 +671,25 @@ func parseModel(m string) Model {
 	return Model(i)
 }
 
+// parseSetup parses the fields of a #C2-M or #C3-M setup line following
+// the colon.
+func parseSetup(s string) *CurrentSetupPacket {
+	p := strings.Split(s, ",")
+	setup := &CurrentSetupPacket{
+		// <Main_Model> - Codified values are 433M:0, 868M:1, 915M:2, WSUB1G:3, 2.4G:4, WSUB3G:5, 6G:6, RFGEN:60
+		Model:          parseModel(p[0]),
+		ExpansionModel: ModelNone,
+	}
+	// <Expansion_Model> - Codified values are 433M:0, 868M:1, 915M:2, WSUB1G:3, 2.4G:4, WSUB3G:5, 6G:6, NONE:255
+	if len(p) >= 2 {
+		setup.ExpansionModel = parseModel(p[1])
+	}
+	if len(p) >= 3 {
+		setup.FirmwareVersion = strings.TrimLeft(p[2], "0")
+	}
+	return setup
+}
+
 func parseMode(m string) Mode {
 	if m == "" {
 		return ModeInvalid
@@ -408,90 +724,314 @@ type Packet interface {
 	Type() string
 }
 
+// Timestamped is implemented by the packets that stream measurements:
+// sweeps, sniffer data, and screen images. ReceivedAt is when the read
+// that completed the packet returned. It has a monotonic clock reading, so
+// the time between packets is accurate even if the wall clock is changed.
+type Timestamped interface {
+	Packet
+	ReceivedAt() time.Time
+}
+
+func (p *SweepDataPacket) ReceivedAt() time.Time {
+	return p.Time
+}
+
+func (p *RawData) ReceivedAt() time.Time {
+	return p.Time
+}
+
+func (si *ScreenImage) ReceivedAt() time.Time {
+	return si.Time
+}
+
+// stamp records when a packet was received.
+func stamp(pkt Packet, t time.Time) {
+	switch pkt := pkt.(type) {
+	case *SweepDataPacket:
+		pkt.Time = t
+	case *RawData:
+		pkt.Time = t
+	case *ScreenImage:
+		pkt.Time = t
+	}
+}
+
+// RFExplorer is a connection to an RF Explorer. Its methods are safe for
+// concurrent use: commands from any number of goroutines are queued and
+// written to the device whole and in order, and packets are read by a
+// single reader that delivers them to Chan and to the requests waiting for
+// them.
 type RFExplorer struct {
-	port          io.ReadWriteCloser
-	writeBuf      []byte
+	portMu        sync.Mutex
+	port          Transport
+	reopen        func() (Transport, error)
+	backoff       time.Duration
+	lastConfig    atomic.Value // string, the last C2-F command
 	closeCh       chan struct{}
+	closeOnce     sync.Once
+	readDone      chan struct{} // closed when readLoop exits
 	readCh        chan Packet
+	errCh         chan error
+	errMu         sync.Mutex
+	err           error
 	config        atomic.Value // *CurrentConfigPacket
-	endOfPresetCh chan struct{}
+	snifferConfig atomic.Value // *CurrentSnifferConfig
+	setup         atomic.Value // *CurrentSetupPacket
+	mode          atomic.Value // Mode
+	serialNumber  atomic.Value // string
+	calibration   atomic.Value // *CalibrationAvailabilityPacket
+	calData       atomic.Value // *CalibrationDataPacket
+	ampCorr       atomic.Value // **AmplitudeCorrection
+	dspMode       atomic.Value // DSPMode
+	inputStage    atomic.Value // InputStage
+	genPowerSet   atomic.Value // GenPower
+	genExpDBM     atomic.Value // float64
+	genExpActive  atomic.Value // bool
+	genCWKHZ      atomic.Value // int
+	backpressure  atomic.Value // Backpressure
+	sweepRate     rateMeter
+	link          linkMeter
+	queue         commandQueue
+	trace         tracer
+	captureMu     sync.Mutex
+	captureW      io.Writer
+	waiters       waiters
+	subs          subscriptions
+}
+
+// New initiates a connection to the RF Explorer over the provided device
+// and waits for it to report its configuration. It connects at 500,000
+// baud unless configured otherwise by the options.
+func New(device string, opts ...Option) (*RFExplorer, error) {
+	o := options{baudRate: BaudRate500000}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.autoBaud {
+		timeout := o.timeout
+		if timeout == 0 {
+			timeout = defaultAutoBaudTimeout
+		}
+		br, err := detectBaudRate(device, timeout)
+		if err != nil {
+			return nil, err
+		}
+		if br != BaudRate500000 && o.upgrade {
+			slow := o
+			slow.baudRate, slow.timeout = br, timeout
+			rf, err := connect(device, &slow)
+			if err != nil {
+				return nil, err
+			}
+			err = rf.SetBaudRate(BaudRate500000)
+			rf.Close()
+			if err != nil {
+				return nil, err
+			}
+			br = BaudRate500000
+		}
+		o.baudRate, o.timeout = br, timeout
+	}
+	rf, err := connect(device, &o)
+	if err != nil {
+		return nil, err
+	}
+	if o.reconnect > 0 {
+		rf.setReconnect(func() (Transport, error) {
+			return OpenSerial(device, o.baudRate)
+		}, o.reconnect)
+	}
+	return rf, nil
 }
 
-// New initiates a connection to the RF Explorer over the provided device.
-// TODO: currently a baud rate of 500,000 is assumed.
-func New(device string) (*RFExplorer, error) {
-	options := serial.OpenOptions{
-		PortName:        device,
-		BaudRate:        500000,
-		DataBits:        8,
-		ParityMode:      serial.PARITY_NONE,
-		StopBits:        1,
-		MinimumReadSize: 1,
+// connect opens device at the baud rate of the options and waits for the
+// config.
+func connect(device string, o *options) (*RFExplorer, error) {
+	port, err := OpenSerial(device, o.baudRate)
+	if err != nil {
+		return nil, err
 	}
-
-	// Open the port.
-	port, err := serial.Open(options)
+	return start(port, device, o)
+}
+
+// NewWithTransport initiates a connection to an RF Explorer over any
+// transport, such as a network connection or a test double, and waits for
+// it to report its configuration. Options that only apply to serial ports
+// are ignored, and WithAutoReconnect needs WithRedial to reopen the
+// transport.
+func NewWithTransport(t Transport, opts ...Option) (*RFExplorer, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	rf, err := start(t, "transport", &o)
 	if err != nil {
 		return nil, err
 	}
-
-	rf := &RFExplorer{
-		port:          port,
-		writeBuf:      make([]byte, 256),
-		closeCh:       make(chan struct{}),
-		readCh:        make(chan Packet, 16),
-		endOfPresetCh: make(chan struct{}, 1),
+	if o.reconnect > 0 && o.redial != nil {
+		rf.setReconnect(o.redial, o.reconnect)
 	}
-	go rf.readLoop()
+	return rf, nil
+}
+
+// start starts talking to the device connected to port and waits for the
+// config. A zero timeout waits indefinitely. name identifies the device in
+// errors.
+func start(port Transport, name string, o *options) (*RFExplorer, error) {
+	rf := newRFExplorer(port)
+	rf.backpressure.Store(o.backpressure)
+	rf.trace.set(o.logger, o.trace)
+	timeout := o.timeout
 
 	// Get the initial config
 	// TODO: this fails depending on mode
 	if err := rf.RequestConfig(); err != nil {
+		rf.Close()
 		return nil, err
 	}
+	var timeoutCh <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		timeoutCh = timer.C
+	}
 setupLoop:
 	for {
-		pkt, ok := <-rf.Chan()
-		if !ok {
+		select {
+		case pkt, ok := <-rf.Chan():
+			if !ok {
+				rf.Close()
+				return nil, fmt.Errorf("rfx: failed to get current config")
+			}
+			// The reader keeps track of the config.
+			if _, ok := pkt.(*CurrentConfigPacket); ok {
+				break setupLoop
+			}
+		case <-timeoutCh:
 			rf.Close()
-			return nil, fmt.Errorf("rfx: failed to get current config")
-		}
-		switch pkt := pkt.(type) {
-		case *CurrentConfigPacket:
-			rf.config.Store(pkt)
-			break setupLoop
+			return nil, fmt.Errorf("rfx: no config received from %s within %s", name, timeout)
 		}
 	}
 	return rf, nil
 }
 
-// Close close the communucation device.
+// detectBaudRate returns the first of autoBaudRates at which the device
+// responds to a config request with a config.
+func detectBaudRate(device string, timeout time.Duration) (BaudRate, error) {
+	br, _, err := probe(device, timeout, "#C2-F:")
+	return br, err
+}
+
+// probe returns the first of autoBaudRates at which the device responds to
+// a config request with a line containing one of prefixes, and the rest of
+// the line. It waits up to timeout at each rate.
+func probe(device string, timeout time.Duration, prefixes ...string) (BaudRate, string, error) {
+	for _, br := range autoBaudRates {
+		port, err := OpenSerial(device, br)
+		if err != nil {
+			return 0, "", err
+		}
+		line, err := requestLine(port, timeout, prefixes...)
+		port.Close()
+		if err == nil {
+			return br, line, nil
+		}
+	}
+	return 0, "", fmt.Errorf("rfx: no response from %s at any baud rate", device)
+}
+
+// open opens a connection to device at a baud rate without waiting for a
+// config, which only analyzers send.
+func open(device string, br BaudRate) (*RFExplorer, error) {
+	port, err := OpenSerial(device, br)
+	if err != nil {
+		return nil, err
+	}
+	return newRFExplorer(port), nil
+}
+
+// newRFExplorer starts reading packets from port.
+func newRFExplorer(port Transport) *RFExplorer {
+	rf := &RFExplorer{
+		port:     port,
+		closeCh:  make(chan struct{}),
+		readDone: make(chan struct{}),
+		readCh:   make(chan Packet, 16),
+		errCh:    make(chan error, 1),
+	}
+	rf.queue.wake = make(chan struct{}, 1)
+	go rf.readLoop()
+	go rf.writeLoop()
+	return rf
+}
+
+// Close closes the communication device. It waits for the reader to stop,
+// after which the channel returned by Chan is closed. It's safe to call
+// more than once.
 func (r *RFExplorer) Close() error {
-	close(r.closeCh)
-	close(r.readCh)
-	return r.port.Close()
+	err := errClosed
+	r.closeOnce.Do(func() {
+		close(r.closeCh)
+		err = r.getPort().Close()
+		<-r.readDone
+	})
+	return err
 }
 
+// errClosed is returned when the connection has been closed.
+var errClosed = fmt.Errorf("rfx: connection closed")
+
+// Chan returns the channel packets from the device are sent to. It's closed
+// when the connection is closed or lost.
 func (r *RFExplorer) Chan() chan Packet {
 	return r.readCh
 }
 
+// Errors returns a channel that receives the error if the connection to
+// the device is lost, for instance because it was unplugged. The
+// connection can't be used after that and should be closed. Connections
+// opened WithAutoReconnect reconnect instead.
+func (r *RFExplorer) Errors() <-chan error {
+	return r.errCh
+}
+
+// Err returns the error that the connection was lost with, or nil if it
+// hasn't been lost.
+func (r *RFExplorer) Err() error {
+	r.errMu.Lock()
+	defer r.errMu.Unlock()
+	return r.err
+}
+
+// lost records that the connection was lost with err.
+func (r *RFExplorer) lost(err error) {
+	err = fmt.Errorf("rfx: connection lost: %s", err)
+	r.trace.log().Error("connection lost", "err", err)
+	r.errMu.Lock()
+	r.err = err
+	r.errMu.Unlock()
+	select {
+	case r.errCh <- err:
+	default:
+	}
+}
+
+// Config returns the configuration last reported by the device, updated
+// with any calculator mode set since, or nil before the device has reported
+// one.
 func (r *RFExplorer) Config() *CurrentConfigPacket {
-	return r.config.Load().(*CurrentConfigPacket)
+	config, _ := r.config.Load().(*CurrentConfigPacket)
+	return config
 }
 
 // SetLCDEnabled requests RF Explorer to turn the LCD on or off.
 func (r *RFExplorer) SetLCDEnabled(enabled bool) error {
-	// #<Size>C(0|1)
-	r.writeBuf[0] = '#'
-	r.writeBuf[1] = 4
-	r.writeBuf[2] = 'L'
+	// #<Size>L(0|1)
 	if enabled {
-		r.writeBuf[3] = '1'
-	} else {
-		r.writeBuf[3] = '0'
+		return r.SendCommand("L1")
 	}
-	return r.write(r.writeBuf[:4])
+	return r.SendCommand("L0")
 }
 
 // SetScreenDumpEnabled requests RF Explorer to dump all screen data
@@ -502,10 +1042,51 @@ func (r *RFExplorer) SetScreenDumpEnabled(enabled bool) error {
 	return r.SendCommand("D0")
 }
 
+// SetTrackingStep moves a tracking sweep to step n, which is sent as a
+// 16-bit big endian number.
 func (r *RFExplorer) SetTrackingStep(n int) error {
-	// return r.SendCommand("k" + )
-	// this.SendCommand("k" + (object) Convert.ToChar(Convert.ToByte((int) nStep >> 8)) + (object) Convert.ToChar(Convert.ToByte((int) nStep & (int) byte.MaxValue)));
-	return nil // TODO
+	cmd, err := trackingStepCommand(n)
+	if err != nil {
+		return err
+	}
+	return r.SendCommand(cmd)
+}
+
+func trackingStepCommand(n int) (string, error) {
+	// #<Size>k<StepHigh><StepLow>
+	if n < 0 || n > 0xffff {
+		return "", fmt.Errorf("rfx: tracking step must be between 0 and 65535, got %d", n)
+	}
+	return "k" + string([]byte{byte(n >> 8), byte(n)}), nil
+}
+
+// StartTrackingSweep puts the analyzer in tracking mode, following a
+// generator that sweeps from startFreqKHZ in steps of stepFreqKHZ. The
+// device reports a TrackingStatusPacket once tracking starts and each step
+// is then measured after SetTrackingStep.
+func (r *RFExplorer) StartTrackingSweep(startFreqKHZ, stepFreqKHZ int) error {
+	cmd, err := trackingSweepCommand(startFreqKHZ, stepFreqKHZ)
+	if err != nil {
+		return err
+	}
+	return r.SendCommand(cmd)
+}
+
+func trackingSweepCommand(startFreqKHZ, stepFreqKHZ int) (string, error) {
+	// #<Size>C3-K:<Start_Freq_KHZ>,<Step_Freq_KHZ>
+	if startFreqKHZ < 0 || startFreqKHZ > 9999999 {
+		return "", fmt.Errorf("rfx: tracking start frequency %d KHz out of range", startFreqKHZ)
+	}
+	if stepFreqKHZ <= 0 || stepFreqKHZ > 9999999 {
+		return "", fmt.Errorf("rfx: tracking step %d KHz out of range", stepFreqKHZ)
+	}
+	return fmt.Sprintf("C3-K:%07d,%07d", startFreqKHZ, stepFreqKHZ), nil
+}
+
+// StopTracking ends a tracking sweep by returning the analyzer to the
+// spectrum analyzer mode, which it confirms by reporting its configuration.
+func (r *RFExplorer) StopTracking() error {
+	return r.RequestConfig()
 }
 
 func (r *RFExplorer) ResetInternalBuffers() error {
@@ -517,6 +1098,64 @@ func (r *RFExplorer) RequestSerialNumber() error {
 	return r.SendCommand("Cn")
 }
 
+// RequestExpansionSerialNumber requests the serial number of the expansion
+// module from the RF Explorer.
+func (r *RFExplorer) RequestExpansionSerialNumber() error {
+	return r.SendCommand("Ce")
+}
+
+// SerialNumber returns the serial number of the RF Explorer, requesting it
+// and waiting for the response the first time.
+func (r *RFExplorer) SerialNumber(ctx context.Context) (string, error) {
+	if sn, ok := r.serialNumber.Load().(string); ok {
+		return sn, nil
+	}
+	return r.GetSerialNumber(ctx)
+}
+
+// DSPMode returns the DSP mode last reported by the device and false if it
+// hasn't reported one, so callers can confirm which mode is active rather
+// than assuming a command took effect.
+func (r *RFExplorer) DSPMode() (DSPMode, bool) {
+	m, ok := r.dspMode.Load().(DSPMode)
+	return m, ok
+}
+
+// CalibrationAvailability returns which modules have internal calibration
+// data. The device reports it along with its configuration so if it hasn't
+// been received yet the configuration is requested.
+func (r *RFExplorer) CalibrationAvailability(ctx context.Context) (*CalibrationAvailabilityPacket, error) {
+	if cal, ok := r.calibration.Load().(*CalibrationAvailabilityPacket); ok {
+		return cal, nil
+	}
+	return r.GetCalibrationAvailability(ctx)
+}
+
+// CalibrationWarning returns a warning if the active module has no
+// internal calibration, in which case measured levels may be off by
+// several dB, or an empty string if it's calibrated. The configuration is
+// requested if the device hasn't reported it yet.
+func (r *RFExplorer) CalibrationWarning(ctx context.Context) (string, error) {
+	cal, err := r.CalibrationAvailability(ctx)
+	if err != nil {
+		return "", err
+	}
+	config := r.Config()
+	if config == nil {
+		if config, err = r.GetConfig(ctx); err != nil {
+			return "", err
+		}
+	}
+	if config.ExpModuleActive {
+		if !cal.ExpansionBoardInternalCalibrationAvailable {
+			return "the expansion module has no internal calibration, measured levels may be inaccurate", nil
+		}
+	} else if !cal.MainboardInternalCalibrationAvailable {
+		return "the mainboard module has no internal calibration, measured levels may be inaccurate", nil
+	}
+	return "", nil
+}
+
 // RequestConfig requests RF Explorer to send the current configuration.
 func (r *RFExplorer) RequestConfig() error {
 	return r.SendCommand("C0")
@@ -527,8 +1166,37 @@ func (r *RFExplorer) RequestPresets() error {
 	return r.SendCommand("CP\x00")
 }
 
-// UpdatePreset updates a stored preset.
+// Setup returns the model setup reported by the device or nil if it hasn't
+// reported one yet.
+func (r *RFExplorer) Setup() *CurrentSetupPacket {
+	setup, _ := r.setup.Load().(*CurrentSetupPacket)
+	return setup
+}
+
+// presetSlots returns the number of preset slots of the device. If the
+// model isn't known yet the number for Plus models is assumed so that valid
+// presets aren't rejected.
+func (r *RFExplorer) presetSlots() int {
+	if setup := r.Setup(); setup != nil {
+		return setup.Model.PresetSlots()
+	}
+	return ModelWSUB1GPlus.PresetSlots()
+}
+
+// UpdatePreset updates a stored preset. The preset is validated for the
+// device first, including the frequency range of the module it selects
+// once the setup is known, and a ValidationErrors is returned if it's
+// invalid. See Preset.Sanitize for fixing names and amplitudes.
 func (r *RFExplorer) UpdatePreset(ctx context.Context, p *Preset) error {
+	if err := r.validatePreset(p); err != nil {
+		return err
+	}
+	return r.writePreset(ctx, p)
+}
+
+// writePreset stores a preset without validating it and waits for the
+// device to confirm.
+func (r *RFExplorer) writePreset(ctx context.Context, p *Preset) error {
 	// "#$CP" \x01 index:byte name:byte*12 \x00 \x00 minfreqkhz:uint32 maxfeqkhz:uint32 calcmode:byte amptop:int8 ampbottom:int8 calciter:byte mainboard:bool markermode:byte \x42 \x00
 	buf := make([]byte, 36)
 	buf[0] = '#'
@@ -537,13 +1205,8 @@ func (r *RFExplorer) UpdatePreset(ctx context.Context, p *Preset) error {
 	buf[3] = 'P'
 	buf[4] = 0x01
 
-	// TODO: filter invalid characters from name
-	// TODO: validate / clamp all parameters
 	buf[5] = byte(p.Index)
 	name := p.Name
-	if len(name) > 12 {
-		name = name[:12]
-	}
 	copy(buf[6:], name)
 	buf[6+len(name)] = 0
 	buf[18] = 0
@@ -562,32 +1225,114 @@ func (r *RFExplorer) UpdatePreset(ctx context.Context, p *Preset) error {
 	buf[33] = byte(p.MarkerMode)
 	buf[34] = 0x42
 	buf[35] = 0
-	// Clear end of preset channel so we can know if we receive one.
-	select {
-	case <-r.endOfPresetCh:
-	default:
-	}
-	if err := r.write(buf[:36]); err != nil {
+	// The device confirms with an end of presets marker, which is waited
+	// for without going through Chan so it's seen even if nobody reads it.
+	w := newWaiter(isEndOfPresets)
+	defer r.waiters.remove(w)
+	if err := r.write(buf[:36], w); err != nil {
 		return err
-
 	}
-	// Way for end of presets
 	select {
-	case <-r.endOfPresetCh:
+	case <-w.ch:
+	case <-r.readDone:
+		if err := r.Err(); err != nil {
+			return err
+		}
+		return errClosed
 	case <-ctx.Done():
 		return ctx.Err()
 	}
 	return nil
 }
 
-// RequestInternalCalibrationData requests RF Explorer to send the currnet configuration.
+func isEndOfPresets(p Packet) bool {
+	_, ok := p.(*EndOfPresetsPacket)
+	return ok
+}
+
+// emptyPreset returns the preset written to a slot to clear it.
+func emptyPreset(index int) *Preset {
+	return &Preset{
+		Index:          index,
+		AmpTopDBm:      0,
+		AmpBottomDBm:   -120,
+		CalcMode:       CalculatorModeNormal,
+		CalcIterations: 1,
+		Mainboard:      true,
+		MarkerMode:     MarkerModePeak,
+	}
+}
+
+// presetWriteTimeout is how long WritePresets waits for the device to
+// confirm each preset.
+const presetWriteTimeout = 5 * time.Second
+
+// DeletePreset clears a stored preset by writing an empty preset with
+// default settings to its slot.
+func (r *RFExplorer) DeletePreset(ctx context.Context, index int) error {
+	if slots := r.presetSlots(); index < 0 || index >= slots {
+		return fmt.Errorf("rfx: preset index %d out of range 0-%d", index, slots-1)
+	}
+	return r.writePreset(ctx, emptyPreset(index))
+}
+
+// WritePresets stores presets one after the other. Every preset is
+// validated before any is written so that an invalid one doesn't leave the
+// device half provisioned. progress, if not nil, is called after each
+// preset is written.
+func (r *RFExplorer) WritePresets(ctx context.Context, presets []*Preset, progress func(p *Preset)) error {
+	for _, p := range presets {
+		if err := r.validatePreset(p); err != nil {
+			return fmt.Errorf("rfx: preset %d: %s", p.Index+1, err)
+		}
+	}
+	for _, p := range presets {
+		wctx, cancel := context.WithTimeout(ctx, presetWriteTimeout)
+		err := r.UpdatePreset(wctx, p)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("rfx: failed to write %q to slot %d: %s", p.Name, p.Index+1, err)
+		}
+		if progress != nil {
+			progress(p)
+		}
+	}
+	return nil
+}
+
+// ClearPresets clears every stored preset that has a name, see
+// DeletePreset. It returns the number of slots cleared.
+func (r *RFExplorer) ClearPresets(ctx context.Context) (int, error) {
+	presets, err := r.GetPresets(ctx)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, p := range presets {
+		if p.Name == "" {
+			continue
+		}
+		if err := r.DeletePreset(ctx, p.Index); err != nil {
+			return n, fmt.Errorf("rfx: failed to clear preset %d: %s", p.Index+1, err)
+		}
+		n++
+	}
+	return n, nil
+}
+
+// RequestInternalCalibrationData requests RF Explorer to send the internal
+// calibration data of the active module, see GetCalibrationData.
 func (r *RFExplorer) RequestInternalCalibrationData() error {
 	return r.SendCommand("Cq")
 }
 
 // SwitchModuleMain request RF Explorer to enable Mainboard module.
 func (r *RFExplorer) SwitchModuleMain() error {
-	return r.SendCommand("CM\x00")
+	if err := r.SendCommand("CM\x00"); err != nil {
+		return err
+	}
+	r.genExpActive.Store(false)
+	return nil
 }
 
 // Hold stops receiving samples. Use RequestConfig to resume receving samples.
@@ -597,7 +1342,11 @@ func (r *RFExplorer) Hold() error {
 
 // SwitchModuleExp request RF Explorer to enable Expansion module.
 func (r *RFExplorer) SwitchModuleExp() error {
-	return r.SendCommand("CM\x01")
+	if err := r.SendCommand("CM\x01"); err != nil {
+		return err
+	}
+	r.genExpActive.Store(true)
+	return nil
 }
 
 // SetBaudRate requets RF Explorer to set the serial baud rate.
@@ -625,18 +1374,31 @@ func (r *RFExplorer) SetBaudRate(br BaudRate) error {
 	return fmt.Errorf("rfx: unknown baud rate %d", br)
 }
 
-func (r *RFExplorer) Realtime() error {
-	return r.SendCommand("C+\x00")
-}
-
-func (r *RFExplorer) SetMaxHold() error {
-	return r.SendCommand("C+\x04")
+// SetCalculatorMode sets the onboard calculator mode which the device
+// applies to the samples of each sweep before sending them. The mode is
+// reflected by Config straight away rather than once the device next
+// reports its configuration.
+func (r *RFExplorer) SetCalculatorMode(mode CalculatorMode) error {
+	// #<Size>C+<CalcMode>
+	if mode < CalculatorModeNormal || mode > CalculatorModeMaxHold {
+		return fmt.Errorf("rfx: unknown calculator mode %d", int(mode))
+	}
+	if err := r.SendCommand("C+" + string([]byte{byte(mode)})); err != nil {
+		return err
+	}
+	if config, ok := r.config.Load().(*CurrentConfigPacket); ok {
+		c := *config
+		c.CalculatorMode = mode
+		r.config.Store(&c)
+	}
+	return nil
 }
 
 func (r *RFExplorer) Shutdown() error {
 	return r.SendCommand("CS")
 }
 
+// SetGeneratorPower turns the output of a signal generator on or off.
 func (r *RFExplorer) SetGeneratorPower(on bool) error {
 	if on {
 		return r.SendCommand("CP1")
@@ -644,14 +1406,14 @@ func (r *RFExplorer) SetGeneratorPower(on bool) error {
 	return r.SendCommand("CP0")
 }
 
-// TODO: SetCalculator	#<Size>C+<CalcMode>	Request RF Explorer to set onboard calculator mode <Size>=5 bytes
-// TODO: SetDSP	#<Size>Cp <DSP_Mode>	Request RF Explorer to set onboard DSP mode <Size>=5 bytes	1.12
 // TODO: SetOffsetDB	#<Size>CO <OffsetDB>	Request RF Explorer to set onboard Amplitude Offset in dB <Size>=5 bytes
 // TODO: SetInputStage	#<Size>a <InputStage>	Request RF Explorer to set onboard input stage mode, available in WSUB1G+ and IoT models only <Size>=4 bytes
-// TODO: SetSweepPointsLarge	#<Size>Cj <Sample_points_large>	Request RF Explorer to change to new data point sweep size <Size>=6 bytes - this mode support sweep sizes up to 65536 data points
 
 // SetSweepPoints sets the number of sweep data points (16-4096, multiple of 16).
 func (r *RFExplorer) SetSweepPoints(steps int) error {
+	if err := r.require(CapSweepPoints); err != nil {
+		return err
+	}
 	if steps < 16 {
 		steps = 16
 	}
@@ -662,7 +1424,15 @@ func (r *RFExplorer) SetSweepPoints(steps int) error {
 }
 
 // SetSweepPointsEx sets the number of sweep data points (112-65536, multiple of 2).
+// Firmware without large sweeps is sent SetSweepPoints instead for up to
+// 4096 points.
 func (r *RFExplorer) SetSweepPointsEx(steps int) error {
+	if err := r.require(CapLargeSweeps); err != nil {
+		if steps <= 4096 {
+			return r.SetSweepPoints(steps)
+		}
+		return err
+	}
 	if steps < 112 {
 		steps = 112
 	}
@@ -672,326 +1442,254 @@ func (r *RFExplorer) SetSweepPointsEx(steps int) error {
 	return r.SendCommand("Cj" + string([]byte{byte((steps & 0xff00) >> 8), byte(steps & 0xff)}))
 }
 
-// SetAnalyzerConfig will change current configuration for RF Explorer and send current Spectrum Analyzer configuration data back to PC.
-func (r *RFExplorer) SetAnalyzerConfig(startFreqKHZ, endFreqKHZ, ampTopDBm, ampBottomDBm, rbwKHZ int) error {
+// SetAnalyzerConfig changes the analyzer configuration and waits for the device to report the configuration it applied,
+// which is returned. An rbwKHZ of 0 lets the device choose the RBW. Parameters the device doesn't support are not
+// corrected, instead a ValidationErrors is returned describing each of them. That includes a range outside the active
+// module's FreqLimits, which can be used to clamp it beforehand. Calls made while an earlier one is still queued are
+// combined since only the last would have any effect, and all of them return the configuration of the last.
+func (r *RFExplorer) SetAnalyzerConfig(ctx context.Context, startFreqKHZ, endFreqKHZ, ampTopDBm, ampBottomDBm, rbwKHZ int) (*CurrentConfigPacket, error) {
 	// #<Size>C2-F: <Start_Freq>, <End_Freq>, <Amp_Top>, <Amp_Bottom>, <RBW_KHZ>
 	// <Start_Freq>, <End_Freq> = 7 ascii digits, decimal
 	// <Amp_Top>, <Amp_Bottom> = 4 ascii digits, decimal
 	// <RBW_KHZ> = 5 ascii digits, decimal
-	if startFreqKHZ < 0 || endFreqKHZ < 0 || startFreqKHZ > 9999999 || endFreqKHZ > 9999999 {
-		return fmt.Errorf("rfx: SetAnalyzerConfig startFreqKHZ and endFreqKHZ must be in the range [0,9999999]")
+	rbwKHZ, err := validateAnalyzerConfig(startFreqKHZ, endFreqKHZ, ampTopDBm, ampBottomDBm, rbwKHZ)
+	if err != nil {
+		return nil, err
 	}
-	if ampTopDBm > 0 {
-		ampTopDBm = 0
+	if limits, ok := r.FreqLimits(); ok {
+		if err := limits.Check(startFreqKHZ, endFreqKHZ); err != nil {
+			return nil, err
+		}
 	}
-	if ampTopDBm < -120 {
-		ampTopDBm = -120
+	var rbwKHZStr string
+	if rbwKHZ > 0 {
+		rbwKHZStr = fmt.Sprintf(",%05d", rbwKHZ)
 	}
-	if ampBottomDBm >= ampTopDBm || ampBottomDBm < -120 {
-		ampBottomDBm = -120
+
+	cmd := fmt.Sprintf("C2-F:%07d,%07d,%04d,%04d%s", startFreqKHZ, endFreqKHZ, ampTopDBm, ampBottomDBm, rbwKHZStr)
+	// Remembered to restore it after reconnecting.
+	r.lastConfig.Store(cmd)
+	// The device echoes the configuration once it has applied it, until
+	// then the command queue holds back other commands.
+	pkt, err := r.request(ctx, cmd, isConfig)
+	if err != nil {
+		return nil, err
 	}
+	return pkt.(*CurrentConfigPacket), nil
+}
 
-	var rbwKHZStr string
-	if rbwKHZ > 0 && rbwKHZ >= 3 && rbwKHZ <= 670 {
-		steps := (endFreqKHZ - startFreqKHZ + rbwKHZ/2) / rbwKHZ
-		if steps < 112 {
-			steps = 112
+// validateAnalyzerConfig checks the parameters of SetAnalyzerConfig and
+// returns the RBW the device will use, which is rounded to fit a whole
+// number of sweep steps in the span.
+func validateAnalyzerConfig(startFreqKHZ, endFreqKHZ, ampTopDBm, ampBottomDBm, rbwKHZ int) (int, error) {
+	var errs ValidationErrors
+	check := func(ok bool, field string, value interface{}, supported string) {
+		if !ok {
+			errs = append(errs, &ValidationError{Field: field, Value: value, Supported: supported})
+		}
+	}
+	check(startFreqKHZ >= 0 && startFreqKHZ <= 9999999, "startFreqKHZ", startFreqKHZ, "must be in the range [0,9999999]")
+	check(endFreqKHZ >= 0 && endFreqKHZ <= 9999999, "endFreqKHZ", endFreqKHZ, "must be in the range [0,9999999]")
+	check(endFreqKHZ > startFreqKHZ, "endFreqKHZ", endFreqKHZ, fmt.Sprintf("must be above startFreqKHZ (%d)", startFreqKHZ))
+	check(ampTopDBm >= -110 && ampTopDBm <= 35, "ampTopDBm", ampTopDBm, "must be in the range [-110,35]")
+	check(ampBottomDBm >= -120 && ampBottomDBm <= 25, "ampBottomDBm", ampBottomDBm, "must be in the range [-120,25]")
+	check(ampTopDBm-ampBottomDBm >= 10, "ampBottomDBm", ampBottomDBm, fmt.Sprintf("must be at least 10 dB below ampTopDBm (%d)", ampTopDBm))
+	if rbwKHZ != 0 && endFreqKHZ > startFreqKHZ {
+		// The RBW is limited by the hardware to [3,620) kHz and by the
+		// span which is divided into between 112 and MaxSpectrumSteps steps.
+		span := endFreqKHZ - startFreqKHZ
+		lo, hi := (span+MaxSpectrumSteps-1)/MaxSpectrumSteps, span/112
+		if lo < 3 {
+			lo = 3
 		}
-		if steps > MaxSpectrumSteps {
-			steps = MaxSpectrumSteps
+		if hi > 619 {
+			hi = 619
 		}
-		rbwKHZ = (endFreqKHZ - startFreqKHZ + steps/2) / steps
-		if rbwKHZ >= 3 && rbwKHZ < 620 {
-			rbwKHZStr = fmt.Sprintf(",%05d", rbwKHZ)
-		} else {
-			fmt.Printf("Ignored RBW %d Khz", rbwKHZ)
+		switch {
+		case lo > hi:
+			check(false, "rbwKHZ", rbwKHZ, fmt.Sprintf("no RBW is supported for a span of %d kHz, use 0 for automatic", span))
+		case rbwKHZ < lo || rbwKHZ > hi:
+			check(false, "rbwKHZ", rbwKHZ, fmt.Sprintf("must be in the range [%d,%d] for a span of %d kHz or 0 for automatic", lo, hi, span))
+		default:
+			steps := (span + rbwKHZ/2) / rbwKHZ
+			rbwKHZ = (span + steps/2) / steps
 		}
 	}
-
-	cmd := fmt.Sprintf("C2-F:%07d,%07d,%04d,%04d%s", startFreqKHZ, endFreqKHZ, ampTopDBm, ampBottomDBm, rbwKHZStr)
-	if err := r.SendCommand(cmd); err != nil {
-		return err
+	if len(errs) != 0 {
+		return 0, errs
 	}
-	// wait some time for the unit to process changes, otherwise may get a different command too soon
-	time.Sleep(time.Millisecond * 500)
-	return nil
+	return rbwKHZ, nil
 }
 
-// Sample rate value should be in range 20,000 – 500,000 for OOK RAW modulation modes usually found in commercial devices, but some experimentation may be needed. This is the sample rate at which the internal decoder will detect activity – the higher this value the better capture resolution but at the cost of a shorter capture time lapse.
-func (r *RFExplorer) SetSnifferConfig(centerFreqKHZ int, sampleRate int) error {
-	return nil // TODO
+// ApplyPreset switches to the preset's module and sets the analyzer
+// configuration from the preset, waiting for the device to apply it. It
+// does not use or modify the device's stored presets.
+func (r *RFExplorer) ApplyPreset(ctx context.Context, p *Preset) error {
+	if p.Mainboard {
+		if err := r.SwitchModuleMain(); err != nil {
+			return err
+		}
+	} else {
+		if err := r.SwitchModuleExp(); err != nil {
+			return err
+		}
+	}
+	_, err := r.SetAnalyzerConfig(ctx, p.MinFreqKHz, p.MaxFreqKHz, p.AmpTopDBm, p.AmpBottomDBm, 0)
+	return err
 }
 
 // SendCommand sends a "#" command to the RF Explorer
 func (r *RFExplorer) SendCommand(cmd string) error {
+	return r.sendCommand(cmd, nil)
+}
+
+// sendCommand sends a command, registering w if not nil as it's written.
+func (r *RFExplorer) sendCommand(cmd string, w *waiter) error {
 	if len(cmd) > 253 {
 		return fmt.Errorf("rfx: command may not exceed a length of 253, got %d", len(cmd))
 	}
-	if cap(r.writeBuf) < len(cmd)+2 {
-		r.writeBuf = make([]byte, len(cmd)+2)
-	}
-	r.writeBuf[0] = '#'
-	r.writeBuf[1] = byte(2 + len(cmd))
-	copy(r.writeBuf[2:], cmd)
-	return r.write(r.writeBuf[:2+len(cmd)])
+	buf := make([]byte, 2+len(cmd))
+	buf[0] = '#'
+	buf[1] = byte(2 + len(cmd))
+	copy(buf[2:], cmd)
+	return r.write(buf, w)
 }
 
-func (r *RFExplorer) write(b []byte) error {
-	if n, err := r.port.Write(b); err != nil {
-		return fmt.Errorf("rfx: failed to write to port: %s", err)
-	} else if n != len(b) {
-		return fmt.Errorf("rfx: expected to write %d bytes but wrote %d", len(b), n)
+// signal does a non-blocking send on a channel used to wake up a waiter.
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
 	}
-	return nil
 }
 
 func (r *RFExplorer) handlePacket(pkt Packet) {
-	r.readCh <- pkt
+	var changed StateChange
+	switch pkt := pkt.(type) {
+	case *CurrentSetupPacket:
+		changed = r.storeSetup(pkt)
+	case *SerialNumberPacket:
+		changed = r.storeSerialNumber(pkt.SN)
+	case *CalibrationAvailabilityPacket:
+		r.calibration.Store(pkt)
+	case *CalibrationDataPacket:
+		r.calData.Store(pkt)
+	case *DSPModePacket:
+		r.dspMode.Store(pkt.Mode)
+	case *InputStagePacket:
+		r.inputStage.Store(pkt.Stage)
+	case *CurrentSnifferConfig:
+		r.snifferConfig.Store(pkt)
+		changed = r.storeMode(pkt.CurrentMode)
+	case *RawData:
+		pkt.Config, _ = r.snifferConfig.Load().(*CurrentSnifferConfig)
+	case *CurrentConfigPacket:
+		pkt.InputStage, _ = r.inputStage.Load().(InputStage)
+		changed = r.storeConfig(pkt)
+		r.sweepRate.reset()
+	case *SweepDataPacket:
+		pkt.Config, _ = r.config.Load().(*CurrentConfigPacket)
+		r.correctSweep(pkt)
+		r.sweepRate.add(time.Now())
+	case *ParseErrorPacket:
+		r.link.framingError()
+		r.trace.log().Warn("undecodable data from the device", "err", pkt.Err, "bytes", len(pkt.Data))
+	}
+	r.waiters.deliver(pkt)
+	policy, _ := r.backpressure.Load().(Backpressure)
+	wake := r.waiters.wake()
+	r.link.drop(r.subs.publish(pkt, policy, wake))
+	r.send(pkt, wake)
+	if changed != 0 {
+		// Not sent to Chan, whose clients expect only what the device
+		// sends.
+		st := r.state(changed)
+		r.trace.log().Debug("device state changed", "changed", changed.String(), "mode", st.Mode.String())
+		r.waiters.deliver(st)
+		r.link.drop(r.subs.publish(st, policy, wake))
+	}
 }
 
-// var logFile *os.File
-
-// func init() {
-// 	var err error
-// 	logFile, err = os.Create("log.bin")
-// 	if err != nil {
-// 		log.Fatal(err)
-// 	}
-// }
+// sweepSamples converts the samples of a sweep data packet to dBm into a
+// packet from the pool.
+func sweepSamples(b []byte) *SweepDataPacket {
+	pkt, _ := sweepPool.Get().(*SweepDataPacket)
+	if pkt == nil || cap(pkt.Samples) < len(b) {
+		pkt = &SweepDataPacket{Samples: make([]float64, len(b))}
+	}
+	samples := pkt.Samples[:len(b)]
+	pkt.Samples = samples
+	for i, adbm := range b {
+		// Sampled value in dBm, repeated n times one per sample. To get the real value in dBm, consider this an
+		// unsigned byte, divide it by two and change sign to negative. For instance a byte=0x11 (17 decimal)
+		// will be -17/2= -8.5dBm. This is now normalized and consistent for all modules and setups
+		samples[i] = -float64(adbm) / 2.0
+	}
+	return pkt
+}
 
 func (r *RFExplorer) readLoop() {
+	defer close(r.readDone)
+	defer r.subs.closeAll()
+	defer close(r.readCh)
 	buf := make([]byte, 8192)
 	off := 0
 	for {
-		if off >= len(buf)-1 {
-			// TODO
+		if off == len(buf) {
+			// decodePacket grows the buffer for packets that need it so
+			// this is garbage that didn't resync.
+			r.link.resync()
+			r.handlePacket(parseError(buf[:off], "discarded %d undecodable bytes", off))
 			off = 0
 		}
-		n, err := r.port.Read(buf[off:])
-		if err != nil {
-			// TODO
-			log.Fatal(err)
-		}
-		// logFile.Write(buf[off : off+n])
+		port := r.getPort()
+		n, err := port.Read(buf[off:])
 		select {
 		case <-r.closeCh:
+			// Reads fail once the port is closed, which isn't an error.
 			return
 		default:
 		}
+		if err != nil {
+			if err = r.reconnect(err); err != nil {
+				if err != errClosed {
+					r.lost(err)
+				}
+				return
+			}
+			// Whatever was left of a packet from before is lost.
+			off = 0
+			continue
+		}
+		received := time.Now()
+		if rt, ok := port.(ReceiveTimer); ok {
+			received = rt.ReceiveTime()
+		}
+		r.capture(buf[off : off+n])
 		if n == 0 {
 			continue
 		}
 		off += n
-	decodeLoop:
-		for off > 2 {
-			// See if there's an EOL
-			eolIdx := bytes.Index(buf[:off], []byte{0x0d, 0x0a})
-			// The buffer is guaranteed to be at least 3 bytes long now
-			b := buf[:off]
-			handled := false
-			switch b[0] {
-			case '$':
-				// TODO: $C?
-				switch b[1] {
-				case 'D':
-					if len(b) < 0x404 {
-						break decodeLoop
-					}
-					data := make([]byte, 0x400)
-					copy(data, b[2:0x402])
-					r.handlePacket(&ScreenImage{
-						Data: data,
-					})
-					eolIdx = 0x402
-					handled = true
-				case 'R':
-					// Raw data (used for sniffer)
-					nBytes := int(buf[2]) | (int(buf[3]) << 8)
-					if len(b) < nBytes+4 {
-						break decodeLoop
-					}
-					data := make([]byte, nBytes)
-					copy(data, b[4:4+nBytes])
-					r.handlePacket(&RawData{
-						Data: data,
-					})
-					eolIdx = 4 + nBytes
-					handled = true
-				case 'S':
-					// Sweep_data - $S<Sample_Steps> <AdBm>… <AdBm> <EOL> - Send all dBm sample points to PC client, in binary
-					if eolIdx < 0 {
-						break decodeLoop
-					}
-					if len(b) > 3 {
-						nSamples := int(b[2])
-						if len(b) < 3+nSamples {
-							// TODO: insert error into packet stream
-							fmt.Printf("SHORT\n")
-						} else {
-							if eolIdx < 3+nSamples {
-								eolIdx = 3 + nSamples
-								if eolIdx > len(b) {
-									// TODO: handle this better
-									fmt.Printf("LONG\n")
-									eolIdx = len(b)
-								}
-							}
-							samples := make([]float64, nSamples)
-							for i, adbm := range b[3 : 3+nSamples] {
-								// Sampled value in dBm, repeated n times one per sample. To get the real value in dBm, consider this an
-								// unsigned byte, divide it by two and change sign to negative. For instance a byte=0x11 (17 decimal)
-								// will be -17/2= -8.5dBm. This is now normalized and consistent for all modules and setups
-								samples[i] = -float64(adbm) / 2.0
-							}
-							r.handlePacket(&SweepDataPacket{
-								Samples: samples,
-							})
-							handled = true
-						}
-					}
-				case 'P':
-					// "$P " index:byte \x01 name:byte*12 \x00 \x00 minfreqkhz:uint32 maxfeqkhz:uint32 calcmode:byte amptop:int8 ampbottom:int8 calciter:byte mainboard:bool markermode:byte \x42 \x00
-					nameBytes := buf[5 : 5+12]
-					if ix := bytes.IndexByte(nameBytes, 0); ix >= 0 {
-						nameBytes = nameBytes[:ix]
-					}
-					r.handlePacket(&Preset{
-						Index:          int(buf[3]),
-						Name:           string(nameBytes),
-						MinFreqKHz:     int(binary.LittleEndian.Uint32(buf[19:23])),
-						MaxFreqKHz:     int(binary.LittleEndian.Uint32(buf[23:27])),
-						CalcMode:       CalculatorMode(buf[27]),
-						AmpTopDBm:      int(int8(buf[28])),
-						AmpBottomDBm:   int(int8(buf[29])),
-						CalcIterations: int(buf[30]),
-						Mainboard:      buf[31] != 0,
-						MarkerMode:     MarkerMode(buf[32]),
-					})
-					handled = true
-				}
-			case '#':
-				if eolIdx < 0 {
-					break decodeLoop
-				}
-				b = buf[:eolIdx]
-				// TODO: #QA:0 is received once on startup (TODO?)
-				// TODO: #K1 & #K0 -- thread tracking something or other
-
-				switch b[1] {
-				case 'C':
-
-					if len(b) > 6 {
-						switch b[2] {
-						case '2': // Spectrum Analyzer mode
-							if b[3] == '-' && b[5] == ':' {
-								switch b[4] {
-								case 'F':
-									// Current_config - #C2-F:<Start_Freq>, <Freq_Step>, <Amp_Top>, <Amp_Bottom>, <Sweep_Steps>,
-									//                  <ExpModuleActive>, <CurrentMode>, <Min_Freq>, <Max_Freq>, <Max_Span>, <RBW>,
-									//                  <AmpOffset>, <CalculatorMode> <EOL>
-									// Send current Spectrum Analyzer configuration data. From RFE to PC, will be used
-									// by the PC to control PC client GUI. Note this has been updated in v1.12
-									p := strings.Split(string(b[6:]), ",")
-									config := &CurrentConfigPacket{
-										StartFreqKHZ:    parseASCIIDecimal(p[0]),
-										FreqStepHZ:      parseASCIIDecimal(p[1]),
-										AmpTopDBM:       parseASCIIDecimal(p[2]),
-										AmpBottomDBM:    parseASCIIDecimal(p[3]),
-										SweepSteps:      parseASCIIDecimal(p[4]),
-										ExpModuleActive: p[5] == "1",
-										CurrentMode:     parseMode(p[6]),
-										MinFreqKHZ:      parseASCIIDecimal(p[7]),
-										MaxFreqKHZ:      parseASCIIDecimal(p[8]),
-										MaxSpan:         parseASCIIDecimal(p[9]),
-										RBWKHZ:          parseASCIIDecimal(p[10]),
-										AmpOffset:       parseASCIIDecimal(p[11]),
-										CalculatorMode:  parseCalculatorMode(p[12]),
-									}
-									r.handlePacket(config)
-									handled = true
-								case 'M':
-									// Current_Setup - #C2-M:<Main_Model>, <Expansion_Model>, <Firmware_Version> <EOL>
-									// Send current Spectrum Analyzer model setup and firmware version	1.06
-									p := strings.Split(string(b[6:]), ",")
-									setup := &CurrentSetupPacket{
-										// <Main_Model> - Codified values are 433M:0, 868M:1, 915M:2, WSUB1G:3, 2.4G:4, WSUB3G:5, 6G:6
-										Model: parseModel(p[0]),
-									}
-									// <Expansion_Model> - Codified values are 433M:0, 868M:1, 915M:2, WSUB1G:3, 2.4G:4, WSUB3G:5, 6G:6, NONE:255
-									if len(p) >= 2 {
-										setup.ExpansionModel = parseModel(p[1])
-									}
-									if len(p) >= 3 {
-										setup.FirmwareVersion = strings.TrimLeft(p[2], "0")
-									}
-									r.handlePacket(setup)
-									handled = true
-								}
-							}
-						// case '3': // Signal generator CW, SweepFreq and SweepAmp modes // TODO: #C3- https://github.com/RFExplorer/RFExplorer-for-Python/blob/master/RFExplorer/RFEConfiguration.py#L136
-						case '4': // Sniffer mode
-							// TODO: #C4- https://github.com/RFExplorer/RFExplorer-for-Python/blob/master/RFExplorer/RFEConfiguration.py#L190
-							// self.fStartMHZ = int(sLine[6:13]) / 1000.0 #note it comes in KHZ
-							// self.bExpansionBoardActive = (sLine[14] == '1')
-							// self.m_eMode = RFE_Common.eMode(int(sLine[16:19]))
-							// nDelay = int(sLine[20:25])
-							// self.nBaudrate = int(round(float(RFE_Common.CONST_FCY_CLOCK) / nDelay))   #FCY_CLOCK = 16 * 1000 * 1000
-							// self.eModulations = RFE_Common.eModulation(int(sLine[26:27]))
-							// ... use Modulation type
-							// self.fRBWKHZ = int(sLine[28:33])
-							// self.fThresholdDBM = (float)(-0.5 * float(sLine[34:37]))
-							if b[3] == '-' && b[4] == 'F' && b[5] == ':' {
-								p := strings.Split(string(b[6:]), ",")
-								r.handlePacket(&CurrentSnifferConfig{
-									StartFreqKHZ:    parseASCIIDecimal(p[0]),
-									ExpModuleActive: p[1] == "1",
-									CurrentMode:     parseMode(p[2]),
-									Delay:           parseASCIIDecimal(p[3]), // baudrate = (FCY_CLOCK=16*1000*1000)/delay,
-									Modulation:      parseModulation(p[4]),
-									RBWKHZ:          parseASCIIDecimal(p[5]),
-									ThresholdDBM:    -0.5 * float64(parseASCIIDecimal(p[6])),
-								})
-								handled = true
-							}
-						case 'A':
-							if b[3] == 'L' && b[4] == ':' {
-								r.handlePacket(&CalibrationAvailabilityPacket{
-									MainboardInternalCalibrationAvailable:      b[5] == '1',
-									ExpansionBoardInternalCalibrationAvailable: b[6] == '1',
-								})
-								handled = true
-							}
-						}
-					}
-				case 'S':
-					// Serial_Number - #Sn<SerialNumber> - device serial number
-					if b[2] == 'n' {
-						r.handlePacket(&SerialNumberPacket{SN: string(buf[3:eolIdx])})
-						handled = true
-					}
-				case 'P':
-					if len(b) >= 4 && string(b[:4]) == "#PCK" {
-						select {
-						case r.endOfPresetCh <- struct{}{}:
-						default:
-						}
-						r.handlePacket(&EndOfPresetsPacket{})
-						handled = true
-					}
+		start := 0
+		for start < off {
+			pkt, n, need := decodePacket(buf[start:off])
+			if n == 0 {
+				if need > len(buf) {
+					buf = append(buf, make([]byte, need-len(buf))...)
 				}
+				break
 			}
-			if !handled && eolIdx >= 0 {
-				// Need to copy the data as we reuse the buffer
-				b2 := make([]byte, eolIdx)
-				copy(b2, b[:eolIdx])
-				r.handlePacket(&UnhandledPacket{Data: b2})
-				handled = true
+			what := "-"
+			if pkt != nil {
+				what = pkt.Type()
 			}
-			if !handled {
-				break
+			r.trace.frame(received, "RX", what, buf[start:start+n])
+			start += n
+			if pkt != nil {
+				stamp(pkt, received)
+				r.handlePacket(pkt)
 			}
-			copy(buf, buf[eolIdx+2:])
-			off -= eolIdx + 2
 		}
+		off = copy(buf, buf[start:off])
 	}
 }
@@ -1,9 +1,24 @@
 package rfx
 
 import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
 	"image/png"
+	"io"
+	"log/slog"
+	"math"
+	"net"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestScreenImage(t *testing.T) {
@@ -46,3 +61,1819 @@ func TestScreenImage(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestParseSetup(t *testing.T) {
+	setup := parseSetup("060,255,01.15")
+	if !setup.IsGenerator() || setup.ExpansionModel != ModelNone || setup.FirmwareVersion != "1.15" {
+		t.Errorf("generator setup = %+v", setup)
+	}
+	setup = parseSetup("003,005,01.26")
+	if setup.IsGenerator() || setup.Model != ModelWSUB1G || setup.ExpansionModel != ModelWSUB3G {
+		t.Errorf("analyzer setup = %+v", setup)
+	}
+}
+
+func TestPresetValidate(t *testing.T) {
+	p := &Preset{Index: 29, Name: "Airband", MinFreqKHz: 118000, MaxFreqKHz: 137000, AmpBottomDBm: -120, CalcIterations: 1}
+	if err := p.Validate(Model24G.PresetSlots()); err != nil {
+		t.Fatal(err)
+	}
+	p.Index = 30
+	p.Name = "Airband été"
+	p.AmpBottomDBm = -5
+	err := p.Validate(Model24G.PresetSlots())
+	errs, ok := err.(ValidationErrors)
+	if !ok {
+		t.Fatalf("expected ValidationErrors, got %v", err)
+	}
+	fields := make(map[string]bool)
+	for _, e := range errs {
+		fields[e.Field] = true
+	}
+	for _, f := range []string{"Index", "Name", "AmpBottomDBm"} {
+		if !fields[f] {
+			t.Errorf("expected an error for %s in %v", f, err)
+		}
+	}
+	p.Name = "Airband"
+	p.AmpBottomDBm = -120
+	if err := p.Validate(Model24GPlus.PresetSlots()); err != nil {
+		t.Errorf("slot 31 should be valid on a Plus model: %s", err)
+	}
+
+	s := (&Preset{Index: 1, Name: "Air\tband été 118", MinFreqKHz: 118000, MaxFreqKHz: 137000, AmpTopDBm: 50, AmpBottomDBm: 45}).Sanitize()
+	if s.Name != "Airband t 11" || s.AmpTopDBm != 35 || s.AmpBottomDBm != 25 || s.CalcIterations != 1 {
+		t.Errorf("unexpected sanitized preset %+v", s)
+	}
+	if err := s.Validate(30); err != nil {
+		t.Errorf("sanitized preset is invalid: %s", err)
+	}
+
+	port, _ := newFakePort()
+	rfe := newRFExplorer(port)
+	defer rfe.Close()
+	rfe.setup.Store(&CurrentSetupPacket{Model: ModelWSUB1G, ExpansionModel: ModelNone})
+	p.Index = 0
+	p.Mainboard = true
+	if err := rfe.validatePreset(p); err == nil || err.(ValidationErrors)[0].Field != "MinFreqKHz" {
+		t.Errorf("expected MinFreqKHz out of the WSUB1G's range, got %v", err)
+	}
+	p.MinFreqKHz, p.MaxFreqKHz = 430000, 440000
+	p.Mainboard = false
+	if err := rfe.validatePreset(p); err == nil || err.(ValidationErrors)[0].Field != "Mainboard" {
+		t.Errorf("expected an error for the missing expansion module, got %v", err)
+	}
+}
+
+func TestValidateAnalyzerConfig(t *testing.T) {
+	if rbw, err := validateAnalyzerConfig(2400000, 2500000, 0, -120, 100); err != nil || rbw != 100 {
+		t.Errorf("valid config: rbw %d, err %v", rbw, err)
+	}
+	if rbw, err := validateAnalyzerConfig(2400000, 2500000, 0, -120, 0); err != nil || rbw != 0 {
+		t.Errorf("automatic RBW: rbw %d, err %v", rbw, err)
+	}
+	_, err := validateAnalyzerConfig(2500000, 2400000, 10, 5, 2)
+	errs, ok := err.(ValidationErrors)
+	if !ok {
+		t.Fatalf("expected ValidationErrors, got %v", err)
+	}
+	if len(errs) != 2 || errs[0].Field != "endFreqKHZ" || errs[1].Field != "ampBottomDBm" {
+		t.Errorf("unexpected errors %v", err)
+	}
+	if _, err := validateAnalyzerConfig(2400000, 2410000, 0, -120, 200); err == nil {
+		t.Error("RBW above span/112 should be rejected")
+	}
+}
+
+// fakePort is the host end of a connection to a fake device. Writes from
+// the host are sent to the returned channel and data written to dev is read
+// by the host.
+type fakePort struct {
+	io.Reader
+	written chan []byte
+}
+
+func (p *fakePort) Write(b []byte) (int, error) {
+	p.written <- append([]byte(nil), b...)
+	return len(b), nil
+}
+
+func (p *fakePort) Close() error {
+	if c, ok := p.Reader.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+func newFakePort() (port *fakePort, dev *io.PipeWriter) {
+	r, w := io.Pipe()
+	return &fakePort{Reader: r, written: make(chan []byte, 16)}, w
+}
+
+func TestSerialNumber(t *testing.T) {
+	port, dev := newFakePort()
+	rfe := newRFExplorer(port)
+	go func() {
+		if cmd := <-port.written; string(cmd) != "#\x04Cn" {
+			t.Errorf("unexpected command %q", cmd)
+		}
+		io.WriteString(dev, "#Sn0SME38SI2X7NGR48\r\n")
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	sn, err := rfe.SerialNumber(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sn != "0SME38SI2X7NGR48" {
+		t.Errorf("serial number %q", sn)
+	}
+	// The second call is answered from the cache.
+	if sn2, err := rfe.SerialNumber(ctx); err != nil || sn2 != sn {
+		t.Errorf("cached serial number %q, %v", sn2, err)
+	}
+}
+
+func TestCalibrationAvailability(t *testing.T) {
+	port, dev := newFakePort()
+	rfe := newRFExplorer(port)
+	rfe.config.Store(&CurrentConfigPacket{ExpModuleActive: true})
+	go func() {
+		if cmd := <-port.written; string(cmd) != "#\x04C0" {
+			t.Errorf("unexpected command %q", cmd)
+		}
+		io.WriteString(dev, "#CAL:10\r\n")
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	warning, err := rfe.CalibrationWarning(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if warning == "" {
+		t.Error("expected a warning for the uncalibrated expansion module")
+	}
+	cal, err := rfe.CalibrationAvailability(ctx)
+	if err != nil || !cal.MainboardInternalCalibrationAvailable || cal.ExpansionBoardInternalCalibrationAvailable {
+		t.Errorf("CalibrationAvailability = %+v, %v", cal, err)
+	}
+
+	rfe.Close()
+
+	// Without a config it's requested.
+	port, dev = newFakePort()
+	rfe = newRFExplorer(port)
+	defer rfe.Close()
+	go func() {
+		<-port.written
+		io.WriteString(dev, "#CAL:10\r\n")
+		<-port.written
+		io.WriteString(dev, "#C2-F:2400000,0089286,-010,-120,0112,0,000,2350000,2550000,0100000,00110,0000,000\r\n")
+	}()
+	go func() {
+		for range rfe.Chan() {
+		}
+	}()
+	if warning, err := rfe.CalibrationWarning(ctx); err != nil || warning != "" {
+		t.Errorf("CalibrationWarning() = %q, %v for a calibrated mainboard", warning, err)
+	}
+}
+
+func TestDSPMode(t *testing.T) {
+	port, dev := newFakePort()
+	rfe := newRFExplorer(port)
+	go io.WriteString(dev, "DSP:2\r\n#C2-d:3\r\n#DSP:1\r\n")
+	for _, want := range []DSPMode{DSPModeFast, DSPModeNoImage, DSPModeFilter} {
+		select {
+		case pkt := <-rfe.Chan():
+			if p, ok := pkt.(*DSPModePacket); !ok || p.Mode != want {
+				t.Fatalf("got %#v, want DSP mode %s", pkt, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for packet")
+		}
+	}
+	if m, ok := rfe.DSPMode(); !ok || m != DSPModeFilter {
+		t.Errorf("DSPMode() = %s, %t", m, ok)
+	}
+	if err := rfe.SetDSP(DSPModeNoImage); err != nil {
+		t.Fatal(err)
+	}
+	if cmd := <-port.written; string(cmd) != "#\x05Cp3" {
+		t.Errorf("unexpected command %q", cmd)
+	}
+	if err := rfe.SetDSP(DSPMode(4)); err == nil {
+		t.Error("expected an error for an unknown DSP mode")
+	}
+}
+
+func TestInputStage(t *testing.T) {
+	port, dev := newFakePort()
+	rfe := newRFExplorer(port)
+	go io.WriteString(dev, "#a2\r\n#C2-F:0433000,0001000,-010,-120,0112,0,000,0050000,0960000,0100000,00003,0000,000\r\n")
+	var config *CurrentConfigPacket
+	for config == nil {
+		select {
+		case pkt := <-rfe.Chan():
+			config, _ = pkt.(*CurrentConfigPacket)
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for config")
+		}
+	}
+	if config.InputStage != InputStageLNA || config.InputStage.GainDB() != 25 {
+		t.Errorf("input stage %s", config.InputStage)
+	}
+	if config.StartFreqKHZ != 433000 || config.SweepSteps != 112 {
+		t.Errorf("unexpected config %+v", config)
+	}
+	if _, ok := parseLine([]byte("#a9")).(*ParseErrorPacket); !ok {
+		t.Error("unknown input stage wasn't rejected")
+	}
+}
+
+func TestApplyProfile(t *testing.T) {
+	port, _ := newFakePort()
+	rfe := newRFExplorer(port)
+	rfe.config.Store(&CurrentConfigPacket{})
+	rfe.setup.Store(&CurrentSetupPacket{Model: ModelWSUB3G, ExpansionModel: ModelNone})
+	if err := rfe.ApplyProfile(ProfileFastRefresh); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"#\x06Cj\x00\x70", "#\x05C+\x00", "#\x05Cp2"} {
+		if cmd := <-port.written; string(cmd) != want {
+			t.Errorf("command %q, want %q", cmd, want)
+		}
+	}
+}
+
+func TestSweepRate(t *testing.T) {
+	var m rateMeter
+	start := time.Now()
+	for i := 0; i < sweepHistory+10; i++ {
+		m.add(start.Add(time.Duration(i) * 100 * time.Millisecond))
+	}
+	r := m.rate()
+	if len(r.Intervals) != sweepHistory || r.Mean != 100*time.Millisecond || r.SweepsPerSecond != 10 {
+		t.Errorf("unexpected rate %v/s, mean %s over %d intervals", r.SweepsPerSecond, r.Mean, len(r.Intervals))
+	}
+	m.reset()
+	if r := m.rate(); r.SweepsPerSecond != 0 {
+		t.Errorf("rate after reset = %v", r.SweepsPerSecond)
+	}
+}
+
+func TestProbe(t *testing.T) {
+	port, dev := newFakePort()
+	rfe := newRFExplorer(port)
+	go func() {
+		<-port.written
+		io.WriteString(dev, "#C2-F:0096000,0090072,-010,-120,0112,0,000,0015000,2700000,0100000,00110,0000,000\r\n")
+	}()
+	go func() {
+		for range rfe.Chan() {
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := rfe.Probe(ctx); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := rfe.Probe(ctx); err == nil {
+		t.Fatal("expected the unanswered probe to time out")
+	}
+	if s := rfe.LinkStats(); s.Probes != 1 || s.Timeouts != 1 || s.LastRTT == 0 || s.MinRTT != s.MaxRTT {
+		t.Errorf("LinkStats() = %+v", s)
+	}
+}
+
+var update = flag.Bool("update", false, "update the replay corpus golden files")
+
+// TestReplayCorpus decodes each transcript in testdata/replay and compares
+// the packets with its golden file. The transcripts are all synthetic so
+// far, so it catches unintended changes in decoding but doesn't check the
+// decoder against real devices.
+func TestReplayCorpus(t *testing.T) {
+	paths, err := filepath.Glob("testdata/replay/*.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range paths {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			f, err := os.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			pkts, err := Replay(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got bytes.Buffer
+			for _, pkt := range pkts {
+				fmt.Fprintln(&got, FormatPacket(pkt))
+			}
+			golden := strings.TrimSuffix(path, ".bin") + ".golden"
+			if *update {
+				if err := os.WriteFile(golden, got.Bytes(), 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got.Bytes(), want) {
+				t.Errorf("decoded packets differ from %s, got:\n%s", golden, got.Bytes())
+			}
+		})
+	}
+}
+
+func TestScreenImageRelease(t *testing.T) {
+	port, dev := newFakePort()
+	rfe := newRFExplorer(port)
+	frame := append([]byte("$D"), make([]byte, screenImageSize)...)
+	frame = append(frame, '\r', '\n')
+	go func() {
+		for i := 0; i < 2; i++ {
+			frame[2] = byte(i + 1)
+			dev.Write(frame)
+		}
+	}()
+	for i := 0; i < 2; i++ {
+		select {
+		case pkt := <-rfe.Chan():
+			si, ok := pkt.(*ScreenImage)
+			if !ok || si.Data[0] != byte(i+1) {
+				t.Fatalf("got %#v, want screen image %d", pkt, i+1)
+			}
+			si.Release()
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for packet")
+		}
+	}
+}
+
+func TestCommandQueue(t *testing.T) {
+	port, _ := newFakePort()
+	rfe := newRFExplorer(port)
+	// Hold the writer in the gap after a config so that the following
+	// commands queue up.
+	go rfe.SendCommand("C2-F:2400000,2500000,0000,-120")
+	if cmd := <-port.written; string(cmd[2:7]) != "C2-F:" {
+		t.Fatalf("unexpected command %q", cmd)
+	}
+	errs := make(chan error, 3)
+	for _, cmd := range []string{"C2-F:0430000,0440000,0000,-120", "Cn", "C2-F:0868000,0870000,0000,-120"} {
+		go func(cmd string) { errs <- rfe.SendCommand(cmd) }(cmd)
+		time.Sleep(5 * time.Millisecond)
+	}
+	if d := rfe.QueueDepth(); d != 2 {
+		t.Errorf("QueueDepth() = %d, want 2", d)
+	}
+	for _, want := range []string{"C2-F:0868000,0870000,0000,-120", "Cn"} {
+		if cmd := <-port.written; string(cmd[2:]) != want {
+			t.Errorf("got command %q, want %q", cmd[2:], want)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestCommandAckAndFlush(t *testing.T) {
+	port, dev := newFakePort()
+	rfe := newRFExplorer(port)
+	defer rfe.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	// An acknowledged config only holds the writer until the echo.
+	start := time.Now()
+	go func() {
+		<-port.written
+		io.WriteString(dev, "#C2-F:2400000,0089286,-010,-120,0112,0,000,2350000,2550000,0100000,00110,0000,000\r\n")
+		<-port.written
+	}()
+	if err := rfe.SendCommand("C2-F:2400000,2410000,0000,-120"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rfe.SendCommand("Cn"); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d >= configGap {
+		t.Errorf("command after an acknowledged config took %s", d)
+	}
+	<-rfe.Chan()
+
+	// Without an echo Flush waits out the config gap.
+	go func() { <-port.written }()
+	go rfe.SendCommand("C2-F:2400000,2420000,0000,-120")
+	time.Sleep(5 * time.Millisecond)
+	start = time.Now()
+	if err := rfe.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < configGap/2 {
+		t.Errorf("Flush returned after %s, before the config gap", d)
+	}
+	if d := rfe.QueueDepth(); d != 0 {
+		t.Errorf("QueueDepth() = %d after Flush", d)
+	}
+	// An idle queue is flushed already.
+	if err := rfe.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSetAnalyzerConfig(t *testing.T) {
+	port, dev := newFakePort()
+	rfe := newRFExplorer(port)
+	defer rfe.Close()
+	go func() {
+		if cmd := <-port.written; string(cmd[2:]) != "C2-F:2400000,2500000,-010,-120" {
+			t.Errorf("unexpected command %q", cmd)
+		}
+		io.WriteString(dev, "#C2-F:2400000,0892857,-010,-120,0112,0,000,2350000,2550000,0100000,00600,0000,000\r\n")
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	config, err := rfe.SetAnalyzerConfig(ctx, 2400000, 2500000, -10, -120, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.StartFreqKHZ != 2400000 || config.FreqStepHZ != 892857 || config.RBWKHZ != 600 {
+		t.Errorf("unexpected config %+v", config)
+	}
+
+	// Without an echo it gives up when ctx is done.
+	echo := make(chan struct{})
+	go func() {
+		<-port.written
+		<-echo
+		// A late echo isn't taken for that of the next call.
+		io.WriteString(dev, "#C2-F:2400000,0446429,-010,-120,0112,0,000,2350000,2550000,0100000,00600,0000,000\r\n")
+		<-port.written
+		io.WriteString(dev, "#C2-F:2460000,0178571,-010,-120,0112,0,000,2350000,2550000,0100000,00600,0000,000\r\n")
+	}()
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := rfe.SetAnalyzerConfig(ctx, 2400000, 2450000, -10, -120, 0); err != context.DeadlineExceeded {
+		t.Errorf("expected DeadlineExceeded, got %v", err)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	time.AfterFunc(10*time.Millisecond, func() { close(echo) })
+	config, err = rfe.SetAnalyzerConfig(ctx, 2460000, 2480000, -10, -120, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.StartFreqKHZ != 2460000 {
+		t.Errorf("got config %+v of the earlier call", config)
+	}
+}
+
+func TestBackpressure(t *testing.T) {
+	sweep := func(i int) string { return string([]byte{'$', 'S', 1, byte(i), '\r', '\n'}) }
+	config := "#C2-F:2400000,0089286,-010,-120,0112,0,000,2350000,2550000,0100000,00110,0000,000\r\n"
+	for _, tc := range []struct {
+		policy  Backpressure
+		input   func(dev io.Writer)
+		want    []string
+		dropped int
+	}{
+		{
+			policy: BackpressureDropNewest,
+			input: func(dev io.Writer) {
+				for i := 1; i <= 20; i++ {
+					io.WriteString(dev, sweep(i))
+				}
+			},
+			want:    []string{"S1", "S2", "S3", "S4", "S5", "S6", "S7", "S8", "S9", "S10", "S11", "S12", "S13", "S14", "S15", "S16"},
+			dropped: 4,
+		},
+		{
+			policy: BackpressureDropOldest,
+			input: func(dev io.Writer) {
+				for i := 1; i <= 20; i++ {
+					io.WriteString(dev, sweep(i))
+				}
+			},
+			want:    []string{"S5", "S6", "S7", "S8", "S9", "S10", "S11", "S12", "S13", "S14", "S15", "S16", "S17", "S18", "S19", "S20"},
+			dropped: 4,
+		},
+		{
+			policy: BackpressureCoalesceSweeps,
+			input: func(dev io.Writer) {
+				io.WriteString(dev, config)
+				for i := 1; i <= 20; i++ {
+					io.WriteString(dev, sweep(i))
+				}
+				io.WriteString(dev, "#Sn0SME38SI2X7NGR48\r\n")
+			},
+			want:    []string{"CurrentConfig", "S16", "S17", "S18", "S19", "S20", "SerialNumber"},
+			dropped: 15,
+		},
+	} {
+		t.Run(tc.policy.String(), func(t *testing.T) {
+			port, dev := newFakePort()
+			rfe := newRFExplorer(port)
+			defer rfe.Close()
+			rfe.backpressure.Store(tc.policy)
+			tc.input(dev)
+			// Writes to the pipe return once the reader has the data, wait
+			// for it to be handled too.
+			deadline := time.Now().Add(time.Second)
+			for rfe.LinkStats().Dropped < tc.dropped || len(rfe.Chan()) < len(tc.want) {
+				if time.Now().After(deadline) {
+					t.Fatalf("timed out, %d packets dropped and %d queued", rfe.LinkStats().Dropped, len(rfe.Chan()))
+				}
+				time.Sleep(time.Millisecond)
+			}
+			var got []string
+			for len(rfe.Chan()) > 0 {
+				switch pkt := (<-rfe.Chan()).(type) {
+				case *SweepDataPacket:
+					got = append(got, fmt.Sprintf("S%d", int(-pkt.Samples[0]*2)))
+				default:
+					got = append(got, pkt.Type())
+				}
+			}
+			if strings.Join(got, " ") != strings.Join(tc.want, " ") {
+				t.Errorf("got packets %v, want %v", got, tc.want)
+			}
+			if d := rfe.LinkStats().Dropped; d != tc.dropped {
+				t.Errorf("Dropped = %d, want %d", d, tc.dropped)
+			}
+		})
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	port, dev := newFakePort()
+	rfe := newRFExplorer(port)
+	all, unsubscribeAll := rfe.Subscribe()
+	sweeps, unsubscribeSweeps := rfe.Subscribe("SweepData")
+	go func() {
+		io.WriteString(dev, "#Sn0SME38SI2X7NGR48\r\n")
+		for i := 0; i < 20; i++ {
+			io.WriteString(dev, "$S\x01\x10\r\n")
+		}
+	}()
+	// Chan isn't read and doesn't hold up the subscribers.
+	for _, want := range []string{"SerialNumber", "StateChanged"} {
+		if pkt := <-all; pkt.Type() != want {
+			t.Errorf("got %s packet, want %s", pkt.Type(), want)
+		}
+	}
+	for i := 0; i < 20; i++ {
+		if pkt := <-sweeps; pkt.Type() != "SweepData" {
+			t.Fatalf("got %s packet, want SweepData", pkt.Type())
+		}
+		<-all
+	}
+	unsubscribeSweeps()
+	unsubscribeSweeps()
+	if _, ok := <-sweeps; ok {
+		t.Error("expected the channel to be closed after unsubscribing")
+	}
+	rfe.Close()
+	// The packets that didn't fit in Chan were dropped and counted.
+	if d := rfe.LinkStats().Dropped; d != 21-cap(rfe.readCh) {
+		t.Errorf("Dropped = %d, want %d", d, 21-cap(rfe.readCh))
+	}
+	if _, ok := <-all; ok {
+		t.Error("expected the channel to be closed with the connection")
+	}
+	unsubscribeAll()
+	if ch, _ := rfe.Subscribe(); ch != nil {
+		if _, ok := <-ch; ok {
+			t.Error("expected a subscription after closing to be closed")
+		}
+	}
+}
+
+func TestStateChanged(t *testing.T) {
+	port, dev := newFakePort()
+	rfe := newRFExplorer(port)
+	defer rfe.Close()
+	if rfe.Config() != nil || rfe.Setup() != nil || rfe.Mode() != ModeUnknown {
+		t.Fatal("expected no state before the device reports it")
+	}
+	states, unsubscribe := rfe.Subscribe("StateChanged")
+	defer unsubscribe()
+	config := "#C2-F:2400000,0089286,-010,-120,0112,0,000,2350000,2550000,0100000,00110,0000,000\r\n"
+	go func() {
+		io.WriteString(dev, "#C2-M:005,255,01.26\r\n")
+		io.WriteString(dev, config)
+		io.WriteString(dev, config)
+		io.WriteString(dev, "#C2-F:2410000,0089286,-010,-120,0112,0,000,2350000,2550000,0100000,00110,0000,000\r\n")
+		io.WriteString(dev, "#C4-F:0433920,0,006,00160,0,00600,0180\r\n")
+		io.WriteString(dev, "#Sn0SME38SI2X7NGR48\r\n")
+	}()
+	go func() {
+		for range rfe.Chan() {
+		}
+	}()
+	for _, want := range []StateChange{StateSetup, StateConfig | StateMode, StateConfig, StateMode, StateSerialNumber} {
+		st := (<-states).(*StateChangedPacket)
+		if st.Changed != want {
+			t.Errorf("got change %s, want %s", st.Changed, want)
+		}
+		if want == StateConfig && st.Config.StartFreqKHZ != 2410000 {
+			t.Errorf("unexpected config %+v", st.Config)
+		}
+		if want == StateSerialNumber && (st.SerialNumber != "0SME38SI2X7NGR48" || st.Mode != ModeRFSniffer || st.Setup.Model != ModelWSUB3G) {
+			t.Errorf("unexpected state %+v", st)
+		}
+	}
+	if rfe.Mode() != ModeRFSniffer || rfe.Config().StartFreqKHZ != 2410000 {
+		t.Errorf("Mode() = %s, Config() = %+v", rfe.Mode(), rfe.Config())
+	}
+}
+
+// syncBuffer is a bytes.Buffer that's safe for concurrent use.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestTraceAndLogger(t *testing.T) {
+	port, dev := newFakePort()
+	go func() {
+		<-port.written
+		io.WriteString(dev, "#C2-F:2400000,0089286,-010,-120,0112,0,000,2350000,2550000,0100000,00110,0000,000\r\n")
+		io.WriteString(dev, "?\r\n")
+	}()
+	var trace, logs syncBuffer
+	rfe, err := NewWithTransport(port,
+		WithTimeout(time.Second),
+		WithTraceWriter(&trace),
+		WithLogger(slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for pkt := range rfe.Chan() {
+		if pkt.Type() == "ParseError" {
+			break
+		}
+	}
+	rfe.Close()
+	for _, want := range []string{
+		" TX command 4 bytes\n00000000  23 04 43 30 ",
+		"|#.C0|",
+		" RX CurrentConfig 83 bytes\n",
+		" RX ParseError 3 bytes\n",
+	} {
+		if !strings.Contains(trace.String(), want) {
+			t.Errorf("trace doesn't contain %q:\n%s", want, trace.String())
+		}
+	}
+	for _, want := range []string{`msg="sent command" command="\"#\\x04C0\""`, `msg="device state changed" changed=config|mode`, `level=WARN msg="undecodable data from the device"`} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("log doesn't contain %s:\n%s", want, logs.String())
+		}
+	}
+}
+
+func TestConcurrentCommands(t *testing.T) {
+	port, _ := newFakePort()
+	rfe := newRFExplorer(port)
+	defer rfe.Close()
+	const goroutines, perGoroutine = 4, 5
+	errs := make(chan error, goroutines*perGoroutine)
+	for g := 0; g < goroutines; g++ {
+		go func(g int) {
+			for i := 0; i < perGoroutine; i++ {
+				errs <- rfe.SendCommand(fmt.Sprintf("X%d-%d%s", g, i, strings.Repeat("x", g*i)))
+			}
+		}(g)
+	}
+	seen := make(map[string]bool)
+	next := make([]int, goroutines)
+	for n := 0; n < goroutines*perGoroutine; n++ {
+		cmd := <-port.written
+		if len(cmd) < 2 || cmd[0] != '#' || int(cmd[1]) != len(cmd) {
+			t.Fatalf("garbled command %q", cmd)
+		}
+		var g, i int
+		if _, err := fmt.Sscanf(string(cmd[2:]), "X%d-%d", &g, &i); err != nil {
+			t.Fatalf("garbled command %q", cmd)
+		}
+		if want := fmt.Sprintf("X%d-%d%s", g, i, strings.Repeat("x", g*i)); string(cmd[2:]) != want || seen[want] {
+			t.Fatalf("got command %q, want %q once", cmd[2:], want)
+		}
+		seen[string(cmd[2:])] = true
+		// Each goroutine's commands are written in the order it sent them.
+		if i != next[g] {
+			t.Errorf("goroutine %d's command %d written before %d", g, i, next[g])
+		}
+		next[g] = i + 1
+	}
+	for n := 0; n < goroutines*perGoroutine; n++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestGetConfig(t *testing.T) {
+	port, dev := newFakePort()
+	rfe := newRFExplorer(port)
+	go func() {
+		for i := 0; i < 2; i++ {
+			if cmd := <-port.written; string(cmd) != "#\x04C0" {
+				t.Errorf("unexpected command %q", cmd)
+			}
+			io.WriteString(dev, "#C2-M:005,255,01.26\r\n#C2-F:2400000,0089286,-010,-120,0112,0,000,2350000,2550000,0100000,00110,0000,000\r\n")
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	config, err := rfe.GetConfig(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.StartFreqKHZ != 2400000 || config.FreqStepHZ != 89286 {
+		t.Errorf("unexpected config %+v", config)
+	}
+	// The responses still go to Chan.
+	for _, want := range []string{"CurrentSetup", "CurrentConfig"} {
+		if pkt := <-rfe.Chan(); pkt.Type() != want {
+			t.Errorf("got %s packet, want %s", pkt.Type(), want)
+		}
+	}
+	setup, err := rfe.GetSetup(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if setup.Model != ModelWSUB3G {
+		t.Errorf("unexpected setup %+v", setup)
+	}
+}
+
+func TestRequestWithUnreadChan(t *testing.T) {
+	port, dev := newFakePort()
+	rfe := newRFExplorer(port)
+	defer rfe.Close()
+	// More sweeps than fit in Chan, which nobody reads, so the reader is
+	// stuck until there's a request.
+	go func() {
+		for i := 0; i < 2*cap(rfe.readCh); i++ {
+			dev.Write([]byte{'$', 'S', 1, byte(i), '\r', '\n'})
+		}
+	}()
+	time.Sleep(10 * time.Millisecond)
+	go func() {
+		<-port.written
+		io.WriteString(dev, "#C2-M:005,255,01.26\r\n#C2-F:2400000,0089286,-010,-120,0112,0,000,2350000,2550000,0100000,00110,0000,000\r\n")
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := rfe.GetConfig(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConnectionLost(t *testing.T) {
+	port, dev := newFakePort()
+	rfe := newRFExplorer(port)
+	dev.CloseWithError(errors.New("device unplugged"))
+	select {
+	case err := <-rfe.Errors():
+		if !strings.Contains(err.Error(), "device unplugged") || rfe.Err() != err {
+			t.Errorf("unexpected error %v, Err() = %v", err, rfe.Err())
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for error")
+	}
+	if _, ok := <-rfe.Chan(); ok {
+		t.Error("Chan should be closed after the connection is lost")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := rfe.GetConfig(ctx); err == nil || err == ctx.Err() {
+		t.Errorf("GetConfig on a lost connection returned %v", err)
+	}
+	rfe.Close()
+	rfe.Close()
+}
+
+func TestCloseWhileSending(t *testing.T) {
+	port, dev := newFakePort()
+	rfe := newRFExplorer(port)
+	// Fill Chan so that the reader blocks sending to it.
+	go func() {
+		for i := 0; i < 20; i++ {
+			if _, err := io.WriteString(dev, "#a0\r\n"); err != nil {
+				return
+			}
+		}
+	}()
+	time.Sleep(10 * time.Millisecond)
+	done := make(chan struct{})
+	go func() {
+		rfe.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Close didn't return")
+	}
+}
+
+func TestAutoReconnect(t *testing.T) {
+	port, dev := newFakePort()
+	port2, dev2 := newFakePort()
+	go func() {
+		if cmd := <-port.written; string(cmd) != "#\x04C0" {
+			t.Errorf("unexpected command %q", cmd)
+		}
+		io.WriteString(dev, "#C2-F:2400000,0089286,-010,-120,0112,0,000,2350000,2550000,0100000,00110,0000,000\r\n")
+	}()
+	attempts := 0
+	rfe, err := NewWithTransport(port, WithTimeout(time.Second), WithAutoReconnect(time.Millisecond), WithRedial(func() (Transport, error) {
+		if attempts++; attempts == 1 {
+			return nil, errors.New("no such device")
+		}
+		return port2, nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rfe.Close()
+	rfe.lastConfig.Store("C2-F:2400000,2500000,-010,-110")
+
+	dev.CloseWithError(errors.New("device unplugged"))
+	select {
+	case pkt := <-rfe.Chan():
+		rp, ok := pkt.(*ReconnectedPacket)
+		if !ok {
+			t.Fatalf("expected ReconnectedPacket, got %T", pkt)
+		}
+		if rp.Attempts != 2 || !strings.Contains(rp.Err.Error(), "device unplugged") {
+			t.Errorf("unexpected packet %+v", rp)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting to reconnect")
+	}
+	select {
+	case cmd := <-port2.written:
+		if string(cmd) != "#\x20C2-F:2400000,2500000,-010,-110" {
+			t.Errorf("unexpected command %q", cmd)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("config wasn't sent again")
+	}
+	io.WriteString(dev2, "#a1\r\n")
+	if pkt := <-rfe.Chan(); pkt.Type() != "InputStage" {
+		t.Errorf("unexpected packet %T after reconnecting", pkt)
+	}
+	if err := rfe.Err(); err != nil {
+		t.Errorf("Err() = %v after reconnecting", err)
+	}
+}
+
+func TestSetCalculatorMode(t *testing.T) {
+	port, _ := newFakePort()
+	rfe := newRFExplorer(port)
+	defer rfe.Close()
+	rfe.config.Store(&CurrentConfigPacket{CalculatorMode: CalculatorModeNormal})
+	if err := rfe.SetCalculatorMode(CalculatorModeMaxHold); err != nil {
+		t.Fatal(err)
+	}
+	if cmd := <-port.written; string(cmd) != "#\x05C+\x04" {
+		t.Errorf("unexpected command %q", cmd)
+	}
+	if m := rfe.Config().CalculatorMode; m != CalculatorModeMaxHold {
+		t.Errorf("Config().CalculatorMode = %s", m)
+	}
+	if err := rfe.SetCalculatorMode(CalculatorModeInvalid); err == nil {
+		t.Error("expected an error for an invalid mode")
+	}
+}
+
+func TestTracking(t *testing.T) {
+	port, dev := newFakePort()
+	rfe := newRFExplorer(port)
+	defer rfe.Close()
+	if err := rfe.StartTrackingSweep(2400000, 1000); err != nil {
+		t.Fatal(err)
+	}
+	if cmd := <-port.written; string(cmd) != "#\x16C3-K:2400000,0001000" {
+		t.Errorf("unexpected command %q", cmd)
+	}
+	if err := rfe.SetTrackingStep(0x0102); err != nil {
+		t.Fatal(err)
+	}
+	if cmd := <-port.written; string(cmd) != "#\x05k\x01\x02" {
+		t.Errorf("unexpected command %q", cmd)
+	}
+	if err := rfe.SetTrackingStep(0x10000); err == nil {
+		t.Error("expected an error for a step that doesn't fit in 16 bits")
+	}
+	go io.WriteString(dev, "#K1\r\n#K0\r\n")
+	for _, want := range []bool{true, false} {
+		if pkt, ok := (<-rfe.Chan()).(*TrackingStatusPacket); !ok || pkt.Tracking != want {
+			t.Errorf("got %#v, want tracking %t", pkt, want)
+		}
+	}
+}
+
+func TestMeasureTrackingStep(t *testing.T) {
+	port, dev := newFakePort()
+	rfe := newRFExplorer(port)
+	defer rfe.Close()
+	go func() {
+		if cmd := <-port.written; string(cmd) != "#\x16C3-K:2400000,0001000" {
+			t.Errorf("unexpected command %q", cmd)
+		}
+		// A sweep from before tracking started doesn't acknowledge it.
+		io.WriteString(dev, "$S\x01\x10\r\n#K1\r\n")
+		if cmd := <-port.written; string(cmd) != "#\x05k\x00\x01" {
+			t.Errorf("unexpected command %q", cmd)
+		}
+		io.WriteString(dev, "$S\x02\x14\x28\r\n")
+	}()
+	// A stale sweep that's already been read.
+	io.WriteString(dev, "$S\x01\x08\r\n")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := rfe.StartTracking(ctx, 2400000, 1000); err != nil {
+		t.Fatal(err)
+	}
+	sweep, err := rfe.MeasureTrackingStep(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sweep.Samples) != 2 || sweep.Samples[1] != -20 {
+		t.Errorf("got samples %v, want the sweep reported after the step", sweep.Samples)
+	}
+}
+
+func TestSniffer(t *testing.T) {
+	port, dev := newFakePort()
+	rfe := newRFExplorer(port)
+	defer rfe.Close()
+	err := rfe.StartSniffer(SnifferConfig{
+		CenterFreqKHZ: 433920,
+		SampleRate:    160000,
+		Modulation:    ModulationOOKRaw,
+		RBWKHZ:        600,
+		ThresholdDBM:  -80,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmd := <-port.written; string(cmd) != "#\x20C3-K:0433920,00100,0,00600,160" {
+		t.Errorf("unexpected command %q", cmd)
+	}
+	if err := rfe.SetSnifferConfig(SnifferConfig{CenterFreqKHZ: 433920, SampleRate: 100}); err == nil {
+		t.Error("expected an error for a sample rate that's too low")
+	}
+
+	go io.WriteString(dev, "#C4-F:0433920,0,006,00100,0,00600,160\r\n$R\x03\x00abc\r\n")
+	if pkt, ok := (<-rfe.Chan()).(*CurrentSnifferConfig); !ok || pkt.SampleRate() != 160000 || pkt.ThresholdDBM != -80 {
+		t.Errorf("unexpected sniffer config %#v", pkt)
+	}
+	pkt, ok := (<-rfe.Chan()).(*RawData)
+	if !ok || string(pkt.Data) != "abc" {
+		t.Fatalf("unexpected raw data %#v", pkt)
+	}
+	if pkt.Config != rfe.SnifferConfig() || pkt.Config == nil {
+		t.Errorf("raw data has config %#v", pkt.Config)
+	}
+}
+
+func TestGenerator(t *testing.T) {
+	port, _ := newFakePort()
+	rfe := newRFExplorer(port)
+	defer rfe.Close()
+	rfe.setup.Store(&CurrentSetupPacket{Model: ModelRFGen})
+	if err := rfe.GenSetPower(3, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := rfe.GenSetCW(433920); err != nil {
+		t.Fatal(err)
+	}
+	if cmd := <-port.written; string(cmd[2:]) != "C3-F:0433920,3,1" {
+		t.Errorf("unexpected command %q", cmd)
+	}
+	if err := rfe.GenStartFreqSweep(2400000, 2500000, 1000, 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if cmd := <-port.written; string(cmd[2:]) != "C3-F:2400000,3,1,0100,0001000,00050" {
+		t.Errorf("unexpected command %q", cmd)
+	}
+	if err := rfe.GenStartAmpSweep(915000, GenPower{Level: 0}, GenPower{Level: 3, HighPower: true}, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if cmd := <-port.written; string(cmd[2:]) != "C3-A:0915000,0,0,3,1,01000" {
+		t.Errorf("unexpected command %q", cmd)
+	}
+	if err := rfe.GenSetCW(1000); err == nil {
+		t.Error("expected an error for a frequency below the generator's range")
+	}
+	// Changing the power of a continuous wave sends it again.
+	if err := rfe.GenSetCW(433920); err != nil {
+		t.Fatal(err)
+	}
+	<-port.written
+	if err := rfe.GenSetPower(1, false); err != nil {
+		t.Fatal(err)
+	}
+	if cmd := <-port.written; string(cmd[2:]) != "C3-F:0433920,1,0" {
+		t.Errorf("unexpected command %q", cmd)
+	}
+	if err := rfe.GenStop(); err != nil {
+		t.Fatal(err)
+	}
+	if cmd := <-port.written; string(cmd[2:]) != "CP0" {
+		t.Errorf("unexpected command %q", cmd)
+	}
+	if err := rfe.GenSetPower(2, false); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case cmd := <-port.written:
+		t.Errorf("unexpected command %q after the output was turned off", cmd)
+	default:
+	}
+
+	rfe.setup.Store(&CurrentSetupPacket{Model: ModelWSUB3G})
+	if err := rfe.GenStop(); err == nil {
+		t.Error("expected an error for an analyzer")
+	}
+	port, _ = newFakePort()
+	rfe = newRFExplorer(port)
+	defer rfe.Close()
+	if err := rfe.GenSetCW(433920); err == nil {
+		t.Error("expected an error for a device of unknown model")
+	}
+}
+
+func TestGeneratorExpansion(t *testing.T) {
+	port, _ := newFakePort()
+	rfe := newRFExplorer(port)
+	defer rfe.Close()
+	rfe.setup.Store(&CurrentSetupPacket{Model: ModelRFGen, ExpansionModel: ModelRFGenExpansion})
+	if err := rfe.GenStartExpansionAmpSweep(915000, -40, 1, -10, 0); err == nil {
+		t.Error("expected an error while the mainboard is active")
+	}
+	if err := rfe.SwitchModuleExp(); err != nil {
+		t.Fatal(err)
+	}
+	<-port.written
+	if err := rfe.GenSetExpansionPower(-20.5); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		fn   func() error
+		want string
+	}{
+		{func() error { return rfe.GenSetCW(433920) }, "C5-F:0433920,-20.5"},
+		{func() error { return rfe.GenSetExpansionPower(5) }, "C5-F:0433920,+05.0"},
+		{func() error { return rfe.GenStartFreqSweep(2400000, 2500000, 1000, 50*time.Millisecond) }, "C5-F:2400000,+05.0,0100,0001000,00050"},
+		{func() error { return rfe.GenStartExpansionAmpSweep(915000, -40, 0.5, -10, time.Second) }, "C5-A:0915000,-40.0,00.5,-10.0,01000"},
+	} {
+		if err := tc.fn(); err != nil {
+			t.Fatal(err)
+		}
+		if cmd := <-port.written; string(cmd[2:]) != tc.want {
+			t.Errorf("got command %q, want %q", cmd[2:], tc.want)
+		}
+	}
+	if err := rfe.GenStartAmpSweep(915000, GenPower{}, GenPower{Level: 3}, 0); err == nil {
+		t.Error("expected an error for a mainboard sweep while the expansion module is active")
+	}
+}
+
+func TestLargeSweep(t *testing.T) {
+	port, dev := newFakePort()
+	rfe := newRFExplorer(port)
+	defer rfe.Close()
+	// Larger than the read buffer and with samples that look like EOLs.
+	const n = 10000
+	z := []byte{'$', 'z', n >> 8, n & 0xff}
+	for i := 0; i < n; i++ {
+		z = append(z, []byte{0x0d, 0x0a, 0x20}[i%3])
+	}
+	z = append(z, "\r\n"...)
+	s := []byte{'$', 's', 1}
+	for i := 0; i < 32; i++ {
+		s = append(s, 0x40)
+	}
+	s = append(s, "\r\n"...)
+	go func() {
+		// Split the packet across writes.
+		dev.Write(z[:5000])
+		time.Sleep(10 * time.Millisecond)
+		dev.Write(z[5000:])
+		dev.Write(s)
+	}()
+	for _, want := range []struct {
+		n     int
+		first float64
+	}{{n, -6.5}, {32, -32}} {
+		select {
+		case pkt := <-rfe.Chan():
+			sweep, ok := pkt.(*SweepDataPacket)
+			if !ok || len(sweep.Samples) != want.n || sweep.Samples[0] != want.first {
+				t.Fatalf("unexpected packet %T, want %d samples", pkt, want.n)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for sweep")
+		}
+	}
+}
+
+func TestCalibrationData(t *testing.T) {
+	port, dev := newFakePort()
+	rfe := newRFExplorer(port)
+	defer rfe.Close()
+	rfe.config.Store(&CurrentConfigPacket{StartFreqKHZ: 100000, FreqStepHZ: 100000000, MinFreqKHZ: 100000, MaxFreqKHZ: 300000})
+	if err := rfe.ApplyCalibration(&SweepDataPacket{Samples: []float64{-50}}); err == nil {
+		t.Error("expected an error without calibration data")
+	}
+	go func() {
+		if cmd := <-port.written; string(cmd) != "#\x04Cq" {
+			t.Errorf("unexpected command %q", cmd)
+		}
+		// +1, -2 (with an EOL in the data), and +3 dB.
+		dev.Write([]byte("$q\x03\x02\xfc\x06\r\n"))
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	cal, err := rfe.GetCalibrationData(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cal.CorrectionsDB) != 3 || cal.CorrectionsDB[1] != -2 {
+		t.Fatalf("unexpected calibration %+v", cal)
+	}
+	sweep := &SweepDataPacket{Samples: []float64{-50, -50, -50}}
+	if err := rfe.ApplyCalibration(sweep); err != nil {
+		t.Fatal(err)
+	}
+	if sweep.Samples[0] != -49 || sweep.Samples[1] != -52 || sweep.Samples[2] != -47 {
+		t.Errorf("calibrated samples %v", sweep.Samples)
+	}
+	if c := cal.Correction(150000000, 100000, 300000); c != -0.5 {
+		t.Errorf("interpolated correction %g, want -0.5", c)
+	}
+}
+
+func TestAmplitudeCorrection(t *testing.T) {
+	c, err := ReadAmplitudeCorrection(strings.NewReader("-- antenna gain\n2500,-3\n2400.0\t1.0\n\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		freqHZ int
+		want   float64
+	}{{2300000000, 1}, {2450000000, -1}, {2600000000, -3}} {
+		if got := c.Correction(tc.freqHZ); got != tc.want {
+			t.Errorf("Correction(%d) = %g, want %g", tc.freqHZ, got, tc.want)
+		}
+	}
+	if _, err := ReadAmplitudeCorrection(strings.NewReader("2400 MHz\n")); err == nil {
+		t.Error("expected an error for a malformed line")
+	}
+
+	port, dev := newFakePort()
+	rfe := newRFExplorer(port)
+	defer rfe.Close()
+	rfe.SetAmplitudeCorrection(c)
+	go io.WriteString(dev, "#C2-F:2400000,0100000,-010,-120,0002,0,000,0015000,2700000,0600000,00003,0000,000\r\n$S\x02\x40\x40\r\n")
+	<-rfe.Chan()
+	if pkt, ok := (<-rfe.Chan()).(*SweepDataPacket); !ok || pkt.Samples[0] != -31 || math.Abs(pkt.Samples[1]+31.004) > 1e-9 {
+		t.Errorf("unexpected corrected sweep %#v", pkt)
+	}
+}
+
+func TestStatusPackets(t *testing.T) {
+	port, dev := newFakePort()
+	rfe := newRFExplorer(port)
+	defer rfe.Close()
+	go io.WriteString(dev, "#QA:0\r\n#K1\r\n#ZZ:new\r\n#\x01\x02\r\n")
+	if pkt, ok := (<-rfe.Chan()).(*QualityPacket); !ok || pkt.Value != 0 {
+		t.Errorf("unexpected packet %#v", pkt)
+	}
+	if pkt, ok := (<-rfe.Chan()).(*TrackingStatusPacket); !ok || !pkt.Tracking {
+		t.Errorf("unexpected packet %#v", pkt)
+	}
+	if pkt, ok := (<-rfe.Chan()).(*StatusPacket); !ok || pkt.Code != "ZZ" || pkt.Value != "new" {
+		t.Errorf("unexpected packet %#v", pkt)
+	}
+	if pkt, ok := (<-rfe.Chan()).(*UnhandledPacket); !ok {
+		t.Errorf("unexpected packet %#v", pkt)
+	}
+}
+
+func TestExpansionSerialNumber(t *testing.T) {
+	port, dev := newFakePort()
+	rfe := newRFExplorer(port)
+	defer rfe.Close()
+	go func() {
+		if cmd := <-port.written; string(cmd) != "#\x04Ce" {
+			t.Errorf("unexpected command %q", cmd)
+		}
+		io.WriteString(dev, "#Sn0SME38SI2X7NGR48\r\n#SeB3X9QK2L7TTA0C1D\r\n")
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	sn, err := rfe.GetExpansionSerialNumber(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sn != "B3X9QK2L7TTA0C1D" {
+		t.Errorf("expansion serial number %q", sn)
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	for _, tc := range []struct {
+		s    string
+		want FirmwareVersion
+	}{{"01.12", FirmwareVersion{1, 12}}, {"1.26B3", FirmwareVersion{1, 26}}} {
+		if v, err := ParseFirmwareVersion(tc.s); err != nil || v != tc.want {
+			t.Errorf("ParseFirmwareVersion(%q) = %v, %v", tc.s, v, err)
+		}
+	}
+	if _, err := ParseFirmwareVersion("beta"); err == nil {
+		t.Error("expected an error for an invalid version")
+	}
+
+	port, _ := newFakePort()
+	rfe := newRFExplorer(port)
+	defer rfe.Close()
+	rfe.setup.Store(&CurrentSetupPacket{Model: ModelWSUB1G, ExpansionModel: ModelNone, FirmwareVersion: "1.12"})
+	if err := rfe.SetDSP(DSPModeFast); !errors.Is(err, ErrUnsupportedByFirmware) {
+		t.Errorf("SetDSP on a WSUB1G returned %v", err)
+	}
+	if err := rfe.SetSweepPointsEx(8192); !errors.Is(err, ErrUnsupportedByFirmware) {
+		t.Errorf("SetSweepPointsEx(8192) on 1.12 returned %v", err)
+	}
+	// Falls back to CJ.
+	if err := rfe.SetSweepPointsEx(1024); err != nil {
+		t.Fatal(err)
+	}
+	if cmd := <-port.written; string(cmd) != "#\x05CJ\x3f" {
+		t.Errorf("unexpected command %q", cmd)
+	}
+	rfe.setup.Store(&CurrentSetupPacket{Model: ModelWSUB3G, ExpansionModel: ModelNone, FirmwareVersion: "01.30"})
+	if !rfe.Supports(CapDSP) || !rfe.Supports(CapLargeSweeps) || rfe.Supports(Cap100Presets) {
+		t.Error("unexpected capabilities for a WSUB3G with firmware 1.30")
+	}
+}
+
+func TestFreqLimits(t *testing.T) {
+	port, _ := newFakePort()
+	rfe := newRFExplorer(port)
+	defer rfe.Close()
+	if info := rfe.Info(); info != (SourceInfo{Name: "RF Explorer"}) {
+		t.Errorf("Info() before the device reports = %+v", info)
+	}
+	rfe.setup.Store(&CurrentSetupPacket{Model: ModelWSUB1G, ExpansionModel: Model24G, FirmwareVersion: "01.26"})
+	rfe.config.Store(&CurrentConfigPacket{ExpModuleActive: true})
+	if info, want := rfe.Info(), (SourceInfo{Name: "RF Explorer WSUB1G", Firmware: "01.26", MinFreqKHZ: 2350000, MaxFreqKHZ: 2550000}); info != want {
+		t.Errorf("Info() = %+v, want %+v", info, want)
+	}
+	_, err := rfe.SetAnalyzerConfig(context.Background(), 2300000, 2450000, 0, -120, 0)
+	verrs, ok := err.(ValidationErrors)
+	if !ok || len(verrs) != 2 || verrs[0].Field != "startFreqKHZ" {
+		t.Fatalf("expected errors for the start and span, got %v", err)
+	}
+
+	limits, _ := Model24G.FreqLimits()
+	for _, tc := range []struct{ start, end, wantStart, wantEnd int }{
+		{2400000, 2450000, 2400000, 2450000},
+		{2300000, 2350000, 2350000, 2400000},
+		{2400000, 2600000, 2457500, 2542500},
+		{2500000, 2600000, 2465000, 2550000},
+	} {
+		start, end := limits.Clamp(tc.start, tc.end)
+		if start != tc.wantStart || end != tc.wantEnd {
+			t.Errorf("Clamp(%d, %d) = %d, %d, want %d, %d", tc.start, tc.end, start, end, tc.wantStart, tc.wantEnd)
+		}
+		if err := limits.Check(start, end); err != nil {
+			t.Errorf("clamped range fails: %v", err)
+		}
+	}
+}
+
+func TestGetPresets(t *testing.T) {
+	port, dev := newFakePort()
+	rfe := newRFExplorer(port)
+	defer rfe.Close()
+	preset := func(index int, name string) string {
+		b := make([]byte, 35)
+		copy(b, "$P ")
+		b[3] = byte(index)
+		b[4] = 0x01
+		copy(b[5:17], name)
+		binary.LittleEndian.PutUint32(b[19:23], 118000)
+		binary.LittleEndian.PutUint32(b[23:27], 137000)
+		b[29] = byte(0x88) // -120 dBm
+		b[30] = 1
+		b[31] = 1
+		b[33] = 0x42
+		return string(b) + "\r\n"
+	}
+	go func() {
+		for i := 0; i < 2; i++ {
+			if cmd := <-port.written; string(cmd) != "#\x05CP\x00" {
+				t.Errorf("unexpected command %q", cmd)
+			}
+			io.WriteString(dev, preset(0, "Airband")+"$S\x01\x10\r\n"+preset(1, "")+"#PCK\r\n")
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	presets, err := rfe.GetPresets(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(presets) != 2 || presets[0].Name != "Airband" || presets[0].MinFreqKHz != 118000 || presets[0].AmpBottomDBm != -120 || presets[1].Index != 1 {
+		t.Fatalf("unexpected presets %+v", presets)
+	}
+	// Nothing is taken off Chan, including the sweep between the presets.
+	for _, want := range []string{"Preset", "SweepData", "Preset", "EndOfPresets"} {
+		if pkt := <-rfe.Chan(); pkt.Type() != want {
+			t.Errorf("got %s packet, want %s", pkt.Type(), want)
+		}
+	}
+	p, err := rfe.GetPreset(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Index != 1 || p.MaxFreqKHz != 137000 {
+		t.Errorf("unexpected preset %+v", p)
+	}
+	if _, err := rfe.GetPreset(ctx, 100); err == nil {
+		t.Error("expected an error for an index out of range")
+	}
+}
+
+func TestExportImportPresets(t *testing.T) {
+	presets := []*Preset{
+		{Index: 0, Name: "Airband", MinFreqKHz: 118000, MaxFreqKHz: 137000, AmpTopDBm: -10, AmpBottomDBm: -120, CalcMode: CalculatorModeMaxHold, CalcIterations: 4, Mainboard: true, MarkerMode: MarkerModeNone},
+		{Index: 41, Name: "ISM 2.4", MinFreqKHz: 2400000, MaxFreqKHz: 2500000, AmpBottomDBm: -100, CalcIterations: 1},
+	}
+	var buf bytes.Buffer
+	if err := ExportPresets(&buf, presets); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ImportPresets(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(presets) {
+		t.Fatalf("got %d presets, want %d", len(got), len(presets))
+	}
+	for i, p := range got {
+		if *p != *presets[i] {
+			t.Errorf("got %+v, want %+v", p, presets[i])
+		}
+	}
+	if _, err := ImportPresets(strings.NewReader(`[{"index": 0}]`)); err == nil {
+		t.Error("expected an error for an index below 1")
+	}
+}
+
+func TestWritePresets(t *testing.T) {
+	port, dev := newFakePort()
+	rfe := newRFExplorer(port)
+	defer rfe.Close()
+	go func() {
+		for cmd := range port.written {
+			if len(cmd) == 36 && string(cmd[:5]) == "#$CP\x01" {
+				// Chan isn't read, and fills up before the confirmation.
+				for i := 0; i < cap(rfe.readCh); i++ {
+					io.WriteString(dev, "$S\x03\x50\x10\x60\r\n")
+				}
+				io.WriteString(dev, "#PCK\r\n")
+			}
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ps := []*Preset{
+		{Index: 0, Name: "Airband", MinFreqKHz: 118000, MaxFreqKHz: 137000, AmpBottomDBm: -120, CalcIterations: 1, Mainboard: true},
+		{Index: 1, Name: "Bad", MinFreqKHz: 118000, MaxFreqKHz: 137000, AmpBottomDBm: -120, CalcIterations: 0, Mainboard: true},
+	}
+	var written []int
+	progress := func(p *Preset) { written = append(written, p.Index) }
+	if err := rfe.WritePresets(ctx, ps, progress); err == nil || len(written) != 0 {
+		t.Fatalf("expected nothing written with an invalid preset, got %v and %v", err, written)
+	}
+	ps[1].CalcIterations = 1
+	if err := rfe.WritePresets(ctx, ps, progress); err != nil {
+		t.Fatal(err)
+	}
+	if len(written) != 2 || written[0] != 0 || written[1] != 1 {
+		t.Errorf("unexpected progress %v", written)
+	}
+	if err := rfe.DeletePreset(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSweepConfig(t *testing.T) {
+	port, dev := newFakePort()
+	rfe := newRFExplorer(port)
+	defer rfe.Close()
+	go func() {
+		io.WriteString(dev, "$S\x03\x50\x10\x60\r\n")
+		io.WriteString(dev, "#C2-F:2400000,0100000,-010,-120,0003,0,000,2350000,2550000,0100000,00110,0000,000\r\n")
+		io.WriteString(dev, "$S\x03\x50\x10\x60\r\n")
+		io.WriteString(dev, "#C2-F:0430000,0010000,-010,-120,0003,0,000,0240000,0960000,0100000,00110,0000,000\r\n")
+	}()
+	var sweeps []*SweepDataPacket
+	for len(sweeps) < 2 {
+		if sweep, ok := (<-rfe.Chan()).(*SweepDataPacket); ok {
+			sweeps = append(sweeps, sweep)
+		}
+	}
+	if sweeps[0].Config != nil || sweeps[0].FreqHZ(1) != 0 || sweeps[0].FrequenciesHZ() != nil {
+		t.Errorf("sweep before any config has config %+v", sweeps[0].Config)
+	}
+	<-rfe.Chan()
+	if sweeps[0].Time.IsZero() || sweeps[1].Time.Before(sweeps[0].Time) {
+		t.Errorf("unexpected receive times %v, %v", sweeps[0].Time, sweeps[1].Time)
+	}
+	if _, ok := Packet(sweeps[0]).(Timestamped); !ok {
+		t.Error("SweepDataPacket isn't Timestamped")
+	}
+	// The later config doesn't change the earlier sweep.
+	sweep := sweeps[1]
+	if sweep.Config == nil || sweep.Config.StartFreqKHZ != 2400000 {
+		t.Fatalf("unexpected config %+v", sweep.Config)
+	}
+	if f := sweep.FrequenciesHZ(); len(f) != 3 || f[0] != 2400000000 || f[2] != 2400200000 {
+		t.Errorf("FrequenciesHZ() = %v", f)
+	}
+	if f, l := sweep.Peak(); f != 2400100000 || l != -8 {
+		t.Errorf("Peak() = %d, %g", f, l)
+	}
+
+	// Sweeps skips sweeps still on Chan from before the current config.
+	io.WriteString(dev, "#C2-F:2400000,0100000,-010,-120,0003,0,000,2350000,2550000,0100000,00110,0000,000\r\n")
+	io.WriteString(dev, "$S\x03\x50\x10\x60\r\n")
+	io.WriteString(dev, "#C2-F:0430000,0010000,-010,-120,0003,0,000,0240000,0960000,0100000,00110,0000,000\r\n")
+	io.WriteString(dev, "$S\x03\x50\x10\x60\r\n")
+	for rfe.Config().StartFreqKHZ != 430000 {
+		time.Sleep(time.Millisecond)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	rfe.Sweeps(ctx, func(sw *Sweep) {
+		if sw.Config.StartFreqKHZ != 430000 {
+			t.Errorf("got sweep of stale config %+v", sw.Config)
+		}
+		cancel()
+	})
+	if ctx.Err() != context.Canceled {
+		t.Error("Sweeps didn't get the sweep of the current config")
+	}
+}
+
+func TestAnalyzer(t *testing.T) {
+	port, dev := newFakePort()
+	a := NewAnalyzerFrom(newRFExplorer(port))
+	defer a.Close()
+	nextMessage := func() AnalyzerMessage {
+		select {
+		case msg := <-a.Chan():
+			return msg
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for a message")
+		}
+		return nil
+	}
+	go func() {
+		io.WriteString(dev, "#C2-F:2400000,0100000,-010,-120,0003,0,000,2350000,2550000,0100000,00110,0000,000\r\n")
+		io.WriteString(dev, "$S\x03\x50\x10\x60\r\n")
+	}()
+	if c, ok := nextMessage().(*CurrentConfigPacket); !ok || c.StartFreqKHZ != 2400000 {
+		t.Fatalf("got %#v, want the config", c)
+	}
+	msg, ok := nextMessage().(*SamplesMessage)
+	if !ok {
+		t.Fatalf("got %#v, want samples", msg)
+	}
+	want := []Sample{{2400000000, -40}, {2400100000, -8}, {2400200000, -48}}
+	if !reflect.DeepEqual(msg.Samples, want) || msg.Time.IsZero() {
+		t.Errorf("got samples %v at %s, want %v", msg.Samples, msg.Time, want)
+	}
+
+	if err := a.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	if cmd := <-port.written; string(cmd) != "#\x04CH" {
+		t.Errorf("Pause sent %q", cmd)
+	}
+	// The config that follows the sweep shows it has been skipped.
+	io.WriteString(dev, "$S\x03\x50\x10\x60\r\n")
+	io.WriteString(dev, "#C2-F:2410000,0100000,-010,-120,0003,0,000,2350000,2550000,0100000,00110,0000,000\r\n")
+	if c, ok := nextMessage().(*CurrentConfigPacket); !ok || c.StartFreqKHZ != 2410000 {
+		t.Fatalf("got %#v while paused, want the new config", c)
+	}
+	if err := a.Resume(); err != nil {
+		t.Fatal(err)
+	}
+	if cmd := <-port.written; string(cmd) != "#\x04C0" {
+		t.Errorf("Resume sent %q", cmd)
+	}
+	io.WriteString(dev, "$S\x03\x50\x10\x60\r\n")
+	if msg, ok := nextMessage().(*SamplesMessage); !ok || msg.Samples[0].FreqHZ != 2410000000 {
+		t.Fatalf("got %#v after resuming, want samples of the new config", msg)
+	}
+
+	a.Close()
+	for range a.Chan() {
+	}
+}
+
+func TestSweepRelease(t *testing.T) {
+	pkt, _, _ := decodePacket([]byte("$S\x04\x02\x04\x06\x08\r\n"))
+	pkt.(*SweepDataPacket).Release()
+	// A smaller sweep may reuse the larger one's buffer.
+	pkt, _, _ = decodePacket([]byte("$S\x02\x0a\x0c\r\n"))
+	sweep := pkt.(*SweepDataPacket)
+	if len(sweep.Samples) != 2 || sweep.Samples[0] != -5 || sweep.Samples[1] != -6 {
+		t.Errorf("unexpected samples %v", sweep.Samples)
+	}
+}
+
+func TestSweepReleaseShared(t *testing.T) {
+	port, dev := newFakePort()
+	rfe := newRFExplorer(port)
+	sweeps, unsubscribe := rfe.Subscribe("SweepData")
+	defer unsubscribe()
+	const n = 200
+	go func() {
+		for i := 0; i < n; i++ {
+			io.WriteString(dev, "$S\x02\x10\x20\r\n")
+		}
+	}()
+	go func() {
+		// Released sweeps would be reused while the subscriber reads them,
+		// which the race detector reports.
+		for pkt := range rfe.Chan() {
+			if sweep, ok := pkt.(*SweepDataPacket); ok {
+				sweep.Release()
+			}
+		}
+	}()
+	for i := 0; i < n; i++ {
+		sweep := (<-sweeps).(*SweepDataPacket)
+		if len(sweep.Samples) != 2 || sweep.Samples[0] != -8 || sweep.Samples[1] != -16 {
+			t.Fatalf("unexpected samples %v", sweep.Samples)
+		}
+	}
+	rfe.Close()
+}
+
+func BenchmarkDecodeSweep(b *testing.B) {
+	for _, steps := range []int{112, 4096, 65536} {
+		var buf []byte
+		if steps <= 255 {
+			buf = append(buf, '$', 'S', byte(steps))
+		} else {
+			buf = append(buf, '$', 'z', byte(steps>>8), byte(steps))
+		}
+		for i := 0; i < steps; i++ {
+			buf = append(buf, byte(i))
+		}
+		buf = append(buf, '\r', '\n')
+		for _, release := range []bool{false, true} {
+			b.Run(fmt.Sprintf("%d/release=%t", steps, release), func(b *testing.B) {
+				b.ReportAllocs()
+				b.SetBytes(int64(len(buf)))
+				for i := 0; i < b.N; i++ {
+					pkt, _, _ := decodePacket(buf)
+					if release {
+						pkt.(*SweepDataPacket).Release()
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestDecodeResync(t *testing.T) {
+	port, dev := newFakePort()
+	rfe := newRFExplorer(port)
+	defer rfe.Close()
+	go func() {
+		// A $S packet whose count is too short, a config missing fields, and
+		// garbage each produce an error, and decoding carries on after them.
+		for _, s := range []string{
+			"$S\x02\x10\x20\x30\r\n#Sn123",
+			"4\r\n#C2-F:2400000,0089286\r\n",
+			"\x00\xff garbage\r\n",
+			"$S\x03\x10\x20\x30\r\n",
+		} {
+			io.WriteString(dev, s)
+		}
+	}()
+	want := []string{"ParseError", "SerialNumber", "ParseError", "ParseError", "SweepData"}
+	for i, w := range want {
+		select {
+		case pkt := <-rfe.Chan():
+			if pkt.Type() != w {
+				t.Fatalf("packet %d is %s, want %s", i, FormatPacket(pkt), w)
+			}
+			if sn, ok := pkt.(*SerialNumberPacket); ok && sn.SN != "1234" {
+				t.Errorf("serial number %q, want 1234", sn.SN)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for %s", w)
+		}
+	}
+	if s := rfe.LinkStats(); s.FramingErrors != 3 {
+		t.Errorf("got %d framing errors, want 3", s.FramingErrors)
+	}
+
+	// Every prefix of a valid packet needs more data rather than failing.
+	pkt := "$S\x03\x10\r\n\r\n"
+	for i := 0; i < len(pkt); i++ {
+		if p, n, need := decodePacket([]byte(pkt[:i])); p != nil || n != 0 || need <= i {
+			t.Errorf("prefix of %d bytes decoded to %v, %d, %d", i, p, n, need)
+		}
+	}
+	if p, n, _ := decodePacket([]byte(pkt)); n != len(pkt) || len(p.(*SweepDataPacket).Samples) != 3 {
+		t.Errorf("decoded %d bytes to %v", n, p)
+	}
+}
+
+// checkDecode decodes every packet in b and checks that the decoder always
+// makes progress and never reads past what it was given.
+func checkDecode(t *testing.T, b []byte) {
+	for len(b) > 0 {
+		pkt, n, need := decodePacket(b)
+		if n == 0 {
+			if pkt != nil || need <= len(b) {
+				t.Fatalf("no progress on %q: packet %v, need %d", b, pkt, need)
+			}
+			return
+		}
+		if n > len(b) {
+			t.Fatalf("consumed %d of %d bytes", n, len(b))
+		}
+		if si, ok := pkt.(*ScreenImage); ok {
+			si.Release()
+		}
+		b = b[n:]
+	}
+}
+
+// The seeds of the fuzz targets are written by hand from the protocol
+// specification, except for testdata/fuzz/FuzzDecodeScreen/screen-dump which
+// is the screen dump captured from a device that TestScreenImage draws. Real
+// captures of the other packets belong in testdata/fuzz as they're
+// contributed, see testdata/replay/README.md.
+
+func FuzzDecodeSweep(f *testing.F) {
+	f.Add([]byte("$S\x03\x10\x20\x30\r\n"))
+	f.Add([]byte("$S\x03\x10\r\n\r\n"))
+	f.Add([]byte("$s\x00" + strings.Repeat("\x40", 16) + "\r\n"))
+	f.Add([]byte("$z\x00\x02\x40\x41\r\n"))
+	f.Fuzz(func(t *testing.T, b []byte) {
+		checkDecode(t, append([]byte("$S"), b...))
+		checkDecode(t, append([]byte("$z"), b...))
+	})
+}
+
+func FuzzDecodePreset(f *testing.F) {
+	seed := make([]byte, presetRecordSize-2, presetRecordSize)
+	seed[1] = 3
+	seed[2] = 0x01
+	copy(seed[3:15], "Airband")
+	binary.LittleEndian.PutUint32(seed[17:21], 118000)
+	binary.LittleEndian.PutUint32(seed[21:25], 137000)
+	seed[27] = byte(0x88) // -120 dBm
+	seed[28] = 1
+	seed[31] = 0x42
+	f.Add(append(seed, "\r\n"...))
+	f.Fuzz(func(t *testing.T, b []byte) {
+		checkDecode(t, append([]byte("$P"), b...))
+	})
+}
+
+func FuzzDecodeScreen(f *testing.F) {
+	f.Add(append(bytes.Repeat([]byte{0x0d, 0x0a}, screenImageSize/2), "\r\n"...))
+	f.Fuzz(func(t *testing.T, b []byte) {
+		checkDecode(t, append([]byte("$D"), b...))
+	})
+}
+
+func FuzzDecodeConfig(f *testing.F) {
+	f.Add([]byte("2400000,0089286,-010,-120,0112,0,000,2350000,2550000,0100000,00110,0000,000\r\n"))
+	f.Add([]byte("2400000,0089286\r\n"))
+	f.Add([]byte(",,,,,,,,,,,,\r\n#C2-M:"))
+	f.Fuzz(func(t *testing.T, b []byte) {
+		checkDecode(t, append([]byte("#C2-F:"), b...))
+	})
+}
+
+func TestDialShare(t *testing.T) {
+	port, dev := newFakePort()
+	go func() {
+		for cmd := range port.written {
+			if string(cmd) == "#\x04C0" {
+				io.WriteString(dev, "#C2-F:2400000,0089286,-010,-120,0112,0,000,2350000,2550000,0100000,00110,0000,000\r\n")
+			}
+		}
+	}()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go Share(l, port)
+
+	rfe, err := Dial("tcp://"+l.Addr().String(), WithTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rfe.Close()
+	if c := rfe.Config(); c == nil || c.StartFreqKHZ != 2400000 {
+		t.Errorf("unexpected config %+v", c)
+	}
+	// A second client is turned away while the first is connected.
+	if _, err := Dial("tcp://"+l.Addr().String(), WithTimeout(200*time.Millisecond)); err == nil {
+		t.Error("expected the second client to fail")
+	}
+	if _, err := Dial("localhost:1234"); err == nil {
+		t.Error("expected an error for an address without tcp://")
+	}
+}
+
+func TestListSysfsPorts(t *testing.T) {
+	root := t.TempDir()
+	usb := filepath.Join(root, "devices", "usb1", "1-1")
+	port := filepath.Join(usb, "1-1:1.0", "ttyUSB0")
+	if err := os.MkdirAll(port, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, value := range map[string]string{
+		"idVendor":  "10c4\n",
+		"idProduct": "ea60\n",
+		"product":   "CP2102 USB to UART Bridge Controller\n",
+		"serial":    "0001\n",
+	} {
+		if err := os.WriteFile(filepath.Join(usb, name), []byte(value), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, tty := range []string{"ttyUSB0", "ttyACM0"} {
+		if err := os.MkdirAll(filepath.Join(root, "class", "tty", tty), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(port, filepath.Join(root, "class", "tty", "ttyUSB0", "device")); err != nil {
+		t.Fatal(err)
+	}
+
+	ports, err := listSysfsPorts(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ports) != 2 {
+		t.Fatalf("Expected 2 ports, got %+v", ports)
+	}
+	exp := PortInfo{Name: "/dev/ttyUSB0", VID: 0x10c4, PID: 0xea60, Product: "CP2102 USB to UART Bridge Controller", Serial: "0001"}
+	if ports[0] != exp {
+		t.Errorf("Expected %+v, got %+v", exp, ports[0])
+	}
+	if !ports[0].IsRFExplorer() {
+		t.Error("Expected the CP210x port to be a likely RF Explorer")
+	}
+	if exp := (PortInfo{Name: "/dev/ttyACM0"}); ports[1] != exp {
+		t.Errorf("Expected %+v, got %+v", exp, ports[1])
+	}
+	if ports[1].IsRFExplorer() {
+		t.Error("Expected a port without USB IDs not to be an RF Explorer")
+	}
+}
@@ -0,0 +1,233 @@
+package rfx
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// commandGap is the minimum time between commands. The firmware can
+	// drop or misparse a command that arrives while it's still handling
+	// the previous one.
+	commandGap = 20 * time.Millisecond
+	// configGap is the time the device needs to apply a new analyzer
+	// configuration before it reliably accepts another command.
+	configGap = 500 * time.Millisecond
+	// presetGap is the time the device needs to store a preset in flash.
+	presetGap = 100 * time.Millisecond
+)
+
+// command is a queued write to the device.
+type command struct {
+	data []byte
+	// key identifies commands that set the same thing. A queued command
+	// is replaced by a later one with the same key since only the last
+	// would have any effect.
+	key  string
+	gap  time.Duration
+	ack  func(Packet) bool
+	done []chan error
+	// waiters are registered as the command is written so that they only
+	// match responses to it.
+	waiters []*waiter
+}
+
+// commandQueue holds the commands waiting to be written to the device.
+type commandQueue struct {
+	mu      sync.Mutex
+	pending []*command
+	busy    bool // a command is being written or waited on
+	flushed []chan struct{}
+	wake    chan struct{}
+}
+
+// commandTiming returns the coalescing key of a command, the gap needed
+// after it, and the packet that acknowledges it if any. When the device
+// acknowledges a command the gap is cut short to commandGap.
+func commandTiming(data []byte) (key string, gap time.Duration, ack func(Packet) bool) {
+	if len(data) < 3 || data[0] != '#' {
+		return "", commandGap, nil
+	}
+	cmd := string(data[2:])
+	switch {
+	case strings.HasPrefix(cmd, "C2-F:"):
+		return "config", configGap, isConfig
+	case strings.HasPrefix(cmd, "CJ"), strings.HasPrefix(cmd, "Cj"):
+		return "sweep-points", commandGap, nil
+	case strings.HasPrefix(cmd, "Cp"):
+		return "dsp", commandGap, nil
+	case strings.HasPrefix(cmd, "C+"):
+		return "calculator", commandGap, nil
+	case strings.HasPrefix(cmd, "CP\x01"):
+		return "", presetGap, nil
+	case cmd == "L0", cmd == "L1":
+		return "lcd", commandGap, nil
+	case cmd == "D0", cmd == "D1":
+		return "screen-dump", commandGap, nil
+	}
+	return "", commandGap, nil
+}
+
+func isConfig(p Packet) bool {
+	_, ok := p.(*CurrentConfigPacket)
+	return ok
+}
+
+// write queues b to be written to the device and waits until it has been
+// written, or replaced by a later command with the same effect. If w isn't
+// nil it's registered just before the command, or the one replacing it, is
+// written.
+func (r *RFExplorer) write(b []byte, w *waiter) error {
+	key, gap, ack := commandTiming(b)
+	done := make(chan error, 1)
+	q := &r.queue
+	q.mu.Lock()
+	coalesced := false
+	if key != "" {
+		for _, c := range q.pending {
+			if c.key == key {
+				c.data = append(c.data[:0], b...)
+				c.done = append(c.done, done)
+				if w != nil {
+					c.waiters = append(c.waiters, w)
+				}
+				coalesced = true
+				break
+			}
+		}
+	}
+	if !coalesced {
+		c := &command{
+			data: append([]byte(nil), b...),
+			key:  key,
+			gap:  gap,
+			ack:  ack,
+			done: []chan error{done},
+		}
+		if w != nil {
+			c.waiters = []*waiter{w}
+		}
+		q.pending = append(q.pending, c)
+	}
+	q.mu.Unlock()
+	signal(q.wake)
+
+	select {
+	case err := <-done:
+		return err
+	case <-r.closeCh:
+		return errClosed
+	}
+}
+
+// Flush waits until every queued command has been written and the device
+// has had the time it needs to handle them.
+func (r *RFExplorer) Flush(ctx context.Context) error {
+	q := &r.queue
+	q.mu.Lock()
+	if len(q.pending) == 0 && !q.busy {
+		q.mu.Unlock()
+		return nil
+	}
+	ch := make(chan struct{})
+	q.flushed = append(q.flushed, ch)
+	q.mu.Unlock()
+	select {
+	case <-ch:
+		return nil
+	case <-r.closeCh:
+		return errClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// QueueDepth returns the number of commands waiting to be written to the
+// device.
+func (r *RFExplorer) QueueDepth() int {
+	r.queue.mu.Lock()
+	defer r.queue.mu.Unlock()
+	return len(r.queue.pending)
+}
+
+// writeLoop writes queued commands to the device, leaving the gap each one
+// needs before the next or, for commands the device acknowledges, until
+// the acknowledgement arrives.
+func (r *RFExplorer) writeLoop() {
+	q := &r.queue
+	for {
+		q.mu.Lock()
+		if len(q.pending) == 0 {
+			q.busy = false
+			for _, ch := range q.flushed {
+				close(ch)
+			}
+			q.flushed = nil
+			q.mu.Unlock()
+			select {
+			case <-q.wake:
+				continue
+			case <-r.closeCh:
+				return
+			}
+		}
+		c := q.pending[0]
+		q.pending = q.pending[1:]
+		q.busy = true
+		q.mu.Unlock()
+
+		var ack *waiter
+		if c.ack != nil {
+			// Registered before writing so that a quick response isn't
+			// missed.
+			ack = r.waiters.add(c.ack)
+		}
+		for _, w := range c.waiters {
+			r.waiters.insert(w)
+		}
+		var err error
+		r.trace.frame(time.Now(), "TX", "command", c.data)
+		if n, werr := r.getPort().Write(c.data); werr != nil {
+			err = fmt.Errorf("rfx: failed to write to port: %s", werr)
+		} else if n != len(c.data) {
+			err = fmt.Errorf("rfx: expected to write %d bytes but wrote %d", len(c.data), n)
+		}
+		if err != nil {
+			r.trace.log().Error("failed to send command", "command", fmt.Sprintf("%q", c.data), "err", err)
+		} else {
+			r.trace.log().Debug("sent command", "command", fmt.Sprintf("%q", c.data))
+		}
+		for _, done := range c.done {
+			done <- err
+		}
+		gap := c.gap
+		if ack != nil {
+			ackCh := ack.ch
+			if err != nil {
+				// Nothing to acknowledge, wait out the gap.
+				ackCh = nil
+			}
+			t := time.NewTimer(gap)
+			select {
+			case <-ackCh:
+				t.Stop()
+				gap = commandGap
+			case <-t.C:
+				gap = 0
+			case <-r.closeCh:
+				t.Stop()
+				r.waiters.remove(ack)
+				return
+			}
+			r.waiters.remove(ack)
+		}
+		select {
+		case <-time.After(gap):
+		case <-r.closeCh:
+			return
+		}
+	}
+}
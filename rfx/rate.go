@@ -0,0 +1,89 @@
+package rfx
+
+import (
+	"sync"
+	"time"
+)
+
+// sweepHistory is the number of sweep intervals kept for SweepRate.
+const sweepHistory = 128
+
+// SweepRate is the rate at which sweeps have recently been received.
+type SweepRate struct {
+	// SweepsPerSecond is the mean rate over the recent sweeps.
+	SweepsPerSecond float64
+	// Mean, Min, and Max are statistics of the time between sweeps.
+	Mean time.Duration
+	Min  time.Duration
+	Max  time.Duration
+	// Intervals is the time between each of the recent sweeps, oldest first.
+	Intervals []time.Duration
+}
+
+// rateMeter records when sweeps are received.
+type rateMeter struct {
+	mu        sync.Mutex
+	last      time.Time
+	intervals []time.Duration // ring buffer
+	next      int
+}
+
+func (m *rateMeter) add(t time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.last.IsZero() {
+		d := t.Sub(m.last)
+		if len(m.intervals) < sweepHistory {
+			m.intervals = append(m.intervals, d)
+		} else {
+			m.intervals[m.next] = d
+			m.next = (m.next + 1) % sweepHistory
+		}
+	}
+	m.last = t
+}
+
+// reset forgets the history, for instance when the configuration changes
+// and the old rate no longer applies.
+func (m *rateMeter) reset() {
+	m.mu.Lock()
+	m.last = time.Time{}
+	m.intervals = m.intervals[:0]
+	m.next = 0
+	m.mu.Unlock()
+}
+
+func (m *rateMeter) rate() SweepRate {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var r SweepRate
+	if len(m.intervals) == 0 {
+		return r
+	}
+	r.Intervals = make([]time.Duration, 0, len(m.intervals))
+	r.Intervals = append(r.Intervals, m.intervals[m.next:]...)
+	r.Intervals = append(r.Intervals, m.intervals[:m.next]...)
+	var sum time.Duration
+	r.Min = r.Intervals[0]
+	for _, d := range r.Intervals {
+		sum += d
+		if d < r.Min {
+			r.Min = d
+		}
+		if d > r.Max {
+			r.Max = d
+		}
+	}
+	r.Mean = sum / time.Duration(len(r.Intervals))
+	if r.Mean > 0 {
+		r.SweepsPerSecond = float64(time.Second) / float64(r.Mean)
+	}
+	return r
+}
+
+// SweepRate returns the rate at which sweeps have been received since the
+// last configuration change, to verify that a configuration delivers the
+// refresh rate that's needed.
+func (r *RFExplorer) SweepRate() SweepRate {
+	return r.sweepRate.rate()
+}
@@ -0,0 +1,102 @@
+package rfx
+
+import (
+	"time"
+)
+
+// maxReconnectBackoff is the longest WithAutoReconnect waits between
+// attempts to reopen the port.
+const maxReconnectBackoff = 30 * time.Second
+
+// ReconnectedPacket is sent on Chan after the connection was lost and the
+// port reopened. Anything the device reported before may be stale so
+// clients should resync their state, the device sends its configuration
+// again shortly after.
+type ReconnectedPacket struct {
+	// Err is why the connection was lost.
+	Err error
+	// Attempts is the number of times the port was opened.
+	Attempts int
+	// Downtime is how long the connection was lost for.
+	Downtime time.Duration
+}
+
+func (p *ReconnectedPacket) Type() string {
+	return "Reconnected"
+}
+
+// setReconnect makes the reader reopen the port with reopen if it's lost,
+// waiting backoff before the first attempt.
+func (r *RFExplorer) setReconnect(reopen func() (Transport, error), backoff time.Duration) {
+	r.portMu.Lock()
+	defer r.portMu.Unlock()
+	r.reopen = reopen
+	r.backoff = backoff
+}
+
+func (r *RFExplorer) getPort() Transport {
+	r.portMu.Lock()
+	defer r.portMu.Unlock()
+	return r.port
+}
+
+// reconnect reopens the port after reading from it failed with cause. It
+// returns cause if reconnecting isn't enabled and errClosed if the
+// connection was closed while waiting to reconnect. Once reopened the last
+// analyzer configuration is sent again, or requested if none was set.
+func (r *RFExplorer) reconnect(cause error) error {
+	r.portMu.Lock()
+	reopen, backoff := r.reopen, r.backoff
+	old := r.port
+	r.portMu.Unlock()
+	if reopen == nil {
+		return cause
+	}
+	old.Close()
+
+	lostAt := time.Now()
+	attempts := 0
+	for {
+		select {
+		case <-time.After(backoff):
+		case <-r.closeCh:
+			return errClosed
+		}
+		attempts++
+		port, err := reopen()
+		if err == nil {
+			r.portMu.Lock()
+			select {
+			case <-r.closeCh:
+				// Closed while opening, Close won't see this port.
+				r.portMu.Unlock()
+				port.Close()
+				return errClosed
+			default:
+			}
+			r.port = port
+			r.portMu.Unlock()
+			break
+		}
+		r.trace.log().Debug("failed to reconnect", "attempt", attempts, "err", err)
+		if backoff *= 2; backoff > maxReconnectBackoff {
+			backoff = maxReconnectBackoff
+		}
+	}
+
+	downtime := time.Since(lostAt)
+	r.trace.log().Info("reconnected", "cause", cause, "attempts", attempts, "downtime", downtime)
+	r.handlePacket(&ReconnectedPacket{
+		Err:      cause,
+		Attempts: attempts,
+		Downtime: downtime,
+	})
+	// A write error here will show up as a read error too, so it's left to
+	// the next attempt.
+	if cmd, ok := r.lastConfig.Load().(string); ok {
+		r.SendCommand(cmd)
+	} else {
+		r.RequestConfig()
+	}
+	return nil
+}
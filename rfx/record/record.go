@@ -0,0 +1,312 @@
+// Package record records sessions with an RF Explorer to a compact binary
+// file and plays them back as a device, for offline analysis and for
+// demonstrating tools without hardware.
+//
+// A recording is everything the device sent, in the chunks it was read in
+// and timestamped, so playing it back goes through the same decoder as a
+// live device and yields the same packets:
+//
+//	"RFXREC01"                      magic
+//	<int64 big endian>              start time in Unix nanoseconds
+//	{ <uvarint> <uvarint> <bytes> } nanoseconds since the previous chunk
+//	                                (or the start), length, and data of
+//	                                each chunk
+package record
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/samuel/rfexplorer/rfx"
+)
+
+const magic = "RFXREC01"
+
+// maxChunk is the largest chunk Play accepts, larger ones mean the file is
+// corrupt.
+const maxChunk = 1 << 20
+
+// Recorder writes a recording. It's an io.Writer to be passed to
+// RFExplorer.SetCapture, each write is recorded as a chunk received at the
+// time of the write.
+type Recorder struct {
+	mu   sync.Mutex
+	w    io.Writer
+	last time.Time
+	buf  []byte
+	err  error
+}
+
+// NewRecorder writes the header of a recording to w and returns a Recorder
+// for the rest.
+func NewRecorder(w io.Writer) (*Recorder, error) {
+	now := time.Now()
+	hdr := make([]byte, len(magic)+8)
+	copy(hdr, magic)
+	binary.BigEndian.PutUint64(hdr[len(magic):], uint64(now.UnixNano()))
+	if _, err := w.Write(hdr); err != nil {
+		return nil, err
+	}
+	return &Recorder{w: w, last: now}, nil
+}
+
+// Write records b as received now. Once writing to the underlying writer
+// fails every later write returns the same error.
+func (r *Recorder) Write(b []byte) (int, error) {
+	now := time.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return 0, r.err
+	}
+	delta := now.Sub(r.last)
+	if delta < 0 {
+		delta = 0
+	}
+	r.last = now
+	r.buf = binary.AppendUvarint(r.buf[:0], uint64(delta))
+	r.buf = binary.AppendUvarint(r.buf, uint64(len(b)))
+	r.buf = append(r.buf, b...)
+	if _, err := r.w.Write(r.buf); err != nil {
+		r.err = err
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Err returns the error that writing the recording failed with, if any.
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// PlayOptions configures Play.
+type PlayOptions struct {
+	// Speed is how many times faster than real time to play, 1 if 0.
+	// math.Inf(1) plays without any delays.
+	Speed float64
+	// Loop starts over when the recording ends instead of ending the
+	// connection. It needs a reader that's an io.Seeker.
+	Loop bool
+	// Options are passed to rfx.NewWithTransport.
+	Options []rfx.Option
+}
+
+// Player is an *rfx.RFExplorer connected to a recording instead of a
+// device. Packets are timestamped with the time they were recorded. When a
+// recording that isn't looped ends the connection is lost as if the device
+// was unplugged, see RFExplorer.Errors.
+//
+// Commands are accepted and ignored, except that requests for the
+// configuration, including setting a new one, are answered with the last
+// configuration played so that they don't time out. The recording doesn't
+// change so sweeps continue as recorded.
+type Player struct {
+	*rfx.RFExplorer
+}
+
+// Play starts playing a recording and waits for its first configuration
+// like rfx.New waits for a device's.
+func Play(r io.Reader, opts PlayOptions) (*Player, error) {
+	if opts.Speed == 0 {
+		opts.Speed = 1
+	}
+	if opts.Speed < 0 {
+		return nil, fmt.Errorf("record: invalid speed %g", opts.Speed)
+	}
+	var seeker io.Seeker
+	if opts.Loop {
+		var ok bool
+		if seeker, ok = r.(io.Seeker); !ok {
+			return nil, errors.New("record: looping needs a reader that can seek")
+		}
+	}
+	t := &transport{
+		src:    r,
+		seeker: seeker,
+		speed:  opts.Speed,
+		inject: make(chan []byte, 4),
+		closed: make(chan struct{}),
+	}
+	if err := t.rewind(); err != nil {
+		return nil, err
+	}
+	rfe, err := rfx.NewWithTransport(t, opts.Options...)
+	if err != nil {
+		return nil, err
+	}
+	t.rfe.Store(rfe)
+	return &Player{RFExplorer: rfe}, nil
+}
+
+// transport feeds a recording to the reader at the recorded pace.
+type transport struct {
+	src    io.Reader
+	seeker io.Seeker
+	speed  float64
+	inject chan []byte
+	closed chan struct{}
+	once   sync.Once
+	rfe    atomic.Value // *rfx.RFExplorer, once started
+
+	// Only used by Read.
+	r         *bufio.Reader
+	startTime time.Time     // when the recording started
+	offset    time.Duration // of the last chunk read
+	playStart time.Time     // when playing from the start of the file began
+	held      []byte        // next chunk, waiting until it's due
+	heldAt    time.Duration
+	pending   []byte // what's left of the chunk or response being read
+	received  time.Time
+}
+
+// rewind reads the header at the start of the recording.
+func (t *transport) rewind() error {
+	if t.seeker != nil {
+		if _, err := t.seeker.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+	}
+	t.r = bufio.NewReader(t.src)
+	hdr := make([]byte, len(magic)+8)
+	if _, err := io.ReadFull(t.r, hdr); err != nil {
+		return fmt.Errorf("record: failed to read header: %s", err)
+	}
+	if !bytes.Equal(hdr[:len(magic)], []byte(magic)) {
+		return errors.New("record: not a recording")
+	}
+	t.startTime = time.Unix(0, int64(binary.BigEndian.Uint64(hdr[len(magic):])))
+	t.offset = 0
+	t.playStart = time.Now()
+	return nil
+}
+
+// next reads the next chunk. It returns io.EOF at the end of a recording
+// that isn't looped.
+func (t *transport) next() (time.Duration, []byte, error) {
+	for rewound := false; ; rewound = true {
+		delta, err := binary.ReadUvarint(t.r)
+		if err == io.EOF && t.seeker != nil && !rewound {
+			if err := t.rewind(); err != nil {
+				return 0, nil, err
+			}
+			continue
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+		size, err := binary.ReadUvarint(t.r)
+		if err != nil {
+			return 0, nil, io.ErrUnexpectedEOF
+		}
+		if size > maxChunk {
+			return 0, nil, fmt.Errorf("record: chunk of %d bytes, the recording is corrupt", size)
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(t.r, data); err != nil {
+			return 0, nil, io.ErrUnexpectedEOF
+		}
+		t.offset += time.Duration(delta)
+		return t.offset, data, nil
+	}
+}
+
+func (t *transport) Read(b []byte) (int, error) {
+	if len(t.pending) == 0 {
+		if t.held == nil {
+			offset, data, err := t.next()
+			if err != nil {
+				return 0, err
+			}
+			t.heldAt, t.held = offset, data
+		}
+		var wait <-chan time.Time
+		if !math.IsInf(t.speed, 1) {
+			due := t.playStart.Add(time.Duration(float64(t.heldAt) / t.speed))
+			timer := time.NewTimer(time.Until(due))
+			defer timer.Stop()
+			wait = timer.C
+		} else {
+			ch := make(chan time.Time)
+			close(ch)
+			wait = ch
+		}
+		// Requests are answered before the next chunk is due.
+		select {
+		case resp := <-t.inject:
+			t.pending = resp
+			t.received = t.now()
+		default:
+			select {
+			case resp := <-t.inject:
+				t.pending = resp
+				t.received = t.now()
+			case <-wait:
+				t.pending, t.held = t.held, nil
+				t.received = t.startTime.Add(t.heldAt)
+			case <-t.closed:
+				return 0, io.EOF
+			}
+		}
+	}
+	n := copy(b, t.pending)
+	t.pending = t.pending[n:]
+	return n, nil
+}
+
+// now returns the current time in the recording, which is no later than
+// the next chunk.
+func (t *transport) now() time.Time {
+	if math.IsInf(t.speed, 1) {
+		return t.startTime.Add(t.heldAt)
+	}
+	elapsed := time.Duration(float64(time.Since(t.playStart)) * t.speed)
+	if elapsed > t.heldAt {
+		elapsed = t.heldAt
+	}
+	return t.startTime.Add(elapsed)
+}
+
+// ReceiveTime implements rfx.ReceiveTimer so that packets get the time they
+// were recorded.
+func (t *transport) ReceiveTime() time.Time {
+	return t.received
+}
+
+// Write answers requests for the configuration and discards everything
+// else.
+func (t *transport) Write(b []byte) (int, error) {
+	if len(b) < 4 || b[0] != '#' {
+		return len(b), nil
+	}
+	cmd := string(b[2:])
+	if cmd != "C0" && !(len(cmd) > 5 && cmd[:5] == "C2-F:") {
+		return len(b), nil
+	}
+	rfe, ok := t.rfe.Load().(*rfx.RFExplorer)
+	if !ok {
+		// Still starting, the recording will have a configuration.
+		return len(b), nil
+	}
+	if config := rfe.Config(); config != nil {
+		select {
+		case t.inject <- config.Encode():
+		default:
+		}
+	}
+	return len(b), nil
+}
+
+func (t *transport) Close() error {
+	t.once.Do(func() { close(t.closed) })
+	return nil
+}
@@ -0,0 +1,138 @@
+package record
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/samuel/rfexplorer/rfx"
+	"github.com/samuel/rfexplorer/rfx/rfxtest"
+)
+
+func TestRecordAndPlay(t *testing.T) {
+	m, err := rfxtest.New(rfxtest.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	rec, err := NewRecorder(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.SetCapture(rec)
+	if err := m.RequestConfig(); err != nil {
+		t.Fatal(err)
+	}
+	sweeps := [][]float64{{-100, -50.5, -80}, {-90, -60, -70.5}}
+	for _, s := range sweeps {
+		time.Sleep(10 * time.Millisecond)
+		m.SendSweep(s)
+	}
+	var got []*rfx.SweepDataPacket
+	timeout := time.After(5 * time.Second)
+	for len(got) < len(sweeps) {
+		select {
+		case pkt := <-m.Chan():
+			if pkt, ok := pkt.(*rfx.SweepDataPacket); ok {
+				got = append(got, pkt)
+			}
+		case <-timeout:
+			t.Fatal("timed out waiting for sweeps")
+		}
+	}
+	m.Close()
+	if err := rec.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := Play(bytes.NewReader(buf.Bytes()), PlayOptions{Speed: math.Inf(1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if c := p.Config(); c == nil || c.StartFreqKHZ != m.Config().StartFreqKHZ {
+		t.Fatalf("config %+v, want %+v", c, m.Config())
+	}
+	for i := range sweeps {
+		select {
+		case pkt := <-p.Chan():
+			sweep, ok := pkt.(*rfx.SweepDataPacket)
+			if !ok {
+				t.Fatalf("got %s, want a sweep", pkt.Type())
+			}
+			if !reflect.DeepEqual(sweep.Samples, sweeps[i]) {
+				t.Errorf("sweep %d is %v, want %v", i, sweep.Samples, sweeps[i])
+			}
+			// Playback is as fast as possible but keeps the recorded times.
+			if d := sweep.Time.Sub(got[i].Time); d < -5*time.Millisecond || d > 5*time.Millisecond {
+				t.Errorf("sweep %d received at %s, recorded at %s", i, sweep.Time, got[i].Time)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for played sweeps")
+		}
+	}
+	select {
+	case err := <-p.Errors():
+		if err == nil {
+			t.Fatal("expected the connection to be lost at the end of the recording")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection not lost at the end of the recording")
+	}
+}
+
+func TestPlayAnswersConfig(t *testing.T) {
+	m, err := rfxtest.New(rfxtest.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	rec, err := NewRecorder(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.SetCapture(rec)
+	if _, err := m.SetAnalyzerConfig(context.Background(), 2410000, 2420000, 0, -120, 0); err != nil {
+		t.Fatal(err)
+	}
+	m.SendSweep([]float64{-100, -90})
+	time.Sleep(50 * time.Millisecond)
+	m.Close()
+
+	p, err := Play(bytes.NewReader(buf.Bytes()), PlayOptions{Loop: true, Speed: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	config, err := p.SetAnalyzerConfig(ctx, 100000, 200000, 0, -120, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.StartFreqKHZ != 2410000 {
+		t.Errorf("start %d kHz, want the recorded 2410000", config.StartFreqKHZ)
+	}
+
+	// Looping plays the sweep again and again.
+	n := 0
+	for n < 3 {
+		select {
+		case pkt := <-p.Chan():
+			if _, ok := pkt.(*rfx.SweepDataPacket); ok {
+				n++
+			}
+		case <-ctx.Done():
+			t.Fatalf("got %d sweeps, want 3", n)
+		}
+	}
+}
+
+func TestPlayNotARecording(t *testing.T) {
+	if _, err := Play(bytes.NewReader([]byte("#C2-F:whatever\r\n")), PlayOptions{}); err == nil {
+		t.Fatal("expected an error")
+	}
+}
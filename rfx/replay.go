@@ -0,0 +1,104 @@
+package rfx
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// SetCapture sets a writer that receives a copy of everything read from the
+// device, or nil to stop capturing. Captures can be decoded again later
+// with Replay, for instance to check parser changes against real devices.
+func (r *RFExplorer) SetCapture(w io.Writer) {
+	r.captureMu.Lock()
+	r.captureW = w
+	r.captureMu.Unlock()
+}
+
+func (r *RFExplorer) capture(b []byte) {
+	r.captureMu.Lock()
+	if r.captureW != nil {
+		r.captureW.Write(b)
+	}
+	r.captureMu.Unlock()
+}
+
+// replayPort feeds a transcript to the reader. Writes are discarded.
+type replayPort struct {
+	r      io.Reader
+	err    error
+	done   chan struct{} // closed when the transcript has been read
+	closed chan struct{}
+	once   sync.Once
+}
+
+func (p *replayPort) Read(b []byte) (int, error) {
+	select {
+	case <-p.done:
+		<-p.closed
+		return 0, nil
+	default:
+	}
+	n, err := p.r.Read(b)
+	if err != nil {
+		if err != io.EOF {
+			p.err = err
+		}
+		close(p.done)
+	}
+	return n, nil
+}
+
+func (p *replayPort) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (p *replayPort) Close() error {
+	p.once.Do(func() { close(p.closed) })
+	return nil
+}
+
+// Replay decodes a transcript of data sent by a device, such as one
+// recorded with SetCapture, and returns the packets in it.
+func Replay(transcript io.Reader) ([]Packet, error) {
+	port := &replayPort{r: transcript, done: make(chan struct{}), closed: make(chan struct{})}
+	rfe := newRFExplorer(port)
+	defer rfe.Close()
+	var pkts []Packet
+	for {
+		select {
+		case pkt := <-rfe.Chan():
+			pkts = append(pkts, pkt)
+		case <-port.done:
+			// The reader only reads again after the previous packets
+			// have been queued so anything left is already buffered.
+			for {
+				select {
+				case pkt := <-rfe.Chan():
+					pkts = append(pkts, pkt)
+				default:
+					if port.err != nil {
+						return pkts, fmt.Errorf("rfx: failed to read transcript: %s", port.err)
+					}
+					return pkts, nil
+				}
+			}
+		}
+	}
+}
+
+// FormatPacket returns a one line description of a packet, suitable for
+// comparing decoded transcripts. Receive times are left out, as is the
+// configuration attached to sweeps and raw data since it's in the
+// transcript as a packet of its own.
+func FormatPacket(pkt Packet) string {
+	switch pkt := pkt.(type) {
+	case *SweepDataPacket:
+		return fmt.Sprintf("%s &{Samples:%v}", pkt.Type(), pkt.Samples)
+	case *RawData:
+		return fmt.Sprintf("%s &{Data:%v}", pkt.Type(), pkt.Data)
+	case *ScreenImage:
+		return fmt.Sprintf("%s &{Data:%v}", pkt.Type(), pkt.Data)
+	}
+	return fmt.Sprintf("%s %+v", pkt.Type(), pkt)
+}
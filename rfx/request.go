@@ -0,0 +1,274 @@
+package rfx
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// waiter is waiting for a packet that matches.
+type waiter struct {
+	match func(Packet) bool
+	ch    chan Packet
+}
+
+// waiters are the requests waiting for a response.
+type waiters struct {
+	mu   sync.Mutex
+	list []*waiter
+	// pending is closed while there are waiters, see wake.
+	pending chan struct{}
+}
+
+func newWaiter(match func(Packet) bool) *waiter {
+	return &waiter{match: match, ch: make(chan Packet, 1)}
+}
+
+func (ws *waiters) add(match func(Packet) bool) *waiter {
+	w := newWaiter(match)
+	ws.insert(w)
+	return w
+}
+
+func (ws *waiters) insert(w *waiter) {
+	ws.mu.Lock()
+	ws.list = append(ws.list, w)
+	ws.update()
+	ws.mu.Unlock()
+}
+
+func (ws *waiters) remove(w *waiter) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	for i, x := range ws.list {
+		if x == w {
+			ws.list = append(ws.list[:i], ws.list[i+1:]...)
+			ws.update()
+			return
+		}
+	}
+}
+
+// deliver hands pkt to the waiters it matches, which are then removed.
+func (ws *waiters) deliver(pkt Packet) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	list := ws.list[:0]
+	for _, w := range ws.list {
+		if w.match(pkt) {
+			w.ch <- pkt
+		} else {
+			list = append(list, w)
+		}
+	}
+	ws.list = list
+	ws.update()
+}
+
+// wake returns a channel that's closed while there are waiters, or once
+// there are. The reader waits on it when Chan is full so that a client that
+// isn't reading Chan doesn't hold up the responses the waiters need.
+func (ws *waiters) wake() <-chan struct{} {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if ws.pending == nil {
+		ws.pending = make(chan struct{})
+		ws.update()
+	}
+	return ws.pending
+}
+
+// update closes pending if there are waiters and replaces it if it's closed
+// and there are none. ws.mu must be held.
+func (ws *waiters) update() {
+	if ws.pending == nil {
+		return
+	}
+	closed := false
+	select {
+	case <-ws.pending:
+		closed = true
+	default:
+	}
+	switch {
+	case len(ws.list) != 0 && !closed:
+		close(ws.pending)
+	case len(ws.list) == 0 && closed:
+		ws.pending = make(chan struct{})
+	}
+}
+
+// request sends cmd and waits for the first packet that matches after it
+// has been written, so a response to an earlier command still in flight
+// isn't mistaken for its own. The packet is still sent to Chan as well, but
+// while the request waits the reader doesn't wait for Chan to be read, see
+// send.
+func (r *RFExplorer) request(ctx context.Context, cmd string, match func(Packet) bool) (Packet, error) {
+	w := newWaiter(match)
+	defer r.waiters.remove(w)
+	if err := r.sendCommand(cmd, w); err != nil {
+		return nil, err
+	}
+	select {
+	case pkt := <-w.ch:
+		return pkt, nil
+	case <-r.readDone:
+		if err := r.Err(); err != nil {
+			return nil, err
+		}
+		return nil, errClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// GetConfig requests the current configuration and waits for it.
+func (r *RFExplorer) GetConfig(ctx context.Context) (*CurrentConfigPacket, error) {
+	pkt, err := r.request(ctx, "C0", func(p Packet) bool {
+		_, ok := p.(*CurrentConfigPacket)
+		return ok
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pkt.(*CurrentConfigPacket), nil
+}
+
+// GetSetup requests the model and firmware setup and waits for it. Unlike
+// Setup it always asks the device.
+func (r *RFExplorer) GetSetup(ctx context.Context) (*CurrentSetupPacket, error) {
+	pkt, err := r.request(ctx, "C0", func(p Packet) bool {
+		_, ok := p.(*CurrentSetupPacket)
+		return ok
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pkt.(*CurrentSetupPacket), nil
+}
+
+// GetSerialNumber requests the serial number and waits for it. Unlike
+// SerialNumber it always asks the device.
+func (r *RFExplorer) GetSerialNumber(ctx context.Context) (string, error) {
+	pkt, err := r.request(ctx, "Cn", func(p Packet) bool {
+		_, ok := p.(*SerialNumberPacket)
+		return ok
+	})
+	if err != nil {
+		return "", err
+	}
+	return pkt.(*SerialNumberPacket).SN, nil
+}
+
+// GetExpansionSerialNumber requests the serial number of the expansion
+// module and waits for it.
+func (r *RFExplorer) GetExpansionSerialNumber(ctx context.Context) (string, error) {
+	pkt, err := r.request(ctx, "Ce", func(p Packet) bool {
+		_, ok := p.(*ExpansionSerialNumberPacket)
+		return ok
+	})
+	if err != nil {
+		return "", err
+	}
+	return pkt.(*ExpansionSerialNumberPacket).SN, nil
+}
+
+// GetCalibrationAvailability requests the configuration and waits for the
+// calibration availability that's sent with it. Unlike
+// CalibrationAvailability it always asks the device.
+func (r *RFExplorer) GetCalibrationAvailability(ctx context.Context) (*CalibrationAvailabilityPacket, error) {
+	pkt, err := r.request(ctx, "C0", func(p Packet) bool {
+		_, ok := p.(*CalibrationAvailabilityPacket)
+		return ok
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pkt.(*CalibrationAvailabilityPacket), nil
+}
+
+// presetCollector collects the presets the device sends in response to a
+// request for them. Its match runs on the reader for every packet before
+// the packet is sent to Chan, so it takes any number of presets without
+// reading Chan or waiting for it to be read.
+type presetCollector struct {
+	presets []*Preset
+}
+
+func (c *presetCollector) match(p Packet) bool {
+	switch p := p.(type) {
+	case *Preset:
+		c.presets = append(c.presets, p)
+	case *EndOfPresetsPacket:
+		// The device sends every slot, so an end marker before any preset
+		// is left over from an earlier write.
+		return len(c.presets) > 0
+	}
+	return false
+}
+
+// GetPresets requests the stored presets and returns them once the device
+// has sent all of them. The presets are still sent to Chan as well.
+func (r *RFExplorer) GetPresets(ctx context.Context) ([]*Preset, error) {
+	c := &presetCollector{}
+	if _, err := r.request(ctx, "CP\x00", c.match); err != nil {
+		return nil, err
+	}
+	return c.presets, nil
+}
+
+// GetPreset requests the stored presets and returns the one in a slot.
+// Indexes start at 0.
+func (r *RFExplorer) GetPreset(ctx context.Context, index int) (*Preset, error) {
+	if index < 0 || index >= r.presetSlots() {
+		return nil, fmt.Errorf("rfx: preset index %d out of range 0-%d", index, r.presetSlots()-1)
+	}
+	presets, err := r.GetPresets(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range presets {
+		if p.Index == index {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("rfx: device didn't send preset %d", index)
+}
+
+// StartTracking starts a tracking sweep like StartTrackingSweep and waits
+// for the device to report that tracking started.
+func (r *RFExplorer) StartTracking(ctx context.Context, startFreqKHZ, stepFreqKHZ int) error {
+	cmd, err := trackingSweepCommand(startFreqKHZ, stepFreqKHZ)
+	if err != nil {
+		return err
+	}
+	_, err = r.request(ctx, cmd, func(p Packet) bool {
+		pkt, ok := p.(*TrackingStatusPacket)
+		return ok && pkt.Tracking
+	})
+	return err
+}
+
+// MeasureTrackingStep moves a tracking sweep to step n and waits for the
+// sweep the device reports in response, which holds the levels measured so
+// far indexed by step. Sweeps reported before the step was sent are
+// ignored.
+func (r *RFExplorer) MeasureTrackingStep(ctx context.Context, n int) (*SweepDataPacket, error) {
+	cmd, err := trackingStepCommand(n)
+	if err != nil {
+		return nil, err
+	}
+	pkt, err := r.request(ctx, cmd, func(p Packet) bool {
+		sweep, ok := p.(*SweepDataPacket)
+		if !ok || len(sweep.Samples) == 0 {
+			return false
+		}
+		// Also sent to Chan, whose reader may release it.
+		sweep.shared = true
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pkt.(*SweepDataPacket), nil
+}
@@ -0,0 +1,120 @@
+package rfx
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CorrectionPoint is the amplitude correction at a frequency.
+type CorrectionPoint struct {
+	FreqHZ int
+	DB     float64
+}
+
+// AmplitudeCorrection is a frequency dependent amplitude offset, such as the
+// gain of an antenna or LNA or the loss of a cable, as stored in RF Explorer
+// .rfa files. The offset is added to measured levels.
+type AmplitudeCorrection struct {
+	// Points are sorted by frequency.
+	Points []CorrectionPoint
+}
+
+// ReadAmplitudeCorrection reads an .rfa file, which has a frequency in MHz
+// and a correction in dB on each line separated by a comma, tab, or spaces.
+// Blank lines and lines starting with "--" or '#' are ignored.
+func ReadAmplitudeCorrection(r io.Reader) (*AmplitudeCorrection, error) {
+	c := &AmplitudeCorrection{}
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "--") || line[0] == '#' {
+			continue
+		}
+		fields := strings.FieldsFunc(line, func(r rune) bool {
+			return r == ',' || r == ';' || r == ' ' || r == '\t'
+		})
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("rfx: line %d: expected frequency and correction", lineNo)
+		}
+		mhz, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("rfx: line %d: invalid frequency %q", lineNo, fields[0])
+		}
+		db, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("rfx: line %d: invalid correction %q", lineNo, fields[1])
+		}
+		c.Points = append(c.Points, CorrectionPoint{FreqHZ: int(mhz*1e6 + 0.5), DB: db})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(c.Points) == 0 {
+		return nil, fmt.Errorf("rfx: no amplitude corrections")
+	}
+	sort.Slice(c.Points, func(i, j int) bool { return c.Points[i].FreqHZ < c.Points[j].FreqHZ })
+	return c, nil
+}
+
+// LoadAmplitudeCorrection reads an .rfa file from path.
+func LoadAmplitudeCorrection(path string) (*AmplitudeCorrection, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	c, err := ReadAmplitudeCorrection(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return c, nil
+}
+
+// Correction returns the correction in dB at a frequency, interpolated
+// between the points on either side of it. Below the first point and above
+// the last the nearest point is used.
+func (c *AmplitudeCorrection) Correction(freqHZ int) float64 {
+	pts := c.Points
+	i := sort.Search(len(pts), func(i int) bool { return pts[i].FreqHZ >= freqHZ })
+	switch {
+	case i == 0:
+		return pts[0].DB
+	case i == len(pts):
+		return pts[len(pts)-1].DB
+	}
+	lo, hi := pts[i-1], pts[i]
+	frac := float64(freqHZ-lo.FreqHZ) / float64(hi.FreqHZ-lo.FreqHZ)
+	return lo.DB + (hi.DB-lo.DB)*frac
+}
+
+// Apply corrects the samples of a sweep taken with config in place.
+func (c *AmplitudeCorrection) Apply(config *CurrentConfigPacket, samples []float64) {
+	startHZ := config.StartFreqKHZ * 1000
+	for i := range samples {
+		samples[i] += c.Correction(startHZ + i*config.FreqStepHZ)
+	}
+}
+
+// SetAmplitudeCorrection makes the reader correct the samples of every
+// sweep before sending it to Chan, or stop correcting them if c is nil.
+func (r *RFExplorer) SetAmplitudeCorrection(c *AmplitudeCorrection) {
+	r.ampCorr.Store(&c)
+}
+
+// correctSweep applies the amplitude correction, if any, to a sweep.
+func (r *RFExplorer) correctSweep(sweep *SweepDataPacket) {
+	c, _ := r.ampCorr.Load().(**AmplitudeCorrection)
+	if c == nil || *c == nil {
+		return
+	}
+	if sweep.Config != nil {
+		(*c).Apply(sweep.Config, sweep.Samples)
+	}
+}
@@ -0,0 +1,212 @@
+// Package rfecsv reads and writes sweeps in the CSV format that RF Explorer
+// for Windows saves its sweep data in, so that captures can be opened in
+// either program:
+//
+//	RF Explorer CSV data file: <program>
+//	Start Frequency: 2400.000000MHZ
+//	Step Frequency: 1000.000000KHZ
+//	Total data entries: 2
+//	Steps per entry: 112
+//	Sweep,Date,Time,Milliseconds,2400.000,2401.000,...
+//	0,1/31/2017,23:59:01,.250,-98.5,-101.0,...
+//	1,1/31/2017,23:59:01,.500,-99.0,-100.5,...
+//
+// Dates and times are local, frequencies are in MHz, and levels in dBm.
+// The binary .rfe format isn't supported as it isn't documented.
+package rfecsv
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/samuel/rfexplorer/rfx"
+)
+
+// header starts the first line of a file.
+const header = "RF Explorer CSV data file: "
+
+// Sweep is a sweep and the time it was received.
+type Sweep struct {
+	Time    time.Time
+	Samples []float64
+}
+
+// File is a series of sweeps of the same range.
+type File struct {
+	// Program identifies the program that saved the file.
+	Program     string
+	StartFreqHZ int
+	StepHZ      int
+	Sweeps      []*Sweep
+}
+
+// FreqHZ returns the frequency of sample i.
+func (f *File) FreqHZ(i int) int {
+	return f.StartFreqHZ + i*f.StepHZ
+}
+
+// Add appends a sweep received from a device. The first sweep sets the
+// range of the file, later sweeps of a different range are rejected since
+// the format can't describe them.
+func (f *File) Add(pkt *rfx.SweepDataPacket) error {
+	if pkt.Config == nil {
+		return fmt.Errorf("rfecsv: sweep has no config")
+	}
+	startHZ := pkt.Config.StartFreqKHZ * 1000
+	if len(f.Sweeps) == 0 {
+		f.StartFreqHZ = startHZ
+		f.StepHZ = pkt.Config.FreqStepHZ
+	} else if startHZ != f.StartFreqHZ || pkt.Config.FreqStepHZ != f.StepHZ || len(pkt.Samples) != len(f.Sweeps[0].Samples) {
+		return fmt.Errorf("rfecsv: sweep of %d steps of %d Hz from %d Hz doesn't match the file's %d steps of %d Hz from %d Hz",
+			len(pkt.Samples), pkt.Config.FreqStepHZ, startHZ, len(f.Sweeps[0].Samples), f.StepHZ, f.StartFreqHZ)
+	}
+	samples := make([]float64, len(pkt.Samples))
+	copy(samples, pkt.Samples)
+	f.Sweeps = append(f.Sweeps, &Sweep{Time: pkt.Time, Samples: samples})
+	return nil
+}
+
+// Write writes f to w. All sweeps must have the same number of samples.
+func Write(w io.Writer, f *File) error {
+	steps := 0
+	if len(f.Sweeps) != 0 {
+		steps = len(f.Sweeps[0].Samples)
+	}
+	program := f.Program
+	if program == "" {
+		program = "github.com/samuel/rfexplorer"
+	}
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "%s%s\r\n", header, program)
+	fmt.Fprintf(bw, "Start Frequency: %.6fMHZ\r\n", float64(f.StartFreqHZ)/1e6)
+	fmt.Fprintf(bw, "Step Frequency: %.6fKHZ\r\n", float64(f.StepHZ)/1e3)
+	fmt.Fprintf(bw, "Total data entries: %d\r\n", len(f.Sweeps))
+	fmt.Fprintf(bw, "Steps per entry: %d\r\n", steps)
+	cw := csv.NewWriter(bw)
+	cw.UseCRLF = true
+	rec := make([]string, 0, 4+steps)
+	rec = append(rec, "Sweep", "Date", "Time", "Milliseconds")
+	for i := 0; i < steps; i++ {
+		rec = append(rec, strconv.FormatFloat(float64(f.FreqHZ(i))/1e6, 'f', 3, 64))
+	}
+	cw.Write(rec)
+	for n, s := range f.Sweeps {
+		if len(s.Samples) != steps {
+			return fmt.Errorf("rfecsv: sweep %d has %d samples, expected %d", n, len(s.Samples), steps)
+		}
+		t := s.Time.Local()
+		rec = append(rec[:0],
+			strconv.Itoa(n),
+			t.Format("1/2/2006"),
+			t.Format("15:04:05"),
+			t.Format(".000"))
+		for _, v := range s.Samples {
+			rec = append(rec, strconv.FormatFloat(v, 'f', 1, 64))
+		}
+		cw.Write(rec)
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// dateLayouts are the date formats accepted when reading, since RF Explorer
+// for Windows writes dates in the format of the system's locale.
+var dateLayouts = []string{"1/2/2006", "2006-01-02", "2006/01/02", "2.1.2006"}
+
+// Read reads a file saved by RF Explorer for Windows or by Write.
+func Read(r io.Reader) (*File, error) {
+	br := bufio.NewReader(r)
+	f := &File{}
+	var steps, entries int
+	for i := 0; i < 5; i++ {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("rfecsv: failed to read header: %s", err)
+		}
+		line = strings.TrimRight(line, "\r\n")
+		key, value, ok := strings.Cut(line, ": ")
+		if !ok {
+			return nil, fmt.Errorf("rfecsv: invalid header line %q", line)
+		}
+		switch key + ": " {
+		case header:
+			f.Program = value
+		case "Start Frequency: ":
+			mhz, err := strconv.ParseFloat(strings.TrimSuffix(value, "MHZ"), 64)
+			if err != nil {
+				return nil, fmt.Errorf("rfecsv: invalid start frequency %q", value)
+			}
+			f.StartFreqHZ = int(math.Round(mhz * 1e6))
+		case "Step Frequency: ":
+			khz, err := strconv.ParseFloat(strings.TrimSuffix(value, "KHZ"), 64)
+			if err != nil {
+				return nil, fmt.Errorf("rfecsv: invalid step frequency %q", value)
+			}
+			f.StepHZ = int(math.Round(khz * 1e3))
+		case "Total data entries: ":
+			if entries, err = strconv.Atoi(value); err != nil {
+				return nil, fmt.Errorf("rfecsv: invalid number of entries %q", value)
+			}
+		case "Steps per entry: ":
+			if steps, err = strconv.Atoi(value); err != nil {
+				return nil, fmt.Errorf("rfecsv: invalid number of steps %q", value)
+			}
+		default:
+			return nil, fmt.Errorf("rfecsv: unknown header line %q", line)
+		}
+	}
+
+	cr := csv.NewReader(br)
+	cr.FieldsPerRecord = 4 + steps
+	if _, err := cr.Read(); err != nil {
+		return nil, fmt.Errorf("rfecsv: failed to read column names: %s", err)
+	}
+	for line := 7; ; line++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("rfecsv: %s", err)
+		}
+		s := &Sweep{Samples: make([]float64, steps)}
+		if s.Time, err = parseTime(rec[1], rec[2], rec[3]); err != nil {
+			return nil, fmt.Errorf("rfecsv: line %d: %s", line, err)
+		}
+		for i, v := range rec[4:] {
+			if s.Samples[i], err = strconv.ParseFloat(v, 64); err != nil {
+				return nil, fmt.Errorf("rfecsv: line %d: %s", line, err)
+			}
+		}
+		f.Sweeps = append(f.Sweeps, s)
+	}
+	if len(f.Sweeps) != entries {
+		return nil, fmt.Errorf("rfecsv: read %d sweeps, header says %d", len(f.Sweeps), entries)
+	}
+	return f, nil
+}
+
+// parseTime parses the local time of a sweep from its date, time, and
+// milliseconds columns.
+func parseTime(date, clock, ms string) (time.Time, error) {
+	for _, layout := range dateLayouts {
+		t, err := time.ParseInLocation(layout+" 15:04:05", date+" "+clock, time.Local)
+		if err != nil {
+			continue
+		}
+		frac, err := strconv.ParseFloat(ms, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid milliseconds %q", ms)
+		}
+		return t.Add(time.Duration(math.Round(frac*1000)) * time.Millisecond), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid date and time %q %q", date, clock)
+}
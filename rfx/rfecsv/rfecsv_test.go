@@ -0,0 +1,78 @@
+package rfecsv
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samuel/rfexplorer/rfx"
+)
+
+func TestWriteRead(t *testing.T) {
+	config := &rfx.CurrentConfigPacket{StartFreqKHZ: 2400000, FreqStepHZ: 1000000, SweepSteps: 3}
+	start := time.Date(2017, 1, 31, 23, 59, 1, 250e6, time.Local)
+	f := &File{}
+	for i, samples := range [][]float64{{-98.5, -101, -60}, {-99, -100.5, -61.5}} {
+		pkt := &rfx.SweepDataPacket{Config: config, Time: start.Add(time.Duration(i) * 250 * time.Millisecond), Samples: samples}
+		if err := f.Add(pkt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	other := &rfx.CurrentConfigPacket{StartFreqKHZ: 2410000, FreqStepHZ: 1000000, SweepSteps: 3}
+	if err := f.Add(&rfx.SweepDataPacket{Config: other, Samples: []float64{-100, -100, -100}}); err == nil {
+		t.Error("expected a sweep of another range to be rejected")
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, f); err != nil {
+		t.Fatal(err)
+	}
+	want := "RF Explorer CSV data file: github.com/samuel/rfexplorer\r\n" +
+		"Start Frequency: 2400.000000MHZ\r\n" +
+		"Step Frequency: 1000.000000KHZ\r\n" +
+		"Total data entries: 2\r\n" +
+		"Steps per entry: 3\r\n" +
+		"Sweep,Date,Time,Milliseconds,2400.000,2401.000,2402.000\r\n" +
+		"0,1/31/2017,23:59:01,.250,-98.5,-101.0,-60.0\r\n" +
+		"1,1/31/2017,23:59:01,.500,-99.0,-100.5,-61.5\r\n"
+	if buf.String() != want {
+		t.Fatalf("wrote\n%s\nwant\n%s", buf.String(), want)
+	}
+
+	got, err := Read(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Program = "github.com/samuel/rfexplorer"
+	if !reflect.DeepEqual(got, f) {
+		t.Fatalf("read %+v, want %+v", got, f)
+	}
+}
+
+func TestReadVendor(t *testing.T) {
+	// As saved by RF Explorer for Windows with an ISO date locale.
+	in := "RF Explorer CSV data file: RF Explorer PC Client\r\n" +
+		"Start Frequency: 433.000000MHZ\r\n" +
+		"Step Frequency: 12.500000KHZ\r\n" +
+		"Total data entries: 1\r\n" +
+		"Steps per entry: 2\r\n" +
+		"Sweep,Date,Time,Milliseconds,0433.000,0433.013\r\n" +
+		"0,2017-02-01,08:15:30,.042,-110.5,-47.0\r\n"
+	f, err := Read(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.StartFreqHZ != 433000000 || f.StepHZ != 12500 || f.FreqHZ(1) != 433012500 {
+		t.Errorf("range %d + n * %d Hz, want 433000000 + n * 12500 Hz", f.StartFreqHZ, f.StepHZ)
+	}
+	wantTime := time.Date(2017, 2, 1, 8, 15, 30, 42e6, time.Local)
+	if len(f.Sweeps) != 1 || !f.Sweeps[0].Time.Equal(wantTime) || !reflect.DeepEqual(f.Sweeps[0].Samples, []float64{-110.5, -47}) {
+		t.Errorf("sweeps %+v", f.Sweeps)
+	}
+
+	if _, err := Read(strings.NewReader(strings.Replace(in, "Total data entries: 1", "Total data entries: 2", 1))); err == nil {
+		t.Error("expected an error for a missing sweep")
+	}
+}
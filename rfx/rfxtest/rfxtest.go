@@ -0,0 +1,316 @@
+// Package rfxtest provides an emulated RF Explorer analyzer for testing
+// code that uses package rfx without hardware.
+package rfxtest
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/samuel/rfexplorer/rfx"
+)
+
+// MockExplorer is an *rfx.RFExplorer connected to an emulated analyzer over
+// an in-memory transport. Since the library talks the serial protocol to
+// it as it would to a device, everything built on rfx behaves as it does
+// with hardware.
+//
+// The emulated analyzer answers configuration, serial number, and preset
+// requests and applies analyzer configurations. Other responses can be
+// scripted with Respond, and sweeps are sent with SendSweep.
+type MockExplorer struct {
+	*rfx.RFExplorer
+	dev *device
+}
+
+// Options describes the emulated device. The zero value is a WSUB3G with
+// firmware 1.26 and no expansion module.
+type Options struct {
+	Model rfx.Model
+	// ExpansionModel is the model of the expansion module, none if nil.
+	ExpansionModel  *rfx.Model
+	FirmwareVersion string
+	SerialNumber    string
+	// SweepSteps is the number of points in a sweep, 112 if 0.
+	SweepSteps int
+	// Timeout is how long New waits for the initial configuration, 5
+	// seconds if 0.
+	Timeout time.Duration
+}
+
+// New returns a MockExplorer connected to a new emulated analyzer.
+func New(opts Options) (*MockExplorer, error) {
+	if opts.Model == 0 && opts.FirmwareVersion == "" {
+		opts.Model = rfx.ModelWSUB3G
+	}
+	if opts.FirmwareVersion == "" {
+		opts.FirmwareVersion = "01.26"
+	}
+	if opts.SerialNumber == "" {
+		opts.SerialNumber = "MOCK000000000001"
+	}
+	if opts.SweepSteps == 0 {
+		opts.SweepSteps = 112
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = 5 * time.Second
+	}
+	limits, ok := opts.Model.FreqLimits()
+	if !ok {
+		return nil, fmt.Errorf("rfxtest: %s is not an analyzer", opts.Model)
+	}
+	d := newDevice(opts, limits)
+	rfe, err := rfx.NewWithTransport(d, rfx.WithTimeout(opts.Timeout))
+	if err != nil {
+		d.Close()
+		return nil, err
+	}
+	return &MockExplorer{RFExplorer: rfe, dev: d}, nil
+}
+
+// Respond makes the emulated device answer commands starting with prefix,
+// such as "Cn" or "C2-F:", with lines instead of its usual response. Each
+// line is sent as given followed by an EOL. Scripted responses are checked
+// in the order they were added, before the built-in ones.
+func (m *MockExplorer) Respond(prefix string, lines ...string) {
+	m.dev.mu.Lock()
+	m.dev.scripts = append(m.dev.scripts, script{prefix: prefix, lines: lines})
+	m.dev.mu.Unlock()
+}
+
+// Commands returns the commands received by the emulated device so far,
+// without the # and size prefix.
+func (m *MockExplorer) Commands() []string {
+	m.dev.mu.Lock()
+	defer m.dev.mu.Unlock()
+	return append([]string(nil), m.dev.commands...)
+}
+
+// Send sends raw bytes from the emulated device, for instance to test how
+// malformed packets are handled.
+func (m *MockExplorer) Send(b []byte) {
+	m.dev.send(b)
+}
+
+// SendSweep sends a sweep with the given levels in dBm. Levels are rounded
+// to the 0.5 dB the protocol carries and limited to its range of 0 to
+// -127.5 dBm.
+func (m *MockExplorer) SendSweep(samples []float64) {
+	var b []byte
+	if len(samples) <= 255 {
+		b = append(b, '$', 'S', byte(len(samples)))
+	} else {
+		b = append(b, '$', 'z', byte(len(samples)>>8), byte(len(samples)))
+	}
+	for _, s := range samples {
+		v := -s * 2
+		switch {
+		case v < 0:
+			v = 0
+		case v > 255:
+			v = 255
+		}
+		b = append(b, byte(v+0.5))
+	}
+	m.dev.send(append(b, '\r', '\n'))
+}
+
+// SendSweepFunc sends a sweep of the current configuration with the level
+// at each frequency returned by level.
+func (m *MockExplorer) SendSweepFunc(level func(freqHZ int) float64) {
+	m.dev.mu.Lock()
+	c := m.dev.config
+	m.dev.mu.Unlock()
+	samples := make([]float64, c.SweepSteps)
+	for i := range samples {
+		samples[i] = level(c.StartFreqKHZ*1000 + i*c.FreqStepHZ)
+	}
+	m.SendSweep(samples)
+}
+
+type script struct {
+	prefix string
+	lines  []string
+}
+
+// device is the emulated analyzer. It's the transport of the RFExplorer:
+// commands written to it are handled immediately and responses are queued
+// to be read.
+type device struct {
+	r *io.PipeReader
+	w *io.PipeWriter
+
+	mu       sync.Mutex
+	setup    rfx.CurrentSetupPacket
+	serial   string
+	config   rfx.CurrentConfigPacket
+	presets  map[int]string
+	scripts  []script
+	commands []string
+	out      chan []byte
+	closed   bool
+}
+
+func newDevice(opts Options, limits rfx.FreqLimits) *device {
+	r, w := io.Pipe()
+	expansion := rfx.ModelNone
+	if opts.ExpansionModel != nil {
+		expansion = *opts.ExpansionModel
+	}
+	d := &device{
+		r: r,
+		w: w,
+		setup: rfx.CurrentSetupPacket{
+			Model:           opts.Model,
+			ExpansionModel:  expansion,
+			FirmwareVersion: opts.FirmwareVersion,
+		},
+		serial: opts.SerialNumber,
+		config: rfx.CurrentConfigPacket{
+			StartFreqKHZ: limits.MinFreqKHZ,
+			AmpTopDBM:    -10,
+			AmpBottomDBM: -120,
+			SweepSteps:   opts.SweepSteps,
+			CurrentMode:  rfx.ModeSpectrumAnalyzer,
+			MinFreqKHZ:   limits.MinFreqKHZ,
+			MaxFreqKHZ:   limits.MaxFreqKHZ,
+			MaxSpan:      limits.MaxSpanKHZ,
+		},
+		presets: make(map[int]string),
+		out:     make(chan []byte, 64),
+	}
+	d.setRange(limits.MinFreqKHZ, limits.MinFreqKHZ+limits.MaxSpanKHZ)
+	go d.writeLoop()
+	return d
+}
+
+// writeLoop passes responses to the reader so that handling a command
+// doesn't wait for the reader. Once the pipe is closed responses are
+// dropped.
+func (d *device) writeLoop() {
+	for b := range d.out {
+		d.w.Write(b)
+	}
+}
+
+func (d *device) send(b []byte) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.closed {
+		d.out <- b
+	}
+}
+
+func (d *device) Read(b []byte) (int, error) {
+	return d.r.Read(b)
+}
+
+func (d *device) Close() error {
+	// Close the pipe first so that a send waiting for writeLoop, which
+	// holds mu, finishes.
+	d.w.Close()
+	err := d.r.Close()
+	d.mu.Lock()
+	if !d.closed {
+		d.closed = true
+		close(d.out)
+	}
+	d.mu.Unlock()
+	return err
+}
+
+// Write handles the commands in b, each of which is #<Size><Command>.
+func (d *device) Write(b []byte) (int, error) {
+	n := len(b)
+	for len(b) >= 2 {
+		size := int(b[1])
+		if b[0] != '#' || size < 2 || size > len(b) {
+			return n, fmt.Errorf("rfxtest: malformed command %q", b)
+		}
+		d.handle(string(b[2:size]))
+		b = b[size:]
+	}
+	return n, nil
+}
+
+func (d *device) handle(cmd string) {
+	d.mu.Lock()
+	d.commands = append(d.commands, cmd)
+	var resp bytes.Buffer
+	scripted := false
+	for _, s := range d.scripts {
+		if strings.HasPrefix(cmd, s.prefix) {
+			for _, l := range s.lines {
+				resp.WriteString(l + "\r\n")
+			}
+			scripted = true
+			break
+		}
+	}
+	if !scripted {
+		d.respond(&resp, cmd)
+	}
+	d.mu.Unlock()
+	if resp.Len() != 0 {
+		d.send(resp.Bytes())
+	}
+}
+
+// respond writes the built-in response to cmd.
+func (d *device) respond(resp *bytes.Buffer, cmd string) {
+	switch {
+	case cmd == "C0":
+		fmt.Fprintf(resp, "#C2-M:%03d,%03d,%s\r\n", int(d.setup.Model), int(d.setup.ExpansionModel), d.setup.FirmwareVersion)
+		d.writeConfig(resp)
+	case cmd == "Cn":
+		fmt.Fprintf(resp, "#Sn%s\r\n", d.serial)
+	case strings.HasPrefix(cmd, "C2-F:"):
+		f := strings.Split(cmd[5:], ",")
+		if len(f) < 4 {
+			return
+		}
+		start, _ := strconv.Atoi(f[0])
+		end, _ := strconv.Atoi(f[1])
+		top, _ := strconv.Atoi(f[2])
+		bottom, _ := strconv.Atoi(f[3])
+		d.setRange(start, end)
+		d.config.AmpTopDBM, d.config.AmpBottomDBM = top, bottom
+		d.writeConfig(resp)
+	case strings.HasPrefix(cmd, "C+") && len(cmd) == 3:
+		d.config.CalculatorMode = rfx.CalculatorMode(cmd[2])
+		d.writeConfig(resp)
+	case cmd == "CP\x00":
+		for i := 0; i < d.setup.Model.PresetSlots(); i++ {
+			if rec, ok := d.presets[i]; ok {
+				resp.WriteString(rec)
+			} else {
+				// An empty slot.
+				resp.WriteString("$P " + string([]byte{byte(i)}) + "\x01" + strings.Repeat("\x00", 28) + "\x42\x00\r\n")
+			}
+		}
+		resp.WriteString("#PCK\r\n")
+	case strings.HasPrefix(cmd, "CP\x01") && len(cmd) == 34:
+		// The command is the stored record without "$P " and with the
+		// index and \x01 swapped.
+		d.presets[int(cmd[3])] = "$P " + cmd[3:4] + "\x01" + cmd[4:] + "\r\n"
+		resp.WriteString("#PCK\r\n")
+	}
+}
+
+// setRange sets the configured range and the step between points.
+func (d *device) setRange(startKHZ, endKHZ int) {
+	d.config.StartFreqKHZ = startKHZ
+	d.config.FreqStepHZ = (endKHZ - startKHZ) * 1000 / d.config.SweepSteps
+	d.config.RBWKHZ = d.config.FreqStepHZ / 1000
+	if d.config.RBWKHZ < 3 {
+		d.config.RBWKHZ = 3
+	}
+}
+
+func (d *device) writeConfig(w io.Writer) {
+	w.Write(d.config.Encode())
+}
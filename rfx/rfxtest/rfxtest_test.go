@@ -0,0 +1,76 @@
+package rfxtest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/samuel/rfexplorer/rfx"
+)
+
+func TestMockExplorer(t *testing.T) {
+	m, err := New(Options{Model: rfx.ModelWSUB1G, FirmwareVersion: "01.12"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	var _ rfx.Explorer = m
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if setup, err := m.GetSetup(ctx); err != nil || setup.Model != rfx.ModelWSUB1G || setup.ExpansionModel != rfx.ModelNone {
+		t.Fatalf("unexpected setup %+v, %v", setup, err)
+	}
+	if err := m.Configure(430000, 440000); err != nil {
+		t.Fatal(err)
+	}
+	config, err := m.GetConfig(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.StartFreqKHZ != 430000 || config.FreqStepHZ != 10000*1000/112 {
+		t.Errorf("unexpected config %+v", config)
+	}
+
+	m.Respond("Cn", "#SnSCRIPTED")
+	if sn, err := m.GetSerialNumber(ctx); err != nil || sn != "SCRIPTED" {
+		t.Errorf("got serial number %q, %v", sn, err)
+	}
+
+	p := &rfx.Preset{Index: 4, Name: "ISM 433", MinFreqKHz: 433050, MaxFreqKHz: 434790, AmpBottomDBm: -120, CalcIterations: 1, Mainboard: true}
+	if err := m.UpdatePreset(ctx, p); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := m.GetPreset(ctx, 4); err != nil || *got != *p {
+		t.Errorf("got preset %+v, %v, want %+v", got, err, p)
+	}
+
+	sweeps := make(chan *rfx.Sweep, 1)
+	go m.Sweeps(ctx, func(s *rfx.Sweep) {
+		select {
+		case sweeps <- s:
+		default:
+		}
+	})
+	// Sweeps only passes on sweeps once it has seen a configuration.
+	if _, err := m.GetConfig(ctx); err != nil {
+		t.Fatal(err)
+	}
+	m.SendSweepFunc(func(freqHZ int) float64 {
+		if freqHZ >= 433900000 && freqHZ < 434000000 {
+			return -30
+		}
+		return -100
+	})
+	select {
+	case s := <-sweeps:
+		if len(s.Samples) != 112 || s.Samples[0] != -100 || s.Samples[(433900-430000)*112/10000+1] != -30 {
+			t.Errorf("unexpected sweep %v", s.Samples)
+		}
+	case <-ctx.Done():
+		t.Fatal("no sweep received")
+	}
+	if cmds := m.Commands(); len(cmds) == 0 || cmds[0] != "C0" {
+		t.Errorf("unexpected commands %q", cmds)
+	}
+}
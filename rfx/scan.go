@@ -0,0 +1,82 @@
+package rfx
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Info returns the model and firmware of the device and the range of the
+// active module, as far as the device has reported them. It implements
+// SpectrumSource.
+func (r *RFExplorer) Info() SourceInfo {
+	info := SourceInfo{Name: "RF Explorer"}
+	if setup := r.Setup(); setup != nil {
+		info.Name += " " + setup.Model.String()
+		info.Firmware = setup.FirmwareVersion
+	}
+	if limits, ok := r.FreqLimits(); ok {
+		info.MinFreqKHZ, info.MaxFreqKHZ = limits.MinFreqKHZ, limits.MaxFreqKHZ
+	}
+	return info
+}
+
+// configureTimeout is how long Configure waits for the device to apply
+// the configuration.
+const configureTimeout = 5 * time.Second
+
+// Configure sets the analyzer to sweep the given range with the full
+// amplitude range and automatic RBW, and waits for the device to apply it.
+// The range is clamped to the active module's limits, so sweeps may cover
+// less than was asked for. It implements SpectrumSource.
+func (r *RFExplorer) Configure(startFreqKHZ, endFreqKHZ int) error {
+	if limits, ok := r.FreqLimits(); ok {
+		startFreqKHZ, endFreqKHZ = limits.Clamp(startFreqKHZ, endFreqKHZ)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), configureTimeout)
+	defer cancel()
+	_, err := r.SetAnalyzerConfig(ctx, startFreqKHZ, endFreqKHZ, 0, -120, 0)
+	return err
+}
+
+// Sweeps calls fn for every sweep received until ctx is done. Sweeps
+// received before the device reports its configuration are skipped so a
+// sweep is never described by a stale config, as are sweeps still queued on
+// Chan from before the current configuration, such as those of the previous
+// band after Configure. It consumes packets from Chan so it should not be
+// used while something else is reading from it. It implements
+// SpectrumSource.
+func (r *RFExplorer) Sweeps(ctx context.Context, fn func(*Sweep)) error {
+	for {
+		select {
+		case pkt, ok := <-r.Chan():
+			if !ok {
+				return fmt.Errorf("rfx: connection closed during scan")
+			}
+			// The sweep's own config is used in case the one on Chan was
+			// dropped by the backpressure policy.
+			if pkt, ok := pkt.(*SweepDataPacket); ok && pkt.Config != nil {
+				if config := r.Config(); config != nil && *pkt.Config == *config {
+					fn(&Sweep{Time: pkt.Time, Config: pkt.Config, Samples: pkt.Samples})
+				}
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// Scan configures the analyzer for the given range and calls fn for every
+// sweep received until ctx is done. Sweeps received before the device
+// reports the new configuration are skipped. It consumes packets from Chan
+// so it should not be used while something else is reading from it.
+func (r *RFExplorer) Scan(ctx context.Context, startFreqKHZ, endFreqKHZ int, fn func(config *CurrentConfigPacket, samples []float64)) error {
+	return Scan(ctx, r, startFreqKHZ, endFreqKHZ, fn)
+}
+
+// ScanMaxHold configures the analyzer for the given range and returns the
+// resulting config and the max-hold of all sweeps received until ctx is
+// done.
+func (r *RFExplorer) ScanMaxHold(ctx context.Context, startFreqKHZ, endFreqKHZ int) (*CurrentConfigPacket, []float64, error) {
+	return MaxHold(ctx, r, startFreqKHZ, endFreqKHZ)
+}
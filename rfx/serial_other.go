@@ -0,0 +1,9 @@
+//go:build !(linux || darwin || freebsd)
+
+package rfx
+
+// clearModemLines does nothing. On Windows the port is opened with DTR
+// and RTS disabled already.
+func clearModemLines(t Transport) error {
+	return nil
+}
@@ -0,0 +1,23 @@
+//go:build linux || darwin || freebsd
+
+package rfx
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// clearModemLines deasserts DTR and RTS on a port opened by OpenSerial,
+// which is an *os.File on this platform.
+func clearModemLines(t Transport) error {
+	f, ok := t.(*os.File)
+	if !ok {
+		return nil
+	}
+	bits := int32(syscall.TIOCM_DTR | syscall.TIOCM_RTS)
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), syscall.TIOCMBIC, uintptr(unsafe.Pointer(&bits))); errno != 0 {
+		return os.NewSyscallError("TIOCMBIC", errno)
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+// Package sigmf writes sweeps as a SigMF recording so that captures can be
+// used with SDR tools. A recording is a data file of little endian float32
+// levels in dBm, every sweep one after another, and a JSON metadata file
+// with a capture segment for each sweep giving its time and frequencies.
+//
+// SigMF describes sampled signals, not spectra, so the frequency axis is
+// described by fields in an "rfexplorer" extension namespace:
+//
+//	rfexplorer:start_frequency  frequency of the first level in Hz
+//	rfexplorer:frequency_step   Hz between levels
+//	rfexplorer:sweep_steps      number of levels in the sweep
+//
+// core:frequency is set to the center of the sweep.
+package sigmf
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"math"
+	"os"
+	"time"
+
+	"github.com/samuel/rfexplorer/rfx"
+)
+
+// Extensions of the files.
+const (
+	DataExt = ".sigmf-data"
+	MetaExt = ".sigmf-meta"
+)
+
+// Meta is the metadata of a recording.
+type Meta struct {
+	Global      Global        `json:"global"`
+	Captures    []*Capture    `json:"captures"`
+	Annotations []interface{} `json:"annotations"`
+}
+
+// Global describes the whole recording.
+type Global struct {
+	Datatype    string      `json:"core:datatype"`
+	Version     string      `json:"core:version"`
+	Description string      `json:"core:description,omitempty"`
+	Recorder    string      `json:"core:recorder,omitempty"`
+	HW          string      `json:"core:hw,omitempty"`
+	Extensions  []Extension `json:"core:extensions"`
+	Unit        string      `json:"rfexplorer:unit"`
+}
+
+// Extension declares a namespace used in the metadata.
+type Extension struct {
+	Name     string `json:"name"`
+	Version  string `json:"version"`
+	Optional bool   `json:"optional"`
+}
+
+// Capture describes a sweep.
+type Capture struct {
+	SampleStart int     `json:"core:sample_start"`
+	FrequencyHZ float64 `json:"core:frequency"`
+	Datetime    string  `json:"core:datetime"`
+	StartFreqHZ int     `json:"rfexplorer:start_frequency"`
+	StepHZ      int     `json:"rfexplorer:frequency_step"`
+	Steps       int     `json:"rfexplorer:sweep_steps"`
+}
+
+// Writer writes the data file of a recording and collects its metadata.
+type Writer struct {
+	w       *bufio.Writer
+	meta    *Meta
+	samples int
+	buf     []byte
+}
+
+// NewWriter returns a Writer that writes data to w. hw describes the
+// device, such as its model, and may be empty.
+func NewWriter(w io.Writer, hw string) *Writer {
+	return &Writer{
+		w: bufio.NewWriter(w),
+		meta: &Meta{
+			Global: Global{
+				Datatype:   "rf32_le",
+				Version:    "1.0.0",
+				Recorder:   "github.com/samuel/rfexplorer",
+				HW:         hw,
+				Extensions: []Extension{{Name: "rfexplorer", Version: "1.0.0", Optional: true}},
+				Unit:       "dBm",
+			},
+			Captures:    []*Capture{},
+			Annotations: []interface{}{},
+		},
+	}
+}
+
+// Add writes a sweep of the given config received at t.
+func (w *Writer) Add(t time.Time, config *rfx.CurrentConfigPacket, samples []float64) error {
+	startHZ := config.StartFreqKHZ * 1000
+	w.meta.Captures = append(w.meta.Captures, &Capture{
+		SampleStart: w.samples,
+		FrequencyHZ: float64(startHZ) + float64((len(samples)-1)*config.FreqStepHZ)/2,
+		Datetime:    t.UTC().Format("2006-01-02T15:04:05.000Z"),
+		StartFreqHZ: startHZ,
+		StepHZ:      config.FreqStepHZ,
+		Steps:       len(samples),
+	})
+	w.samples += len(samples)
+	w.buf = w.buf[:0]
+	for _, s := range samples {
+		w.buf = binary.LittleEndian.AppendUint32(w.buf, math.Float32bits(float32(s)))
+	}
+	_, err := w.w.Write(w.buf)
+	return err
+}
+
+// Flush writes any buffered data.
+func (w *Writer) Flush() error {
+	return w.w.Flush()
+}
+
+// Meta returns the metadata of the sweeps added so far.
+func (w *Writer) Meta() *Meta {
+	return w.meta
+}
+
+// WriteMeta writes the metadata of the sweeps added so far to mw.
+func (w *Writer) WriteMeta(mw io.Writer) error {
+	enc := json.NewEncoder(mw)
+	enc.SetIndent("", "  ")
+	return enc.Encode(w.meta)
+}
+
+// File is a recording being written to a pair of files.
+type File struct {
+	*Writer
+	data     *os.File
+	metaPath string
+}
+
+// Create creates the data file of a recording at base plus DataExt. The
+// metadata is written to base plus MetaExt by Close.
+func Create(base, hw string) (*File, error) {
+	data, err := os.Create(base + DataExt)
+	if err != nil {
+		return nil, err
+	}
+	return &File{Writer: NewWriter(data, hw), data: data, metaPath: base + MetaExt}, nil
+}
+
+// Close finishes the data file and writes the metadata file.
+func (f *File) Close() error {
+	if err := f.Flush(); err != nil {
+		f.data.Close()
+		return err
+	}
+	if err := f.data.Close(); err != nil {
+		return err
+	}
+	mf, err := os.Create(f.metaPath)
+	if err != nil {
+		return err
+	}
+	if err := f.WriteMeta(mf); err != nil {
+		mf.Close()
+		return err
+	}
+	return mf.Close()
+}
@@ -0,0 +1,67 @@
+package sigmf
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/samuel/rfexplorer/rfx"
+)
+
+func TestCreate(t *testing.T) {
+	base := filepath.Join(t.TempDir(), "capture")
+	f, err := Create(base, "WSUB3G")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &rfx.CurrentConfigPacket{StartFreqKHZ: 2400000, FreqStepHZ: 1000000}
+	start := time.Date(2017, 1, 31, 23, 59, 1, 250e6, time.UTC)
+	sweeps := [][]float64{{-98.5, -101, -60}, {-99, -100.5, -61.5}}
+	for i, samples := range sweeps {
+		if err := f.Add(start.Add(time.Duration(i)*250*time.Millisecond), config, samples); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(base + DataExt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var levels []float64
+	for i := 0; i+4 <= len(data); i += 4 {
+		levels = append(levels, float64(math.Float32frombits(binary.LittleEndian.Uint32(data[i:]))))
+	}
+	if want := append(sweeps[0], sweeps[1]...); !reflect.DeepEqual(levels, want) {
+		t.Errorf("data %v, want %v", levels, want)
+	}
+
+	b, err := os.ReadFile(base + MetaExt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var meta Meta
+	if err := json.Unmarshal(b, &meta); err != nil {
+		t.Fatal(err)
+	}
+	if meta.Global.Datatype != "rf32_le" || meta.Global.HW != "WSUB3G" || meta.Annotations == nil {
+		t.Errorf("global %+v", meta.Global)
+	}
+	want := []*Capture{
+		{SampleStart: 0, FrequencyHZ: 2401e6, Datetime: "2017-01-31T23:59:01.250Z", StartFreqHZ: 2400e6, StepHZ: 1e6, Steps: 3},
+		{SampleStart: 3, FrequencyHZ: 2401e6, Datetime: "2017-01-31T23:59:01.500Z", StartFreqHZ: 2400e6, StepHZ: 1e6, Steps: 3},
+	}
+	if !reflect.DeepEqual(meta.Captures, want) {
+		for _, c := range meta.Captures {
+			t.Logf("%+v", c)
+		}
+		t.Error("captures don't match")
+	}
+}
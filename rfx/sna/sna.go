@@ -0,0 +1,228 @@
+// Package sna turns an RF Explorer analyzer and an RFE6GEN generator into a
+// scalar network analyzer. The generator's output is swept through the
+// device under test into the analyzer, which measures the level at each
+// step. A normalization pass with the cables connected directly (a thru)
+// records the reference that later measurements are compared against, so
+// that the result is the insertion loss of the device alone.
+package sna
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/samuel/rfexplorer/rfx"
+)
+
+// Tracker runs the steps of a tracking sweep.
+type Tracker interface {
+	// Start prepares a sweep from startKHZ in steps of stepKHZ.
+	Start(ctx context.Context, startKHZ, stepKHZ, steps int) error
+	// Step tunes the generator to step i and returns the level measured by
+	// the analyzer.
+	Step(ctx context.Context, i int) (float64, error)
+	// Stop ends the sweep and turns off the generator.
+	Stop() error
+}
+
+// Trace is the level at each step of a sweep.
+type Trace struct {
+	StartFreqHZ int       `json:"start_freq_hz"`
+	StepHZ      int       `json:"step_hz"`
+	Time        time.Time `json:"time"`
+	// LevelsDB are levels in dBm for a raw sweep or the reference, and the
+	// gain in dB (negative for a loss) for a normalized measurement.
+	LevelsDB []float64 `json:"levels_db"`
+}
+
+// FreqHZ returns the frequency of step i.
+func (t *Trace) FreqHZ(i int) int {
+	return t.StartFreqHZ + i*t.StepHZ
+}
+
+// matches returns true if the traces were taken at the same frequencies.
+func (t *Trace) matches(o *Trace) bool {
+	return t.StartFreqHZ == o.StartFreqHZ && t.StepHZ == o.StepHZ && len(t.LevelsDB) == len(o.LevelsDB)
+}
+
+// SNA is a scalar network analyzer sweeping a fixed range.
+type SNA struct {
+	tracker           Tracker
+	startKHZ, stepKHZ int
+	steps             int
+	// Reference is the normalization trace, nil until Normalize or
+	// LoadReference.
+	Reference *Trace
+}
+
+// New returns an SNA sweeping from startKHZ to stopKHZ in the given number
+// of steps.
+func New(t Tracker, startKHZ, stopKHZ, steps int) (*SNA, error) {
+	if steps < 2 {
+		return nil, fmt.Errorf("sna: need at least 2 steps, got %d", steps)
+	}
+	if stopKHZ <= startKHZ {
+		return nil, fmt.Errorf("sna: stop frequency must be above the start")
+	}
+	stepKHZ := (stopKHZ - startKHZ) / (steps - 1)
+	if stepKHZ == 0 {
+		return nil, fmt.Errorf("sna: %d steps don't fit in %d KHz", steps, stopKHZ-startKHZ)
+	}
+	return &SNA{tracker: t, startKHZ: startKHZ, stepKHZ: stepKHZ, steps: steps}, nil
+}
+
+// Sweep runs a tracking sweep and returns the raw levels.
+func (s *SNA) Sweep(ctx context.Context) (*Trace, error) {
+	if err := s.tracker.Start(ctx, s.startKHZ, s.stepKHZ, s.steps); err != nil {
+		return nil, err
+	}
+	tr := &Trace{
+		StartFreqHZ: s.startKHZ * 1000,
+		StepHZ:      s.stepKHZ * 1000,
+		Time:        time.Now(),
+		LevelsDB:    make([]float64, s.steps),
+	}
+	for i := range tr.LevelsDB {
+		level, err := s.tracker.Step(ctx, i)
+		if err != nil {
+			s.tracker.Stop()
+			return nil, err
+		}
+		tr.LevelsDB[i] = level
+	}
+	return tr, s.tracker.Stop()
+}
+
+// Normalize runs a sweep with the device under test replaced by a thru and
+// keeps it as the reference.
+func (s *SNA) Normalize(ctx context.Context) error {
+	tr, err := s.Sweep(ctx)
+	if err != nil {
+		return err
+	}
+	s.Reference = tr
+	return nil
+}
+
+// Measure runs a sweep and returns the gain of the device under test at
+// each step relative to the reference.
+func (s *SNA) Measure(ctx context.Context) (*Trace, error) {
+	if s.Reference == nil {
+		return nil, fmt.Errorf("sna: not normalized")
+	}
+	tr, err := s.Sweep(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !tr.matches(s.Reference) {
+		return nil, fmt.Errorf("sna: reference was taken over a different range")
+	}
+	for i, ref := range s.Reference.LevelsDB {
+		tr.LevelsDB[i] -= ref
+	}
+	return tr, nil
+}
+
+// Run measures repeatedly until ctx is done, calling fn with each trace.
+func (s *SNA) Run(ctx context.Context, fn func(*Trace)) error {
+	for {
+		tr, err := s.Measure(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		fn(tr)
+	}
+}
+
+// SaveReference writes the reference as JSON so that it can be reused
+// without normalizing again.
+func (s *SNA) SaveReference(w io.Writer) error {
+	if s.Reference == nil {
+		return fmt.Errorf("sna: not normalized")
+	}
+	return json.NewEncoder(w).Encode(s.Reference)
+}
+
+// LoadReference reads a reference written by SaveReference. It must have
+// been taken over the same range.
+func (s *SNA) LoadReference(r io.Reader) error {
+	var ref Trace
+	if err := json.NewDecoder(r).Decode(&ref); err != nil {
+		return fmt.Errorf("sna: invalid reference: %s", err)
+	}
+	want := &Trace{StartFreqHZ: s.startKHZ * 1000, StepHZ: s.stepKHZ * 1000, LevelsDB: make([]float64, s.steps)}
+	if !want.matches(&ref) {
+		return fmt.Errorf("sna: reference was taken over a different range")
+	}
+	s.Reference = &ref
+	return nil
+}
+
+// pairTracker tracks with the analyzer and generator of a Pair.
+type pairTracker struct {
+	pair              *rfx.Pair
+	startKHZ, stepKHZ int
+	// settle is how long to wait after tuning the generator before
+	// measuring.
+	settle time.Duration
+}
+
+// NewPairTracker returns a Tracker using the devices of a Pair, waiting
+// settle after tuning the generator before each measurement.
+func NewPairTracker(p *rfx.Pair, settle time.Duration) Tracker {
+	return &pairTracker{pair: p, settle: settle}
+}
+
+func (t *pairTracker) Start(ctx context.Context, startKHZ, stepKHZ, steps int) error {
+	t.startKHZ, t.stepKHZ = startKHZ, stepKHZ
+	return t.pair.Analyzer.StartTracking(ctx, startKHZ, stepKHZ)
+}
+
+func (t *pairTracker) Step(ctx context.Context, i int) (float64, error) {
+	if err := t.pair.Generator.GenSetCW(t.startKHZ + i*t.stepKHZ); err != nil {
+		return 0, err
+	}
+	select {
+	case <-time.After(t.settle):
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+	t.drain()
+	sweep, err := t.pair.Analyzer.MeasureTrackingStep(ctx, i)
+	if err != nil {
+		return 0, err
+	}
+	// The analyzer reports the levels of the sweep so far indexed by step.
+	if i < len(sweep.Samples) {
+		return sweep.Samples[i], nil
+	}
+	return sweep.Samples[len(sweep.Samples)-1], nil
+}
+
+// drain discards the packets waiting in the analyzer's Chan, which nothing
+// else reads during a tracking sweep.
+func (t *pairTracker) drain() {
+	for {
+		select {
+		case _, ok := <-t.pair.Analyzer.Chan():
+			if !ok {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (t *pairTracker) Stop() error {
+	err := t.pair.Generator.GenStop()
+	if e := t.pair.Analyzer.StopTracking(); err == nil {
+		err = e
+	}
+	return err
+}
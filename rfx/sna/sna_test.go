@@ -0,0 +1,79 @@
+package sna
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"testing"
+)
+
+// fakeTracker measures a filter with a fixed loss through cables whose loss
+// rises with frequency.
+type fakeTracker struct {
+	startKHZ, stepKHZ int
+	dut               bool
+	started, stopped  int
+}
+
+func (t *fakeTracker) Start(ctx context.Context, startKHZ, stepKHZ, steps int) error {
+	t.startKHZ, t.stepKHZ = startKHZ, stepKHZ
+	t.started++
+	return nil
+}
+
+func (t *fakeTracker) Step(ctx context.Context, i int) (float64, error) {
+	level := -10 - float64(i)*0.5 // cables
+	if t.dut {
+		level -= 6
+	}
+	return level, nil
+}
+
+func (t *fakeTracker) Stop() error {
+	t.stopped++
+	return nil
+}
+
+func TestMeasure(t *testing.T) {
+	ft := &fakeTracker{}
+	s, err := New(ft, 400000, 500000, 11)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if _, err := s.Measure(ctx); err == nil {
+		t.Error("expected an error measuring before normalizing")
+	}
+	if err := s.Normalize(ctx); err != nil {
+		t.Fatal(err)
+	}
+	ft.dut = true
+	tr, err := s.Measure(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ft.startKHZ != 400000 || ft.stepKHZ != 10000 || ft.started != ft.stopped {
+		t.Errorf("tracker %+v", ft)
+	}
+	if len(tr.LevelsDB) != 11 || tr.FreqHZ(10) != 500000000 {
+		t.Fatalf("unexpected trace %+v", tr)
+	}
+	for i, l := range tr.LevelsDB {
+		if math.Abs(l+6) > 1e-9 {
+			t.Errorf("step %d has gain %g, want -6", i, l)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := s.SaveReference(&buf); err != nil {
+		t.Fatal(err)
+	}
+	s2, _ := New(ft, 400000, 500000, 11)
+	if err := s2.LoadReference(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	s3, _ := New(ft, 400000, 600000, 11)
+	if err := s3.LoadReference(bytes.NewReader(buf.Bytes())); err == nil {
+		t.Error("expected an error loading a reference for a different range")
+	}
+}
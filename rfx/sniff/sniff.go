@@ -0,0 +1,315 @@
+// Package sniff decodes the OOK/ASK captures of the RF sniffer, such as
+// those of 433 MHz remotes and key fobs, into pulses and bitstreams.
+package sniff
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/samuel/rfexplorer/rfx"
+)
+
+// Pulse is a run of samples at the same level.
+type Pulse struct {
+	High    bool
+	Samples int
+	// Duration is zero if the sample rate isn't known.
+	Duration time.Duration
+}
+
+// Pulses splits sniffer data, one sample per bit with the first sample in
+// the most significant bit, into runs of the same level. The sample rate is
+// used for the durations and may be zero if it isn't known.
+func Pulses(data []byte, sampleRate int) []Pulse {
+	var pulses []Pulse
+	for _, b := range data {
+		for i := 7; i >= 0; i-- {
+			high := b&(1<<uint(i)) != 0
+			if n := len(pulses); n > 0 && pulses[n-1].High == high {
+				pulses[n-1].Samples++
+			} else {
+				pulses = append(pulses, Pulse{High: high, Samples: 1})
+			}
+		}
+	}
+	if sampleRate > 0 {
+		for i := range pulses {
+			pulses[i].Duration = time.Duration(pulses[i].Samples) * time.Second / time.Duration(sampleRate)
+		}
+	}
+	return pulses
+}
+
+// FromRawData returns the pulses of a sniffer capture, timed by the
+// configuration it was captured with.
+func FromRawData(raw *rfx.RawData) []Pulse {
+	rate := 0
+	if raw.Config != nil {
+		rate = raw.Config.SampleRate()
+	}
+	return Pulses(raw.Data, rate)
+}
+
+// Code is a frame decoded from a capture.
+type Code struct {
+	Protocol string
+	Bits     []bool
+	// Repeats is the number of times the frame was received in a row.
+	// Remotes usually send each frame several times.
+	Repeats int
+	// ShortSamples is the length of a short pulse, the base timing unit of
+	// the protocol.
+	ShortSamples  int
+	ShortDuration time.Duration
+}
+
+// Uint64 returns the bits as a number, the first bit being the most
+// significant. Only the last 64 bits are kept.
+func (c *Code) Uint64() uint64 {
+	var v uint64
+	for _, b := range c.Bits {
+		v <<= 1
+		if b {
+			v |= 1
+		}
+	}
+	return v
+}
+
+// Tristate returns the code as the tri-state symbols of a PT2262 encoder,
+// where the bit pairs 00, 11, and 01 are 0, 1, and F. It returns false if
+// the bits aren't a valid PT2262 code.
+func (c *Code) Tristate() (string, bool) {
+	if len(c.Bits)%2 != 0 {
+		return "", false
+	}
+	var sb strings.Builder
+	for i := 0; i < len(c.Bits); i += 2 {
+		switch {
+		case !c.Bits[i] && !c.Bits[i+1]:
+			sb.WriteByte('0')
+		case c.Bits[i] && c.Bits[i+1]:
+			sb.WriteByte('1')
+		case !c.Bits[i] && c.Bits[i+1]:
+			sb.WriteByte('F')
+		default:
+			return "", false
+		}
+	}
+	return sb.String(), true
+}
+
+func (c *Code) String() string {
+	var sb strings.Builder
+	for _, b := range c.Bits {
+		if b {
+			sb.WriteByte('1')
+		} else {
+			sb.WriteByte('0')
+		}
+	}
+	s := fmt.Sprintf("%s %d bits %s", c.Protocol, len(c.Bits), sb.String())
+	if c.Repeats > 1 {
+		s += fmt.Sprintf(" x%d", c.Repeats)
+	}
+	return s
+}
+
+// Decode runs the built-in decoders on pulses and returns the codes found.
+// Fixed code remotes are tried first and Manchester if none are found,
+// since the pulses of one often partly decode as the other.
+func Decode(pulses []Pulse) []Code {
+	if codes := DecodeEV1527(pulses); len(codes) > 0 {
+		return codes
+	}
+	return DecodeManchester(pulses)
+}
+
+const (
+	// ev1527Bits is the number of data bits in an EV1527 or PT2262 frame.
+	ev1527Bits = 24
+	// The sync pulse is a short high followed by a low 31 times as long.
+	minSyncRatio = 20
+	maxSyncRatio = 45
+)
+
+// DecodeEV1527 decodes fixed code remotes using an EV1527 or PT2262
+// encoder. Each frame is a sync pulse, a short high and a low 31 times as
+// long, followed by 24 bits. A 0 is a short high and a long low and a 1 a
+// long high and a short low, the long pulses being 3 times as long. PT2262
+// codes are read with Code.Tristate.
+func DecodeEV1527(pulses []Pulse) []Code {
+	var codes []Code
+	for i := 0; i+1 < len(pulses); i++ {
+		sync, gap := pulses[i], pulses[i+1]
+		if !sync.High || gap.Samples < minSyncRatio*sync.Samples || gap.Samples > maxSyncRatio*sync.Samples {
+			continue
+		}
+		short := sync.Samples
+		bits, ok := readEV1527(pulses[i+2:], short)
+		if !ok {
+			continue
+		}
+		codes = appendCode(codes, Code{
+			Protocol:      "EV1527",
+			Bits:          bits,
+			Repeats:       1,
+			ShortSamples:  short,
+			ShortDuration: sync.Duration,
+		})
+		i += 1 + 2*ev1527Bits
+	}
+	return codes
+}
+
+// readEV1527 reads the bits following a sync pulse.
+func readEV1527(pulses []Pulse, short int) ([]bool, bool) {
+	if len(pulses) < 2*ev1527Bits-1 {
+		return nil, false
+	}
+	isShort := func(p Pulse) bool { return p.Samples*2 < short*4 && p.Samples*2 > short }
+	isLong := func(p Pulse) bool { return p.Samples >= short*2 && p.Samples <= short*5 }
+	bits := make([]bool, ev1527Bits)
+	for b := range bits {
+		high := pulses[2*b]
+		if !high.High {
+			return nil, false
+		}
+		switch {
+		case isShort(high):
+		case isLong(high):
+			bits[b] = true
+		default:
+			return nil, false
+		}
+		if 2*b+1 >= len(pulses) {
+			// The capture ended after the last high.
+			break
+		}
+		low := pulses[2*b+1]
+		if b == ev1527Bits-1 {
+			// The low of the last bit runs into the next sync pulse or
+			// the end of the transmission.
+			break
+		}
+		if bits[b] && !isShort(low) || !bits[b] && !isLong(low) {
+			return nil, false
+		}
+	}
+	return bits, true
+}
+
+// appendCode appends c to codes or counts it as a repeat of the last one.
+func appendCode(codes []Code, c Code) []Code {
+	if n := len(codes); n > 0 && codes[n-1].Protocol == c.Protocol && equalBits(codes[n-1].Bits, c.Bits) {
+		codes[n-1].Repeats++
+		return codes
+	}
+	return append(codes, c)
+}
+
+func equalBits(a, b []bool) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// minManchesterBits is the fewest bits a Manchester frame must have to be
+// reported, so that noise isn't.
+const minManchesterBits = 16
+
+// DecodeManchester decodes Manchester coded frames, using the IEEE 802.3
+// convention where a 1 is a low to high transition in the middle of the bit
+// and a 0 high to low. The half bit period is taken from the shortest
+// pulses and frames are separated by anything that isn't one or two half
+// bits long.
+func DecodeManchester(pulses []Pulse) []Code {
+	half, halfDuration := shortestPulse(pulses)
+	if half == 0 {
+		return nil
+	}
+	var codes []Code
+	var halves []bool
+	flush := func() {
+		if bits := manchesterBits(halves); len(bits) >= minManchesterBits {
+			codes = appendCode(codes, Code{
+				Protocol:      "Manchester",
+				Bits:          bits,
+				Repeats:       1,
+				ShortSamples:  half,
+				ShortDuration: halfDuration,
+			})
+		}
+		halves = halves[:0]
+	}
+	for _, p := range pulses {
+		n := (p.Samples + half/2) / half
+		if n < 1 || n > 2 {
+			if p.High {
+				// A long high ends a frame, a long low might start one.
+				flush()
+				continue
+			}
+			flush()
+			// The frame starts with the low half of a 1.
+			halves = append(halves, false)
+			continue
+		}
+		for j := 0; j < n; j++ {
+			halves = append(halves, p.High)
+		}
+	}
+	flush()
+	return codes
+}
+
+// manchesterBits decodes half bit levels, aligning to whichever phase
+// decodes the most bits before an invalid pair.
+func manchesterBits(halves []bool) []bool {
+	var best []bool
+	for phase := 0; phase < 2; phase++ {
+		var bits []bool
+		for i := phase; i+1 < len(halves); i += 2 {
+			if halves[i] == halves[i+1] {
+				break
+			}
+			bits = append(bits, halves[i+1])
+		}
+		if len(bits) > len(best) {
+			best = bits
+		}
+	}
+	return best
+}
+
+// shortestPulse returns the typical length of the shortest pulses, ignoring
+// the first and last which are usually cut off by the capture.
+func shortestPulse(pulses []Pulse) (int, time.Duration) {
+	if len(pulses) < 3 {
+		return 0, 0
+	}
+	inner := pulses[1 : len(pulses)-1]
+	min := inner[0].Samples
+	for _, p := range inner {
+		if p.Samples < min {
+			min = p.Samples
+		}
+	}
+	sum, n := 0, 0
+	var dur time.Duration
+	for _, p := range inner {
+		if p.Samples*2 < min*3 {
+			sum += p.Samples
+			dur += p.Duration
+			n++
+		}
+	}
+	return (sum + n/2) / n, dur / time.Duration(n)
+}
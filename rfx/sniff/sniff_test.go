@@ -0,0 +1,92 @@
+package sniff
+
+import (
+	"testing"
+	"time"
+)
+
+// pack packs levels into sniffer data, one bit per sample.
+func pack(levels []bool) []byte {
+	data := make([]byte, (len(levels)+7)/8)
+	for i, l := range levels {
+		if l {
+			data[i/8] |= 0x80 >> uint(i%8)
+		}
+	}
+	return data
+}
+
+// level appends n samples of a level.
+func level(levels []bool, high bool, n int) []bool {
+	for i := 0; i < n; i++ {
+		levels = append(levels, high)
+	}
+	return levels
+}
+
+func TestPulses(t *testing.T) {
+	pulses := Pulses([]byte{0xf0, 0x0f}, 8000)
+	want := []Pulse{{true, 4, 500 * time.Microsecond}, {false, 8, time.Millisecond}, {true, 4, 500 * time.Microsecond}}
+	if len(pulses) != len(want) {
+		t.Fatalf("got %+v, want %+v", pulses, want)
+	}
+	for i := range want {
+		if pulses[i] != want[i] {
+			t.Errorf("pulse %d is %+v, want %+v", i, pulses[i], want[i])
+		}
+	}
+}
+
+func TestDecodeEV1527(t *testing.T) {
+	// PT2262 code 0F1F0F1F0F1F
+	bits := "000111010001110100011101"
+	const short = 5
+	var levels []bool
+	levels = level(levels, false, 40)
+	for frame := 0; frame < 3; frame++ {
+		levels = level(levels, true, short)
+		levels = level(levels, false, 31*short)
+		for _, b := range bits {
+			if b == '1' {
+				levels = level(level(levels, true, 3*short), false, short)
+			} else {
+				levels = level(level(levels, true, short), false, 3*short)
+			}
+		}
+	}
+	levels = level(levels, true, short)
+	levels = level(levels, false, 40)
+
+	codes := Decode(Pulses(pack(levels), 0))
+	if len(codes) != 1 {
+		t.Fatalf("got codes %v", codes)
+	}
+	c := codes[0]
+	if c.Protocol != "EV1527" || c.Repeats != 3 || c.ShortSamples != short || c.Uint64() != 0x1d1d1d {
+		t.Errorf("unexpected code %v (%#x)", &c, c.Uint64())
+	}
+	if ts, ok := c.Tristate(); !ok || ts != "0F1F0F1F0F1F" {
+		t.Errorf("tri-state %q, %t", ts, ok)
+	}
+}
+
+func TestDecodeManchester(t *testing.T) {
+	bits := "1011001110001111"
+	const half = 4
+	var levels []bool
+	levels = level(levels, false, 30)
+	for _, b := range bits {
+		// IEEE 802.3: 1 is low then high.
+		first := b == '0'
+		levels = level(level(levels, first, half), !first, half)
+	}
+	levels = level(levels, false, 30)
+
+	codes := Decode(Pulses(pack(levels), 0))
+	if len(codes) != 1 {
+		t.Fatalf("got codes %v", codes)
+	}
+	if c := codes[0]; c.Protocol != "Manchester" || c.Uint64() != 0xb38f {
+		t.Errorf("unexpected code %v", &c)
+	}
+}
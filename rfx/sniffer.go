@@ -0,0 +1,77 @@
+package rfx
+
+import (
+	"fmt"
+	"math"
+)
+
+// snifferClockHZ is the clock the sniffer's sample delay is counted in.
+const snifferClockHZ = 16 * 1000 * 1000
+
+// SnifferConfig configures the RF sniffer mode.
+type SnifferConfig struct {
+	CenterFreqKHZ int
+	// SampleRate is the rate in samples per second at which the internal
+	// decoder detects activity. It should be in the range 20,000 – 500,000
+	// for OOK RAW modulation modes usually found in commercial devices, but
+	// some experimentation may be needed. The higher the rate the better the
+	// capture resolution but at the cost of a shorter capture time lapse.
+	SampleRate   int
+	Modulation   Modulation
+	RBWKHZ       int
+	ThresholdDBM float64
+}
+
+// SetSnifferConfig configures the sniffer and switches the analyzer to the
+// sniffer mode. The device confirms with a CurrentSnifferConfig and then
+// sends the captured data as RawData packets.
+func (r *RFExplorer) SetSnifferConfig(c SnifferConfig) error {
+	// #<Size>C3-K:<Center_Freq_KHZ>,<Delay>,<Modulation>,<RBW_KHZ>,<Threshold>
+	// <Center_Freq_KHZ> = 7 ascii digits, decimal
+	// <Delay> = 5 ascii digits, the sample period in 16 MHz clock cycles
+	// <Modulation> = 1 ascii digit
+	// <RBW_KHZ> = 5 ascii digits, decimal
+	// <Threshold> = 3 ascii digits, -0.5 dBm units
+	if c.CenterFreqKHZ <= 0 || c.CenterFreqKHZ > 9999999 {
+		return fmt.Errorf("rfx: sniffer center frequency %d KHz out of range", c.CenterFreqKHZ)
+	}
+	if c.SampleRate <= 0 {
+		return fmt.Errorf("rfx: sniffer sample rate must be positive, got %d", c.SampleRate)
+	}
+	delay := (snifferClockHZ + c.SampleRate/2) / c.SampleRate
+	if delay < 1 || delay > 99999 {
+		return fmt.Errorf("rfx: sniffer sample rate %d out of range", c.SampleRate)
+	}
+	switch c.Modulation {
+	case ModulationOOKRaw, ModulationPSKRaw, ModulationOOKStd, ModulationPSKStd:
+	default:
+		return fmt.Errorf("rfx: unknown modulation %d", int(c.Modulation))
+	}
+	if c.RBWKHZ <= 0 || c.RBWKHZ > 99999 {
+		return fmt.Errorf("rfx: sniffer RBW %d KHz out of range", c.RBWKHZ)
+	}
+	threshold := int(math.Round(-2 * c.ThresholdDBM))
+	if threshold < 0 || threshold > 255 {
+		return fmt.Errorf("rfx: sniffer threshold %g dBm out of range", c.ThresholdDBM)
+	}
+	return r.SendCommand(fmt.Sprintf("C3-K:%07d,%05d,%d,%05d,%03d",
+		c.CenterFreqKHZ, delay, int(c.Modulation), c.RBWKHZ, threshold))
+}
+
+// SnifferConfig returns the sniffer configuration last reported by the
+// device or nil if it hasn't reported one.
+func (r *RFExplorer) SnifferConfig() *CurrentSnifferConfig {
+	config, _ := r.snifferConfig.Load().(*CurrentSnifferConfig)
+	return config
+}
+
+// StartSniffer starts capturing raw data with the given configuration.
+func (r *RFExplorer) StartSniffer(c SnifferConfig) error {
+	return r.SetSnifferConfig(c)
+}
+
+// StopSniffer stops capturing and returns the analyzer to the spectrum
+// analyzer mode, which it confirms by reporting its configuration.
+func (r *RFExplorer) StopSniffer() error {
+	return r.RequestConfig()
+}
@@ -0,0 +1,103 @@
+package rfx
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Sweep is a single sweep received from a SpectrumSource.
+type Sweep struct {
+	Time time.Time
+	// Config describes the sweep. Sources that aren't an RF Explorer fill
+	// in the equivalent values.
+	Config  *CurrentConfigPacket
+	Samples []float64
+}
+
+// SourceInfo describes a SpectrumSource.
+type SourceInfo struct {
+	// Name is the name of the instrument, e.g. "RF Explorer WSUB3G".
+	Name       string
+	Firmware   string
+	MinFreqKHZ int
+	MaxFreqKHZ int
+}
+
+// SpectrumSource is the interface shared by the RF Explorer and other
+// backends such as the tinySA, so that tools can be written against any of
+// them.
+type SpectrumSource interface {
+	// Info describes the instrument.
+	Info() SourceInfo
+	// Configure sets the range to sweep. A range beyond the limits of the
+	// instrument is clamped to them like FreqLimits.Clamp does, so sweeps
+	// may cover less than was asked for, rather than being an error. A
+	// range that doesn't end above its start is an error.
+	Configure(startFreqKHZ, endFreqKHZ int) error
+	// Sweeps calls fn for every sweep received until ctx is done, in which
+	// case it returns nil, or the source fails.
+	Sweeps(ctx context.Context, fn func(*Sweep)) error
+}
+
+// Explorer is the API of an RF Explorer analyzer that applications are
+// usually written against. It's implemented by *RFExplorer, including the
+// emulated device in package rfxtest, so code that takes an Explorer can be
+// tested without hardware.
+type Explorer interface {
+	SpectrumSource
+	// Chan returns the packets received from the device.
+	Chan() chan Packet
+	// Subscribe returns an independent stream of packets.
+	Subscribe(types ...PacketType) (<-chan Packet, func())
+	// Errors reports the connection failing.
+	Errors() <-chan error
+	Close() error
+	SendCommand(cmd string) error
+	Config() *CurrentConfigPacket
+	Setup() *CurrentSetupPacket
+	GetConfig(ctx context.Context) (*CurrentConfigPacket, error)
+	SetAnalyzerConfig(ctx context.Context, startFreqKHZ, endFreqKHZ, ampTopDBm, ampBottomDBm, rbwKHZ int) (*CurrentConfigPacket, error)
+	SetCalculatorMode(mode CalculatorMode) error
+	GetPresets(ctx context.Context) ([]*Preset, error)
+	UpdatePreset(ctx context.Context, p *Preset) error
+	WritePresets(ctx context.Context, presets []*Preset, progress func(p *Preset)) error
+}
+
+var _ Explorer = (*RFExplorer)(nil)
+
+// Scan configures src for the given range and calls fn for every sweep
+// received until ctx is done.
+func Scan(ctx context.Context, src SpectrumSource, startFreqKHZ, endFreqKHZ int, fn func(config *CurrentConfigPacket, samples []float64)) error {
+	if err := src.Configure(startFreqKHZ, endFreqKHZ); err != nil {
+		return err
+	}
+	return src.Sweeps(ctx, func(s *Sweep) {
+		fn(s.Config, s.Samples)
+	})
+}
+
+// MaxHold scans the given range with src and returns the last config and
+// the max-hold of all sweeps received until ctx is done.
+func MaxHold(ctx context.Context, src SpectrumSource, startFreqKHZ, endFreqKHZ int) (*CurrentConfigPacket, []float64, error) {
+	var config *CurrentConfigPacket
+	var maxHold []float64
+	err := Scan(ctx, src, startFreqKHZ, endFreqKHZ, func(c *CurrentConfigPacket, samples []float64) {
+		if c != config || len(maxHold) != len(samples) {
+			config = c
+			maxHold = append([]float64(nil), samples...)
+		}
+		for i, s := range samples {
+			if s > maxHold[i] {
+				maxHold[i] = s
+			}
+		}
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if maxHold == nil {
+		return nil, nil, fmt.Errorf("rfx: no sweeps received during scan")
+	}
+	return config, maxHold, nil
+}
@@ -0,0 +1,228 @@
+package spectrogram
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+
+	"github.com/samuel/rfexplorer/rfx/internal/pixfont"
+)
+
+// Palette maps levels to colors. Levels are scaled from 0 at the bottom of
+// the range to 1 at the top and the color is interpolated between the
+// evenly spaced stops of the palette.
+type Palette []color.RGBA
+
+// Palettes
+var (
+	Grayscale = Palette{{0, 0, 0, 255}, {255, 255, 255, 255}}
+	// Heat runs from black through blue, cyan, and yellow to red, the
+	// usual colors of a waterfall display.
+	Heat = Palette{
+		{0, 0, 0, 255},
+		{0, 0, 160, 255},
+		{0, 200, 255, 255},
+		{255, 255, 0, 255},
+		{255, 0, 0, 255},
+	}
+)
+
+// At returns the color of v, between 0 and 1.
+func (p Palette) At(v float64) color.RGBA {
+	if len(p) == 0 {
+		return color.RGBA{}
+	}
+	if len(p) == 1 || v <= 0 || math.IsNaN(v) {
+		return p[0]
+	}
+	if v >= 1 {
+		return p[len(p)-1]
+	}
+	pos := v * float64(len(p)-1)
+	i := int(pos)
+	f := pos - float64(i)
+	a, b := p[i], p[i+1]
+	mix := func(x, y uint8) uint8 {
+		return uint8(float64(x) + f*(float64(y)-float64(x)) + 0.5)
+	}
+	return color.RGBA{mix(a.R, b.R), mix(a.G, b.G), mix(a.B, b.B), mix(a.A, b.A)}
+}
+
+// RenderOptions configures rendering.
+type RenderOptions struct {
+	// MinDBM and MaxDBM are the levels at the ends of the palette. If they
+	// are equal the range of the levels in the buffer is used.
+	MinDBM, MaxDBM float64
+	// Width is the width of the heatmap in pixels, 600 if 0.
+	Width int
+	// RowHeight is the height of each sweep in pixels, 1 if 0.
+	RowHeight int
+}
+
+// Layout of the rendered image.
+const (
+	labelScale   = 2
+	labelHeight  = pixfont.Height * labelScale
+	marginLeft   = 8*pixfont.Advance*labelScale + 12 // HH:MM:SS
+	marginTop    = 8
+	marginBottom = labelHeight + 12
+	barGap       = 8
+	barWidth     = 12
+	marginRight  = barGap + barWidth + 4 + 4*pixfont.Advance*labelScale + 4 // -120
+	tickLength   = 4
+)
+
+var (
+	background = color.RGBA{0, 0, 0, 255}
+	foreground = color.RGBA{255, 255, 255, 255}
+)
+
+// Render draws the sweeps in the buffer as a heatmap of time, oldest at the
+// top, against frequency, with the times, frequencies in MHz, and a color
+// scale in dBm labeled.
+func (b *Buffer) Render(palette Palette, opts RenderOptions) (*image.RGBA, error) {
+	grid, rows := b.snapshot()
+	if len(rows) == 0 || grid.Points == 0 {
+		return nil, errors.New("spectrogram: no sweeps")
+	}
+	if opts.Width <= 0 {
+		opts.Width = 600
+	}
+	if opts.RowHeight <= 0 {
+		opts.RowHeight = 1
+	}
+	minDBM, maxDBM := opts.MinDBM, opts.MaxDBM
+	if minDBM == maxDBM {
+		minDBM, maxDBM = levelRange(rows)
+	}
+
+	plot := image.Rect(marginLeft, marginTop, marginLeft+opts.Width, marginTop+len(rows)*opts.RowHeight)
+	img := image.NewRGBA(image.Rect(0, 0, plot.Max.X+marginRight, plot.Max.Y+marginBottom))
+	draw.Draw(img, img.Bounds(), image.NewUniform(background), image.Point{}, draw.Src)
+
+	scale := func(dbm float64) float64 {
+		return (dbm - minDBM) / (maxDBM - minDBM)
+	}
+	for r, row := range rows {
+		for x := 0; x < opts.Width; x++ {
+			s := row.Samples[x*grid.Points/opts.Width]
+			if math.IsNaN(s) {
+				continue
+			}
+			c := palette.At(scale(s))
+			for y := 0; y < opts.RowHeight; y++ {
+				img.SetRGBA(plot.Min.X+x, plot.Min.Y+r*opts.RowHeight+y, c)
+			}
+		}
+	}
+
+	// Times down the left, at most every few label heights.
+	rowsPerLabel := (3*labelHeight + opts.RowHeight - 1) / opts.RowHeight
+	for r := 0; r < len(rows); r += rowsPerLabel {
+		y := plot.Min.Y + r*opts.RowHeight
+		hline(img, plot.Min.X-tickLength, plot.Min.X, y)
+		label := rows[r].Time.Format("15:04:05")
+		pixfont.Draw(img, plot.Min.X-tickLength-2-pixfont.TextWidth(label, labelScale), y, label, foreground, labelScale)
+	}
+
+	// Frequencies along the bottom.
+	startHZ, endHZ := float64(grid.StartFreqHZ), float64(grid.EndFreqHZ())
+	labelWidth := pixfont.TextWidth(formatMHz(endHZ, endHZ-startHZ), labelScale)
+	// The labels at the ends are aligned with the edges rather than
+	// centered, so they need room for twice their width.
+	ticks := opts.Width / (2 * labelWidth)
+	if ticks < 1 {
+		ticks = 1
+	}
+	for i := 0; i <= ticks; i++ {
+		x := plot.Min.X + i*(opts.Width-1)/ticks
+		vline(img, x, plot.Max.Y, plot.Max.Y+tickLength)
+		label := formatMHz(startHZ+float64(i)/float64(ticks)*(endHZ-startHZ), endHZ-startHZ)
+		lx := x - pixfont.TextWidth(label, labelScale)/2
+		if i == ticks {
+			lx = x - pixfont.TextWidth(label, labelScale)
+		} else if i == 0 {
+			lx = x
+		}
+		pixfont.Draw(img, lx, plot.Max.Y+tickLength+2, label, foreground, labelScale)
+	}
+	pixfont.Draw(img, plot.Max.X+barGap, plot.Max.Y+tickLength+2, "MHz", foreground, labelScale)
+
+	// Color scale on the right.
+	bar := image.Rect(plot.Max.X+barGap, plot.Min.Y, plot.Max.X+barGap+barWidth, plot.Max.Y)
+	for y := bar.Min.Y; y < bar.Max.Y; y++ {
+		v := 1 - float64(y-bar.Min.Y)/float64(bar.Dy())
+		draw.Draw(img, image.Rect(bar.Min.X, y, bar.Max.X, y+1), image.NewUniform(palette.At(v)), image.Point{}, draw.Src)
+	}
+	pixfont.Draw(img, bar.Max.X+4, bar.Min.Y, fmt.Sprintf("%.0f", maxDBM), foreground, labelScale)
+	if bar.Dy() >= 3*labelHeight {
+		pixfont.Draw(img, bar.Max.X+4, bar.Max.Y-labelHeight, fmt.Sprintf("%.0f", minDBM), foreground, labelScale)
+	}
+	if bar.Dy() >= 5*labelHeight {
+		pixfont.Draw(img, bar.Max.X+4, bar.Min.Y+bar.Dy()/2-labelHeight/2, "dBm", foreground, labelScale)
+	}
+	return img, nil
+}
+
+// RenderPNG renders the sweeps in the buffer as a PNG image, see Render.
+func (b *Buffer) RenderPNG(w io.Writer, palette Palette, opts RenderOptions) error {
+	img, err := b.Render(palette, opts)
+	if err != nil {
+		return err
+	}
+	return png.Encode(w, img)
+}
+
+// levelRange returns the lowest and highest levels of rows, 1 dB apart if
+// they're all the same.
+func levelRange(rows []Row) (minDBM, maxDBM float64) {
+	minDBM, maxDBM = math.Inf(1), math.Inf(-1)
+	for _, row := range rows {
+		for _, s := range row.Samples {
+			if math.IsNaN(s) {
+				continue
+			}
+			minDBM = math.Min(minDBM, s)
+			maxDBM = math.Max(maxDBM, s)
+		}
+	}
+	if math.IsInf(minDBM, 1) {
+		return -120, 0
+	}
+	if maxDBM-minDBM < 1 {
+		maxDBM = minDBM + 1
+	}
+	return minDBM, maxDBM
+}
+
+// formatMHz formats a frequency in MHz with enough decimals to tell apart
+// labels across a span.
+func formatMHz(freqHZ, spanHZ float64) string {
+	decimals := 0
+	switch {
+	case spanHZ < 1e6:
+		decimals = 3
+	case spanHZ < 10e6:
+		decimals = 2
+	case spanHZ < 100e6:
+		decimals = 1
+	}
+	return fmt.Sprintf("%.*f", decimals, freqHZ/1e6)
+}
+
+func hline(img *image.RGBA, x0, x1, y int) {
+	for x := x0; x < x1; x++ {
+		img.SetRGBA(x, y, foreground)
+	}
+}
+
+func vline(img *image.RGBA, x, y0, y1 int) {
+	for y := y0; y < y1; y++ {
+		img.SetRGBA(x, y, foreground)
+	}
+}
@@ -0,0 +1,98 @@
+// Package spectrogram keeps a rolling window of sweeps for a time versus
+// frequency view and renders it as an image.
+package spectrogram
+
+import (
+	"sync"
+	"time"
+
+	"github.com/samuel/rfexplorer/rfx"
+	"github.com/samuel/rfexplorer/rfx/analysis"
+)
+
+// Row is a sweep in a spectrogram.
+type Row struct {
+	Time    time.Time
+	Samples []float64
+}
+
+// Buffer holds the most recent sweeps on one frequency grid, set by the
+// first sweep added. Later sweeps of other grids are resampled onto it with
+// levels outside of the sweep set to NaN, so a long run keeps one picture
+// across changes of span. It's safe for concurrent use.
+type Buffer struct {
+	mu   sync.Mutex
+	max  int
+	grid analysis.Grid
+	rows []Row // ring of up to max rows, the oldest at next once full
+	next int
+}
+
+// New returns a Buffer that keeps up to max sweeps.
+func New(max int) *Buffer {
+	if max < 1 {
+		max = 1
+	}
+	return &Buffer{max: max}
+}
+
+// Add adds a sweep of the given config received at t, dropping the oldest
+// sweep if the buffer is full.
+func (b *Buffer) Add(t time.Time, config *rfx.CurrentConfigPacket, samples []float64) {
+	grid := analysis.ConfigGrid(config, len(samples))
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.rows) == 0 {
+		b.grid = grid
+	}
+	if grid == b.grid {
+		samples = append([]float64(nil), samples...)
+	} else {
+		samples = analysis.Resample(grid, samples, b.grid)
+	}
+	row := Row{Time: t, Samples: samples}
+	if len(b.rows) < b.max {
+		b.rows = append(b.rows, row)
+		return
+	}
+	b.rows[b.next] = row
+	b.next = (b.next + 1) % b.max
+}
+
+// Grid returns the frequency grid of the sweeps.
+func (b *Buffer) Grid() analysis.Grid {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.grid
+}
+
+// Len returns the number of sweeps in the buffer.
+func (b *Buffer) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.rows)
+}
+
+// Rows returns the sweeps in the buffer, oldest first. The samples are
+// shared with the buffer and must not be modified.
+func (b *Buffer) Rows() []Row {
+	_, rows := b.snapshot()
+	return rows
+}
+
+// snapshot returns the grid and the rows, oldest first.
+func (b *Buffer) snapshot() (analysis.Grid, []Row) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	rows := make([]Row, 0, len(b.rows))
+	rows = append(rows, b.rows[b.next:]...)
+	return b.grid, append(rows, b.rows[:b.next]...)
+}
+
+// Reset discards all sweeps. The next sweep added sets the grid.
+func (b *Buffer) Reset() {
+	b.mu.Lock()
+	b.rows = nil
+	b.next = 0
+	b.mu.Unlock()
+}
@@ -0,0 +1,81 @@
+package spectrogram
+
+import (
+	"bytes"
+	"image/png"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/samuel/rfexplorer/rfx"
+)
+
+func TestBuffer(t *testing.T) {
+	b := New(2)
+	config := &rfx.CurrentConfigPacket{StartFreqKHZ: 2400000, FreqStepHZ: 1000000}
+	start := time.Date(2017, 1, 31, 23, 59, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		b.Add(start.Add(time.Duration(i)*time.Second), config, []float64{-100, float64(-90 + i), -80})
+	}
+	rows := b.Rows()
+	if len(rows) != 2 || rows[0].Samples[1] != -89 || rows[1].Samples[1] != -88 || !rows[1].Time.After(rows[0].Time) {
+		t.Fatalf("rows %+v, want the last two sweeps oldest first", rows)
+	}
+	// A sweep of another span is resampled onto the first span's grid.
+	b.Add(start.Add(3*time.Second), &rfx.CurrentConfigPacket{StartFreqKHZ: 2401000, FreqStepHZ: 1000000}, []float64{-70, -60})
+	last := b.Rows()[1].Samples
+	if !math.IsNaN(last[0]) || last[1] != -70 || last[2] != -60 {
+		t.Errorf("resampled sweep %v", last)
+	}
+	b.Reset()
+	if b.Len() != 0 {
+		t.Error("expected no sweeps after Reset")
+	}
+}
+
+func TestRenderPNG(t *testing.T) {
+	b := New(100)
+	config := &rfx.CurrentConfigPacket{StartFreqKHZ: 2400000, FreqStepHZ: 1000000}
+	start := time.Date(2017, 1, 31, 23, 59, 0, 0, time.UTC)
+	samples := make([]float64, 100)
+	for i := range samples {
+		samples[i] = -100
+	}
+	samples[0] = -40
+	for i := 0; i < 50; i++ {
+		b.Add(start.Add(time.Duration(i)*time.Second), config, samples)
+	}
+	var buf bytes.Buffer
+	if err := b.RenderPNG(&buf, Heat, RenderOptions{Width: 200, RowHeight: 2}); err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w, h := img.Bounds().Dx(), img.Bounds().Dy(); w != marginLeft+200+marginRight || h != marginTop+100+marginBottom {
+		t.Errorf("image is %dx%d", w, h)
+	}
+	// The strongest level is at the hot end of the palette, the weakest
+	// at the cold end.
+	hot, cold := Heat[len(Heat)-1], Heat[0]
+	if r, g, bl, _ := img.At(marginLeft, marginTop).RGBA(); r>>8 != uint32(hot.R) || g>>8 != uint32(hot.G) || bl>>8 != uint32(hot.B) {
+		t.Errorf("pixel of the strongest level is %v", img.At(marginLeft, marginTop))
+	}
+	if r, g, bl, _ := img.At(marginLeft+100, marginTop+50).RGBA(); r>>8 != uint32(cold.R) || g>>8 != uint32(cold.G) || bl>>8 != uint32(cold.B) {
+		t.Errorf("pixel of the weakest level is %v", img.At(marginLeft+100, marginTop+50))
+	}
+
+	if err := New(10).RenderPNG(&buf, Heat, RenderOptions{}); err == nil {
+		t.Error("expected an error rendering an empty buffer")
+	}
+}
+
+func TestPalette(t *testing.T) {
+	if c := Grayscale.At(0.5); c.R != 128 || c.G != 128 || c.B != 128 {
+		t.Errorf("middle of grayscale is %v", c)
+	}
+	if Heat.At(-1) != Heat[0] || Heat.At(2) != Heat[len(Heat)-1] {
+		t.Error("levels outside of the range aren't clamped")
+	}
+}
@@ -0,0 +1,120 @@
+package rfx
+
+import (
+	"fmt"
+	"strings"
+)
+
+// StateChange is a set of the parts of the device state tracked by the
+// RFExplorer.
+type StateChange int
+
+const (
+	// StateConfig is the analyzer configuration returned by Config.
+	StateConfig StateChange = 1 << iota
+	// StateSetup is the model and firmware returned by Setup.
+	StateSetup
+	// StateSerialNumber is the serial number returned by SerialNumber.
+	StateSerialNumber
+	// StateMode is the operating mode returned by Mode.
+	StateMode
+)
+
+func (c StateChange) String() string {
+	var parts []string
+	for _, s := range []struct {
+		c    StateChange
+		name string
+	}{
+		{StateConfig, "config"},
+		{StateSetup, "setup"},
+		{StateSerialNumber, "serial number"},
+		{StateMode, "mode"},
+	} {
+		if c&s.c != 0 {
+			parts = append(parts, s.name)
+			c &^= s.c
+		}
+	}
+	if c != 0 {
+		parts = append(parts, fmt.Sprintf("StateChange(%d)", int(c)))
+	}
+	return strings.Join(parts, "|")
+}
+
+// StateChangedPacket is sent to subscribers, see Subscribe, right after a
+// packet that changed the state tracked by the RFExplorer, with a snapshot
+// of the state. Packets that repeat the current state don't cause one. It
+// isn't sent to Chan.
+type StateChangedPacket struct {
+	Changed StateChange
+	// Config and Setup are nil and SerialNumber empty until the device
+	// reports them.
+	Config       *CurrentConfigPacket
+	Setup        *CurrentSetupPacket
+	SerialNumber string
+	Mode         Mode
+}
+
+func (p *StateChangedPacket) Type() string {
+	return "StateChanged"
+}
+
+// Mode returns the operating mode last reported by the device in an
+// analyzer or sniffer configuration, or ModeUnknown before it has reported
+// one.
+func (r *RFExplorer) Mode() Mode {
+	if mode, ok := r.mode.Load().(Mode); ok {
+		return mode
+	}
+	return ModeUnknown
+}
+
+// state returns a snapshot of the tracked state.
+func (r *RFExplorer) state(changed StateChange) *StateChangedPacket {
+	sn, _ := r.serialNumber.Load().(string)
+	return &StateChangedPacket{
+		Changed:      changed,
+		Config:       r.Config(),
+		Setup:        r.Setup(),
+		SerialNumber: sn,
+		Mode:         r.Mode(),
+	}
+}
+
+func (r *RFExplorer) storeConfig(config *CurrentConfigPacket) StateChange {
+	old := r.Config()
+	r.config.Store(config)
+	changed := r.storeMode(config.CurrentMode)
+	if old == nil || *old != *config {
+		changed |= StateConfig
+	}
+	return changed
+}
+
+func (r *RFExplorer) storeSetup(setup *CurrentSetupPacket) StateChange {
+	old := r.Setup()
+	r.setup.Store(setup)
+	if old == nil || *old != *setup {
+		return StateSetup
+	}
+	return 0
+}
+
+func (r *RFExplorer) storeSerialNumber(sn string) StateChange {
+	old, ok := r.serialNumber.Load().(string)
+	r.serialNumber.Store(sn)
+	if !ok || old != sn {
+		return StateSerialNumber
+	}
+	return 0
+}
+
+func (r *RFExplorer) storeMode(mode Mode) StateChange {
+	old, ok := r.mode.Load().(Mode)
+	r.mode.Store(mode)
+	if !ok || old != mode {
+		return StateMode
+	}
+	return 0
+}
@@ -0,0 +1,248 @@
+// Package store records sweeps to disk for long running monitors, keeping
+// full resolution data and downsampled summaries for separate retention
+// periods so that the disk doesn't fill up.
+//
+// Files are kept in two directories under the store's root, one file per
+// day of full resolution sweeps and one file per month of summaries:
+//
+//	full/2006-01-02.csv
+//	summary/2006-01.csv
+//
+// Both use the survey CSV format. Full resolution rows have an empty label
+// and summary rows are labeled "max" or "mean" with the time at the start
+// of the summary interval.
+package store
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/samuel/rfexplorer/rfx"
+	"github.com/samuel/rfexplorer/rfx/survey"
+)
+
+const (
+	fullDir       = "full"
+	summaryDir    = "summary"
+	dayFormat     = "2006-01-02"
+	monthFormat   = "2006-01"
+	fileExtension = ".csv"
+)
+
+// Policy controls how long data is kept.
+type Policy struct {
+	// FullRetention is how long full resolution sweeps are kept. Zero keeps
+	// them forever.
+	FullRetention time.Duration
+	// SummaryRetention is how long summaries are kept. Zero keeps them
+	// forever.
+	SummaryRetention time.Duration
+	// SummaryInterval is the period summarized by each summary row.
+	SummaryInterval time.Duration
+}
+
+// DefaultPolicy keeps a week of full resolution data and six months of one
+// minute summaries, which is a few GB for a continuously running analyzer.
+var DefaultPolicy = Policy{
+	FullRetention:    7 * 24 * time.Hour,
+	SummaryRetention: 183 * 24 * time.Hour,
+	SummaryInterval:  time.Minute,
+}
+
+// Store writes sweeps to rotating files in a directory.
+type Store struct {
+	dir    string
+	policy Policy
+
+	full        *os.File
+	fullW       *survey.Writer
+	fullDay     string
+	summary     *os.File
+	summaryW    *survey.Writer
+	summaryMon  string
+	windowStart time.Time
+	windowMax   *survey.Point
+	windowSum   []float64
+	windowN     int
+}
+
+// Open opens a store in dir, creating it if necessary, and prunes data that
+// is past its retention.
+func Open(dir string, policy Policy) (*Store, error) {
+	if policy.SummaryInterval <= 0 {
+		return nil, fmt.Errorf("rfx: summary interval must be positive")
+	}
+	for _, d := range []string{fullDir, summaryDir} {
+		if err := os.MkdirAll(filepath.Join(dir, d), 0755); err != nil {
+			return nil, err
+		}
+	}
+	s := &Store{dir: dir, policy: policy}
+	if err := s.Prune(time.Now()); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Add records a sweep received at time t.
+func (s *Store) Add(t time.Time, config *rfx.CurrentConfigPacket, samples []float64) error {
+	p := &survey.Point{
+		Time:        t,
+		StartFreqHZ: config.StartFreqKHZ * 1000,
+		StepHZ:      config.FreqStepHZ,
+		Samples:     samples,
+	}
+	if day := t.Format(dayFormat); day != s.fullDay {
+		if err := s.rotateFull(day); err != nil {
+			return err
+		}
+		// Rotation happens at most once a day which makes it a good time
+		// to check retention.
+		if err := s.Prune(t); err != nil {
+			return err
+		}
+	}
+	if err := s.fullW.Write(p); err != nil {
+		return err
+	}
+
+	if s.windowMax != nil && (t.Sub(s.windowStart) >= s.policy.SummaryInterval ||
+		s.windowMax.StartFreqHZ != p.StartFreqHZ || s.windowMax.StepHZ != p.StepHZ ||
+		len(s.windowMax.Samples) != len(samples)) {
+		if err := s.flushSummary(); err != nil {
+			return err
+		}
+	}
+	if s.windowMax == nil {
+		s.windowStart = t.Truncate(s.policy.SummaryInterval)
+		s.windowMax = &survey.Point{
+			Label:       "max",
+			Time:        s.windowStart,
+			StartFreqHZ: p.StartFreqHZ,
+			StepHZ:      p.StepHZ,
+			Samples:     append([]float64(nil), samples...),
+		}
+		s.windowSum = make([]float64, len(samples))
+	}
+	for i, v := range samples {
+		if v > s.windowMax.Samples[i] {
+			s.windowMax.Samples[i] = v
+		}
+		s.windowSum[i] += v
+	}
+	s.windowN++
+	return nil
+}
+
+// flushSummary writes the max and mean of the current summary window.
+func (s *Store) flushSummary() error {
+	if s.windowMax == nil {
+		return nil
+	}
+	max := s.windowMax
+	s.windowMax = nil
+	if mon := max.Time.Format(monthFormat); mon != s.summaryMon {
+		if s.summary != nil {
+			if err := s.summary.Close(); err != nil {
+				return err
+			}
+		}
+		f, err := openAppend(filepath.Join(s.dir, summaryDir, mon+fileExtension))
+		if err != nil {
+			return err
+		}
+		s.summary = f
+		s.summaryW = survey.NewWriter(f)
+		s.summaryMon = mon
+	}
+	mean := *max
+	mean.Label = "mean"
+	mean.Samples = make([]float64, len(s.windowSum))
+	for i, v := range s.windowSum {
+		mean.Samples[i] = v / float64(s.windowN)
+	}
+	s.windowN = 0
+	if err := s.summaryW.Write(max); err != nil {
+		return err
+	}
+	return s.summaryW.Write(&mean)
+}
+
+func (s *Store) rotateFull(day string) error {
+	if s.full != nil {
+		if err := s.full.Close(); err != nil {
+			return err
+		}
+	}
+	f, err := openAppend(filepath.Join(s.dir, fullDir, day+fileExtension))
+	if err != nil {
+		return err
+	}
+	s.full = f
+	s.fullW = survey.NewWriter(f)
+	s.fullDay = day
+	return nil
+}
+
+// Prune removes files whose newest possible data is older than the
+// retention period relative to now.
+func (s *Store) Prune(now time.Time) error {
+	if err := prune(filepath.Join(s.dir, fullDir), dayFormat, s.policy.FullRetention, now, func(t time.Time) time.Time {
+		return t.AddDate(0, 0, 1)
+	}); err != nil {
+		return err
+	}
+	return prune(filepath.Join(s.dir, summaryDir), monthFormat, s.policy.SummaryRetention, now, func(t time.Time) time.Time {
+		return t.AddDate(0, 1, 0)
+	})
+}
+
+func prune(dir, format string, retention time.Duration, now time.Time, end func(time.Time) time.Time) error {
+	if retention <= 0 {
+		return nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	cutoff := now.Add(-retention)
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, fileExtension) {
+			continue
+		}
+		t, err := time.ParseInLocation(format, strings.TrimSuffix(name, fileExtension), now.Location())
+		if err != nil {
+			// Not one of ours
+			continue
+		}
+		if !end(t).After(cutoff) {
+			if err := os.Remove(filepath.Join(dir, name)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Close writes the pending summary and closes the files.
+func (s *Store) Close() error {
+	err := s.flushSummary()
+	for _, f := range []*os.File{s.full, s.summary} {
+		if f != nil {
+			if e := f.Close(); err == nil {
+				err = e
+			}
+		}
+	}
+	s.full, s.summary = nil, nil
+	s.fullDay, s.summaryMon = "", ""
+	return err
+}
+
+func openAppend(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+}
@@ -0,0 +1,73 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/samuel/rfexplorer/rfx"
+	"github.com/samuel/rfexplorer/rfx/survey"
+)
+
+func TestStore(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, Policy{FullRetention: 24 * time.Hour, SummaryRetention: 60 * 24 * time.Hour, SummaryInterval: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &rfx.CurrentConfigPacket{StartFreqKHZ: 2400000, FreqStepHZ: 1000000}
+	start := time.Date(2017, 1, 31, 23, 59, 0, 0, time.Local)
+	for i, samples := range [][]float64{{-100, -40}, {-80, -60}, {-90, -90}} {
+		if err := s.Add(start.Add(time.Duration(i)*30*time.Second), config, samples); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"full/2017-01-31.csv", "full/2017-02-01.csv", "summary/2017-01.csv", "summary/2017-02.csv"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f, err := os.Open(filepath.Join(dir, "summary/2017-01.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	points, err := survey.ReadAll(f)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 2 || points[0].Label != "max" || points[1].Label != "mean" {
+		t.Fatalf("unexpected summary %+v", points)
+	}
+	if got := points[0].Samples; got[0] != -80 || got[1] != -40 {
+		t.Errorf("max = %v", got)
+	}
+	if got := points[1].Samples; got[0] != -90 || got[1] != -50 {
+		t.Errorf("mean = %v", got)
+	}
+
+	if err := s.Prune(time.Date(2017, 2, 2, 12, 0, 0, 0, time.Local)); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]bool{
+		"full/2017-01-31.csv": false,
+		"full/2017-02-01.csv": true,
+		"summary/2017-01.csv": true,
+	} {
+		_, err := os.Stat(filepath.Join(dir, name))
+		if exists := err == nil; exists != want {
+			t.Errorf("%s exists = %t, want %t", name, exists, want)
+		}
+	}
+	if err := s.Prune(time.Date(2017, 4, 15, 12, 0, 0, 0, time.Local)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "summary/2017-01.csv")); err == nil {
+		t.Error("January summary should have been pruned")
+	}
+}
@@ -0,0 +1,114 @@
+package rfx
+
+import (
+	"sync"
+)
+
+// PacketType is the type of a packet as returned by its Type method, such
+// as "SweepData" or "CurrentConfig".
+type PacketType string
+
+// subscriptionSize is the number of packets a subscription buffers.
+const subscriptionSize = 16
+
+// subscription is a channel from Subscribe.
+type subscription struct {
+	ch    chan Packet
+	types map[PacketType]bool // nil for all types
+	done  chan struct{}       // closed on unsubscribe
+	once  sync.Once
+}
+
+// subscriptions are the channels returned by Subscribe.
+type subscriptions struct {
+	mu     sync.Mutex
+	list   []*subscription
+	closed bool // the reader has stopped
+}
+
+func (ss *subscriptions) active() bool {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	return len(ss.list) != 0
+}
+
+// publish sends pkt to the subscriptions that want it and returns the
+// number of packets dropped by policy. Like Chan, a subscription doesn't
+// hold up the reader once wake is closed. It holds the lock while sending so
+// that a subscription isn't closed during the send, an unsubscribe closes
+// done first to end a send that's waiting.
+func (ss *subscriptions) publish(pkt Packet, policy Backpressure, wake <-chan struct{}) int {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	dropped := 0
+	for _, s := range ss.list {
+		if s.types == nil || s.types[PacketType(pkt.Type())] {
+			if sweep, ok := pkt.(*SweepDataPacket); ok {
+				// Set before the sweep reaches Chan or any subscriber.
+				sweep.shared = true
+			}
+			dropped += deliver(s.ch, pkt, policy, s.done, wake)
+		}
+	}
+	return dropped
+}
+
+func (ss *subscriptions) remove(s *subscription) {
+	s.once.Do(func() {
+		close(s.done)
+		ss.mu.Lock()
+		defer ss.mu.Unlock()
+		for i, x := range ss.list {
+			if x == s {
+				ss.list = append(ss.list[:i], ss.list[i+1:]...)
+				close(s.ch)
+				return
+			}
+		}
+	})
+}
+
+// closeAll closes every subscription once the reader has stopped.
+func (ss *subscriptions) closeAll() {
+	ss.mu.Lock()
+	ss.closed = true
+	list := ss.list
+	ss.mu.Unlock()
+	for _, s := range list {
+		ss.remove(s)
+	}
+}
+
+// Subscribe returns a channel that receives every packet of the given types,
+// or all packets if no types are given, and a function that ends the
+// subscription and closes the channel. Each subscriber has its own buffer
+// so several can consume the same stream without taking packets from each
+// other. The packets themselves are shared with Chan and the other
+// subscribers, so a subscriber must not modify them, and releasing a
+// sweep it received is a no-op. A subscriber that doesn't keep up is
+// handled by the WithBackpressure policy like Chan is; with the default
+// policy it holds up the reader, and with it every other subscriber. The
+// channel is closed when the connection is closed or lost.
+//
+// While there are subscribers Chan drops its oldest packets when full
+// rather than hold up the reader, so it can be left unread.
+func (r *RFExplorer) Subscribe(types ...PacketType) (<-chan Packet, func()) {
+	s := &subscription{
+		ch:   make(chan Packet, subscriptionSize),
+		done: make(chan struct{}),
+	}
+	if len(types) != 0 {
+		s.types = make(map[PacketType]bool, len(types))
+		for _, t := range types {
+			s.types[t] = true
+		}
+	}
+	r.subs.mu.Lock()
+	if r.subs.closed {
+		close(s.ch)
+	} else {
+		r.subs.list = append(r.subs.list, s)
+	}
+	r.subs.mu.Unlock()
+	return s.ch, func() { r.subs.remove(s) }
+}
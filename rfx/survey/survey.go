@@ -0,0 +1,105 @@
+// Package survey records spectrum snapshots against locations for site
+// surveys, producing a dataset that can be turned into heatmaps or reports.
+package survey
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Point is a max-hold snapshot of a frequency range taken at a location.
+type Point struct {
+	// Label identifies the location, e.g. "Room 204, NE corner".
+	Label       string
+	Time        time.Time
+	StartFreqHZ int
+	StepHZ      int
+	Samples     []float64
+}
+
+// FreqHZ returns the frequency of sample i.
+func (p *Point) FreqHZ(i int) int {
+	return p.StartFreqHZ + i*p.StepHZ
+}
+
+// PeakDBM returns the strongest sample and its frequency.
+func (p *Point) PeakDBM() (freqHZ int, dbm float64) {
+	dbm = -999
+	for i, s := range p.Samples {
+		if s > dbm {
+			freqHZ, dbm = p.FreqHZ(i), s
+		}
+	}
+	return freqHZ, dbm
+}
+
+// Writer writes points as CSV, one point per row:
+//
+//	label,time,start_freq_hz,step_hz,sample0,sample1,...
+//
+// Time is formatted as RFC 3339 and samples are in dBm.
+type Writer struct {
+	w *csv.Writer
+}
+
+// NewWriter returns a Writer that writes to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: csv.NewWriter(w)}
+}
+
+// Write writes a point and flushes it so that a survey interrupted part way
+// through keeps all points recorded so far.
+func (w *Writer) Write(p *Point) error {
+	rec := make([]string, 0, 4+len(p.Samples))
+	rec = append(rec,
+		p.Label,
+		p.Time.Format(time.RFC3339),
+		strconv.Itoa(p.StartFreqHZ),
+		strconv.Itoa(p.StepHZ))
+	for _, s := range p.Samples {
+		rec = append(rec, strconv.FormatFloat(s, 'f', 1, 64))
+	}
+	if err := w.w.Write(rec); err != nil {
+		return err
+	}
+	w.w.Flush()
+	return w.w.Error()
+}
+
+// ReadAll reads all points written by a Writer.
+func ReadAll(r io.Reader) ([]*Point, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	var points []*Point
+	for line := 1; ; line++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return points, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if len(rec) < 4 {
+			return nil, fmt.Errorf("rfx: survey line %d has %d fields, expected at least 4", line, len(rec))
+		}
+		p := &Point{Label: rec[0]}
+		if p.Time, err = time.Parse(time.RFC3339, rec[1]); err != nil {
+			return nil, fmt.Errorf("rfx: survey line %d: %s", line, err)
+		}
+		if p.StartFreqHZ, err = strconv.Atoi(rec[2]); err != nil {
+			return nil, fmt.Errorf("rfx: survey line %d: %s", line, err)
+		}
+		if p.StepHZ, err = strconv.Atoi(rec[3]); err != nil {
+			return nil, fmt.Errorf("rfx: survey line %d: %s", line, err)
+		}
+		p.Samples = make([]float64, len(rec)-4)
+		for i, s := range rec[4:] {
+			if p.Samples[i], err = strconv.ParseFloat(s, 64); err != nil {
+				return nil, fmt.Errorf("rfx: survey line %d: %s", line, err)
+			}
+		}
+		points = append(points, p)
+	}
+}
@@ -0,0 +1,44 @@
+package survey
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRoundTrip(t *testing.T) {
+	points := []*Point{
+		{
+			Label:       "Room 204, NE corner",
+			Time:        time.Date(2017, 3, 4, 10, 30, 0, 0, time.UTC),
+			StartFreqHZ: 2400000000,
+			StepHZ:      1000000,
+			Samples:     []float64{-95.5, -40, -87},
+		},
+		{
+			Label:       "Lobby",
+			Time:        time.Date(2017, 3, 4, 10, 35, 0, 0, time.UTC),
+			StartFreqHZ: 2400000000,
+			StepHZ:      1000000,
+			Samples:     []float64{-101, -99.5, -60},
+		},
+	}
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	for _, p := range points {
+		if err := w.Write(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := ReadAll(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, points) {
+		t.Fatalf("got %+v, want %+v", got, points)
+	}
+	if f, dbm := got[1].PeakDBM(); f != 2402000000 || dbm != -60 {
+		t.Errorf("PeakDBM = %d, %.1f", f, dbm)
+	}
+}
@@ -0,0 +1,231 @@
+// Package tinysa provides an interface to the tinySA and tinySA Ultra
+// spectrum analyzers over their USB serial console. It implements
+// rfx.SpectrumSource so that tools written for the RF Explorer can use a
+// tinySA instead.
+package tinysa
+
+// https://tinysa.org/wiki/pmwiki.php?n=Main.USBInterface
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jacobsa/go-serial/serial"
+	"github.com/samuel/rfexplorer/rfx"
+)
+
+const prompt = "ch> "
+
+// Model is the hardware model of a tinySA.
+type Model int
+
+const (
+	ModelBasic Model = iota
+	ModelUltra
+)
+
+func (m Model) String() string {
+	switch m {
+	case ModelBasic:
+		return "tinySA"
+	case ModelUltra:
+		return "tinySA Ultra"
+	}
+	return fmt.Sprintf("Model(%d)", int(m))
+}
+
+// TinySA is a connection to a tinySA.
+type TinySA struct {
+	port    io.ReadWriteCloser
+	r       *bufio.Reader
+	model   Model
+	version string
+	// startFreqKHZ and endFreqKHZ is the range set by Configure.
+	startFreqKHZ int
+	endFreqKHZ   int
+	// Points is the number of points measured per sweep.
+	Points int
+}
+
+// Open opens a connection to a tinySA on the provided serial device.
+func Open(device string) (*TinySA, error) {
+	port, err := serial.Open(serial.OpenOptions{
+		PortName:        device,
+		BaudRate:        115200,
+		DataBits:        8,
+		ParityMode:      serial.PARITY_NONE,
+		StopBits:        1,
+		MinimumReadSize: 1,
+	})
+	if err != nil {
+		return nil, err
+	}
+	t, err := New(port)
+	if err != nil {
+		port.Close()
+		return nil, err
+	}
+	return t, nil
+}
+
+// New returns a connection to a tinySA over port and queries its version.
+func New(port io.ReadWriteCloser) (*TinySA, error) {
+	t := &TinySA{port: port, r: bufio.NewReader(port)}
+	// An empty command gets the console to a known state with any partial
+	// input discarded.
+	if _, err := t.Command(""); err != nil {
+		return nil, err
+	}
+	lines, err := t.Command("version")
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("tinysa: empty version response")
+	}
+	t.version = lines[0]
+	t.Points = 290
+	if strings.HasPrefix(t.version, "tinySA4") {
+		t.model = ModelUltra
+		t.Points = 450
+	}
+	return t, nil
+}
+
+// Close closes the connection.
+func (t *TinySA) Close() error {
+	return t.port.Close()
+}
+
+// Model returns the hardware model.
+func (t *TinySA) Model() Model {
+	return t.model
+}
+
+// Version returns the firmware version string.
+func (t *TinySA) Version() string {
+	return t.version
+}
+
+// minFreqKHZ is the lowest frequency of every tinySA model.
+const minFreqKHZ = 100
+
+// MaxFreqKHZ returns the highest frequency the model can measure.
+func (t *TinySA) MaxFreqKHZ() int {
+	if t.model == ModelUltra {
+		return 6000000
+	}
+	// With the high input
+	return 960000
+}
+
+// Command sends a console command and returns the lines of output without
+// the echoed command.
+func (t *TinySA) Command(cmd string) ([]string, error) {
+	if _, err := io.WriteString(t.port, cmd+"\r"); err != nil {
+		return nil, fmt.Errorf("tinysa: failed to write to port: %s", err)
+	}
+	var out []byte
+	for !bytes.HasSuffix(out, []byte(prompt)) {
+		b, err := t.r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("tinysa: failed to read from port: %s", err)
+		}
+		out = append(out, b)
+	}
+	out = out[:len(out)-len(prompt)]
+	lines := strings.Split(strings.ReplaceAll(string(out), "\r", ""), "\n")
+	// The first line is the echo of the command and the last is empty.
+	if len(lines) > 0 && strings.TrimSpace(lines[0]) == cmd {
+		lines = lines[1:]
+	}
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines, nil
+}
+
+// Sweep measures a single sweep of the given range.
+func (t *TinySA) Sweep(startFreqKHZ, endFreqKHZ int) (*rfx.CurrentConfigPacket, []float64, error) {
+	// Output mask 3 prints the frequency and level of every point.
+	lines, err := t.Command(fmt.Sprintf("scan %d %d %d 3", startFreqKHZ*1000, endFreqKHZ*1000, t.Points))
+	if err != nil {
+		return nil, nil, err
+	}
+	freqs := make([]int, 0, len(lines))
+	samples := make([]float64, 0, len(lines))
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, nil, fmt.Errorf("tinysa: unexpected scan output %q", line)
+		}
+		f, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			return nil, nil, fmt.Errorf("tinysa: bad frequency in %q", line)
+		}
+		l, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return nil, nil, fmt.Errorf("tinysa: bad level in %q", line)
+		}
+		freqs = append(freqs, int(f))
+		samples = append(samples, l)
+	}
+	if len(samples) < 2 {
+		return nil, nil, fmt.Errorf("tinysa: scan returned %d points", len(samples))
+	}
+	config := &rfx.CurrentConfigPacket{
+		StartFreqKHZ: freqs[0] / 1000,
+		FreqStepHZ:   (freqs[len(freqs)-1] - freqs[0]) / (len(freqs) - 1),
+		AmpTopDBM:    0,
+		AmpBottomDBM: -120,
+		SweepSteps:   len(samples),
+		CurrentMode:  rfx.ModeSpectrumAnalyzer,
+		MinFreqKHZ:   minFreqKHZ,
+		MaxFreqKHZ:   t.MaxFreqKHZ(),
+		MaxSpan:      t.MaxFreqKHZ() - minFreqKHZ,
+	}
+	return config, samples, nil
+}
+
+// Info describes the tinySA. It implements rfx.SpectrumSource.
+func (t *TinySA) Info() rfx.SourceInfo {
+	return rfx.SourceInfo{
+		Name:       t.model.String(),
+		Firmware:   t.version,
+		MinFreqKHZ: minFreqKHZ,
+		MaxFreqKHZ: t.MaxFreqKHZ(),
+	}
+}
+
+// Configure sets the range swept by Sweeps. The range is clamped to the
+// frequencies the tinySA covers. It implements rfx.SpectrumSource.
+func (t *TinySA) Configure(startFreqKHZ, endFreqKHZ int) error {
+	if startFreqKHZ >= endFreqKHZ {
+		return fmt.Errorf("tinysa: start frequency must be below end frequency")
+	}
+	limits := rfx.FreqLimits{MinFreqKHZ: minFreqKHZ, MaxFreqKHZ: t.MaxFreqKHZ()}
+	t.startFreqKHZ, t.endFreqKHZ = limits.Clamp(startFreqKHZ, endFreqKHZ)
+	return nil
+}
+
+// Sweeps sweeps the configured range repeatedly and calls fn for every
+// sweep until ctx is done. It implements rfx.SpectrumSource.
+func (t *TinySA) Sweeps(ctx context.Context, fn func(*rfx.Sweep)) error {
+	if t.endFreqKHZ == 0 {
+		return fmt.Errorf("tinysa: Configure must be called before Sweeps")
+	}
+	for ctx.Err() == nil {
+		config, samples, err := t.Sweep(t.startFreqKHZ, t.endFreqKHZ)
+		if err != nil {
+			return err
+		}
+		fn(&rfx.Sweep{Time: time.Now(), Config: config, Samples: samples})
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package tinysa
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/samuel/rfexplorer/rfx"
+)
+
+var _ rfx.SpectrumSource = &TinySA{}
+
+// fakeDevice emulates the tinySA console on the other end of a pipe.
+func fakeDevice(version string) io.ReadWriteCloser {
+	hostR, devW := io.Pipe()
+	devR, hostW := io.Pipe()
+	go func() {
+		defer devW.Close()
+		r := bufio.NewReader(devR)
+		for {
+			cmd, err := r.ReadString('\r')
+			if err != nil {
+				return
+			}
+			cmd = strings.TrimSuffix(cmd, "\r")
+			out := cmd + "\r\n"
+			fields := strings.Fields(cmd)
+			switch {
+			case cmd == "":
+			case cmd == "version":
+				out += version + "\r\nHW Version:V0.4.5.1\r\n"
+			case len(fields) == 5 && fields[0] == "scan":
+				start, _ := strconv.Atoi(fields[1])
+				stop, _ := strconv.Atoi(fields[2])
+				n, _ := strconv.Atoi(fields[3])
+				for i := 0; i < n; i++ {
+					out += fmt.Sprintf("%d %.6e \r\n", start+i*(stop-start)/(n-1), -100.0+float64(i))
+				}
+			default:
+				out += cmd + "?\r\n"
+			}
+			if _, err := io.WriteString(devW, out+prompt); err != nil {
+				return
+			}
+		}
+	}()
+	return struct {
+		io.Reader
+		io.WriteCloser
+	}{hostR, hostW}
+}
+
+func TestScan(t *testing.T) {
+	sa, err := New(fakeDevice("tinySA4_v1.4-143-g864bb27"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sa.Close()
+	if sa.Model() != ModelUltra || sa.Points != 450 {
+		t.Fatalf("model %s with %d points, want Ultra with 450", sa.Model(), sa.Points)
+	}
+	sa.Points = 11
+	config, samples, err := rfx.MaxHold(cancelAfter(1), sa, 100000, 101000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.StartFreqKHZ != 100000 || config.FreqStepHZ != 100000 || len(samples) != 11 {
+		t.Fatalf("unexpected sweep %+v with %d samples", config, len(samples))
+	}
+	if samples[0] != -100 || samples[10] != -90 {
+		t.Errorf("unexpected samples %v", samples)
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	sa, err := New(fakeDevice("tinySA_v1.3-143-g864bb27"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sa.Close()
+	// Clamped to 100 kHz-960 MHz like an RF Explorer clamps to its module.
+	if err := sa.Configure(50, 1000000); err != nil {
+		t.Fatal(err)
+	}
+	if sa.startFreqKHZ != 100 || sa.endFreqKHZ != 960000 {
+		t.Errorf("configured %d-%d kHz, want 100-960000", sa.startFreqKHZ, sa.endFreqKHZ)
+	}
+	if err := sa.Configure(2000, 1000); err == nil {
+		t.Error("expected an error for an empty range")
+	}
+}
+
+// cancelAfter returns a context that's canceled after n calls to Err.
+func cancelAfter(n int) context.Context {
+	return &countingContext{Context: context.Background(), n: n}
+}
+
+type countingContext struct {
+	context.Context
+	n int
+}
+
+func (c *countingContext) Err() error {
+	if c.n <= 0 {
+		return context.Canceled
+	}
+	c.n--
+	return nil
+}
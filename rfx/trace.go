@@ -0,0 +1,80 @@
+package rfx
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// traceTimeFormat is the format of the timestamps in a protocol trace.
+const traceTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+// tracer holds the logger and the protocol trace writer.
+type tracer struct {
+	mu     sync.Mutex
+	logger *slog.Logger
+	w      io.Writer
+}
+
+// discardHandler is a slog.Handler that drops everything, used when no
+// logger was set.
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
+
+var discardLogger = slog.New(discardHandler{})
+
+func (t *tracer) set(logger *slog.Logger, w io.Writer) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.logger = logger
+	t.w = w
+}
+
+// log returns the logger, which discards everything if none was set.
+func (t *tracer) log() *slog.Logger {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.logger == nil {
+		return discardLogger
+	}
+	return t.logger
+}
+
+// frame writes b to the trace, if there is one, as a header line followed
+// by a hex and ASCII dump. dir is TX or RX and what describes the frame.
+func (t *tracer) frame(at time.Time, dir, what string, b []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.w == nil {
+		return
+	}
+	fmt.Fprintf(t.w, "%s %s %s %d bytes\n%s", at.Format(traceTimeFormat), dir, what, len(b), hex.Dump(b))
+}
+
+// WithLogger sets a logger for connection events such as lost connections,
+// reconnects, undecodable data, and state changes. Commands sent are
+// logged at debug level. By default nothing is logged.
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// WithTraceWriter makes the connection write every command sent and every
+// frame received to w with a timestamp, as a hex and ASCII dump, to debug
+// protocol issues. Received frames are labeled with the type of packet
+// they were decoded as. Unlike SetCapture the trace isn't meant to be
+// replayed.
+func WithTraceWriter(w io.Writer) Option {
+	return func(o *options) {
+		o.trace = w
+	}
+}
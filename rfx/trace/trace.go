@@ -0,0 +1,195 @@
+// Package trace derives the traces a spectrum analyzer displays from a
+// stream of sweeps: the live sweep, max-hold, min-hold, and an exponential
+// average. Traces are kept for each configuration so that switching back to
+// a span continues its traces where they were left.
+package trace
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/samuel/rfexplorer/rfx"
+)
+
+// Kind is a kind of trace.
+type Kind int
+
+const (
+	Live Kind = iota
+	MaxHold
+	MinHold
+	Average
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Live:
+		return "Live"
+	case MaxHold:
+		return "MaxHold"
+	case MinHold:
+		return "MinHold"
+	case Average:
+		return "Average"
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+// DefaultAlpha is the weight of each new sweep in the average if none is
+// given.
+const DefaultAlpha = 0.2
+
+// Key identifies the frequencies of a sweep. Traces of sweeps with the same
+// key are combined.
+type Key struct {
+	StartFreqKHZ int
+	FreqStepHZ   int
+	Steps        int
+}
+
+// KeyOf returns the key of a sweep of the given config.
+func KeyOf(config *rfx.CurrentConfigPacket, samples []float64) Key {
+	return Key{StartFreqKHZ: config.StartFreqKHZ, FreqStepHZ: config.FreqStepHZ, Steps: len(samples)}
+}
+
+// Traces are the traces of a configuration.
+type Traces struct {
+	Config  *rfx.CurrentConfigPacket
+	Live    []float64
+	MaxHold []float64
+	MinHold []float64
+	Average []float64
+	// Sweeps is the number of sweeps combined.
+	Sweeps int
+}
+
+// Trace returns the trace of the given kind.
+func (t *Traces) Trace(k Kind) []float64 {
+	switch k {
+	case Live:
+		return t.Live
+	case MaxHold:
+		return t.MaxHold
+	case MinHold:
+		return t.MinHold
+	case Average:
+		return t.Average
+	}
+	return nil
+}
+
+func (t *Traces) clone() *Traces {
+	return &Traces{
+		Config:  t.Config,
+		Live:    append([]float64(nil), t.Live...),
+		MaxHold: append([]float64(nil), t.MaxHold...),
+		MinHold: append([]float64(nil), t.MinHold...),
+		Average: append([]float64(nil), t.Average...),
+		Sweeps:  t.Sweeps,
+	}
+}
+
+// Engine maintains traces from a stream of sweeps. It's safe to add sweeps
+// from one goroutine and read traces from others.
+type Engine struct {
+	mu     sync.Mutex
+	alpha  float64
+	traces map[Key]*Traces
+	active Key
+}
+
+// New returns an Engine that averages with the given weight of each new
+// sweep, between 0 and 1, or DefaultAlpha if 0.
+func New(alpha float64) *Engine {
+	e := &Engine{traces: make(map[Key]*Traces)}
+	e.SetAlpha(alpha)
+	return e
+}
+
+// SetAlpha sets the weight of each new sweep in the average, between 0 and
+// 1, or DefaultAlpha if 0. Higher weights follow changes faster, 1 makes
+// the average the live sweep.
+func (e *Engine) SetAlpha(alpha float64) {
+	if alpha <= 0 {
+		alpha = DefaultAlpha
+	} else if alpha > 1 {
+		alpha = 1
+	}
+	e.mu.Lock()
+	e.alpha = alpha
+	e.mu.Unlock()
+}
+
+// Add adds a sweep of the given config, which becomes the active
+// configuration.
+func (e *Engine) Add(config *rfx.CurrentConfigPacket, samples []float64) {
+	key := KeyOf(config, samples)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.active = key
+	t := e.traces[key]
+	if t == nil {
+		t = &Traces{
+			Live:    make([]float64, len(samples)),
+			MaxHold: append([]float64(nil), samples...),
+			MinHold: append([]float64(nil), samples...),
+			Average: append([]float64(nil), samples...),
+		}
+		e.traces[key] = t
+	}
+	t.Config = config
+	t.Sweeps++
+	copy(t.Live, samples)
+	for i, s := range samples {
+		if s > t.MaxHold[i] {
+			t.MaxHold[i] = s
+		}
+		if s < t.MinHold[i] {
+			t.MinHold[i] = s
+		}
+		t.Average[i] += e.alpha * (s - t.Average[i])
+	}
+}
+
+// Active returns a copy of the traces of the configuration of the last
+// sweep added, or nil before any sweeps.
+func (e *Engine) Active() *Traces {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	t := e.traces[e.active]
+	if t == nil {
+		return nil
+	}
+	return t.clone()
+}
+
+// Get returns a copy of the traces of a configuration, or nil if there
+// haven't been any sweeps of it.
+func (e *Engine) Get(key Key) *Traces {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	t := e.traces[key]
+	if t == nil {
+		return nil
+	}
+	return t.clone()
+}
+
+// Trace returns a copy of the trace of the given kind of the active
+// configuration, or nil before any sweeps.
+func (e *Engine) Trace(k Kind) []float64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	t := e.traces[e.active]
+	if t == nil {
+		return nil
+	}
+	return append([]float64(nil), t.Trace(k)...)
+}
+
+// Reset discards the traces of all configurations.
+func (e *Engine) Reset() {
+	e.mu.Lock()
+	e.traces = make(map[Key]*Traces)
+	e.mu.Unlock()
+}
@@ -0,0 +1,55 @@
+package trace
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/samuel/rfexplorer/rfx"
+)
+
+func TestEngine(t *testing.T) {
+	e := New(0.5)
+	if e.Active() != nil || e.Trace(Live) != nil {
+		t.Fatal("expected no traces before any sweeps")
+	}
+	wifi := &rfx.CurrentConfigPacket{StartFreqKHZ: 2400000, FreqStepHZ: 1000000}
+	e.Add(wifi, []float64{-100, -40, -80})
+	e.Add(wifi, []float64{-90, -60, -80})
+	want := &Traces{
+		Config:  wifi,
+		Live:    []float64{-90, -60, -80},
+		MaxHold: []float64{-90, -40, -80},
+		MinHold: []float64{-100, -60, -80},
+		Average: []float64{-95, -50, -80},
+		Sweeps:  2,
+	}
+	if got := e.Active(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+
+	// Another span has traces of its own, and switching back continues
+	// the first span's.
+	ism := &rfx.CurrentConfigPacket{StartFreqKHZ: 433000, FreqStepHZ: 10000}
+	e.Add(ism, []float64{-110, -50})
+	if got := e.Trace(MaxHold); !reflect.DeepEqual(got, []float64{-110, -50}) {
+		t.Errorf("max-hold of the second span is %v", got)
+	}
+	e.Add(wifi, []float64{-70, -70, -70})
+	if got := e.Trace(MaxHold); !reflect.DeepEqual(got, []float64{-70, -40, -70}) {
+		t.Errorf("max-hold after switching back is %v", got)
+	}
+	if got := e.Get(KeyOf(ism, make([]float64, 2))); got == nil || got.Sweeps != 1 {
+		t.Errorf("traces of the second span %+v", got)
+	}
+
+	// Copies are returned.
+	e.Trace(Live)[0] = 0
+	if e.Trace(Live)[0] != -70 {
+		t.Error("modifying a returned trace changed the engine's")
+	}
+
+	e.Reset()
+	if e.Active() != nil {
+		t.Error("expected no traces after Reset")
+	}
+}
@@ -0,0 +1,159 @@
+package rfx
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jacobsa/go-serial/serial"
+)
+
+// Transport is the connection to a device. It's a serial port for a local
+// device, see OpenSerial, but can be anything that carries the byte stream
+// such as a TCP connection to ser2net or an in-memory test double, see
+// NewWithTransport.
+type Transport interface {
+	io.ReadWriteCloser
+}
+
+// ReceiveTimer is implemented by transports that know when the data they
+// return was received, such as one that plays back a recording. Packets
+// are timestamped with the ReceiveTime of the read that completed them
+// instead of the current time.
+type ReceiveTimer interface {
+	// ReceiveTime returns when the data returned by the last Read was
+	// received.
+	ReceiveTime() time.Time
+}
+
+// OpenSerial opens the serial port of an RF Explorer. DTR and RTS are
+// deasserted on every platform. The device doesn't use them, but Linux and
+// macOS assert them on open while Windows, where the RF Explorer's own
+// client runs, doesn't.
+func OpenSerial(device string, br BaudRate) (Transport, error) {
+	if runtime.GOOS == "windows" && !strings.HasPrefix(device, `\\.\`) {
+		// COM10 and above can only be opened through the device
+		// namespace, which works for the others as well.
+		device = `\\.\` + device
+	}
+	port, err := serial.Open(serial.OpenOptions{
+		PortName:        device,
+		BaudRate:        uint(br),
+		DataBits:        8,
+		ParityMode:      serial.PARITY_NONE,
+		StopBits:        1,
+		MinimumReadSize: 1,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := clearModemLines(port); err != nil {
+		port.Close()
+		return nil, fmt.Errorf("rfx: %s: %s", device, err)
+	}
+	return port, nil
+}
+
+const (
+	// dialTimeout is how long Dial waits to connect.
+	dialTimeout = 10 * time.Second
+	// tcpKeepAlive is the keepalive period of network connections, so
+	// that a peer that went away without closing the connection is
+	// noticed and the connection reopened.
+	tcpKeepAlive = 15 * time.Second
+	// shareWriteTimeout is how long Share waits for a client to take what
+	// the device sent before disconnecting it, so that a client that
+	// can't keep up doesn't hold up reading the device.
+	shareWriteTimeout = 5 * time.Second
+)
+
+// Dial connects to an RF Explorer shared over the network, by Share or a
+// serial to network bridge such as ser2net, and waits for it to report its
+// configuration. The address has the form tcp://host:port. With
+// WithAutoReconnect a lost connection is dialed again.
+func Dial(addr string, opts ...Option) (*RFExplorer, error) {
+	hostport := strings.TrimPrefix(addr, "tcp://")
+	if hostport == addr {
+		return nil, fmt.Errorf("rfx: unsupported address %q, expected tcp://host:port", addr)
+	}
+	dial := func() (Transport, error) {
+		d := net.Dialer{Timeout: dialTimeout, KeepAlive: tcpKeepAlive}
+		return d.Dial("tcp", hostport)
+	}
+	t, err := dial()
+	if err != nil {
+		return nil, err
+	}
+	return NewWithTransport(t, append([]Option{WithRedial(dial)}, opts...)...)
+}
+
+// Share makes the device connected to t available to one network client
+// at a time, as used by Dial. Anything the device sends while no client is
+// connected is dropped, and further clients are turned away while one is
+// connected. A client that doesn't keep up with the device is disconnected.
+// Clients aren't authenticated, so l should only be reachable by trusted
+// ones. It returns when accepting fails or the device can't be read, and
+// closes l in the latter case.
+func Share(l net.Listener, t Transport) error {
+	var mu sync.Mutex
+	var client net.Conn
+	readErr := make(chan error, 1)
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, err := t.Read(buf)
+			if n > 0 {
+				mu.Lock()
+				c := client
+				mu.Unlock()
+				if c != nil {
+					c.SetWriteDeadline(time.Now().Add(shareWriteTimeout))
+					if _, err := c.Write(buf[:n]); err != nil {
+						// Ends the copy to the device, which lets
+						// the next client in.
+						c.Close()
+					}
+				}
+			}
+			if err != nil {
+				readErr <- err
+				l.Close()
+				return
+			}
+		}
+	}()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			select {
+			case err := <-readErr:
+				return fmt.Errorf("rfx: failed to read from device: %s", err)
+			default:
+			}
+			return err
+		}
+		if tc, ok := conn.(*net.TCPConn); ok {
+			tc.SetKeepAlive(true)
+			tc.SetKeepAlivePeriod(tcpKeepAlive)
+		}
+		mu.Lock()
+		if client != nil {
+			mu.Unlock()
+			conn.Close()
+			continue
+		}
+		client = conn
+		mu.Unlock()
+		go func() {
+			io.Copy(t, conn)
+			conn.Close()
+			mu.Lock()
+			client = nil
+			mu.Unlock()
+		}()
+	}
+}
@@ -0,0 +1,218 @@
+package rfx
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ValidationError describes a parameter that is outside of what the device
+// supports.
+type ValidationError struct {
+	// Field is the name of the parameter.
+	Field string
+	Value interface{}
+	// Supported describes the values the device supports.
+	Supported string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("rfx: invalid %s %v: %s", e.Field, e.Value, e.Supported)
+}
+
+// ValidationErrors is a list of invalid parameters.
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	s := make([]string, len(e))
+	for i, err := range e {
+		s[i] = fmt.Sprintf("invalid %s %v: %s", err.Field, err.Value, err.Supported)
+	}
+	return "rfx: " + strings.Join(s, "; ")
+}
+
+// Validate checks that the preset can be stored on a device with the given
+// number of preset slots and returns a ValidationErrors listing every
+// invalid field.
+func (p *Preset) Validate(slots int) error {
+	var errs ValidationErrors
+	check := func(ok bool, field string, value interface{}, supported string) {
+		if !ok {
+			errs = append(errs, &ValidationError{Field: field, Value: value, Supported: supported})
+		}
+	}
+	check(p.Index >= 0 && p.Index < slots, "Index", p.Index, fmt.Sprintf("must be in the range [0,%d]", slots-1))
+	check(len(p.Name) <= 12, "Name", fmt.Sprintf("%q", p.Name), "must be at most 12 characters")
+	for _, c := range p.Name {
+		if c < 0x20 || c > 0x7e {
+			check(false, "Name", fmt.Sprintf("%q", p.Name), fmt.Sprintf("character %q is not printable 7-bit ASCII", c))
+			break
+		}
+	}
+	check(p.MinFreqKHz >= 0, "MinFreqKHz", p.MinFreqKHz, "must not be negative")
+	check(p.MaxFreqKHz > p.MinFreqKHz, "MaxFreqKHz", p.MaxFreqKHz, fmt.Sprintf("must be above MinFreqKHz (%d)", p.MinFreqKHz))
+	check(p.AmpTopDBm >= -110 && p.AmpTopDBm <= 35, "AmpTopDBm", p.AmpTopDBm, "must be in the range [-110,35]")
+	check(p.AmpBottomDBm >= -120 && p.AmpBottomDBm <= 25, "AmpBottomDBm", p.AmpBottomDBm, "must be in the range [-120,25]")
+	check(p.AmpTopDBm-p.AmpBottomDBm >= 10, "AmpBottomDBm", p.AmpBottomDBm, fmt.Sprintf("must be at least 10 dB below AmpTopDBm (%d)", p.AmpTopDBm))
+	check(p.CalcMode >= CalculatorModeNormal && p.CalcMode <= CalculatorModeMaxHold, "CalcMode", p.CalcMode, "unknown calculator mode")
+	check(p.CalcIterations >= 1 && p.CalcIterations <= 16, "CalcIterations", p.CalcIterations, "must be in the range [1,16]")
+	check(p.MarkerMode <= MarkerModeManual, "MarkerMode", p.MarkerMode, "unknown marker mode")
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// Sanitize returns a copy of the preset that passes Validate where it can
+// be fixed without guessing: characters that can't be stored are dropped
+// from the name, which is cut to 12 characters, and the amplitudes and
+// iterations are clamped to their ranges. The index and frequencies are
+// left alone.
+func (p *Preset) Sanitize() *Preset {
+	s := *p
+	name := make([]byte, 0, 12)
+	for _, c := range p.Name {
+		if c >= 0x20 && c <= 0x7e && len(name) < 12 {
+			name = append(name, byte(c))
+		}
+	}
+	s.Name = string(name)
+	s.AmpTopDBm = clampInt(s.AmpTopDBm, -110, 35)
+	s.AmpBottomDBm = clampInt(s.AmpBottomDBm, -120, 25)
+	if s.AmpTopDBm-s.AmpBottomDBm < 10 {
+		s.AmpBottomDBm = s.AmpTopDBm - 10
+	}
+	s.CalcIterations = clampInt(s.CalcIterations, 1, 16)
+	return &s
+}
+
+func clampInt(v, min, max int) int {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
+
+// validatePreset validates a preset for the device. When the setup is
+// known the frequencies are also checked against the limits of the module
+// the preset selects.
+func (r *RFExplorer) validatePreset(p *Preset) error {
+	var errs ValidationErrors
+	if err := p.Validate(r.presetSlots()); err != nil {
+		errs = err.(ValidationErrors)
+	}
+	if setup := r.Setup(); setup != nil {
+		model := setup.Model
+		if !p.Mainboard {
+			model = setup.ExpansionModel
+		}
+		if model == ModelNone {
+			errs = append(errs, &ValidationError{Field: "Mainboard", Value: p.Mainboard, Supported: "the device has no expansion module"})
+		} else if l, ok := model.FreqLimits(); ok {
+			if p.MinFreqKHz < l.MinFreqKHZ {
+				errs = append(errs, &ValidationError{Field: "MinFreqKHz", Value: p.MinFreqKHz,
+					Supported: fmt.Sprintf("must be at least %d for the %s", l.MinFreqKHZ, model)})
+			}
+			if p.MaxFreqKHz > l.MaxFreqKHZ {
+				errs = append(errs, &ValidationError{Field: "MaxFreqKHz", Value: p.MaxFreqKHz,
+					Supported: fmt.Sprintf("must be at most %d for the %s", l.MaxFreqKHZ, model)})
+			}
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// FreqLimits is the frequency range a module can be tuned to.
+type FreqLimits struct {
+	MinFreqKHZ, MaxFreqKHZ int
+	// MaxSpanKHZ is the widest span of a single sweep.
+	MaxSpanKHZ int
+}
+
+// modelFreqLimits are the published limits of each analyzer model.
+var modelFreqLimits = map[Model]FreqLimits{
+	Model433M:       {430000, 440000, 10000},
+	Model868M:       {860000, 870000, 10000},
+	Model915M:       {910000, 920000, 10000},
+	ModelWSUB1G:     {240000, 960000, 100000},
+	Model24G:        {2350000, 2550000, 85000},
+	ModelWSUB3G:     {15000, 2700000, 600000},
+	Model6G:         {4850000, 6100000, 600000},
+	ModelWSUB1GPlus: {50, 960000, 100000},
+	Model24GPlus:    {2350000, 2550000, 85000},
+	Model4GPlus:     {240000, 4000000, 600000},
+	Model6GPlus:     {4850000, 6100000, 600000},
+}
+
+// FreqLimits returns the published frequency limits of the model, or false
+// if they aren't known such as for the signal generator.
+func (m Model) FreqLimits() (FreqLimits, bool) {
+	l, ok := modelFreqLimits[m]
+	return l, ok
+}
+
+// Check returns a ValidationErrors if a range isn't within the limits.
+func (l FreqLimits) Check(startFreqKHZ, endFreqKHZ int) error {
+	var errs ValidationErrors
+	if startFreqKHZ < l.MinFreqKHZ {
+		errs = append(errs, &ValidationError{Field: "startFreqKHZ", Value: startFreqKHZ,
+			Supported: fmt.Sprintf("must be at least %d for the active module", l.MinFreqKHZ)})
+	}
+	if endFreqKHZ > l.MaxFreqKHZ {
+		errs = append(errs, &ValidationError{Field: "endFreqKHZ", Value: endFreqKHZ,
+			Supported: fmt.Sprintf("must be at most %d for the active module", l.MaxFreqKHZ)})
+	}
+	if span := endFreqKHZ - startFreqKHZ; l.MaxSpanKHZ > 0 && span > l.MaxSpanKHZ {
+		errs = append(errs, &ValidationError{Field: "endFreqKHZ", Value: endFreqKHZ,
+			Supported: fmt.Sprintf("span of %d kHz exceeds the active module's maximum of %d kHz", span, l.MaxSpanKHZ)})
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// Clamp returns the range moved and narrowed as little as possible to fit
+// within the limits, keeping its center where it can.
+func (l FreqLimits) Clamp(startFreqKHZ, endFreqKHZ int) (int, int) {
+	if span := endFreqKHZ - startFreqKHZ; l.MaxSpanKHZ > 0 && span > l.MaxSpanKHZ {
+		center := startFreqKHZ + span/2
+		startFreqKHZ, endFreqKHZ = center-l.MaxSpanKHZ/2, center-l.MaxSpanKHZ/2+l.MaxSpanKHZ
+	}
+	if startFreqKHZ < l.MinFreqKHZ {
+		endFreqKHZ += l.MinFreqKHZ - startFreqKHZ
+		startFreqKHZ = l.MinFreqKHZ
+	}
+	if endFreqKHZ > l.MaxFreqKHZ {
+		startFreqKHZ -= endFreqKHZ - l.MaxFreqKHZ
+		endFreqKHZ = l.MaxFreqKHZ
+		if startFreqKHZ < l.MinFreqKHZ {
+			startFreqKHZ = l.MinFreqKHZ
+		}
+	}
+	return startFreqKHZ, endFreqKHZ
+}
+
+// FreqLimits returns the limits of the active module. They're taken from
+// the configuration the device reported if there is one, otherwise from
+// the model in its setup. It returns false if neither is known.
+func (r *RFExplorer) FreqLimits() (FreqLimits, bool) {
+	config, _ := r.config.Load().(*CurrentConfigPacket)
+	if config != nil && config.MaxFreqKHZ > config.MinFreqKHZ {
+		return FreqLimits{MinFreqKHZ: config.MinFreqKHZ, MaxFreqKHZ: config.MaxFreqKHZ, MaxSpanKHZ: config.MaxSpan}, true
+	}
+	setup := r.Setup()
+	if setup == nil {
+		return FreqLimits{}, false
+	}
+	model := setup.Model
+	if config != nil && config.ExpModuleActive {
+		model = setup.ExpansionModel
+	}
+	return model.FreqLimits()
+}
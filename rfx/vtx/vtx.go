@@ -0,0 +1,103 @@
+// Package vtx checks that FPV video channels are clear before a race.
+package vtx
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/samuel/rfexplorer/rfx"
+	"github.com/samuel/rfexplorer/rfx/bands"
+)
+
+// DefaultThresholdDBM is the level above which a channel is considered
+// occupied when no pilots are transmitting.
+const DefaultThresholdDBM = -80
+
+// Result is the outcome of checking a single channel.
+type Result struct {
+	Channel bands.Channel
+	Clear   bool
+	// LevelDBM is the strongest level seen within the channel.
+	LevelDBM float64
+	// FreqHZ is the frequency at which LevelDBM was seen.
+	FreqHZ int
+	// Interferer names the channels (as "band/channel") nearest to FreqHZ
+	// when the channel isn't clear, which is the most likely source of the
+	// interference.
+	Interferer string
+}
+
+// Check checks the named VTX58 channels against a measured spectrum. The
+// spectrum is described by config and samples as received from the device.
+func Check(config *rfx.CurrentConfigPacket, samples []float64, channels []string, thresholdDBM float64) ([]Result, error) {
+	startHZ := config.StartFreqKHZ * 1000
+	results := make([]Result, 0, len(channels))
+	for _, name := range channels {
+		c, ok := bands.VTX58.Channel(name)
+		if !ok {
+			return nil, fmt.Errorf("vtx: unknown channel %q", name)
+		}
+		res := Result{Channel: c, Clear: true, LevelDBM: -999}
+		found := false
+		for i, s := range samples {
+			f := startHZ + i*config.FreqStepHZ
+			if f < c.LowFreqHZ() || f > c.HighFreqHZ() {
+				continue
+			}
+			found = true
+			if s > res.LevelDBM {
+				res.LevelDBM = s
+				res.FreqHZ = f
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("vtx: channel %s is outside of the scanned range", name)
+		}
+		if res.LevelDBM >= thresholdDBM {
+			res.Clear = false
+			res.Interferer = likelySource(res.FreqHZ)
+		}
+		results = append(results, res)
+	}
+	return results, nil
+}
+
+// likelySource returns the names of the channels in any band whose center
+// frequency is closest to freqHZ.
+func likelySource(freqHZ int) string {
+	var names []string
+	best := -1
+	for _, b := range bands.At(freqHZ) {
+		for _, c := range b.ChannelsAt(freqHZ) {
+			d := c.CenterFreqHZ - freqHZ
+			if d < 0 {
+				d = -d
+			}
+			name := b.Name + "/" + c.Name
+			switch {
+			case best < 0 || d < best:
+				best = d
+				names = []string{name}
+			case d == best:
+				names = append(names, name)
+			}
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// Verify sweeps the 5.8 GHz band for duration d and checks that the named
+// VTX58 channels are clear. Pilots' video transmitters should be off while
+// verifying.
+func Verify(ctx context.Context, s rfx.SpectrumSource, channels []string, d time.Duration, thresholdDBM float64) ([]Result, error) {
+	lo, hi := bands.VTX58.Range()
+	ctx, cancel := context.WithTimeout(ctx, d)
+	defer cancel()
+	config, maxHold, err := rfx.MaxHold(ctx, s, lo/1000, (hi+999)/1000)
+	if err != nil {
+		return nil, err
+	}
+	return Check(config, maxHold, channels, thresholdDBM)
+}
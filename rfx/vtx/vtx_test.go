@@ -0,0 +1,31 @@
+package vtx
+
+import (
+	"testing"
+
+	"github.com/samuel/rfexplorer/rfx"
+)
+
+func TestCheck(t *testing.T) {
+	config := &rfx.CurrentConfigPacket{StartFreqKHZ: 5600000, FreqStepHZ: 1000000}
+	samples := make([]float64, 400)
+	for i := range samples {
+		samples[i] = -100
+	}
+	// Someone is transmitting near F4 (5800 MHz) at 5802 MHz, which is
+	// inside C5 (5806 MHz).
+	samples[202] = -40
+	res, err := Check(config, samples, []string{"C1", "C5"}, DefaultThresholdDBM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res[0].Clear {
+		t.Errorf("C1 should be clear: %+v", res[0])
+	}
+	if res[1].Clear || res[1].FreqHZ != 5802000000 || res[1].Interferer != "vtx58/F4" {
+		t.Errorf("C5 should be blocked by F4: %+v", res[1])
+	}
+	if _, err := Check(config, samples, []string{"Z9"}, DefaultThresholdDBM); err == nil {
+		t.Error("expected error for unknown channel")
+	}
+}
@@ -0,0 +1,988 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/samuel/rfexplorer/rfx"
+	"github.com/samuel/rfexplorer/rfx/aggregate"
+	"github.com/samuel/rfexplorer/rfx/analysis"
+	"github.com/samuel/rfexplorer/rfx/auth"
+	"github.com/samuel/rfexplorer/rfx/bands"
+	"github.com/samuel/rfexplorer/rfx/coord"
+	"github.com/samuel/rfexplorer/rfx/harmonics"
+	"github.com/samuel/rfexplorer/rfx/plot"
+	"github.com/samuel/rfexplorer/rfx/presets"
+	"github.com/samuel/rfexplorer/rfx/record"
+	"github.com/samuel/rfexplorer/rfx/rfecsv"
+	"github.com/samuel/rfexplorer/rfx/sigmf"
+	"github.com/samuel/rfexplorer/rfx/sniff"
+	"github.com/samuel/rfexplorer/rfx/spectrogram"
+	"github.com/samuel/rfexplorer/rfx/store"
+	"github.com/samuel/rfexplorer/rfx/survey"
+	"github.com/samuel/rfexplorer/rfx/trace"
+	"github.com/samuel/rfexplorer/rfx/vtx"
+)
+
+// parseMHzRange parses a range such as "470-608" in MHz.
+func parseMHzRange(s string) (lowHZ, highHZ int, err error) {
+	parts := strings.SplitN(s, "-", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid range %q, expected low-high in MHz", s)
+	}
+	lo, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid range %q: %s", s, err)
+	}
+	hi, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid range %q: %s", s, err)
+	}
+	if hi <= lo {
+		return 0, 0, fmt.Errorf("invalid range %q, high must be above low", s)
+	}
+	return int(lo * 1e6), int(hi * 1e6), nil
+}
+
+// runCoordinate scans the tuning range of the microphones and prints a
+// frequency for each of them that avoids the given TV channels, active
+// carriers, and intermodulation products.
+func runCoordinate(rfe *rfx.RFExplorer, count int, rangeMHz, tvPlan, tvChannels string, scanTime time.Duration) error {
+	lo, hi, err := parseMHzRange(rangeMHz)
+	if err != nil {
+		return err
+	}
+	opts := coord.DefaultOptions
+	if tvChannels != "" {
+		plan := bands.Lookup(tvPlan)
+		if plan == nil {
+			return fmt.Errorf("unknown TV channel plan %q", tvPlan)
+		}
+		for _, name := range strings.Split(tvChannels, ",") {
+			c, ok := plan.Channel(strings.TrimSpace(name))
+			if !ok {
+				return fmt.Errorf("unknown %s channel %q", plan.Name, name)
+			}
+			opts.Excluded = append(opts.Excluded, c)
+		}
+	}
+
+	if err := rfe.SetSweepPointsEx(4096); err != nil {
+		return err
+	}
+	fmt.Printf("Scanning %.3f-%.3f MHz for %s\n", float64(lo)/1e6, float64(hi)/1e6, scanTime)
+	ctx, cancel := context.WithTimeout(context.Background(), scanTime)
+	defer cancel()
+	config, maxHold, err := rfe.ScanMaxHold(ctx, lo/1000, hi/1000)
+	if err != nil {
+		return err
+	}
+	spectrum := &coord.Spectrum{
+		StartFreqHZ: config.StartFreqKHZ * 1000,
+		StepHZ:      config.FreqStepHZ,
+		Samples:     maxHold,
+	}
+
+	units := make([]coord.Unit, count)
+	for i := range units {
+		units[i] = coord.Unit{
+			Name:      fmt.Sprintf("Mic %d", i+1),
+			MinFreqHZ: lo,
+			MaxFreqHZ: hi,
+			StepHZ:    25000,
+		}
+	}
+	for _, a := range coord.Coordinate(units, spectrum, &opts) {
+		if a.FreqHZ == 0 {
+			fmt.Printf("%s\tno clean frequency\n", a.Unit.Name)
+			continue
+		}
+		fmt.Printf("%s\t%.3f MHz\t%.1f dBm\n", a.Unit.Name, float64(a.FreqHZ)/1e6, a.LevelDB)
+	}
+	return nil
+}
+
+// runVTXCheck verifies that the given 5.8 GHz video channels are clear and
+// prints the result for each.
+func runVTXCheck(rfe *rfx.RFExplorer, channels []string, scanTime time.Duration) error {
+	for i, c := range channels {
+		channels[i] = strings.ToUpper(strings.TrimSpace(c))
+	}
+	if err := rfe.SwitchModuleMain(); err != nil {
+		return err
+	}
+	if err := rfe.SetSweepPointsEx(4096); err != nil {
+		return err
+	}
+	fmt.Printf("Scanning 5.8 GHz for %s\n", scanTime)
+	results, err := vtx.Verify(context.Background(), rfe, channels, scanTime, vtx.DefaultThresholdDBM)
+	if err != nil {
+		return err
+	}
+	for _, r := range results {
+		if r.Clear {
+			fmt.Printf("%s\tclear\t%.1f dBm\n", r.Channel.Name, r.LevelDBM)
+		} else {
+			fmt.Printf("%s\tBLOCKED\t%.1f dBm at %.3f MHz (%s)\n", r.Channel.Name, r.LevelDBM, float64(r.FreqHZ)/1e6, r.Interferer)
+		}
+	}
+	return nil
+}
+
+// runCoexistence measures the occupancy of the 2.4 GHz Zigbee and Wi-Fi
+// channels and prints the Zigbee channels ordered best first.
+func runCoexistence(rfe *rfx.RFExplorer, scanTime time.Duration) error {
+	const thresholdDBM = -85
+	zigbee := analysis.NewOccupancy(bands.Zigbee24, thresholdDBM)
+	wifi := analysis.NewOccupancy(bands.WiFi24, thresholdDBM)
+	if err := rfe.SetSweepPointsEx(1024); err != nil {
+		return err
+	}
+	fmt.Printf("Scanning 2.4 GHz for %s\n", scanTime)
+	ctx, cancel := context.WithTimeout(context.Background(), scanTime)
+	defer cancel()
+	err := rfe.Scan(ctx, 2400000, 2500000, func(config *rfx.CurrentConfigPacket, samples []float64) {
+		zigbee.Add(config, samples)
+		wifi.Add(config, samples)
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Zigbee\tBusy\tMean\tWi-Fi\n")
+	for _, r := range analysis.ZigbeeCoexistence(zigbee.Result(), wifi.Result()) {
+		var wifiChs []string
+		for _, w := range r.WiFi {
+			wifiChs = append(wifiChs, fmt.Sprintf("%s (%.0f%%)", w.Channel.Name, w.Busy*100))
+		}
+		fmt.Printf("%s\t%.0f%%\t%.1f dBm\t%s\n", r.Channel.Name, r.Busy*100, r.MeanDBM, strings.Join(wifiChs, ", "))
+	}
+	return nil
+}
+
+// runLoRaOccupancy measures the occupancy of the channels of a LoRaWAN
+// channel plan and prints them ranked least occupied first.
+func runLoRaOccupancy(rfe *rfx.RFExplorer, planName string, scanTime time.Duration) error {
+	var plan, subBands *bands.Band
+	switch strings.ToLower(planName) {
+	case "eu868":
+		plan, subBands = bands.EU868, bands.ISM868
+	case "us915":
+		plan = bands.US915
+	default:
+		return fmt.Errorf("unknown LoRaWAN channel plan %q, expected eu868 or us915", planName)
+	}
+	const thresholdDBM = -100
+	occ := analysis.NewOccupancy(plan, thresholdDBM)
+	lo, hi := plan.Range()
+	if err := rfe.SetSweepPointsEx(4096); err != nil {
+		return err
+	}
+	fmt.Printf("Scanning %s for %s\n", plan.Description, scanTime)
+	ctx, cancel := context.WithTimeout(context.Background(), scanTime)
+	defer cancel()
+	if err := rfe.Scan(ctx, lo/1000, (hi+999)/1000, occ.Add); err != nil {
+		return err
+	}
+	fmt.Printf("Channel\tFreq\tBusy\tMean\tLimit\n")
+	for _, r := range analysis.RankLoRaChannels(occ.Result(), subBands) {
+		limit := "-"
+		if r.DutyCycleLimit > 0 {
+			limit = fmt.Sprintf("%g%% (%s)", r.DutyCycleLimit*100, r.SubBand.Name)
+			if r.OverLimit {
+				limit += " exceeded"
+			}
+		}
+		fmt.Printf("%s\t%.3f MHz\t%.2f%%\t%.1f dBm\t%s\n", r.Channel.Name, float64(r.Channel.CenterFreqHZ)/1e6, r.Busy*100, r.MeanDBM, limit)
+	}
+	return nil
+}
+
+// runWritePresets writes library presets to the device's stored presets
+// starting at slot startIndex. names is a comma separated list of library
+// preset names or "all".
+func runWritePresets(rfe *rfx.RFExplorer, names string, startIndex int) error {
+	var ps []*rfx.Preset
+	if names == "all" {
+		for i := range presets.Library {
+			p := presets.Library[i]
+			ps = append(ps, &p)
+		}
+	} else {
+		for _, name := range strings.Split(names, ",") {
+			p, ok := presets.Lookup(name)
+			if !ok {
+				return fmt.Errorf("unknown preset %q, available presets: %s", name, strings.Join(presets.Names(), ", "))
+			}
+			ps = append(ps, p)
+		}
+	}
+	for i, p := range ps {
+		p.Index = startIndex + i
+	}
+	return programPresets(rfe, ps)
+}
+
+// programPresets writes presets to the device, printing each as it's
+// written, and verifies them by reading them back.
+func programPresets(rfe *rfx.RFExplorer, ps []*rfx.Preset) error {
+	err := presets.Program(context.Background(), rfe, ps, func(p *rfx.Preset) {
+		fmt.Printf("%d\t%s\n", p.Index+1, p.Name)
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Verified %d presets\n", len(ps))
+	return nil
+}
+
+// runProgramPresets writes the presets defined in a CSV file to the device.
+func runProgramPresets(rfe *rfx.RFExplorer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	ps, err := presets.ReadCSV(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	return programPresets(rfe, ps)
+}
+
+// runDumpPresets saves the device's stored presets to a file, skipping
+// empty slots.
+func runDumpPresets(rfe *rfx.RFExplorer, path string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	stored, err := rfe.GetPresets(ctx)
+	cancel()
+	if err != nil {
+		return err
+	}
+	var ps []*rfx.Preset
+	for _, p := range stored {
+		if p.Name != "" {
+			ps = append(ps, p)
+		}
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := rfx.ExportPresets(f, ps); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("Saved %d presets\n", len(ps))
+	return nil
+}
+
+// runLoadPresets writes the presets saved by runDumpPresets to the device.
+func runLoadPresets(rfe *rfx.RFExplorer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	ps, err := rfx.ImportPresets(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("%s: %s", path, err)
+	}
+	return programPresets(rfe, ps)
+}
+
+// runSyncPresets makes the device's stored presets match those defined in
+// a CSV file, writing only the ones that differ.
+func runSyncPresets(rfe *rfx.RFExplorer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	ps, err := presets.ReadCSV(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	changes, err := presets.Sync(context.Background(), rfe, ps)
+	if err != nil {
+		return err
+	}
+	counts := make(map[presets.ChangeKind]int)
+	for _, c := range changes {
+		counts[c.Kind]++
+		if c.Kind == presets.Updated {
+			fmt.Printf("%d\t%s\t%s (was %s)\n", c.Preset.Index+1, c.Kind, c.Preset.Name, c.Old.Name)
+		} else {
+			fmt.Printf("%d\t%s\t%s\n", c.Preset.Index+1, c.Kind, c.Preset.Name)
+		}
+	}
+	fmt.Printf("%d added, %d updated, %d unchanged\n", counts[presets.Added], counts[presets.Updated], counts[presets.Unchanged])
+	return nil
+}
+
+// runWxSatMonitor watches the 137 MHz weather satellite band until
+// interrupted and logs the start and end of every pass.
+func runWxSatMonitor(rfe *rfx.RFExplorer) error {
+	p, _ := presets.Lookup("Wx Sat 137")
+	if err := rfe.SwitchModuleMain(); err != nil {
+		return err
+	}
+	if err := rfe.SetSweepPointsEx(1024); err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	const timeFormat = "2006-01-02 15:04:05"
+	detector := analysis.NewPassDetector(bands.WxSat137)
+	logEnded := func(ended []analysis.Pass) {
+		for _, p := range ended {
+			fmt.Printf("%s\tEND\t%s\tduration %s, peak %.1f dBm at %s\n",
+				p.End.Format(timeFormat), p.Channel.Name, p.End.Sub(p.Start).Round(time.Second),
+				p.PeakDBM, p.PeakTime.Format(timeFormat))
+		}
+	}
+	fmt.Printf("Monitoring %.3f-%.3f MHz, interrupt to stop\n", float64(p.MinFreqKHz)/1000, float64(p.MaxFreqKHz)/1000)
+	err := rfe.Scan(ctx, p.MinFreqKHz, p.MaxFreqKHz, func(config *rfx.CurrentConfigPacket, samples []float64) {
+		started, ended := detector.Add(time.Now(), config, samples)
+		for _, p := range started {
+			fmt.Printf("%s\tSTART\t%s\t%.1f dBm\n", p.Start.Format(timeFormat), p.Channel.Name, p.PeakDBM)
+		}
+		logEnded(ended)
+	})
+	logEnded(detector.Flush())
+	return err
+}
+
+// runSniff captures OOK transmissions on a frequency with the sniffer until
+// interrupted and prints the codes decoded from them.
+func runSniff(rfe *rfx.RFExplorer, freqMHz float64) error {
+	err := rfe.StartSniffer(rfx.SnifferConfig{
+		CenterFreqKHZ: int(freqMHz * 1000),
+		SampleRate:    100000,
+		Modulation:    rfx.ModulationOOKRaw,
+		RBWKHZ:        600,
+		ThresholdDBM:  -90,
+	})
+	if err != nil {
+		return err
+	}
+	defer rfe.StopSniffer()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Printf("Sniffing %.3f MHz, interrupt to stop\n", freqMHz)
+	for {
+		select {
+		case pkt, ok := <-rfe.Chan():
+			if !ok {
+				return fmt.Errorf("connection closed")
+			}
+			raw, ok := pkt.(*rfx.RawData)
+			if !ok {
+				continue
+			}
+			for _, c := range sniff.Decode(sniff.FromRawData(raw)) {
+				c := c
+				fmt.Printf("%s\t%s", raw.Time.Format("2006-01-02 15:04:05"), &c)
+				if ts, ok := c.Tristate(); ok && c.Protocol == "EV1527" {
+					fmt.Printf("\tPT2262 %s", ts)
+				}
+				fmt.Println()
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// exportSweeps calls fn for every sweep of src until interrupted, fn fails,
+// or the source ends, such as at the end of a recording being played. What
+// was exported so far is kept if the source ends.
+func exportSweeps(src rfx.SpectrumSource, path string, fn func(*rfx.Sweep) error) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Printf("Saving sweeps to %s, interrupt to stop\n", path)
+	var ferr error
+	err := src.Sweeps(ctx, func(s *rfx.Sweep) {
+		if ferr == nil {
+			if ferr = fn(s); ferr != nil {
+				stop()
+			}
+		}
+	})
+	if ferr != nil {
+		return ferr
+	}
+	if err != nil {
+		fmt.Printf("Stopped: %s\n", err)
+	}
+	return nil
+}
+
+// runExportCSV saves sweeps in the format of RF Explorer for Windows. Sweeps
+// of another range than the first are skipped since the format can't hold
+// them.
+func runExportCSV(src rfx.SpectrumSource, path string) error {
+	f := &rfecsv.File{}
+	skipped := 0
+	exportSweeps(src, path, func(s *rfx.Sweep) error {
+		if err := f.Add(&rfx.SweepDataPacket{Time: s.Time, Config: s.Config, Samples: s.Samples}); err != nil {
+			skipped++
+		}
+		return nil
+	})
+	if skipped != 0 {
+		fmt.Printf("Skipped %d sweeps of another range\n", skipped)
+	}
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := rfecsv.Write(out, f); err != nil {
+		out.Close()
+		return err
+	}
+	fmt.Printf("Saved %d sweeps\n", len(f.Sweeps))
+	return out.Close()
+}
+
+// runExportSigMF saves sweeps as a SigMF recording at base.
+func runExportSigMF(src rfx.SpectrumSource, base string) error {
+	f, err := sigmf.Create(base, src.Info().Name)
+	if err != nil {
+		return err
+	}
+	err = exportSweeps(src, base+sigmf.DataExt, func(s *rfx.Sweep) error {
+		return f.Add(s.Time, s.Config, s.Samples)
+	})
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Saved %d sweeps\n", len(f.Meta().Captures))
+	return nil
+}
+
+// runSnapshot plots the last sweep received within scanTime along with the
+// max-hold and strongest peaks of the sweeps of its span, as SVG if path
+// ends in .svg and PNG otherwise.
+func runSnapshot(src rfx.SpectrumSource, path string, scanTime time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), scanTime)
+	defer cancel()
+	traces := trace.New(0)
+	if err := src.Sweeps(ctx, func(s *rfx.Sweep) {
+		traces.Add(s.Config, s.Samples)
+	}); err != nil {
+		return err
+	}
+	t := traces.Active()
+	if t == nil {
+		return fmt.Errorf("no sweeps received in %s", scanTime)
+	}
+	live := &rfx.SweepDataPacket{Config: t.Config, Samples: t.Live}
+	p, err := plot.FromSweep(live)
+	if err != nil {
+		return err
+	}
+	p.MaxHold = t.MaxHold
+	for _, pk := range analysis.FindPeaks(live, analysis.PeakOptions{Max: 3, ThresholdDB: 10, MinSpacingHZ: 5 * t.Config.FreqStepHZ}) {
+		p.Markers = append(p.Markers, plot.Marker{FreqHZ: pk.FreqHZ, Label: fmt.Sprintf("%.3f", pk.FreqHZ/1e6)})
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if strings.HasSuffix(path, ".svg") {
+		err = p.WriteSVG(f)
+	} else {
+		err = p.WritePNG(f)
+	}
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// spectrogramRows is the number of sweeps runSpectrogram keeps.
+const spectrogramRows = 2000
+
+// runSpectrogram renders the last sweeps as a PNG heatmap.
+func runSpectrogram(src rfx.SpectrumSource, path string) error {
+	buf := spectrogram.New(spectrogramRows)
+	err := exportSweeps(src, path, func(s *rfx.Sweep) error {
+		buf.Add(s.Time, s.Config, s.Samples)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := buf.RenderPNG(f, spectrogram.Heat, spectrogram.RenderOptions{}); err != nil {
+		f.Close()
+		return err
+	}
+	fmt.Printf("Rendered %d sweeps\n", buf.Len())
+	return f.Close()
+}
+
+// runSurvey records a max-hold snapshot of a range against a location label
+// for every label entered on stdin, appending the points to a survey file.
+// Surveys can be resumed by running again with the same file.
+func runSurvey(src rfx.SpectrumSource, path, rangeMHz string, scanTime time.Duration) error {
+	lo, hi, err := parseMHzRange(rangeMHz)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := survey.NewWriter(f)
+
+	lines := bufio.NewScanner(os.Stdin)
+	for {
+		fmt.Print("Location label (empty to finish): ")
+		if !lines.Scan() {
+			break
+		}
+		label := strings.TrimSpace(lines.Text())
+		if label == "" {
+			break
+		}
+		fmt.Printf("Scanning %s for %s...\n", rangeMHz, scanTime)
+		ctx, cancel := context.WithTimeout(context.Background(), scanTime)
+		config, samples, err := rfx.MaxHold(ctx, src, lo/1000, hi/1000)
+		cancel()
+		if err != nil {
+			return err
+		}
+		p := &survey.Point{
+			Label:       label,
+			Time:        time.Now(),
+			StartFreqHZ: config.StartFreqKHZ * 1000,
+			StepHZ:      config.FreqStepHZ,
+			Samples:     samples,
+		}
+		if err := w.Write(p); err != nil {
+			return err
+		}
+		freq, dbm := p.PeakDBM()
+		fmt.Printf("Recorded %q, peak %.1f dBm at %.3f MHz\n", label, dbm, float64(freq)/1e6)
+	}
+	return lines.Err()
+}
+
+// runRecord scans a range until interrupted and records every sweep to a
+// store in dir, pruning old data according to policy.
+func runRecord(src rfx.SpectrumSource, dir, rangeMHz string, policy store.Policy) error {
+	lo, hi, err := parseMHzRange(rangeMHz)
+	if err != nil {
+		return err
+	}
+	s, err := store.Open(dir, policy)
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Printf("Recording %s MHz to %s, interrupt to stop\n", rangeMHz, dir)
+	var writeErr error
+	if err := src.Configure(lo/1000, hi/1000); err != nil {
+		return err
+	}
+	scanErr := src.Sweeps(ctx, func(sw *rfx.Sweep) {
+		if writeErr != nil {
+			return
+		}
+		if writeErr = s.Add(sw.Time, sw.Config, sw.Samples); writeErr != nil {
+			stop()
+		}
+	})
+	if err := s.Close(); err != nil && writeErr == nil {
+		writeErr = err
+	}
+	if scanErr != nil {
+		return scanErr
+	}
+	return writeErr
+}
+
+// runHarmonics measures the 2nd and 3rd harmonics of a transmitter and
+// compares them against a spurious emission mask.
+func runHarmonics(src rfx.SpectrumSource, freqMHz, limitDBC float64, scanTime time.Duration) error {
+	const spanHZ = 1000000
+	fundamentalHZ := int(freqMHz * 1e6)
+	mask := harmonics.DefaultMask(fundamentalHZ)
+	if limitDBC != 0 {
+		mask = harmonics.Mask{Name: "custom", LimitDBC: limitDBC}
+	}
+	fmt.Printf("Measuring each harmonic for %s\n", scanTime)
+	results, err := harmonics.Measure(context.Background(), src, fundamentalHZ, 3, spanHZ, scanTime, mask)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Mask: %s, %.0f dBc\n", mask.Name, mask.LimitDBC)
+	for _, r := range results {
+		switch {
+		case !r.Measured:
+			fmt.Printf("%d\t%.3f MHz\tout of range\n", r.N, float64(r.FreqHZ)/1e6)
+		case r.N == 1:
+			fmt.Printf("%d\t%.3f MHz\t%6.1f dBm\n", r.N, float64(r.FreqHZ)/1e6, r.LevelDBM)
+		default:
+			status := "PASS"
+			if !r.Pass {
+				status = "FAIL"
+			}
+			fmt.Printf("%d\t%.3f MHz\t%6.1f dBm\t%6.1f dBc\t%s\n", r.N, float64(r.FreqHZ)/1e6, r.LevelDBM, r.RelativeDB, status)
+		}
+	}
+	return nil
+}
+
+// runFleet applies the same presets, library preset, and profile to every
+// analyzer found on the serial ports and reports how each one went. It
+// returns an error if any device failed.
+func runFleet(presetsPath, presetName, profileName string) error {
+	var ps []*rfx.Preset
+	if presetsPath != "" {
+		f, err := os.Open(presetsPath)
+		if err != nil {
+			return err
+		}
+		ps, err = presets.ReadCSV(f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	var preset *rfx.Preset
+	if presetName != "" {
+		p, ok := presets.Lookup(presetName)
+		if !ok {
+			return fmt.Errorf("unknown preset %q, available presets: %s", presetName, strings.Join(presets.Names(), ", "))
+		}
+		preset = p
+	}
+	var profile *rfx.Profile
+	if profileName != "" {
+		p, ok := rfx.LookupProfile(profileName)
+		if !ok {
+			return fmt.Errorf("unknown profile %q", profileName)
+		}
+		profile = &p
+	}
+	if ps == nil && preset == nil && profile == nil {
+		return fmt.Errorf("-fleet needs at least one of -program-presets, -preset, or -profile")
+	}
+
+	provision := func(port string) (string, error) {
+		rfe, err := rfx.New(port)
+		if err != nil {
+			return "", err
+		}
+		defer rfe.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		sn, err := rfe.SerialNumber(ctx)
+		if err != nil {
+			return "", err
+		}
+		if setup := rfe.Setup(); setup != nil && setup.ExpansionModel != rfx.ModelNone {
+			expSN, err := rfe.GetExpansionSerialNumber(ctx)
+			if err != nil {
+				return sn, err
+			}
+			sn += " expansion " + expSN
+		}
+		if ps != nil {
+			if err := presets.Program(ctx, rfe, ps, nil); err != nil {
+				return sn, err
+			}
+		}
+		if preset != nil {
+			if err := rfe.ApplyPreset(ctx, preset); err != nil {
+				return sn, err
+			}
+		}
+		if profile != nil {
+			if err := rfe.ApplyProfile(*profile); err != nil {
+				return sn, err
+			}
+		}
+		return sn, nil
+	}
+
+	var ok, failed int
+	for _, d := range rfx.Discover(2 * time.Second) {
+		port, setup := d.Port, d.Setup
+		if setup.IsGenerator() {
+			fmt.Printf("%s\tskipped generator %s\n", port, setup.Model)
+			continue
+		}
+		sn, err := provision(port)
+		if err != nil {
+			failed++
+			fmt.Printf("%s\t%s %s\tFAILED: %s\n", port, setup.Model, sn, err)
+			continue
+		}
+		ok++
+		fmt.Printf("%s\t%s %s\tOK\n", port, setup.Model, sn)
+	}
+	fmt.Printf("%d devices provisioned, %d failed\n", ok, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d devices failed", failed)
+	}
+	if ok == 0 {
+		return fmt.Errorf("no analyzers found")
+	}
+	return nil
+}
+
+// serverSecurity is the TLS and authentication configuration of a server.
+type serverSecurity struct {
+	certFile, keyFile string
+	clientCAFile      string
+	requireClientCert bool
+	clientCertRole    string
+	tokensFile        string
+	// insecure allows serving on an address other than localhost without
+	// authentication, or with tokens over plain HTTP.
+	insecure bool
+}
+
+// listenAddr returns the address for a server to listen on. A server
+// whose clients aren't authenticated gives every client control, so it
+// may then only listen on a loopback address and listens on localhost if
+// addr has no host, unless sec.insecure is set.
+func (sec *serverSecurity) listenAddr(addr string, authenticated bool) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", err
+	}
+	if authenticated || isLoopback(host) {
+		return addr, nil
+	}
+	if host == "" {
+		return net.JoinHostPort("localhost", port), nil
+	}
+	if !sec.insecure {
+		return "", fmt.Errorf("serving on %s without authentication gives anyone who can connect to it control, serve on localhost or set -insecure", addr)
+	}
+	log.Printf("Warning: serving on %s without authentication gives anyone who can connect to it control", addr)
+	return addr, nil
+}
+
+// apply wraps h with authentication and configures TLS on srv, and checks
+// srv.Addr with listenAddr. Tokens are sent in the clear without TLS, so
+// they're only accepted over plain HTTP on a loopback address unless
+// sec.insecure is set.
+func (sec *serverSecurity) apply(srv *http.Server, h http.Handler) error {
+	a := &auth.Authenticator{}
+	if sec.tokensFile != "" {
+		f, err := os.Open(sec.tokensFile)
+		if err != nil {
+			return err
+		}
+		a.Tokens, err = auth.ReadTokens(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %s", sec.tokensFile, err)
+		}
+	}
+	if sec.clientCAFile != "" {
+		role, err := auth.ParseRole(sec.clientCertRole)
+		if err != nil {
+			return err
+		}
+		a.ClientCertRole = role
+	}
+	if sec.certFile != "" {
+		tlsConfig, err := auth.ServerTLSConfig(sec.certFile, sec.keyFile, sec.clientCAFile, sec.requireClientCert)
+		if err != nil {
+			return err
+		}
+		srv.TLSConfig = tlsConfig
+	} else if sec.clientCAFile != "" {
+		return fmt.Errorf("client certificates need -tls-cert and -tls-key")
+	}
+	addr, err := sec.listenAddr(srv.Addr, len(a.Tokens) != 0 || a.ClientCertRole != auth.RoleNone)
+	if err != nil {
+		return fmt.Errorf("%s; -tokens and -tls-client-ca authenticate clients", err)
+	}
+	srv.Addr = addr
+	if len(a.Tokens) != 0 && srv.TLSConfig == nil {
+		host, _, err := net.SplitHostPort(srv.Addr)
+		if err != nil {
+			return err
+		}
+		if !isLoopback(host) {
+			if !sec.insecure {
+				return fmt.Errorf("serving on %s would send tokens in the clear, set -tls-cert and -tls-key, serve on localhost, or set -insecure", srv.Addr)
+			}
+			log.Printf("Warning: serving on %s sends tokens in the clear", srv.Addr)
+		}
+	}
+	srv.Handler = a.Handler(h)
+	return nil
+}
+
+// runAggregator serves an aggregator for monitor nodes until interrupted.
+func runAggregator(addr, dir string, sec *serverSecurity) error {
+	s, err := aggregate.NewServer(dir, store.DefaultPolicy)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	srv := &http.Server{Addr: addr}
+	if err := sec.apply(srv, s); err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		srv.Shutdown(context.Background())
+	}()
+	fmt.Printf("Aggregating to %s, serving on %s\n", dir, srv.Addr)
+	if srv.TLSConfig != nil {
+		err = srv.ListenAndServeTLS("", "")
+	} else {
+		err = srv.ListenAndServe()
+	}
+	if err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// runShare shares the RF Explorer on a serial device over the network
+// until interrupted. Clients aren't authenticated and get full control of
+// the device, so addr is checked like that of a server without
+// authentication.
+func runShare(addr, device string, br rfx.BaudRate, sec *serverSecurity) error {
+	if sec.tokensFile != "" || sec.certFile != "" || sec.clientCAFile != "" {
+		return fmt.Errorf("-share doesn't support -tokens or TLS")
+	}
+	addr, err := sec.listenAddr(addr, false)
+	if err != nil {
+		return err
+	}
+	if br == 0 {
+		br = rfx.BaudRate500000
+	}
+	t, err := rfx.OpenSerial(device, br)
+	if err != nil {
+		return err
+	}
+	defer t.Close()
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		l.Close()
+	}()
+	fmt.Printf("Sharing %s on %s\n", device, l.Addr())
+	if err := rfx.Share(l, t); err != nil && ctx.Err() == nil {
+		return err
+	}
+	return nil
+}
+
+// isLoopback reports whether host is a loopback address or localhost.
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// playSession plays a session recorded with -record-session. A speed of 0
+// plays as fast as possible. The file stays open until the program exits.
+func playSession(path string, speed float64, opts []rfx.Option) (*rfx.RFExplorer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if speed == 0 {
+		speed = math.Inf(1)
+	}
+	p, err := record.Play(f, record.PlayOptions{Speed: speed, Options: opts})
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return p.RFExplorer, nil
+}
+
+func runListPorts() error {
+	ports, err := rfx.ListPorts()
+	if err != nil {
+		return err
+	}
+	if len(ports) == 0 {
+		return fmt.Errorf("no serial ports found")
+	}
+	for _, p := range ports {
+		mark := ""
+		if p.IsRFExplorer() {
+			mark = "\tlikely RF Explorer"
+		}
+		fmt.Printf("%s%s\n", p, mark)
+	}
+	return nil
+}
+
+// pickPort asks which serial port to use when none responded to discovery.
+// It returns discoverErr if there are no ports to pick from.
+func pickPort(discoverErr error) (string, error) {
+	ports, err := rfx.ListPorts()
+	if err != nil || len(ports) == 0 {
+		return "", discoverErr
+	}
+	fmt.Printf("%v, pick a serial port:\n", discoverErr)
+	for i, p := range ports {
+		mark := ""
+		if p.IsRFExplorer() {
+			mark = " *"
+		}
+		fmt.Printf("%3d  %s%s\n", i+1, p, mark)
+	}
+	fmt.Print("> ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return "", discoverErr
+	}
+	i, err := strconv.Atoi(strings.TrimSpace(line))
+	if err != nil || i < 1 || i > len(ports) {
+		return "", fmt.Errorf("invalid choice %q", strings.TrimSpace(line))
+	}
+	return ports[i-1].Name, nil
+}